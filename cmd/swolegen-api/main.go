@@ -1,31 +1,100 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
 	"log"
 	"log/slog"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/aaronromeo/swolegen/internal/config"
 	"github.com/aaronromeo/swolegen/internal/httpapi"
+	"github.com/aaronromeo/swolegen/internal/logging"
+	"github.com/aaronromeo/swolegen/internal/store"
+	"github.com/aaronromeo/swolegen/internal/tracing"
 )
 
+// shutdownTimeout is how long in-flight requests get to finish after
+// SIGINT or SIGTERM. Jobs still running after it are canceled.
+const shutdownTimeout = 30 * time.Second
+
 func main() {
-	cfg, err := config.LoadConfig()
-	if err != nil {
+	if err := run(); err != nil {
 		log.Fatal(err)
 	}
+}
+
+// run serves until the listener fails or a signal asks it to stop. It
+// returns errors rather than exiting, so the store and tracer are closed on
+// every path.
+func run() error {
+	configPath := flag.String("config", os.Getenv(config.EnvConfigFile), "YAML config file; environment variables override it (default $"+config.EnvConfigFile+")")
+	flag.Parse()
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		return err
+	}
 
 	programLevel := slog.LevelInfo
 	if cfg.Debug {
 		programLevel = slog.LevelDebug
 	}
 
-	logger := slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: programLevel}))
+	policy, err := logging.NewPolicy(cfg.LogRedact, cfg.LogSecretKeys, cfg.LogPIIKeys)
+	if err != nil {
+		return err
+	}
+	logger := slog.New(logging.NewHandler(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: programLevel}), policy))
 	slog.SetDefault(logger)
+	if cfg.RecoveryGarminExport != "" {
+		logger.Warn("RECOVERY_GARMIN_EXPORT is deprecated; set RECOVERY_SOURCE=garmin and RECOVERY_PATH instead")
+	}
 
-	app := httpapi.NewServer(cfg, logger)
-	log.Printf("listening on %s", cfg.Addr)
-	if err := app.Listen(cfg.Addr); err != nil {
-		log.Fatal(err)
+	shutdownTracing, err := tracing.Setup(context.Background(), cfg.TraceExporter, cfg.TraceSampleRatio)
+	if err != nil {
+		return err
+	}
+	defer shutdownTracing(context.Background()) //nolint:errcheck
+
+	st, err := store.Open(cfg.StorePath)
+	if err != nil {
+		return err
+	}
+	defer st.Close() //nolint:errcheck
+
+	app, err := httpapi.NewServer(cfg, logger, st)
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	listenErr := make(chan error, 1)
+	go func() {
+		logger.Info("listening", "addr", cfg.Addr)
+		listenErr <- app.Listen(cfg.Addr)
+	}()
+
+	select {
+	case err := <-listenErr:
+		return err
+	case <-ctx.Done():
+	}
+	stop()
+	logger.Info("shutting down", "timeout", shutdownTimeout.String())
+	// Shutdown stops accepting connections, waits for in-flight requests and
+	// then runs the OnShutdown hooks, which cancel and drain the job workers.
+	err = app.ShutdownWithTimeout(shutdownTimeout)
+	if lerr := <-listenErr; lerr != nil && err == nil {
+		err = lerr
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		logger.Warn("shutdown timed out; closing remaining connections")
+		return nil
 	}
+	return err
 }
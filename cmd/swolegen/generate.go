@@ -0,0 +1,270 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/aaronromeo/swolegen/internal/llm"
+	"github.com/aaronromeo/swolegen/internal/llm/schemas"
+	"github.com/aaronromeo/swolegen/internal/store"
+	"github.com/aaronromeo/swolegen/internal/workout"
+)
+
+// inputFlags registers the AnalyzerInputs flags on fs. The returned func
+// loads -inputs (YAML or JSON) and then applies any flags set explicitly, so
+// a saved inputs file can be tweaked per run.
+func inputFlags(fs *flag.FlagSet) func() (llm.AnalyzerInputs, error) {
+	var (
+		inputsPath   = fs.String("inputs", "", "AnalyzerInputs file (YAML or JSON)")
+		instructions = fs.String("instructions", "", "instructions URL or file")
+		historyURL   = fs.String("history", "", "history URL or file")
+		location     = fs.String("location", "", "location key: gym:<name>, home or hotel:<name>")
+		equipment    = fs.String("equipment", "", "comma-separated equipment inventory")
+		duration     = fs.Int("duration", 0, "session duration in minutes")
+		units        = fs.String("units", "", "lbs or kg (default lbs)")
+		cardio       = fs.String("cardio", "", "upcoming cardio, free text")
+		stravaPath   = fs.String("strava", "", "JSON file of recent Strava activities")
+		sleepScore   = fs.Int("sleep-score", 0, "sleep score 0-100")
+		bodyBattery  = fs.Int("body-battery", 0, "body battery or readiness 0-100")
+		sessionDate  = fs.String("date", "", "session date YYYY-MM-DD (default today in -timezone)")
+		timezone     = fs.String("timezone", "", "IANA timezone for today's date (default $TIMEZONE)")
+	)
+	return func() (llm.AnalyzerInputs, error) {
+		var in llm.AnalyzerInputs
+		if *inputsPath != "" {
+			raw, err := os.ReadFile(*inputsPath)
+			if err != nil {
+				return in, err
+			}
+			b, err := workout.ToJSON(raw)
+			if err != nil {
+				return in, fmt.Errorf("%s: %w", *inputsPath, err)
+			}
+			if err := json.Unmarshal(b, &in); err != nil {
+				return in, fmt.Errorf("%s: %w", *inputsPath, err)
+			}
+		}
+
+		var err error
+		fs.Visit(func(f *flag.Flag) {
+			switch f.Name {
+			case "instructions":
+				in.InstructionsURL = *instructions
+			case "history":
+				in.HistoryURL = *historyURL
+			case "location":
+				in.Location = *location
+			case "equipment":
+				in.EquipmentInventory = splitList(*equipment)
+			case "duration":
+				in.DurationMinutes = *duration
+			case "units":
+				in.Units = *units
+			case "cardio":
+				in.UpcomingCardioText = *cardio
+			case "strava":
+				var raw []byte
+				if raw, err = os.ReadFile(*stravaPath); err == nil && !json.Valid(raw) {
+					err = fmt.Errorf("%s: not valid JSON", *stravaPath)
+				}
+				in.StravaRecent = raw
+			case "sleep-score":
+				in.SleepScore = sleepScore
+			case "body-battery":
+				in.BodyBattery = bodyBattery
+			case "date":
+				in.SessionDate = *sessionDate
+			case "timezone":
+				in.Timezone = *timezone
+			}
+		})
+		in.InstructionsURL = localRef(in.InstructionsURL)
+		in.HistoryURL = localRef(in.HistoryURL)
+		return in, err
+	}
+}
+
+// localRef makes a bare local path absolute; the CLI's fetcher resolves
+// relative paths against its base directory, not the working directory.
+// URLs and references such as gist:<id> pass through.
+func localRef(ref string) string {
+	if u, err := url.Parse(ref); ref == "" || (err == nil && u.Scheme != "") {
+		return ref
+	}
+	if abs, err := filepath.Abs(ref); err == nil {
+		return abs
+	}
+	return ref
+}
+
+func splitList(s string) []string {
+	out := []string{}
+	for _, p := range strings.Split(s, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+func (a *app) analyze(ctx context.Context, args []string) error {
+	fs := a.flagSet("analyze", "")
+	inputs := inputFlags(fs)
+	out := fs.String("out", "", "write the plan JSON here instead of stdout")
+	if err := parse(fs, args); err != nil {
+		return err
+	}
+	in, err := inputs()
+	if err != nil {
+		return err
+	}
+	cli, err := a.newClient(ctx)
+	if err != nil {
+		return err
+	}
+	an, err := cli.RunAnalysis(ctx, in)
+	if err != nil {
+		return err
+	}
+	a.printWarnings(an.Warnings)
+	b, err := json.MarshalIndent(an.Plan, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := a.writeOutput(*out, append(b, '\n')); err != nil {
+		return err
+	}
+	// The seed keeps the workout_id stable when the plan is generated later.
+	fmt.Fprintf(a.stderr, "seed: %s (pass to generate -seed)\n", an.Seed) //nolint:errcheck
+	return nil
+}
+
+func (a *app) generate(ctx context.Context, args []string) error {
+	fs := a.flagSet("generate", "<plan.json|plan.yaml|->")
+	seed := fs.String("seed", "", "workout_id seed printed by analyze")
+	out := fs.String("out", "", "write the workout YAML here instead of stdout")
+	storePath := storePathFlag(fs)
+	scope := userFlag(fs)
+	if err := parse(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return fmt.Errorf("%w: generate takes one plan file", errUsage)
+	}
+	ctx, err := scope(ctx)
+	if err != nil {
+		return err
+	}
+	plan, err := a.loadPlan(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	cli, err := a.newClient(ctx)
+	if err != nil {
+		return err
+	}
+	return a.generateWorkout(ctx, cli, *plan, *seed, "", *storePath, *out)
+}
+
+func (a *app) plan(ctx context.Context, args []string) error {
+	fs := a.flagSet("plan", "")
+	inputs := inputFlags(fs)
+	planOut := fs.String("plan-out", "", "also write the plan JSON to this file")
+	out := fs.String("out", "", "write the workout YAML here instead of stdout")
+	storePath := storePathFlag(fs)
+	scope := userFlag(fs)
+	if err := parse(fs, args); err != nil {
+		return err
+	}
+	ctx, err := scope(ctx)
+	if err != nil {
+		return err
+	}
+	in, err := inputs()
+	if err != nil {
+		return err
+	}
+	cli, err := a.newClient(ctx)
+	if err != nil {
+		return err
+	}
+	an, err := cli.RunAnalysis(ctx, in)
+	if err != nil {
+		return fmt.Errorf("analyze: %w", err)
+	}
+	a.printWarnings(an.Warnings)
+	if *planOut != "" {
+		b, err := json.MarshalIndent(an.Plan, "", "  ")
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(*planOut, append(b, '\n'), 0o644); err != nil {
+			return err
+		}
+	}
+	return a.generateWorkout(ctx, cli, an.Plan, an.Seed, an.InputsHash, *storePath, *out)
+}
+
+// printWarnings reports changes made to the inputs before prompting.
+func (a *app) printWarnings(warns []llm.Warning) {
+	for _, w := range warns {
+		fmt.Fprintf(a.stderr, "warning: %s\n", w.Message) //nolint:errcheck
+	}
+}
+
+// loadPlan reads and validates an analyzer plan in JSON or YAML.
+func (a *app) loadPlan(path string) (*schemas.AnalyzerV1Json, error) {
+	raw, err := a.readInput(path)
+	if err != nil {
+		return nil, err
+	}
+	b, err := workout.ToJSON(raw)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	plan, err := llm.ValidateAnalyzerJSON(b)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return plan, nil
+}
+
+// generateWorkout runs the generator and records the workout in the store,
+// which also assigns its workout_id exactly as swolegen-api does.
+func (a *app) generateWorkout(ctx context.Context, cli *llm.Client, plan schemas.AnalyzerV1Json, seed, inputsHash, storePath, out string) error {
+	doc, err := cli.Generate(ctx, plan)
+	if err != nil {
+		return fmt.Errorf("generate: %w", err)
+	}
+	st, err := store.Open(storePath)
+	if err != nil {
+		return err
+	}
+	defer st.Close() //nolint:errcheck
+
+	providerName, _ := cli.ProviderInfo()
+	model := cli.StageModel(llm.StageGenerating)
+	w, err := workout.Save(ctx, st, plan, doc, workout.Provenance{
+		Seed:          seed,
+		InputsHash:    inputsHash,
+		Provider:      providerName,
+		Model:         model,
+		PromptVersion: cli.PromptVersion(),
+	}, time.Now())
+	if err != nil {
+		return fmt.Errorf("save workout: %w", err)
+	}
+	if err := a.writeOutput(out, w.YAML); err != nil {
+		return err
+	}
+	fmt.Fprintf(a.stderr, "workout_id: %s\n", w.ID) //nolint:errcheck
+	return nil
+}
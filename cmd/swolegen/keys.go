@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/aaronromeo/swolegen/internal/auth"
+	"github.com/aaronromeo/swolegen/internal/store"
+)
+
+// keys manages swolegen-api keys in the store file. bbolt locks the file, so
+// stop the server first or use the /v1/admin/keys endpoints while it runs.
+func (a *app) keys(ctx context.Context, args []string) error {
+	if len(args) == 0 {
+		fmt.Fprintln(a.stderr, "usage: swolegen keys issue|list|revoke [flags]") //nolint:errcheck
+		return fmt.Errorf("%w: keys needs a subcommand", errUsage)
+	}
+	sub, args := args[0], args[1:]
+	fs := a.flagSet("keys "+sub, "")
+	storePath := storePathFlag(fs)
+	var user, name *string
+	var admin *bool
+	switch sub {
+	case "issue":
+		user = fs.String("user", "", "user the key authenticates as")
+		name = fs.String("name", "", "label to tell the user's keys apart")
+		admin = fs.Bool("admin", false, "allow the key to manage keys and read all usage")
+	case "revoke":
+		fs.Usage = func() {
+			fmt.Fprintln(a.stderr, "usage: swolegen keys revoke [flags] <key-id>") //nolint:errcheck
+			fs.PrintDefaults()
+		}
+	case "list":
+	default:
+		return fmt.Errorf("%w: unknown keys subcommand %q", errUsage, sub)
+	}
+	if err := parse(fs, args); err != nil {
+		return err
+	}
+	if strings.TrimSpace(*storePath) == "" {
+		return fmt.Errorf("%w: keys needs -store or STORE_PATH", errUsage)
+	}
+	st, err := store.Open(*storePath)
+	if err != nil {
+		return err
+	}
+	defer st.Close() //nolint:errcheck
+
+	switch sub {
+	case "issue":
+		k, plain, err := auth.Issue(ctx, st, *user, *name, *admin)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(a.stdout, plain)                                                        //nolint:errcheck
+		fmt.Fprintf(a.stderr, "issued key %s for %s; it is not shown again\n", k.ID, k.User) //nolint:errcheck
+		return nil
+	case "revoke":
+		if fs.NArg() != 1 {
+			fs.Usage()
+			return fmt.Errorf("%w: keys revoke takes one key id", errUsage)
+		}
+		k, err := auth.Revoke(ctx, st, fs.Arg(0))
+		if errors.Is(err, store.ErrNotFound) {
+			return fmt.Errorf("no key %q", fs.Arg(0))
+		}
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(a.stdout, "revoked key %s for %s\n", k.ID, k.User) //nolint:errcheck
+		return nil
+	}
+
+	keys, err := st.ListAPIKeys(ctx)
+	if err != nil {
+		return err
+	}
+	tw := tabwriter.NewWriter(a.stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tUSER\tNAME\tADMIN\tCREATED\tREVOKED") //nolint:errcheck
+	for _, k := range keys {
+		revoked := "-"
+		if k.Revoked() {
+			revoked = k.RevokedAt.Format("2006-01-02")
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%t\t%s\t%s\n", //nolint:errcheck
+			k.ID, k.User, k.Name, k.Admin, k.CreatedAt.Format("2006-01-02"), revoked)
+	}
+	return tw.Flush()
+}
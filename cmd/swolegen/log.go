@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/aaronromeo/swolegen/internal/history"
+	"github.com/aaronromeo/swolegen/internal/store"
+	"github.com/aaronromeo/swolegen/internal/workout"
+)
+
+func (a *app) log(ctx context.Context, args []string) error {
+	fs := a.flagSet("log", "<workout.yaml|->")
+	storePath := storePathFlag(fs)
+	scope := userFlag(fs)
+	if err := parse(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return fmt.Errorf("%w: log takes one workout file", errUsage)
+	}
+	ctx, err := scope(ctx)
+	if err != nil {
+		return err
+	}
+	if strings.TrimSpace(*storePath) == "" {
+		return fmt.Errorf("%w: log needs -store or STORE_PATH to persist sets", errUsage)
+	}
+
+	raw, err := a.readInput(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	w, err := workout.Parse(raw)
+	if err != nil {
+		return fmt.Errorf("%s: %w", fs.Arg(0), err)
+	}
+	if w.WorkoutId == "" {
+		return fmt.Errorf("%s: workout_id is empty", fs.Arg(0))
+	}
+
+	st, err := store.Open(*storePath)
+	if err != nil {
+		return err
+	}
+	defer st.Close() //nolint:errcheck
+
+	sets := workout.LoggedSets(w)
+	if err := st.PutSets(ctx, w.WorkoutId, sets); err != nil {
+		return err
+	}
+	for _, e := range workout.Exercises(w) {
+		if err := st.PutExercise(ctx, e); err != nil {
+			return err
+		}
+	}
+	fmt.Fprintf(a.stdout, "logged %d of %d sets for %s\n", len(sets), len(w.Sets), w.WorkoutId) //nolint:errcheck
+	return nil
+}
+
+func (a *app) history(ctx context.Context, args []string) error {
+	if len(args) == 0 || args[0] != "stats" {
+		fmt.Fprintln(a.stderr, "usage: swolegen history stats [flags]") //nolint:errcheck
+		return fmt.Errorf("%w: history supports the stats subcommand", errUsage)
+	}
+	fs := a.flagSet("history stats", "")
+	storePath := storePathFlag(fs)
+	source := fs.String("source", "", "summarize a history markdown URL or file instead of the store")
+	from := fs.String("from", "", "first date to include (YYYY-MM-DD)")
+	to := fs.String("to", "", "last date to include (YYYY-MM-DD)")
+	exercise := fs.String("exercise", "", "only this exercise")
+	asJSON := fs.Bool("json", false, "print JSON instead of a table")
+	scope := userFlag(fs)
+	if err := parse(fs, args[1:]); err != nil {
+		return err
+	}
+	ctx, err := scope(ctx)
+	if err != nil {
+		return err
+	}
+
+	var h history.DomainHistory
+	if *source != "" {
+		raw, err := a.readSource(ctx, *source)
+		if err != nil {
+			return err
+		}
+		if h, err = history.ParseHistoryMarkdown(raw); err != nil {
+			return err
+		}
+	} else {
+		st, err := store.Open(*storePath)
+		if err != nil {
+			return err
+		}
+		defer st.Close() //nolint:errcheck
+		sets, err := st.ListSets(ctx, store.SetFilter{})
+		if err != nil {
+			return err
+		}
+		h = history.FromSets(sets)
+	}
+
+	filtered := history.DomainHistory{}
+	for _, e := range h.Entries {
+		if (*from != "" && e.Date < *from) || (*to != "" && e.Date > *to) {
+			continue
+		}
+		if *exercise != "" && !strings.EqualFold(strings.TrimSpace(e.Exercise), *exercise) {
+			continue
+		}
+		filtered.Entries = append(filtered.Entries, e)
+	}
+	stats := history.Stats(filtered)
+
+	if *asJSON {
+		b, err := json.MarshalIndent(stats, "", "  ")
+		if err != nil {
+			return err
+		}
+		return a.writeOutput("", append(b, '\n'))
+	}
+	tw := tabwriter.NewWriter(a.stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "EXERCISE\tSESSIONS\tSETS\tLAST\tBEST\tE1RM\tVOLUME") //nolint:errcheck
+	for _, s := range stats {
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%s\t%gx%d\t%.1f\t%.0f\n", //nolint:errcheck
+			s.Exercise, s.Sessions, s.Sets, s.LastDate, s.BestLoad, s.BestLoadReps, s.BestE1RM, s.Volume)
+	}
+	return tw.Flush()
+}
+
+// readSource reads a history document from a URL, a gist: or gdoc:
+// reference, or a local file.
+func (a *app) readSource(ctx context.Context, src string) ([]byte, error) {
+	f, err := newFetcherFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	res, err := f.Fetch(ctx, localRef(src), 0)
+	return res.Body, err
+}
@@ -0,0 +1,207 @@
+// Command swolegen plans, generates, validates and logs workouts from the
+// terminal, calling the same LLM client and store as swolegen-api.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+
+	"github.com/aaronromeo/swolegen/internal/config"
+	"github.com/aaronromeo/swolegen/internal/fetch"
+	"github.com/aaronromeo/swolegen/internal/llm"
+	"github.com/aaronromeo/swolegen/internal/logging"
+	"github.com/aaronromeo/swolegen/internal/recovery"
+	"github.com/aaronromeo/swolegen/internal/store"
+)
+
+const usage = `usage: swolegen <command> [flags] [args]
+
+commands:
+  analyze        build an analyzer plan from inputs and print it as JSON
+  generate       turn a plan file into workout YAML
+  plan           analyze and generate in one step
+  log            record the sets filled in on a workout YAML
+  history stats  summarize logged sets per exercise
+  validate       check workout or plan files against the schemas
+  keys           issue, list and revoke swolegen-api keys
+
+Run "swolegen <command> -h" for a command's flags.
+`
+
+// errUsage marks errors caused by bad arguments; they exit with status 2.
+var errUsage = errors.New("usage")
+
+// app carries the process I/O and dependencies shared by subcommands.
+type app struct {
+	stdin  io.Reader
+	stdout io.Writer
+	stderr io.Writer
+	// newClient builds the LLM client for the user ctx is scoped to; tests
+	// replace it with a fake provider.
+	newClient func(ctx context.Context) (*llm.Client, error)
+}
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	a := &app{stdin: os.Stdin, stdout: os.Stdout, stderr: os.Stderr, newClient: newClientFromEnv}
+	err := a.run(ctx, os.Args[1:])
+	switch {
+	case err == nil, errors.Is(err, flag.ErrHelp):
+	case errors.Is(err, errUsage):
+		fmt.Fprintln(os.Stderr, err) //nolint:errcheck
+		os.Exit(2)
+	default:
+		fmt.Fprintln(os.Stderr, "swolegen:", err) //nolint:errcheck
+		os.Exit(1)
+	}
+}
+
+func (a *app) run(ctx context.Context, args []string) error {
+	if len(args) == 0 {
+		fmt.Fprint(a.stderr, usage) //nolint:errcheck
+		return errUsage
+	}
+	cmd, rest := args[0], args[1:]
+	switch cmd {
+	case "analyze":
+		return a.analyze(ctx, rest)
+	case "generate":
+		return a.generate(ctx, rest)
+	case "plan":
+		return a.plan(ctx, rest)
+	case "log":
+		return a.log(ctx, rest)
+	case "history":
+		return a.history(ctx, rest)
+	case "validate":
+		return a.validate(rest)
+	case "keys":
+		return a.keys(ctx, rest)
+	case "help", "-h", "-help", "--help":
+		fmt.Fprint(a.stdout, usage) //nolint:errcheck
+		return nil
+	default:
+		fmt.Fprint(a.stderr, usage) //nolint:errcheck
+		return fmt.Errorf("%w: unknown command %q", errUsage, cmd)
+	}
+}
+
+// flagSet returns a FlagSet that reports parse errors to the caller instead
+// of exiting.
+func (a *app) flagSet(name, args string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(a.stderr)
+	fs.Usage = func() {
+		fmt.Fprintf(a.stderr, "usage: swolegen %s [flags] %s\n", name, args) //nolint:errcheck
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// parse parses flags, wrapping non-help failures as usage errors.
+func parse(fs *flag.FlagSet, args []string) error {
+	err := fs.Parse(args)
+	if err != nil && !errors.Is(err, flag.ErrHelp) {
+		return fmt.Errorf("%w: %s: %v", errUsage, fs.Name(), err)
+	}
+	return err
+}
+
+// newClientFromEnv builds the LLM client from the same environment as
+// swolegen-api, including the user's recovery export (see recovery.PathFor).
+func newClientFromEnv(ctx context.Context) (*llm.Client, error) {
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		return nil, err
+	}
+	relaxFetch(&cfg.Fetch)
+	level := slog.LevelWarn
+	if cfg.Debug {
+		level = slog.LevelDebug
+	}
+	policy, err := logging.NewPolicy(cfg.LogRedact, cfg.LogSecretKeys, cfg.LogPIIKeys)
+	if err != nil {
+		return nil, err
+	}
+	logger := slog.New(logging.NewHandler(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: level}), policy))
+
+	var series *recovery.Series
+	if path := recovery.PathFor(strings.TrimSpace(cfg.RecoveryPath), store.UserFrom(ctx), store.DefaultUser); path != "" {
+		src, err := recovery.NewSource(cfg.RecoverySource, path)
+		if err != nil {
+			return nil, err
+		}
+		if series, err = src.Load(); err != nil {
+			return nil, fmt.Errorf("load recovery export %s: %w", path, err)
+		}
+	}
+	return llm.NewFromConfig(cfg, logger, llm.WithRecovery(series))
+}
+
+// readInput reads path, or stdin when path is "-".
+func (a *app) readInput(path string) ([]byte, error) {
+	if path == "-" {
+		return io.ReadAll(a.stdin)
+	}
+	return os.ReadFile(path)
+}
+
+// writeOutput writes b to path, or stdout when path is empty or "-".
+func (a *app) writeOutput(path string, b []byte) error {
+	if path == "" || path == "-" {
+		_, err := a.stdout.Write(b)
+		return err
+	}
+	return os.WriteFile(path, b, 0o644)
+}
+
+// storePathFlag registers -store, defaulting to STORE_PATH like swolegen-api.
+func storePathFlag(fs *flag.FlagSet) *string {
+	return fs.String("store", os.Getenv("STORE_PATH"), "bbolt store file (default $STORE_PATH; empty keeps state in memory)")
+}
+
+// userFlag registers -user, defaulting to SWOLEGEN_USER, and returns a func
+// scoping a context to it, so the CLI reads and writes the same data as that
+// user's API key.
+func userFlag(fs *flag.FlagSet) func(context.Context) (context.Context, error) {
+	user := fs.String("user", os.Getenv("SWOLEGEN_USER"), "store user to act as (default $SWOLEGEN_USER or \""+store.DefaultUser+"\")")
+	return func(ctx context.Context) (context.Context, error) {
+		if *user == "" {
+			return store.WithUser(ctx, store.DefaultUser), nil
+		}
+		if err := store.ValidateUser(*user); err != nil {
+			return ctx, fmt.Errorf("%w: -user: %v", errUsage, err)
+		}
+		return store.WithUser(ctx, *user), nil
+	}
+}
+
+// relaxFetch lifts the server's fetch restrictions: the CLI runs as its
+// user, who can already read their files and reach their network.
+func relaxFetch(cfg *config.FetchConfig) {
+	if cfg.BaseDir == "" {
+		cfg.BaseDir = string(filepath.Separator)
+	}
+	cfg.AllowPrivate = true
+}
+
+// newFetcherFromEnv builds the fetcher from the FETCH_* settings alone, so
+// commands that only read documents need no LLM configuration.
+func newFetcherFromEnv() (fetch.Source, error) {
+	cfg, err := config.LoadFetchConfig()
+	if err != nil {
+		return nil, err
+	}
+	relaxFetch(cfg)
+	return llm.NewFetcher(cfg)
+}
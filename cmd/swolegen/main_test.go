@@ -0,0 +1,192 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/aaronromeo/swolegen/internal/history"
+	"github.com/aaronromeo/swolegen/internal/llm"
+	"github.com/aaronromeo/swolegen/internal/llm/provider"
+)
+
+// stageProvider answers analyzer and generator prompts with fixed replies.
+type stageProvider struct {
+	plan, workout string
+}
+
+func (s stageProvider) Complete(_ context.Context, prf provider.ProviderResponseFormat) (provider.Completion, error) {
+	if prf.Name == provider.ResponseFormatAnalyzerPlan {
+		return provider.Completion{Text: s.plan}, nil
+	}
+	return provider.Completion{Text: s.workout}, nil
+}
+
+func (s stageProvider) Validate() error { return nil }
+
+func newTestApp(t *testing.T) (*app, *bytes.Buffer) {
+	t.Helper()
+	plan, err := os.ReadFile("testdata/plan.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	workout, err := os.ReadFile("testdata/workout.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := &bytes.Buffer{}
+	return &app{
+		stdin:  strings.NewReader(""),
+		stdout: stdout,
+		stderr: io.Discard,
+		newClient: func(context.Context) (*llm.Client, error) {
+			return llm.New(
+				llm.WithProvider(stageProvider{plan: string(plan), workout: string(workout)}),
+				llm.WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil))),
+			)
+		},
+	}, stdout
+}
+
+func TestPlanLogAndStats(t *testing.T) {
+	a, stdout := newTestApp(t)
+	ctx := context.Background()
+	dir := t.TempDir()
+	db := filepath.Join(dir, "swolegen.db")
+	workoutPath := filepath.Join(dir, "workout.yaml")
+	planPath := filepath.Join(dir, "plan.json")
+
+	err := a.run(ctx, []string{"plan", "-date", "2025-08-09", "-location", "home", "-duration", "45", "-equipment", "dumbbell, bench",
+		"-store", db, "-out", workoutPath, "-plan-out", planPath})
+	if err != nil {
+		t.Fatalf("plan: %v", err)
+	}
+	doc, err := os.ReadFile(workoutPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wid := regexp.MustCompile(`(?m)^workout_id: (2025-08-09-home-\d{2})$`).FindSubmatch(doc)
+	if wid == nil {
+		t.Fatalf("expected a server-assigned workout_id:\n%s", doc)
+	}
+
+	stdout.Reset()
+	if err := a.run(ctx, []string{"validate", planPath, workoutPath}); err != nil {
+		t.Fatalf("validate: %v\n%s", err, stdout)
+	}
+	if !strings.Contains(stdout.String(), "ok (plan)") || !strings.Contains(stdout.String(), "ok (workout)") {
+		t.Fatalf("unexpected validate output: %s", stdout)
+	}
+
+	// Fill in the first set the way a user would in their editor.
+	filled := strings.Replace(string(doc), "actual_weight: null", "actual_weight: 60", 1)
+	filled = strings.Replace(filled, "actual_reps: null", "actual_reps: 10", 1)
+	if err := os.WriteFile(workoutPath, []byte(filled), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	stdout.Reset()
+	if err := a.run(ctx, []string{"log", "-store", db, workoutPath}); err != nil {
+		t.Fatalf("log: %v", err)
+	}
+	if want := "logged 1 of 2 sets for " + string(wid[1]); !strings.Contains(stdout.String(), want) {
+		t.Fatalf("expected %q, got %q", want, stdout)
+	}
+
+	stdout.Reset()
+	if err := a.run(ctx, []string{"history", "stats", "-store", db, "-json"}); err != nil {
+		t.Fatalf("history stats: %v", err)
+	}
+	var stats []history.ExerciseStats
+	if err := json.Unmarshal(stdout.Bytes(), &stats); err != nil {
+		t.Fatalf("decode stats: %v\n%s", err, stdout)
+	}
+	if len(stats) != 1 || stats[0].Exercise != "Goblet Squat" || stats[0].Sets != 1 || stats[0].Volume != 600 {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+}
+
+func TestGenerateIsIdempotentForSeed(t *testing.T) {
+	a, stdout := newTestApp(t)
+	ctx := context.Background()
+	db := filepath.Join(t.TempDir(), "swolegen.db")
+
+	var ids []string
+	for i := 0; i < 2; i++ {
+		stdout.Reset()
+		if err := a.run(ctx, []string{"generate", "-seed", "abc", "-store", db, "testdata/plan.json"}); err != nil {
+			t.Fatalf("generate: %v", err)
+		}
+		m := regexp.MustCompile(`(?m)^workout_id: (\S+)$`).FindStringSubmatch(stdout.String())
+		if m == nil {
+			t.Fatalf("no workout_id in output:\n%s", stdout)
+		}
+		ids = append(ids, m[1])
+	}
+	if ids[0] != ids[1] {
+		t.Fatalf("expected the same workout_id for the same seed, got %v", ids)
+	}
+}
+
+func TestValidateRejectsInvalid(t *testing.T) {
+	a, stdout := newTestApp(t)
+	path := filepath.Join(t.TempDir(), "bad.yaml")
+	if err := os.WriteFile(path, []byte("workout_id: x\nsets: []\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.run(context.Background(), []string{"validate", path}); err == nil {
+		t.Fatalf("expected validation failure")
+	}
+	if !strings.Contains(stdout.String(), "invalid") {
+		t.Fatalf("expected invalid report, got %q", stdout)
+	}
+}
+
+func TestKeys(t *testing.T) {
+	a, stdout := newTestApp(t)
+	ctx := context.Background()
+	db := filepath.Join(t.TempDir(), "swolegen.db")
+
+	if err := a.run(ctx, []string{"keys", "issue", "-store", db, "-user", "alice", "-name", "laptop"}); err != nil {
+		t.Fatalf("keys issue: %v", err)
+	}
+	plain := strings.TrimSpace(stdout.String())
+	m := regexp.MustCompile(`^sg_([0-9a-f]+)_[0-9a-f]+$`).FindStringSubmatch(plain)
+	if m == nil {
+		t.Fatalf("issued key = %q", plain)
+	}
+
+	stdout.Reset()
+	if err := a.run(ctx, []string{"keys", "revoke", "-store", db, m[1]}); err != nil {
+		t.Fatalf("keys revoke: %v", err)
+	}
+	stdout.Reset()
+	if err := a.run(ctx, []string{"keys", "list", "-store", db}); err != nil {
+		t.Fatalf("keys list: %v", err)
+	}
+	if out := stdout.String(); !strings.Contains(out, m[1]) || !strings.Contains(out, "alice") || strings.Contains(out, plain) {
+		t.Fatalf("keys list = %q", out)
+	}
+
+	if err := a.run(ctx, []string{"keys", "issue", "-store", db, "-user", "Not Valid"}); err == nil {
+		t.Fatalf("expected an error for an invalid user")
+	}
+	if err := a.run(ctx, []string{"keys", "rotate", "-store", db}); !errors.Is(err, errUsage) {
+		t.Fatalf("expected usage error, got %v", err)
+	}
+}
+
+func TestUnknownCommand(t *testing.T) {
+	a, _ := newTestApp(t)
+	if err := a.run(context.Background(), []string{"nope"}); !errors.Is(err, errUsage) {
+		t.Fatalf("expected usage error, got %v", err)
+	}
+}
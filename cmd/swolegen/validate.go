@@ -0,0 +1,84 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/aaronromeo/swolegen/internal/llm"
+	"github.com/aaronromeo/swolegen/internal/workout"
+)
+
+func (a *app) validate(args []string) error {
+	fs := a.flagSet("validate", "<file>...")
+	kind := fs.String("kind", "auto", "auto, plan or workout")
+	if err := parse(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return fmt.Errorf("%w: validate takes at least one file", errUsage)
+	}
+	switch *kind {
+	case "auto", "plan", "workout":
+	default:
+		return fmt.Errorf("%w: -kind must be auto, plan or workout", errUsage)
+	}
+
+	failed := 0
+	for _, path := range fs.Args() {
+		k, err := a.validateFile(path, *kind)
+		if err != nil {
+			failed++
+			fmt.Fprintf(a.stdout, "%s: invalid: %v\n", path, err) //nolint:errcheck
+			continue
+		}
+		fmt.Fprintf(a.stdout, "%s: ok (%s)\n", path, k) //nolint:errcheck
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d files invalid", failed, fs.NArg())
+	}
+	return nil
+}
+
+// validateFile checks one file and reports which schema it was checked
+// against.
+func (a *app) validateFile(path, kind string) (string, error) {
+	raw, err := a.readInput(path)
+	if err != nil {
+		return kind, err
+	}
+	b, err := workout.ToJSON(raw)
+	if err != nil {
+		return kind, err
+	}
+	if kind == "auto" {
+		if kind, err = detectKind(b); err != nil {
+			return kind, err
+		}
+	}
+	if kind == "plan" {
+		_, err = llm.ValidateAnalyzerJSON(b)
+	} else {
+		_, err = llm.ValidateWorkoutJSON(b)
+	}
+	return kind, err
+}
+
+// detectKind tells plans (meta + session) from workouts (workout_id + sets).
+func detectKind(b []byte) (string, error) {
+	var top map[string]json.RawMessage
+	if err := json.Unmarshal(b, &top); err != nil {
+		return "auto", errors.New("expected a mapping document")
+	}
+	if _, ok := top["sets"]; ok {
+		return "workout", nil
+	}
+	if _, ok := top["workout_id"]; ok {
+		return "workout", nil
+	}
+	if _, ok := top["meta"]; ok {
+		return "plan", nil
+	}
+	return "auto", errors.New("cannot tell plan from workout; pass -kind")
+}
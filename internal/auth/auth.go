@@ -0,0 +1,148 @@
+// Package auth issues and checks the API keys that identify swolegen-api
+// callers. A key is "sg_<id>_<secret>": the id locates the stored record and
+// only a SHA-256 hash of the secret is kept, so a copy of the store does not
+// leak usable keys.
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aaronromeo/swolegen/internal/id"
+	"github.com/aaronromeo/swolegen/internal/store"
+)
+
+// ErrInvalidKey is returned for keys that are malformed, unknown or revoked.
+// Callers should not tell these cases apart in responses.
+var ErrInvalidKey = errors.New("auth: invalid api key")
+
+const keyPrefix = "sg_"
+
+var now = func() time.Time { return time.Now().UTC() }
+
+// Issue creates a key for user and returns the stored record with the
+// plaintext key, which is shown once and cannot be recovered later.
+func Issue(ctx context.Context, st store.Store, user, name string, admin bool) (store.APIKey, string, error) {
+	if err := store.ValidateUser(user); err != nil {
+		return store.APIKey{}, "", err
+	}
+	id, err := randomHex(8)
+	if err != nil {
+		return store.APIKey{}, "", err
+	}
+	secret, err := randomHex(24)
+	if err != nil {
+		return store.APIKey{}, "", err
+	}
+	k := store.APIKey{
+		ID:        id,
+		User:      user,
+		Name:      name,
+		Admin:     admin,
+		Hash:      hashSecret(secret),
+		CreatedAt: now(),
+	}
+	if err := st.PutAPIKey(ctx, k); err != nil {
+		return store.APIKey{}, "", fmt.Errorf("store api key: %w", err)
+	}
+	return k, keyPrefix + id + "_" + secret, nil
+}
+
+// Import stores plain, a key made outside Issue, for user. It is how a
+// server whose store starts empty gets its first admin key. Importing the
+// same key again keeps the stored record, revocation included; a different
+// key under a stored id is an error.
+func Import(ctx context.Context, st store.Store, plain, user, name string, admin bool) (store.APIKey, error) {
+	if err := store.ValidateUser(user); err != nil {
+		return store.APIKey{}, err
+	}
+	id, secret, ok := splitKey(plain)
+	if !ok {
+		return store.APIKey{}, fmt.Errorf("%w: want %s<id>_<secret>", ErrInvalidKey, keyPrefix)
+	}
+	k, err := st.GetAPIKey(ctx, id)
+	if err == nil {
+		if subtle.ConstantTimeCompare([]byte(hashSecret(secret)), []byte(k.Hash)) != 1 {
+			return store.APIKey{}, fmt.Errorf("api key id %s is already taken by another key", id)
+		}
+		return k, nil
+	}
+	if !errors.Is(err, store.ErrNotFound) {
+		return store.APIKey{}, err
+	}
+	k = store.APIKey{
+		ID:        id,
+		User:      user,
+		Name:      name,
+		Admin:     admin,
+		Hash:      hashSecret(secret),
+		CreatedAt: now(),
+	}
+	if err := st.PutAPIKey(ctx, k); err != nil {
+		return store.APIKey{}, fmt.Errorf("store api key: %w", err)
+	}
+	return k, nil
+}
+
+// Authenticate returns the active key record matching plain.
+func Authenticate(ctx context.Context, st store.Store, plain string) (store.APIKey, error) {
+	id, secret, ok := splitKey(plain)
+	if !ok {
+		return store.APIKey{}, ErrInvalidKey
+	}
+	k, err := st.GetAPIKey(ctx, id)
+	if errors.Is(err, store.ErrNotFound) {
+		return store.APIKey{}, ErrInvalidKey
+	}
+	if err != nil {
+		return store.APIKey{}, err
+	}
+	if subtle.ConstantTimeCompare([]byte(hashSecret(secret)), []byte(k.Hash)) != 1 || k.Revoked() {
+		return store.APIKey{}, ErrInvalidKey
+	}
+	return k, nil
+}
+
+// Revoke marks the key with the given id revoked. Revoking twice keeps the
+// original revocation time.
+func Revoke(ctx context.Context, st store.Store, id string) (store.APIKey, error) {
+	k, err := st.GetAPIKey(ctx, id)
+	if err != nil {
+		return store.APIKey{}, err
+	}
+	if k.Revoked() {
+		return k, nil
+	}
+	t := now()
+	k.RevokedAt = &t
+	if err := st.PutAPIKey(ctx, k); err != nil {
+		return store.APIKey{}, fmt.Errorf("store api key: %w", err)
+	}
+	return k, nil
+}
+
+// splitKey splits plain into the id and secret of "sg_<id>_<secret>".
+func splitKey(plain string) (id, secret string, ok bool) {
+	rest, ok := strings.CutPrefix(plain, keyPrefix)
+	id, secret, ok2 := strings.Cut(rest, "_")
+	return id, secret, ok && ok2 && id != "" && secret != ""
+}
+
+func hashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+func randomHex(n int) (string, error) {
+	s, err := id.Random(n)
+	if err != nil {
+		return "", fmt.Errorf("generate api key: %w", err)
+	}
+	return s, nil
+}
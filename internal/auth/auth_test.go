@@ -0,0 +1,74 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/aaronromeo/swolegen/internal/store"
+)
+
+func TestIssueAuthenticateRevoke(t *testing.T) {
+	ctx := context.Background()
+	st := store.NewMemory()
+
+	k, plain, err := Issue(ctx, st, "alice", "laptop", false)
+	if err != nil {
+		t.Fatalf("Issue: %v", err)
+	}
+	if !strings.HasPrefix(plain, "sg_"+k.ID+"_") || strings.Contains(k.Hash, strings.TrimPrefix(plain, "sg_"+k.ID+"_")) {
+		t.Fatalf("key %q / record %+v: want sg_<id>_<secret> with only a hash stored", plain, k)
+	}
+
+	got, err := Authenticate(ctx, st, plain)
+	if err != nil || got.User != "alice" {
+		t.Fatalf("Authenticate = %+v, %v; want alice", got, err)
+	}
+	for _, bad := range []string{"", "sg_", "sg_" + k.ID + "_wrong", "sg_nope_secret", strings.TrimPrefix(plain, "sg_")} {
+		if _, err := Authenticate(ctx, st, bad); !errors.Is(err, ErrInvalidKey) {
+			t.Errorf("Authenticate(%q) = %v; want ErrInvalidKey", bad, err)
+		}
+	}
+
+	if _, err := Revoke(ctx, st, k.ID); err != nil {
+		t.Fatalf("Revoke: %v", err)
+	}
+	if _, err := Authenticate(ctx, st, plain); !errors.Is(err, ErrInvalidKey) {
+		t.Fatalf("Authenticate after revoke = %v; want ErrInvalidKey", err)
+	}
+	if _, err := Revoke(ctx, st, "missing"); !errors.Is(err, store.ErrNotFound) {
+		t.Fatalf("Revoke(missing) = %v; want ErrNotFound", err)
+	}
+	if _, _, err := Issue(ctx, st, "Bad/User", "", false); err == nil {
+		t.Fatalf("Issue accepted an invalid user id")
+	}
+}
+
+func TestImport(t *testing.T) {
+	ctx := context.Background()
+	st := store.NewMemory()
+	const plain = "sg_boot_0123456789abcdef"
+
+	k, err := Import(ctx, st, plain, store.DefaultUser, "bootstrap", true)
+	if err != nil || !k.Admin || k.User != store.DefaultUser {
+		t.Fatalf("Import = %+v, %v; want an admin key for %s", k, err, store.DefaultUser)
+	}
+	if got, err := Authenticate(ctx, st, plain); err != nil || got.ID != "boot" {
+		t.Fatalf("Authenticate imported key = %+v, %v", got, err)
+	}
+
+	// Importing again at the next start keeps the record, revoked or not.
+	if _, err := Revoke(ctx, st, "boot"); err != nil {
+		t.Fatalf("Revoke: %v", err)
+	}
+	if again, err := Import(ctx, st, plain, store.DefaultUser, "bootstrap", true); err != nil || !again.Revoked() {
+		t.Fatalf("re-Import = %+v, %v; want the revoked record", again, err)
+	}
+	if _, err := Import(ctx, st, "sg_boot_other", store.DefaultUser, "", true); err == nil {
+		t.Fatal("Import accepted a different key under a stored id")
+	}
+	if _, err := Import(ctx, st, "not-a-key", store.DefaultUser, "", true); !errors.Is(err, ErrInvalidKey) {
+		t.Fatalf("Import(malformed) = %v; want ErrInvalidKey", err)
+	}
+}
@@ -0,0 +1,98 @@
+// Package cache stores opaque values by key with a TTL and a size limit,
+// in memory or on disk.
+package cache
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// Cache is a bounded key/value store. A miss, an expired entry and an
+// unreadable entry all look the same to the caller.
+type Cache interface {
+	Get(key string) ([]byte, bool)
+	Set(key string, val []byte) error
+}
+
+// Memory is an LRU cache bounded by the total size of its values.
+type Memory struct {
+	maxBytes int64
+	ttl      time.Duration
+	now      func() time.Time
+
+	mu    sync.Mutex
+	size  int64
+	order *list.List // front is most recently used
+	items map[string]*list.Element
+}
+
+type entry struct {
+	key     string
+	val     []byte
+	expires time.Time
+}
+
+// NewMemory returns a cache holding at most maxBytes of values, each for at
+// most ttl. A zero ttl keeps entries until they are evicted.
+func NewMemory(maxBytes int64, ttl time.Duration) *Memory {
+	return &Memory{
+		maxBytes: maxBytes,
+		ttl:      ttl,
+		now:      time.Now,
+		order:    list.New(),
+		items:    map[string]*list.Element{},
+	}
+}
+
+func (m *Memory) Get(key string) ([]byte, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	el, ok := m.items[key]
+	if !ok {
+		return nil, false
+	}
+	e := el.Value.(*entry)
+	if !e.expires.IsZero() && !m.now().Before(e.expires) {
+		m.remove(el)
+		return nil, false
+	}
+	m.order.MoveToFront(el)
+	return append([]byte(nil), e.val...), true
+}
+
+// Set stores val, evicting least recently used entries to make room.
+// Values larger than the whole cache are not stored.
+func (m *Memory) Set(key string, val []byte) error {
+	if int64(len(val)) > m.maxBytes {
+		return nil
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if el, ok := m.items[key]; ok {
+		m.remove(el)
+	}
+	e := &entry{key: key, val: append([]byte(nil), val...)}
+	if m.ttl > 0 {
+		e.expires = m.now().Add(m.ttl)
+	}
+	m.items[key] = m.order.PushFront(e)
+	m.size += int64(len(val))
+	for m.size > m.maxBytes {
+		m.remove(m.order.Back())
+	}
+	return nil
+}
+
+// Len reports the number of entries, expired ones included.
+func (m *Memory) Len() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.order.Len()
+}
+
+func (m *Memory) remove(el *list.Element) {
+	e := m.order.Remove(el).(*entry)
+	delete(m.items, e.key)
+	m.size -= int64(len(e.val))
+}
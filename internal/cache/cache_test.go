@@ -0,0 +1,77 @@
+package cache
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestMemory_EvictsAndExpires(t *testing.T) {
+	now := time.Unix(0, 0)
+	m := NewMemory(10, time.Minute)
+	m.now = func() time.Time { return now }
+
+	m.Set("a", []byte("aaaa")) //nolint:errcheck
+	m.Set("b", []byte("bbbb")) //nolint:errcheck
+	if _, ok := m.Get("a"); !ok {
+		t.Fatalf("expected a to be cached")
+	}
+	// b is now least recently used and makes room for c.
+	m.Set("c", []byte("cccc")) //nolint:errcheck
+	if _, ok := m.Get("b"); ok {
+		t.Fatalf("expected b to be evicted")
+	}
+	if v, ok := m.Get("a"); !ok || string(v) != "aaaa" {
+		t.Fatalf("expected a to survive, got %q %v", v, ok)
+	}
+	m.Set("huge", make([]byte, 11)) //nolint:errcheck
+	if _, ok := m.Get("huge"); ok {
+		t.Fatalf("values larger than the cache should not be stored")
+	}
+
+	now = now.Add(time.Minute)
+	if _, ok := m.Get("a"); ok {
+		t.Fatalf("expected a to expire")
+	}
+	if m.Len() != 1 {
+		t.Fatalf("expected expired entry to be dropped, have %d", m.Len())
+	}
+}
+
+func TestDisk_RoundTripAndLimits(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "llm")
+	d, err := NewDisk(dir, 10, time.Hour)
+	if err != nil {
+		t.Fatalf("NewDisk: %v", err)
+	}
+	if err := d.Set("plan/../../etc", []byte("first")); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+	if v, ok := d.Get("plan/../../etc"); !ok || string(v) != "first" {
+		t.Fatalf("round trip: got %q %v", v, ok)
+	}
+
+	// Age the first entry so eviction order is deterministic.
+	old := time.Now().Add(-time.Minute)
+	if err := os.Chtimes(d.path("plan/../../etc"), old, old); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Set("second", []byte("second")); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+	if _, ok := d.Get("plan/../../etc"); ok {
+		t.Fatalf("expected the oldest entry to be evicted")
+	}
+	if _, ok := d.Get("second"); !ok {
+		t.Fatalf("expected the newest entry to be kept")
+	}
+
+	d.now = func() time.Time { return time.Now().Add(2 * time.Hour) }
+	if _, ok := d.Get("second"); ok {
+		t.Fatalf("expected entry to expire")
+	}
+	if left, _ := filepath.Glob(filepath.Join(dir, "*")); len(left) != 0 {
+		t.Fatalf("expected expired files to be removed, have %v", left)
+	}
+}
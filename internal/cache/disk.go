@@ -0,0 +1,122 @@
+package cache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Disk is a cache of one file per entry in a directory, so entries survive
+// restarts and can be shared by the CLI and the server. Entries expire by
+// modification time; when the directory grows past its limit the oldest
+// entries are removed first.
+type Disk struct {
+	dir      string
+	maxBytes int64
+	ttl      time.Duration
+	now      func() time.Time
+
+	mu sync.Mutex // serializes eviction
+}
+
+// NewDisk returns a cache in dir, creating it if needed.
+func NewDisk(dir string, maxBytes int64, ttl time.Duration) (*Disk, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("cache dir: %w", err)
+	}
+	return &Disk{dir: dir, maxBytes: maxBytes, ttl: ttl, now: time.Now}, nil
+}
+
+// path hashes key so any key maps to a safe file name.
+func (d *Disk) path(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(d.dir, hex.EncodeToString(sum[:])+".cache")
+}
+
+func (d *Disk) Get(key string) ([]byte, bool) {
+	p := d.path(key)
+	fi, err := os.Stat(p)
+	if err != nil {
+		return nil, false
+	}
+	if d.expired(fi) {
+		os.Remove(p) //nolint:errcheck
+		return nil, false
+	}
+	val, err := os.ReadFile(p)
+	if err != nil {
+		return nil, false
+	}
+	return val, true
+}
+
+// Set writes val through a temporary file so readers never see a partial
+// entry.
+func (d *Disk) Set(key string, val []byte) error {
+	if int64(len(val)) > d.maxBytes {
+		return nil
+	}
+	tmp, err := os.CreateTemp(d.dir, "*.tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(val); err != nil {
+		tmp.Close()           //nolint:errcheck
+		os.Remove(tmp.Name()) //nolint:errcheck
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name()) //nolint:errcheck
+		return err
+	}
+	if err := os.Rename(tmp.Name(), d.path(key)); err != nil {
+		os.Remove(tmp.Name()) //nolint:errcheck
+		return err
+	}
+	return d.evict()
+}
+
+func (d *Disk) expired(fi os.FileInfo) bool {
+	return d.ttl > 0 && !d.now().Before(fi.ModTime().Add(d.ttl))
+}
+
+// evict removes expired entries, then the oldest ones until the directory
+// fits in maxBytes.
+func (d *Disk) evict() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	matches, err := filepath.Glob(filepath.Join(d.dir, "*.cache"))
+	if err != nil {
+		return err
+	}
+	var live []os.FileInfo
+	var size int64
+	for _, p := range matches {
+		fi, err := os.Stat(p)
+		if err != nil {
+			continue
+		}
+		if d.expired(fi) {
+			os.Remove(p) //nolint:errcheck
+			continue
+		}
+		live = append(live, fi)
+		size += fi.Size()
+	}
+	sort.Slice(live, func(i, j int) bool { return live[i].ModTime().Before(live[j].ModTime()) })
+	for _, fi := range live {
+		if size <= d.maxBytes {
+			break
+		}
+		if err := os.Remove(filepath.Join(d.dir, fi.Name())); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		size -= fi.Size()
+	}
+	return nil
+}
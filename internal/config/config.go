@@ -1,27 +1,182 @@
 package config
 
-import "github.com/caarlos0/env/v11"
+import "time"
 
+// Config is the server and CLI configuration. Each field is read from the
+// environment variable in its env tag, or from the YAML config file under
+// the key in its yaml tag (see Load).
 type Config struct {
-	// stateSecret  string `env:"STRAVA_STATE_SECRET,required"`
-	// clientID     string `env:"STRAVA_CLIENT_ID,required"`
-	// clientSecret string `env:"STRAVA_CLIENT_SECRET,required"`
-	// redirectBase string `env:"STRAVA_REDIRECT_BASE_URL,required"`
-	// scopes       string `env:"STRAVA_SCOPES,required"`
-
-	LlmRetries       int    `env:"LLM_RETRIES" envDefault:"3"`
-	LlmModel         string `env:"LLM_MODEL_ANALYZER"  envDefault:"gpt-4o-mini"`
-	LlmMaxFetchBytes int    `env:"LLM_MAX_FETCH_BYTES" envDefault:"65536"`
-
-	OpenaiKey string `env:"OPENAI_API_KEY,required"`
-	Debug     bool   `env:"DEBUG" envDefault:"false"`
-	Addr      string `env:"ADDR" envDefault:":8080"`
+	LlmRetries       int    `env:"LLM_RETRIES" envDefault:"3" yaml:"llm_retries"`
+	LlmModel         string `env:"LLM_MODEL_ANALYZER"  envDefault:"gpt-4o-mini" yaml:"llm_model_analyzer"`
+	LlmMaxFetchBytes int    `env:"LLM_MAX_FETCH_BYTES" envDefault:"65536" yaml:"llm_max_fetch_bytes"`
+
+	// Per-stage completion settings. The generator and repairs use the
+	// analyzer's model when theirs is empty; repairs otherwise keep the
+	// settings of the stage they repair. Zero max tokens leaves the limit
+	// to the provider, an empty reasoning effort is not sent (setting one
+	// drops the temperature, which reasoning models reject) and a nil seed
+	// leaves sampling unseeded.
+	LlmModelGenerator           string  `env:"LLM_MODEL_GENERATOR" yaml:"llm_model_generator"`
+	LlmModelRepair              string  `env:"LLM_MODEL_REPAIR" yaml:"llm_model_repair"`
+	LlmTemperatureAnalyzer      float64 `env:"LLM_TEMPERATURE_ANALYZER" envDefault:"0.2" yaml:"llm_temperature_analyzer"`
+	LlmTemperatureGenerator     float64 `env:"LLM_TEMPERATURE_GENERATOR" envDefault:"0.4" yaml:"llm_temperature_generator"`
+	LlmMaxTokensAnalyzer        int64   `env:"LLM_MAX_TOKENS_ANALYZER" envDefault:"0" yaml:"llm_max_tokens_analyzer"`
+	LlmMaxTokensGenerator       int64   `env:"LLM_MAX_TOKENS_GENERATOR" envDefault:"0" yaml:"llm_max_tokens_generator"`
+	LlmReasoningEffortAnalyzer  string  `env:"LLM_REASONING_EFFORT_ANALYZER" yaml:"llm_reasoning_effort_analyzer"`
+	LlmReasoningEffortGenerator string  `env:"LLM_REASONING_EFFORT_GENERATOR" yaml:"llm_reasoning_effort_generator"`
+	LlmSeedAnalyzer             *int64  `env:"LLM_SEED_ANALYZER" yaml:"llm_seed_analyzer"`
+	LlmSeedGenerator            *int64  `env:"LLM_SEED_GENERATOR" yaml:"llm_seed_generator"`
+
+	// Approximate token budgets for user-supplied prompt sections; longer
+	// text is cut with a notice and a warning in the response. 0 disables.
+	LlmBudgetInstructions   int `env:"LLM_BUDGET_INSTRUCTIONS" envDefault:"4000" yaml:"llm_budget_instructions"`
+	LlmBudgetHistory        int `env:"LLM_BUDGET_HISTORY" envDefault:"12000" yaml:"llm_budget_history"`
+	LlmBudgetUpcomingCardio int `env:"LLM_BUDGET_UPCOMING_CARDIO" envDefault:"500" yaml:"llm_budget_upcoming_cardio"`
+
+	// Per-stage deadlines for the LLM pipeline; repairs count against their
+	// stage. A missed deadline is answered with 504 naming the stage.
+	LlmFetchTimeout     time.Duration `env:"LLM_TIMEOUT_FETCH" envDefault:"15s" yaml:"llm_timeout_fetch"`
+	LlmAnalyzerTimeout  time.Duration `env:"LLM_TIMEOUT_ANALYZER" envDefault:"90s" yaml:"llm_timeout_analyzer"`
+	LlmGeneratorTimeout time.Duration `env:"LLM_TIMEOUT_GENERATOR" envDefault:"60s" yaml:"llm_timeout_generator"`
+
+	// LlmFallbackModels are tried in order when the primary model fails.
+	// Each model has its own circuit breaker: LlmBreakerFailures failures
+	// within LlmBreakerWindow open it, and calls are rejected with 503 until
+	// LlmBreakerCooldown has passed. Zero failures disables the breakers.
+	LlmFallbackModels  []string      `env:"LLM_FALLBACK_MODELS" envSeparator:"," yaml:"llm_fallback_models"`
+	LlmBreakerFailures int           `env:"LLM_BREAKER_FAILURES" envDefault:"5" yaml:"llm_breaker_failures"`
+	LlmBreakerWindow   time.Duration `env:"LLM_BREAKER_WINDOW" envDefault:"1m" yaml:"llm_breaker_window"`
+	LlmBreakerCooldown time.Duration `env:"LLM_BREAKER_COOLDOWN" envDefault:"30s" yaml:"llm_breaker_cooldown"`
+
+	// LlmPrices is the price table used to cost completions, in USD per
+	// million tokens: "model=input:output,...". Models match by prefix.
+	LlmPrices string `env:"LLM_PRICES" envDefault:"gpt-4o-mini=0.15:0.60,gpt-4.1-mini=0.40:1.60,gpt-4.1=2.00:8.00,gpt-4o=2.50:10.00" yaml:"llm_prices"`
+
+	// Validated analyzer and generator output is cached for LlmCacheTTL, up
+	// to LlmCacheMaxBytes, on disk under LlmCacheDir when set and in memory
+	// otherwise. A zero TTL disables the cache.
+	LlmCacheTTL      time.Duration `env:"LLM_CACHE_TTL" envDefault:"24h" yaml:"llm_cache_ttl"`
+	LlmCacheMaxBytes int64         `env:"LLM_CACHE_MAX_BYTES" envDefault:"33554432" yaml:"llm_cache_max_bytes"`
+	LlmCacheDir      string        `env:"LLM_CACHE_DIR" yaml:"llm_cache_dir"`
+
+	// LlmPromptsDir holds alternative prompt sets, one subdirectory each,
+	// loaded at startup; files a set leaves out use the embedded prompts.
+	// LlmPromptSet names the default set ("embedded" when empty).
+	LlmPromptsDir string `env:"LLM_PROMPTS_DIR" yaml:"llm_prompts_dir"`
+	LlmPromptSet  string `env:"LLM_PROMPT_SET" yaml:"llm_prompt_set"`
+
+	Fetch  FetchConfig  `yaml:"fetch"`
+	Strava StravaConfig `yaml:"strava"`
+
+	// Timezone is the IANA zone session dates are taken in.
+	Timezone string `env:"TIMEZONE" envDefault:"America/Toronto" yaml:"timezone"`
+
+	// RecoverySource selects the recovery importer (garmin, apple_health, csv)
+	// and RecoveryPath the export it reads to fill each session's recovery
+	// signals. A "{user}" in RecoveryPath stands for the user the session is
+	// for; without one, the export is the "default" user's alone.
+	RecoverySource string `env:"RECOVERY_SOURCE" envDefault:"garmin" yaml:"recovery_source"`
+	RecoveryPath   string `env:"RECOVERY_PATH" yaml:"recovery_path"`
+	// RecoveryGarminExport is the Garmin export setting recovery import
+	// started with. Deprecated: it is read as RecoverySource "garmin" with
+	// RecoveryPath when RecoveryPath is unset; use those instead.
+	RecoveryGarminExport string `env:"RECOVERY_GARMIN_EXPORT" yaml:"recovery_garmin_export"`
+
+	// JobWorkers bounds concurrent background generation jobs; JobQueueSize
+	// is how many more may wait before POST /v1/jobs returns 503.
+	JobWorkers   int `env:"JOB_WORKERS" envDefault:"2" yaml:"job_workers"`
+	JobQueueSize int `env:"JOB_QUEUE_SIZE" envDefault:"16" yaml:"job_queue_size"`
+
+	// AuthRequired makes /llm, /v1 and the Strava routes require an
+	// X-API-Key issued with "swolegen keys issue". When false, requests
+	// without a key run as the "default" user, as a single-user install did
+	// before keys existed.
+	AuthRequired bool `env:"AUTH_REQUIRED" envDefault:"true" yaml:"auth_required"`
+	// AuthAdminKey is an admin key for the "default" user, in the
+	// "sg_<id>_<secret>" form "swolegen keys issue" prints, added to the
+	// store at startup. It is the way in for a server whose store starts
+	// empty, such as the in-memory one; use it to issue the real keys.
+	AuthAdminKey string `env:"AUTH_ADMIN_KEY" yaml:"auth_admin_key"`
+
+	// ProxyHeader is the header the reverse proxy puts the client IP in
+	// (Dokku's nginx sets X-Forwarded-For to the connecting address). It is
+	// believed only on connections from TrustedProxies, IPs or CIDRs; other
+	// requests, and all requests when ProxyHeader is empty, use the peer.
+	ProxyHeader    string   `env:"PROXY_HEADER" envDefault:"X-Forwarded-For" yaml:"proxy_header"`
+	TrustedProxies []string `env:"TRUSTED_PROXIES" envSeparator:"," envDefault:"127.0.0.1,::1,172.16.0.0/12" yaml:"trusted_proxies"`
+
+	// RateLimitPerMinute refills each API key's (or, without one, each
+	// client IP's) bucket of RateLimitBurst requests to /llm and /v1.
+	// Zero disables rate limiting.
+	RateLimitPerMinute int `env:"RATE_LIMIT_PER_MINUTE" envDefault:"60" yaml:"rate_limit_per_minute"`
+	RateLimitBurst     int `env:"RATE_LIMIT_BURST" envDefault:"10" yaml:"rate_limit_burst"`
+
+	// LlmDailyTokens and LlmDailyUSD cap each user's LLM spend per UTC day;
+	// zero is unlimited. LlmDailyBudgets overrides them per user as
+	// "user=tokens:usd,...".
+	LlmDailyTokens  int64   `env:"LLM_DAILY_TOKENS" envDefault:"0" yaml:"llm_daily_tokens"`
+	LlmDailyUSD     float64 `env:"LLM_DAILY_USD" envDefault:"0" yaml:"llm_daily_usd"`
+	LlmDailyBudgets string  `env:"LLM_DAILY_BUDGETS" yaml:"llm_daily_budgets"`
+
+	// StorePath is the bbolt database file; empty keeps state in memory.
+	StorePath string `env:"STORE_PATH" yaml:"store_path"`
+
+	// LogRedact is how much logs redact: "strict" removes secrets and
+	// replaces user content (history, instructions, prompts, plans) with its
+	// size, "secrets" removes secrets only, "off" logs everything. The
+	// extra keys add attribute names to treat as secrets or user content.
+	LogRedact     string   `env:"LOG_REDACT" envDefault:"strict" yaml:"log_redact"`
+	LogSecretKeys []string `env:"LOG_SECRET_KEYS" envSeparator:"," yaml:"log_secret_keys"`
+	LogPIIKeys    []string `env:"LOG_PII_KEYS" envSeparator:"," yaml:"log_pii_keys"`
+
+	// TraceExporter sends spans over OTLP/HTTP ("otlp", configured by the
+	// standard OTEL_EXPORTER_OTLP_* variables), writes them to stdout
+	// ("stdout") or drops them ("none"). TraceSampleRatio is the fraction
+	// of new traces kept; requests carrying a sampled traceparent are kept.
+	TraceExporter    string  `env:"TRACE_EXPORTER" envDefault:"none" yaml:"trace_exporter"`
+	TraceSampleRatio float64 `env:"TRACE_SAMPLE_RATIO" envDefault:"1" yaml:"trace_sample_ratio"`
+
+	OpenaiKey string `env:"OPENAI_API_KEY" yaml:"openai_api_key"`
+	Debug     bool   `env:"DEBUG" envDefault:"false" yaml:"debug"`
+	Addr      string `env:"ADDR" envDefault:":8080" yaml:"addr"`
+}
+
+// FetchConfig is how instructions and history documents are fetched.
+//
+// URLs are fetched only over Schemes, from Hosts when set ("*.example.com"
+// matches subdomains), and never from loopback, private or link-local
+// addresses (checked after DNS) unless AllowPrivate. Local paths are read
+// only from under BaseDir; empty disables them. Responses must be one of
+// ContentTypes.
+//
+// GistToken and GoogleToken authenticate gist: and gdoc:/gsheet:
+// references, and Credentials attach an Authorization header to URLs under
+// a prefix: "https://logs.example.com/=bearer:TOKEN" or
+// "https://intranet.example.com/=basic:user:pass". Credentials never come
+// from the request. Responses with an ETag or Last-Modified are kept, up to
+// CacheMaxBytes, and revalidated instead of downloaded again.
+type FetchConfig struct {
+	Schemes       []string      `env:"FETCH_SCHEMES" envSeparator:"," envDefault:"https,http" yaml:"schemes"`
+	Hosts         []string      `env:"FETCH_HOSTS" envSeparator:"," yaml:"hosts"`
+	AllowPrivate  bool          `env:"FETCH_ALLOW_PRIVATE" envDefault:"false" yaml:"allow_private"`
+	BaseDir       string        `env:"FETCH_BASE_DIR" yaml:"base_dir"`
+	MaxRedirects  int           `env:"FETCH_MAX_REDIRECTS" envDefault:"3" yaml:"max_redirects"`
+	Timeout       time.Duration `env:"FETCH_TIMEOUT" envDefault:"10s" yaml:"timeout"`
+	ContentTypes  []string      `env:"FETCH_CONTENT_TYPES" envSeparator:"," envDefault:"text/*,application/json,application/yaml,application/x-yaml,application/csv" yaml:"content_types"`
+	GistToken     string        `env:"FETCH_GIST_TOKEN" yaml:"gist_token"`
+	GoogleToken   string        `env:"FETCH_GOOGLE_TOKEN" yaml:"google_token"`
+	Credentials   []string      `env:"FETCH_CREDENTIALS" envSeparator:"," yaml:"credentials"`
+	CacheMaxBytes int64         `env:"FETCH_CACHE_MAX_BYTES" envDefault:"8388608" yaml:"cache_max_bytes"`
 }
 
-func LoadConfig() (*Config, error) {
-	var cfg Config
-	if err := env.Parse(&cfg); err != nil {
-		return nil, err
-	}
-	return &cfg, nil
+// StravaConfig is the Strava API application the OAuth flow authorizes
+// against, and the timeout for each call to Strava. The OAuth settings may
+// be left empty when the Strava routes are unused; /readyz reports them.
+type StravaConfig struct {
+	ClientID        string        `env:"STRAVA_CLIENT_ID" yaml:"client_id"`
+	ClientSecret    string        `env:"STRAVA_CLIENT_SECRET" yaml:"client_secret"`
+	RedirectBaseURL string        `env:"STRAVA_REDIRECT_BASE_URL" yaml:"redirect_base_url"`
+	Scopes          string        `env:"STRAVA_SCOPES" envDefault:"read,activity:read_all" yaml:"scopes"`
+	StateSecret     string        `env:"STRAVA_STATE_SECRET" yaml:"state_secret"`
+	Timeout         time.Duration `env:"STRAVA_TIMEOUT" envDefault:"30s" yaml:"timeout"`
 }
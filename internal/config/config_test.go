@@ -0,0 +1,134 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeConfig(t *testing.T, body string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "swolegen.yaml")
+	if err := os.WriteFile(path, []byte(body), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoad_Layers(t *testing.T) {
+	t.Setenv("OPENAI_API_KEY", "")
+	t.Setenv("LLM_MODEL_ANALYZER", "gpt-4.1-mini")
+	t.Setenv("FETCH_HOSTS", "")
+	t.Setenv("LLM_SEED_ANALYZER", "3")
+	t.Setenv("STORE_PATH", "")
+	path := writeConfig(t, `
+openai_api_key: sk-file
+store_path: swolegen.db
+llm_model_analyzer: gpt-4o
+llm_temperature_generator: 0.7
+llm_seed_generator: 7
+llm_timeout_analyzer: 2m
+fetch:
+  hosts: [gist.githubusercontent.com]
+strava:
+  client_id: "1234"
+  timeout: 5s
+`)
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if cfg.OpenaiKey != "sk-file" || cfg.LlmAnalyzerTimeout != 2*time.Minute {
+		t.Errorf("file values not applied: %+v", cfg)
+	}
+	if cfg.LlmModel != "gpt-4.1-mini" {
+		t.Errorf("env should override the file, got model %q", cfg.LlmModel)
+	}
+	if cfg.LlmTemperatureGenerator != 0.7 || cfg.LlmTemperatureAnalyzer != 0.2 {
+		t.Errorf("temperatures = %g/%g, want 0.2/0.7", cfg.LlmTemperatureAnalyzer, cfg.LlmTemperatureGenerator)
+	}
+	if cfg.LlmSeedAnalyzer == nil || *cfg.LlmSeedAnalyzer != 3 || cfg.LlmSeedGenerator == nil || *cfg.LlmSeedGenerator != 7 {
+		t.Errorf("seeds not applied: %v %v", cfg.LlmSeedAnalyzer, cfg.LlmSeedGenerator)
+	}
+	if len(cfg.Fetch.Hosts) != 1 || cfg.Strava.ClientID != "1234" || cfg.Strava.Timeout != 5*time.Second {
+		t.Errorf("nested sections not applied: %+v %+v", cfg.Fetch, cfg.Strava)
+	}
+	if cfg.LlmRetries != 3 || cfg.Strava.Scopes != "read,activity:read_all" || cfg.Timezone != "America/Toronto" {
+		t.Errorf("defaults lost: %+v", cfg)
+	}
+}
+
+func TestLoad_Errors(t *testing.T) {
+	t.Setenv("OPENAI_API_KEY", "")
+	t.Setenv("JOB_WORKERS", "0")
+	t.Setenv("TIMEZONE", "Mars/Olympus")
+	t.Setenv("LLM_REASONING_EFFORT_GENERATOR", "max")
+	t.Setenv("TRUSTED_PROXIES", "10.0.0.1,dokku")
+	t.Setenv("LLM_PRICES", "gpt-4o=cheap")
+	t.Setenv("LLM_DAILY_BUDGETS", "alice=1")
+	t.Setenv("STORE_PATH", "")
+	t.Setenv("AUTH_ADMIN_KEY", "")
+	path := writeConfig(t, `
+llm_timeout_generator: -1s
+llm_temperature_analyzer: 3
+strava:
+  redirect_base_url: example.com
+`)
+	_, err := Load(path)
+	if err == nil {
+		t.Fatal("expected validation errors")
+	}
+	for _, want := range []string{"OPENAI_API_KEY: required", "JOB_WORKERS", "TIMEZONE", "LLM_TIMEOUT_GENERATOR", "LLM_TEMPERATURE_ANALYZER", "LLM_REASONING_EFFORT_GENERATOR", "TRUSTED_PROXIES", "LLM_PRICES", "LLM_DAILY_BUDGETS", "STRAVA_REDIRECT_BASE_URL", "AUTH_REQUIRED"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error does not mention %s: %v", want, err)
+		}
+	}
+
+	if _, err := Load(writeConfig(t, "llm_model: gpt-4o\n")); err == nil || !strings.Contains(err.Error(), "llm_model") {
+		t.Errorf("expected unknown key error, got %v", err)
+	}
+	if _, err := Load(filepath.Join(t.TempDir(), "missing.yaml")); err == nil {
+		t.Error("expected error for a missing file")
+	}
+}
+
+func TestLoad_RecoveryGarminExportAlias(t *testing.T) {
+	t.Setenv("OPENAI_API_KEY", "sk-test")
+	t.Setenv("AUTH_REQUIRED", "false")
+	t.Setenv("RECOVERY_SOURCE", "csv")
+	t.Setenv("RECOVERY_PATH", "")
+	t.Setenv("RECOVERY_GARMIN_EXPORT", "/data/garmin.zip")
+	cfg, err := Load("")
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if cfg.RecoverySource != "garmin" || cfg.RecoveryPath != "/data/garmin.zip" {
+		t.Fatalf("recovery = %q %q; want the Garmin export", cfg.RecoverySource, cfg.RecoveryPath)
+	}
+
+	t.Setenv("RECOVERY_PATH", "/data/recovery.csv")
+	if cfg, err = Load(""); err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if cfg.RecoverySource != "csv" || cfg.RecoveryPath != "/data/recovery.csv" {
+		t.Fatalf("recovery = %q %q; want RECOVERY_PATH to win", cfg.RecoverySource, cfg.RecoveryPath)
+	}
+}
+
+func TestParseBudgets(t *testing.T) {
+	got, err := ParseBudgets("alice=100000:1.50, bob=0:0.25")
+	if err != nil {
+		t.Fatalf("ParseBudgets: %v", err)
+	}
+	if got["alice"] != (Budget{Tokens: 100000, USD: 1.5}) || got["bob"] != (Budget{USD: 0.25}) {
+		t.Fatalf("ParseBudgets = %+v", got)
+	}
+	for _, bad := range []string{"alice", "alice=1", "=1:1", "alice=x:1"} {
+		if _, err := ParseBudgets(bad); err == nil {
+			t.Errorf("ParseBudgets(%q) accepted", bad)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/caarlos0/env/v11"
+	"gopkg.in/yaml.v3"
+)
+
+// EnvConfigFile names the YAML config file LoadConfig reads, if any.
+const EnvConfigFile = "SWOLEGEN_CONFIG"
+
+// noDefaults is a tag no field has, so an env pass with it as the default
+// tag only sets variables that are present and non-empty.
+const noDefaults = "-"
+
+// LoadConfig is Load with the file named by $SWOLEGEN_CONFIG.
+func LoadConfig() (*Config, error) {
+	return Load(os.Getenv(EnvConfigFile))
+}
+
+// Load builds the configuration in three layers: the envDefault values,
+// then the YAML file at path when path is not empty, then environment
+// variables that are set and non-empty. Unknown keys in the file are
+// errors, as is any setting that fails Validate.
+func Load(path string) (*Config, error) {
+	cfg, err := load(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("config: %w", err)
+	}
+	return cfg, nil
+}
+
+// LoadFetchConfig reads only the fetch settings, for tools that fetch
+// documents without calling an LLM.
+func LoadFetchConfig() (*FetchConfig, error) {
+	cfg, err := load(os.Getenv(EnvConfigFile))
+	if err != nil {
+		return nil, err
+	}
+	if err := cfg.Fetch.Validate(); err != nil {
+		return nil, fmt.Errorf("config: %w", err)
+	}
+	return &cfg.Fetch, nil
+}
+
+func load(path string) (*Config, error) {
+	var cfg Config
+	if err := env.ParseWithOptions(&cfg, env.Options{Environment: map[string]string{}}); err != nil {
+		return nil, fmt.Errorf("config defaults: %w", err)
+	}
+	if path != "" {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("config: %w", err)
+		}
+		dec := yaml.NewDecoder(bytes.NewReader(b))
+		dec.KnownFields(true)
+		if err := dec.Decode(&cfg); err != nil && !errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("config %s: %w", path, err)
+		}
+	}
+	if err := env.ParseWithOptions(&cfg, env.Options{DefaultValueTagName: noDefaults}); err != nil {
+		return nil, fmt.Errorf("config: %w", err)
+	}
+	if cfg.RecoveryPath == "" && cfg.RecoveryGarminExport != "" {
+		cfg.RecoverySource, cfg.RecoveryPath = "garmin", cfg.RecoveryGarminExport
+	}
+	return &cfg, nil
+}
@@ -0,0 +1,81 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Price is what a model charges, in USD per million tokens.
+type Price struct {
+	Input  float64 `json:"input"`
+	Output float64 `json:"output"`
+}
+
+// ParsePrices reads a price table written as "model=input:output,...",
+// e.g. "gpt-4o-mini=0.15:0.60" (see LlmPrices).
+func ParsePrices(s string) (map[string]Price, error) {
+	prices := map[string]Price{}
+	for _, entry := range strings.Split(s, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		model, rates, ok := strings.Cut(entry, "=")
+		in, out, ok2 := strings.Cut(rates, ":")
+		if !ok || !ok2 || strings.TrimSpace(model) == "" {
+			return nil, fmt.Errorf("price %q: want model=input:output", entry)
+		}
+		var p Price
+		var err error
+		if p.Input, err = strconv.ParseFloat(strings.TrimSpace(in), 64); err != nil {
+			return nil, fmt.Errorf("price %q: %w", entry, err)
+		}
+		if p.Output, err = strconv.ParseFloat(strings.TrimSpace(out), 64); err != nil {
+			return nil, fmt.Errorf("price %q: %w", entry, err)
+		}
+		prices[strings.TrimSpace(model)] = p
+	}
+	return prices, nil
+}
+
+// Budget is a user's daily LLM allowance. Zero fields are unlimited.
+type Budget struct {
+	Tokens int64
+	USD    float64
+}
+
+// Unlimited reports whether b caps nothing.
+func (b Budget) Unlimited() bool { return b.Tokens <= 0 && b.USD <= 0 }
+
+// ParseBudgets reads per-user overrides as "user=tokens:usd,..." (see
+// LlmDailyBudgets). It checks only the syntax; the server checks the user
+// IDs against the store's rules when it starts.
+func ParseBudgets(s string) (map[string]Budget, error) {
+	out := map[string]Budget{}
+	for _, entry := range strings.Split(s, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		user, limits, ok := strings.Cut(entry, "=")
+		tokens, usd, ok2 := strings.Cut(limits, ":")
+		if !ok || !ok2 {
+			return nil, fmt.Errorf("budget %q: want user=tokens:usd", entry)
+		}
+		user = strings.TrimSpace(user)
+		if user == "" {
+			return nil, fmt.Errorf("budget %q: want user=tokens:usd", entry)
+		}
+		var b Budget
+		var err error
+		if b.Tokens, err = strconv.ParseInt(strings.TrimSpace(tokens), 10, 64); err != nil {
+			return nil, fmt.Errorf("budget %q: %w", entry, err)
+		}
+		if b.USD, err = strconv.ParseFloat(strings.TrimSpace(usd), 64); err != nil {
+			return nil, fmt.Errorf("budget %q: %w", entry, err)
+		}
+		out[user] = b
+	}
+	return out, nil
+}
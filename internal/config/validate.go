@@ -0,0 +1,158 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+	_ "time/tzdata" // TIMEZONE must resolve on hosts without a zoneinfo database
+)
+
+// problems collects validation failures, each naming the setting by its
+// environment variable.
+type problems []error
+
+func (p *problems) add(name, format string, args ...any) {
+	*p = append(*p, fmt.Errorf("%s: %s", name, fmt.Sprintf(format, args...)))
+}
+
+func (p *problems) nonNegative(name string, v int64) {
+	if v < 0 {
+		p.add(name, "must not be negative, got %d", v)
+	}
+}
+
+func (p *problems) positive(name string, v int64) {
+	if v <= 0 {
+		p.add(name, "must be positive, got %d", v)
+	}
+}
+
+func (p *problems) positiveDuration(name string, d time.Duration) {
+	if d <= 0 {
+		p.add(name, "must be a positive duration, got %s", d)
+	}
+}
+
+func (p *problems) temperature(name string, v float64) {
+	if v < 0 || v > 2 {
+		p.add(name, "must be between 0 and 2, got %g", v)
+	}
+}
+
+// oneOf checks v against allowed; "" in allowed accepts an unset value.
+func (p *problems) oneOf(name, v string, allowed ...string) {
+	if !slices.Contains(allowed, v) {
+		named := slices.DeleteFunc(slices.Clone(allowed), func(s string) bool { return s == "" })
+		p.add(name, "must be one of %s, got %q", strings.Join(named, ", "), v)
+	}
+}
+
+// Validate reports every invalid setting at once, so a misconfigured
+// deployment fails at startup with the whole list.
+func (c *Config) Validate() error {
+	var p problems
+	if c.OpenaiKey == "" {
+		p.add("OPENAI_API_KEY", "required")
+	}
+	if c.LlmModel == "" {
+		p.add("LLM_MODEL_ANALYZER", "required")
+	}
+	p.nonNegative("LLM_RETRIES", int64(c.LlmRetries))
+	p.positive("LLM_MAX_FETCH_BYTES", int64(c.LlmMaxFetchBytes))
+	p.nonNegative("LLM_MAX_TOKENS_ANALYZER", c.LlmMaxTokensAnalyzer)
+	p.nonNegative("LLM_MAX_TOKENS_GENERATOR", c.LlmMaxTokensGenerator)
+	p.temperature("LLM_TEMPERATURE_ANALYZER", c.LlmTemperatureAnalyzer)
+	p.temperature("LLM_TEMPERATURE_GENERATOR", c.LlmTemperatureGenerator)
+	p.oneOf("LLM_REASONING_EFFORT_ANALYZER", c.LlmReasoningEffortAnalyzer, "", "minimal", "low", "medium", "high")
+	p.oneOf("LLM_REASONING_EFFORT_GENERATOR", c.LlmReasoningEffortGenerator, "", "minimal", "low", "medium", "high")
+	p.nonNegative("LLM_BUDGET_INSTRUCTIONS", int64(c.LlmBudgetInstructions))
+	p.nonNegative("LLM_BUDGET_HISTORY", int64(c.LlmBudgetHistory))
+	p.nonNegative("LLM_BUDGET_UPCOMING_CARDIO", int64(c.LlmBudgetUpcomingCardio))
+	p.positiveDuration("LLM_TIMEOUT_FETCH", c.LlmFetchTimeout)
+	p.positiveDuration("LLM_TIMEOUT_ANALYZER", c.LlmAnalyzerTimeout)
+	p.positiveDuration("LLM_TIMEOUT_GENERATOR", c.LlmGeneratorTimeout)
+	p.nonNegative("LLM_BREAKER_FAILURES", int64(c.LlmBreakerFailures))
+	if c.LlmBreakerFailures > 0 {
+		p.positiveDuration("LLM_BREAKER_WINDOW", c.LlmBreakerWindow)
+		p.positiveDuration("LLM_BREAKER_COOLDOWN", c.LlmBreakerCooldown)
+	}
+	p.nonNegative("LLM_CACHE_MAX_BYTES", c.LlmCacheMaxBytes)
+	p.oneOf("RECOVERY_SOURCE", strings.ToLower(strings.TrimSpace(c.RecoverySource)), "", "garmin", "apple_health", "csv")
+	p.positive("JOB_WORKERS", int64(c.JobWorkers))
+	p.nonNegative("JOB_QUEUE_SIZE", int64(c.JobQueueSize))
+	if c.AuthRequired && c.StorePath == "" && c.AuthAdminKey == "" {
+		p.add("AUTH_REQUIRED", "the in-memory store starts with no keys; set STORE_PATH and issue keys with \"swolegen keys issue\", or set AUTH_ADMIN_KEY")
+	}
+	p.nonNegative("RATE_LIMIT_PER_MINUTE", int64(c.RateLimitPerMinute))
+	if c.RateLimitPerMinute > 0 {
+		p.positive("RATE_LIMIT_BURST", int64(c.RateLimitBurst))
+	}
+	for _, tp := range c.TrustedProxies {
+		if net.ParseIP(tp) == nil {
+			if _, _, err := net.ParseCIDR(tp); err != nil {
+				p.add("TRUSTED_PROXIES", "want an IP or CIDR, got %q", tp)
+			}
+		}
+	}
+	if _, err := ParsePrices(c.LlmPrices); err != nil {
+		p.add("LLM_PRICES", "%v", err)
+	}
+	if _, err := ParseBudgets(c.LlmDailyBudgets); err != nil {
+		p.add("LLM_DAILY_BUDGETS", "%v", err)
+	}
+	p.nonNegative("LLM_DAILY_TOKENS", c.LlmDailyTokens)
+	if c.LlmDailyUSD < 0 {
+		p.add("LLM_DAILY_USD", "must not be negative, got %g", c.LlmDailyUSD)
+	}
+	p.oneOf("LOG_REDACT", strings.ToLower(strings.TrimSpace(c.LogRedact)), "", "strict", "secrets", "off")
+	p.oneOf("TRACE_EXPORTER", c.TraceExporter, "", "none", "otlp", "stdout")
+	if c.TraceSampleRatio < 0 || c.TraceSampleRatio > 1 {
+		p.add("TRACE_SAMPLE_RATIO", "must be between 0 and 1, got %g", c.TraceSampleRatio)
+	}
+	if _, err := time.LoadLocation(c.Timezone); err != nil || c.Timezone == "" {
+		p.add("TIMEZONE", "unknown time zone %q", c.Timezone)
+	}
+	if c.Addr == "" {
+		p.add("ADDR", "required")
+	}
+	if err := c.Fetch.Validate(); err != nil {
+		p = append(p, err)
+	}
+	if err := c.Strava.Validate(); err != nil {
+		p = append(p, err)
+	}
+	return errors.Join(p...)
+}
+
+// Validate reports every invalid fetch setting.
+func (c *FetchConfig) Validate() error {
+	var p problems
+	if len(c.Schemes) == 0 {
+		p.add("FETCH_SCHEMES", "required")
+	}
+	for _, s := range c.Schemes {
+		p.oneOf("FETCH_SCHEMES", s, "https", "http")
+	}
+	p.nonNegative("FETCH_MAX_REDIRECTS", int64(c.MaxRedirects))
+	p.positiveDuration("FETCH_TIMEOUT", c.Timeout)
+	p.nonNegative("FETCH_CACHE_MAX_BYTES", c.CacheMaxBytes)
+	return errors.Join(p...)
+}
+
+// Validate reports invalid Strava settings. Missing OAuth settings are not
+// errors here: the server runs without Strava, and /readyz reports them.
+func (c *StravaConfig) Validate() error {
+	var p problems
+	if c.RedirectBaseURL != "" {
+		u, err := url.Parse(c.RedirectBaseURL)
+		if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+			p.add("STRAVA_REDIRECT_BASE_URL", "must be an absolute http(s) URL, got %q", c.RedirectBaseURL)
+		}
+	}
+	p.positiveDuration("STRAVA_TIMEOUT", c.Timeout)
+	return errors.Join(p...)
+}
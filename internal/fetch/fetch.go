@@ -0,0 +1,499 @@
+// Package fetch downloads user-supplied URLs without letting them reach
+// the server's own network or file system.
+package fetch
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/aaronromeo/swolegen/internal/cache"
+	"github.com/aaronromeo/swolegen/internal/metrics"
+	"github.com/aaronromeo/swolegen/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "github.com/aaronromeo/swolegen/internal/fetch"
+
+// Span attributes of a fetch.
+const (
+	attrSource      = attribute.Key("swolegen.fetch.source")
+	attrBytes       = attribute.Key("swolegen.fetch.bytes")
+	attrTruncated   = attribute.Key("swolegen.fetch.truncated")
+	attrNotModified = attribute.Key("swolegen.fetch.not_modified")
+)
+
+// ErrBlocked is matched by errors for URLs the fetch policy refuses.
+var ErrBlocked = errors.New("fetch blocked")
+
+// BlockedError names the refused URL or address and why it was refused.
+type BlockedError struct {
+	URL    string
+	Reason string
+}
+
+func (e *BlockedError) Error() string {
+	return fmt.Sprintf("%s: %s: %s", ErrBlocked, e.URL, e.Reason)
+}
+
+func (e *BlockedError) Is(target error) bool { return target == ErrBlocked }
+
+// Result is a fetched document. Truncated reports that it was cut at the
+// caller's limit; NotModified that the server answered 304 and the body
+// came from the fetcher's cache.
+type Result struct {
+	Body        []byte
+	ContentType string
+	Truncated   bool
+	NotModified bool
+}
+
+// Source fetches documents by reference: URLs, resolver references such as
+// gist:<id>/<file>, or local paths. Both the analyzer inputs and the
+// history tools read through it.
+type Source interface {
+	Fetch(ctx context.Context, ref string, limit int64) (Result, error)
+}
+
+// Resolver turns the references it recognizes into the HTTP request that
+// fetches them; ok is false for references it does not handle. Requests
+// are still subject to the fetcher's scheme, host and address checks.
+type Resolver interface {
+	Resolve(ctx context.Context, ref string) (req *http.Request, ok bool, err error)
+}
+
+// Extractor is implemented by resolvers whose response wraps the document,
+// such as an API answering JSON.
+type Extractor interface {
+	Extract(ref string, body []byte) ([]byte, error)
+}
+
+// maxExtractBytes bounds a wrapped response; the limit applies to the
+// document extracted from it.
+const maxExtractBytes = 10 << 20
+
+// Fetcher fetches documents through its resolvers and, when a base
+// directory is configured, local files. The defaults suit a server exposed to untrusted callers:
+// http and https only, no private or loopback addresses, no local files.
+type Fetcher struct {
+	schemes      []string
+	hosts        []string
+	allowPrivate bool
+	baseDir      string
+	maxRedirects int
+	timeout      time.Duration
+	contentTypes []string
+	resolvers    []Resolver
+	cache        cache.Cache
+
+	client *http.Client
+}
+
+type Option func(*Fetcher)
+
+// WithSchemes sets the URL schemes that may be fetched. Default http, https.
+func WithSchemes(schemes ...string) Option {
+	return func(f *Fetcher) {
+		f.schemes = schemes
+	}
+}
+
+// WithAllowedHosts restricts fetching to the given hosts; "*.example.com"
+// matches any subdomain of example.com. Empty allows any public host.
+func WithAllowedHosts(hosts ...string) Option {
+	return func(f *Fetcher) {
+		f.hosts = hosts
+	}
+}
+
+// WithAllowPrivate permits loopback, private and link-local addresses.
+// Only for trusted callers, such as the CLI or local development.
+func WithAllowPrivate(allow bool) Option {
+	return func(f *Fetcher) {
+		f.allowPrivate = allow
+	}
+}
+
+// WithBaseDir enables file:// URLs and bare paths, confined to dir.
+// Relative paths resolve against dir. Empty disables local files.
+func WithBaseDir(dir string) Option {
+	return func(f *Fetcher) {
+		f.baseDir = dir
+	}
+}
+
+// WithMaxRedirects sets how many redirects are followed. Default 3.
+func WithMaxRedirects(n int) Option {
+	return func(f *Fetcher) {
+		f.maxRedirects = n
+	}
+}
+
+// WithTimeout bounds each fetch, redirects included. Default 10s.
+func WithTimeout(d time.Duration) Option {
+	return func(f *Fetcher) {
+		f.timeout = d
+	}
+}
+
+// WithContentTypes sets the accepted response media types; "text/*"
+// matches any text type. Responses without a Content-Type are accepted.
+// Empty accepts anything.
+func WithContentTypes(types ...string) Option {
+	return func(f *Fetcher) {
+		f.contentTypes = types
+	}
+}
+
+// WithResolvers sets the resolvers tried, in order, for each reference.
+// Default: Gist, GoogleDrive and HTTP without credentials.
+func WithResolvers(rs ...Resolver) Option {
+	return func(f *Fetcher) {
+		f.resolvers = rs
+	}
+}
+
+// WithCache keeps responses that carry an ETag or Last-Modified and
+// revalidates them with If-None-Match / If-Modified-Since, so unchanged
+// documents are not downloaded again.
+func WithCache(c cache.Cache) Option {
+	return func(f *Fetcher) {
+		f.cache = c
+	}
+}
+
+// DefaultContentTypes are the text formats instructions and history come in.
+var DefaultContentTypes = []string{"text/*", "application/json", "application/yaml", "application/x-yaml", "application/csv"}
+
+func New(opts ...Option) *Fetcher {
+	f := &Fetcher{
+		schemes:      []string{"http", "https"},
+		maxRedirects: 3,
+		timeout:      10 * time.Second,
+		contentTypes: DefaultContentTypes,
+		resolvers:    []Resolver{&Gist{}, &GoogleDrive{}, &HTTP{}},
+	}
+	for _, opt := range opts {
+		opt(f)
+	}
+	// Addresses are checked when dialing, after DNS resolution, so a public
+	// name resolving (or rebinding) to a private address is still refused.
+	// No proxy: it would be dialed instead of the target.
+	dialer := &net.Dialer{Timeout: f.timeout, Control: f.checkDial}
+	f.client = &http.Client{
+		Timeout: f.timeout,
+		Transport: &http.Transport{
+			DialContext:         dialer.DialContext,
+			ForceAttemptHTTP2:   true,
+			MaxIdleConns:        10,
+			IdleConnTimeout:     90 * time.Second,
+			TLSHandshakeTimeout: 10 * time.Second,
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) > f.maxRedirects {
+				return &BlockedError{URL: req.URL.String(), Reason: fmt.Sprintf("more than %d redirects", f.maxRedirects)}
+			}
+			return f.checkURL(req.URL)
+		},
+	}
+	return f
+}
+
+// Fetch reads up to limit bytes of the document ref names; limit <= 0
+// reads everything. An empty ref yields an empty result. Refused
+// references fail with an error matching ErrBlocked.
+func (f *Fetcher) Fetch(ctx context.Context, ref string, limit int64) (res Result, err error) {
+	ref = strings.TrimSpace(ref)
+	if ref == "" {
+		return Result{}, nil
+	}
+	ctx, span := tracing.Tracer(tracerName).Start(ctx, "fetch", trace.WithAttributes(attrSource.String(sourceOf(ref))))
+	defer func() {
+		span.SetAttributes(attrBytes.Int(len(res.Body)), attrTruncated.Bool(res.Truncated), attrNotModified.Bool(res.NotModified))
+		tracing.End(span, err)
+	}()
+	if p, ok := strings.CutPrefix(ref, "file://"); ok {
+		return f.fetchFile(ref, p, limit)
+	}
+	for _, r := range f.resolvers {
+		req, ok, err := r.Resolve(ctx, ref)
+		if err != nil {
+			return Result{}, err
+		}
+		if ok {
+			return f.do(req, r, ref, limit)
+		}
+	}
+	u, err := url.Parse(ref)
+	if err != nil || u.Scheme == "" {
+		return f.fetchFile(ref, ref, limit)
+	}
+	return Result{}, &BlockedError{URL: ref, Reason: fmt.Sprintf("scheme %q is not supported", u.Scheme)}
+}
+
+// sourceOf names where ref is read from without its path or query, which
+// may carry document IDs or tokens: the scheme and host of a URL, the
+// prefix of a resolver reference such as "gist", or "file".
+func sourceOf(ref string) string {
+	u, err := url.Parse(ref)
+	switch {
+	case err != nil || u.Scheme == "" || u.Scheme == "file":
+		return "file"
+	case u.Host != "":
+		return u.Scheme + "://" + u.Host
+	default:
+		return u.Scheme
+	}
+}
+
+// cachedResponse is a response kept for revalidation.
+type cachedResponse struct {
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"last_modified,omitempty"`
+	ContentType  string `json:"content_type,omitempty"`
+	Body         []byte `json:"body"`
+	Truncated    bool   `json:"truncated,omitempty"`
+}
+
+// do sends a resolved request, revalidating a cached copy when there is one.
+func (f *Fetcher) do(req *http.Request, r Resolver, ref string, limit int64) (Result, error) {
+	if err := f.checkURL(req.URL); err != nil {
+		return Result{}, err
+	}
+	ex, extract := r.(Extractor)
+	readLimit := limit
+	if extract {
+		readLimit = maxExtractBytes
+	}
+
+	// Credentials are part of the key: they come from config, but a cached
+	// body must never be served for a request made with other credentials.
+	key := fmt.Sprintf("fetch\x00%s\x00%s\x00%d", req.URL, req.Header.Get("Authorization"), readLimit)
+	var prev *cachedResponse
+	if f.cache != nil {
+		if b, ok := f.cache.Get(key); ok {
+			var c cachedResponse
+			if json.Unmarshal(b, &c) == nil {
+				prev = &c
+				if c.ETag != "" {
+					req.Header.Set("If-None-Match", c.ETag)
+				}
+				if c.LastModified != "" {
+					req.Header.Set("If-Modified-Since", c.LastModified)
+				}
+			}
+		}
+	}
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return Result{}, err
+	}
+	defer resp.Body.Close() //nolint:errcheck
+	if f.cache != nil {
+		metrics.CacheResult("fetch", resp.StatusCode == http.StatusNotModified && prev != nil)
+	}
+
+	var res Result
+	switch {
+	case resp.StatusCode == http.StatusNotModified && prev != nil:
+		res = Result{Body: prev.Body, ContentType: prev.ContentType, Truncated: prev.Truncated, NotModified: true}
+	case resp.StatusCode >= 300:
+		return Result{}, fmt.Errorf("GET %s: %d", ref, resp.StatusCode)
+	default:
+		ct := resp.Header.Get("Content-Type")
+		if !f.acceptsContentType(ct) {
+			return Result{}, &BlockedError{URL: ref, Reason: fmt.Sprintf("content type %q is not accepted", ct)}
+		}
+		if res, err = readCapped(resp.Body, readLimit); err != nil {
+			return Result{}, err
+		}
+		res.ContentType = ct
+		f.store(key, resp.Header, res)
+	}
+
+	if extract {
+		body, err := ex.Extract(ref, res.Body)
+		if err != nil {
+			return Result{}, fmt.Errorf("fetch %s: %w", ref, err)
+		}
+		res.Body, res.Truncated = body, false
+		if limit > 0 && int64(len(body)) > limit {
+			res.Body, res.Truncated = body[:limit], true
+		}
+	}
+	return res, nil
+}
+
+func (f *Fetcher) store(key string, h http.Header, res Result) {
+	etag, modified := h.Get("ETag"), h.Get("Last-Modified")
+	if f.cache == nil || (etag == "" && modified == "") {
+		return
+	}
+	b, err := json.Marshal(cachedResponse{ETag: etag, LastModified: modified, ContentType: res.ContentType, Body: res.Body, Truncated: res.Truncated})
+	if err == nil {
+		_ = f.cache.Set(key, b) // a full cache only costs a download
+	}
+}
+
+// checkURL applies the scheme and host allowlists.
+func (f *Fetcher) checkURL(u *url.URL) error {
+	scheme := strings.ToLower(u.Scheme)
+	if !contains(f.schemes, scheme) {
+		return &BlockedError{URL: u.String(), Reason: fmt.Sprintf("scheme %q is not allowed", scheme)}
+	}
+	if u.User != nil {
+		return &BlockedError{URL: u.Redacted(), Reason: "credentials in URLs are not allowed"}
+	}
+	if len(f.hosts) > 0 && !matchHost(f.hosts, strings.ToLower(u.Hostname())) {
+		return &BlockedError{URL: u.String(), Reason: fmt.Sprintf("host %q is not allowed", u.Hostname())}
+	}
+	return nil
+}
+
+// checkDial refuses connections to non-public addresses.
+func (f *Fetcher) checkDial(_, address string, _ syscall.RawConn) error {
+	if f.allowPrivate {
+		return nil
+	}
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip, err := netip.ParseAddr(host)
+	if err != nil {
+		return err
+	}
+	if !publicAddr(ip) {
+		return &BlockedError{URL: address, Reason: "address is not public"}
+	}
+	return nil
+}
+
+// reservedPrefixes are non-public ranges the netip predicates miss.
+var reservedPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"), // carrier-grade NAT
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+	netip.MustParsePrefix("240.0.0.0/4"),
+	netip.MustParsePrefix("64:ff9b::/96"), // NAT64 can reach IPv4 private space
+}
+
+func publicAddr(ip netip.Addr) bool {
+	ip = ip.Unmap()
+	if !ip.IsGlobalUnicast() || ip.IsPrivate() || ip.IsLoopback() || ip.IsLinkLocalUnicast() {
+		return false
+	}
+	for _, p := range reservedPrefixes {
+		if p.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// fetchFile reads a local file under the base directory. Symlinks are
+// resolved first, so a link cannot point outside it.
+func (f *Fetcher) fetchFile(rawURL, p string, limit int64) (Result, error) {
+	if f.baseDir == "" {
+		return Result{}, &BlockedError{URL: rawURL, Reason: "local files are disabled"}
+	}
+	base, err := filepath.Abs(f.baseDir)
+	if err == nil {
+		base, err = filepath.EvalSymlinks(base)
+	}
+	if err != nil {
+		return Result{}, fmt.Errorf("fetch base dir: %w", err)
+	}
+	if !filepath.IsAbs(p) {
+		p = filepath.Join(base, p)
+	}
+	resolved, err := filepath.EvalSymlinks(p)
+	if err != nil {
+		return Result{}, err
+	}
+	if rel, err := filepath.Rel(base, resolved); err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return Result{}, &BlockedError{URL: rawURL, Reason: "path is outside the base directory"}
+	}
+	file, err := os.Open(resolved)
+	if err != nil {
+		return Result{}, err
+	}
+	defer file.Close() //nolint:errcheck
+	return readCapped(file, limit)
+}
+
+func (f *Fetcher) acceptsContentType(ct string) bool {
+	if ct == "" || len(f.contentTypes) == 0 {
+		return true
+	}
+	mt, _, err := mime.ParseMediaType(ct)
+	if err != nil {
+		return false
+	}
+	for _, want := range f.contentTypes {
+		want = strings.ToLower(strings.TrimSpace(want))
+		if prefix, ok := strings.CutSuffix(want, "/*"); ok {
+			if strings.HasPrefix(mt, prefix+"/") {
+				return true
+			}
+		} else if mt == want {
+			return true
+		}
+	}
+	return false
+}
+
+// readCapped reads up to limit bytes of r, reading one more to tell whether
+// r held more than that.
+func readCapped(r io.Reader, limit int64) (Result, error) {
+	if limit <= 0 {
+		b, err := io.ReadAll(r)
+		return Result{Body: b}, err
+	}
+	b, err := io.ReadAll(io.LimitReader(r, limit+1))
+	if err != nil {
+		return Result{}, err
+	}
+	if int64(len(b)) > limit {
+		return Result{Body: b[:limit], Truncated: true}, nil
+	}
+	return Result{Body: b}, nil
+}
+
+func matchHost(patterns []string, host string) bool {
+	for _, p := range patterns {
+		p = strings.ToLower(strings.TrimSpace(p))
+		if suffix, ok := strings.CutPrefix(p, "*."); ok {
+			if strings.HasSuffix(host, "."+suffix) {
+				return true
+			}
+		} else if host == p {
+			return true
+		}
+	}
+	return false
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if strings.EqualFold(strings.TrimSpace(v), s) {
+			return true
+		}
+	}
+	return false
+}
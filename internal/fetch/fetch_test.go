@@ -0,0 +1,136 @@
+package fetch
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFetch_CapsSize(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		if _, err := w.Write([]byte(strings.Repeat("x", 200000))); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+	}))
+	defer ts.Close()
+	got, err := New(WithAllowPrivate(true)).Fetch(context.Background(), ts.URL, 1024)
+	if err != nil {
+		t.Fatalf("Fetch: %v", err)
+	}
+	if len(got.Body) != 1024 || !got.Truncated {
+		t.Fatalf("expected 1024 truncated bytes, got %d (truncated=%v)", len(got.Body), got.Truncated)
+	}
+}
+
+func TestFetch_Policy(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/text", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/markdown")
+		w.Write([]byte("ok")) //nolint:errcheck
+	})
+	mux.HandleFunc("/image", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/png")
+		w.Write([]byte("\x89PNG")) //nolint:errcheck
+	})
+	mux.HandleFunc("/loop", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/loop", http.StatusFound)
+	})
+	mux.HandleFunc("/away", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "http://169.254.169.254/latest/meta-data/", http.StatusFound)
+	})
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	trusted := New(WithAllowPrivate(true), WithAllowedHosts("127.0.0.1"))
+	for _, tc := range []struct {
+		name    string
+		f       *Fetcher
+		url     string
+		blocked bool
+	}{
+		{"loopback refused by default", New(), ts.URL + "/text", true},
+		{"metadata address refused", New(), "http://169.254.169.254/latest/meta-data/", true},
+		{"private allowed when configured", trusted, ts.URL + "/text", false},
+		{"scheme not allowed", New(WithSchemes("https")), ts.URL + "/text", true},
+		{"host not allowed", New(WithAllowPrivate(true), WithAllowedHosts("*.example.com")), ts.URL + "/text", true},
+		{"credentials in url", trusted, strings.Replace(ts.URL, "://", "://user:pass@", 1) + "/text", true},
+		{"content type", trusted, ts.URL + "/image", true},
+		{"redirect loop", trusted, ts.URL + "/loop", true},
+		{"redirect to other host", trusted, ts.URL + "/away", true},
+		{"gopher", New(), "gopher://example.com/", true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := tc.f.Fetch(context.Background(), tc.url, 1024)
+			if got := errors.Is(err, ErrBlocked); got != tc.blocked {
+				t.Fatalf("blocked = %v, want %v (err %v)", got, tc.blocked, err)
+			}
+			if !tc.blocked && err != nil {
+				t.Fatalf("Fetch: %v", err)
+			}
+		})
+	}
+}
+
+func TestFetch_LocalFiles(t *testing.T) {
+	dir := t.TempDir()
+	base := filepath.Join(dir, "shared")
+	if err := os.Mkdir(base, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(base, "history.md"), []byte("hello world"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	secret := filepath.Join(dir, "secret.txt")
+	if err := os.WriteFile(secret, []byte("secret"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(secret, filepath.Join(base, "link.txt")); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	if _, err := New().Fetch(ctx, "file://"+filepath.Join(base, "history.md"), 0); !errors.Is(err, ErrBlocked) {
+		t.Fatalf("expected local files to be disabled, got %v", err)
+	}
+	f := New(WithBaseDir(base))
+	for _, u := range []string{"file://" + filepath.Join(base, "history.md"), "history.md"} {
+		got, err := f.Fetch(ctx, u, 0)
+		if err != nil || string(got.Body) != "hello world" {
+			t.Fatalf("Fetch(%q) = %q, %v", u, got.Body, err)
+		}
+	}
+	for _, u := range []string{"../secret.txt", secret, "file:///etc/passwd", "link.txt"} {
+		if _, err := f.Fetch(ctx, u, 0); !errors.Is(err, ErrBlocked) {
+			t.Fatalf("Fetch(%q): expected ErrBlocked, got %v", u, err)
+		}
+	}
+}
+
+func TestPublicAddr(t *testing.T) {
+	for addr, want := range map[string]bool{
+		"8.8.8.8":          true,
+		"2606:4700::1111":  true,
+		"127.0.0.1":        false,
+		"10.1.2.3":         false,
+		"172.16.0.1":       false,
+		"192.168.1.1":      false,
+		"169.254.169.254":  false,
+		"100.64.0.1":       false,
+		"0.0.0.0":          false,
+		"::1":              false,
+		"fd00::1":          false,
+		"fe80::1":          false,
+		"::ffff:127.0.0.1": false,
+	} {
+		if got := publicAddr(netip.MustParseAddr(addr)); got != want {
+			t.Errorf("publicAddr(%s) = %v, want %v", addr, got, want)
+		}
+	}
+}
@@ -0,0 +1,223 @@
+package fetch
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Credential is an Authorization header sent to URLs under Prefix
+// (scheme://host[/path]).
+type Credential struct {
+	Prefix        string
+	Authorization string
+
+	prefix *url.URL
+}
+
+// ParseCredential reads "prefix=bearer:TOKEN" or "prefix=basic:user:pass".
+func ParseCredential(s string) (Credential, error) {
+	prefix, spec, ok := strings.Cut(strings.TrimSpace(s), "=")
+	kind, secret, ok2 := strings.Cut(spec, ":")
+	if !ok || !ok2 || secret == "" {
+		return Credential{}, fmt.Errorf("credential for %q: want prefix=bearer:token or prefix=basic:user:pass", prefix)
+	}
+	u, err := url.Parse(prefix)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return Credential{}, fmt.Errorf("credential prefix %q: want an http(s) URL", prefix)
+	}
+	c := Credential{Prefix: prefix, prefix: u}
+	switch strings.ToLower(kind) {
+	case "bearer":
+		c.Authorization = "Bearer " + secret
+	case "basic":
+		c.Authorization = "Basic " + base64.StdEncoding.EncodeToString([]byte(secret))
+	default:
+		return Credential{}, fmt.Errorf("credential for %q: unknown kind %q", prefix, kind)
+	}
+	return c, nil
+}
+
+// ParseCredentials reads each spec with ParseCredential, skipping blank
+// entries.
+func ParseCredentials(specs []string) ([]Credential, error) {
+	creds := make([]Credential, 0, len(specs))
+	for _, s := range specs {
+		if strings.TrimSpace(s) == "" {
+			continue
+		}
+		c, err := ParseCredential(s)
+		if err != nil {
+			return nil, err
+		}
+		creds = append(creds, c)
+	}
+	return creds, nil
+}
+
+// matches compares scheme and host exactly and the path on segment
+// boundaries, so https://logs.example.com never matches
+// https://logs.example.com.evil.test.
+func (c Credential) matches(u *url.URL) bool {
+	p := c.prefix
+	if p == nil || !strings.EqualFold(p.Scheme, u.Scheme) || !strings.EqualFold(p.Host, u.Host) {
+		return false
+	}
+	dir := strings.TrimSuffix(p.Path, "/")
+	return dir == "" || u.Path == dir || strings.HasPrefix(u.Path, dir+"/")
+}
+
+// HTTP resolves http and https URLs, attaching the credential with the
+// longest matching prefix. Go drops the header on redirects to other hosts.
+type HTTP struct {
+	Credentials []Credential
+}
+
+func (h *HTTP) Resolve(ctx context.Context, ref string) (*http.Request, bool, error) {
+	lower := strings.ToLower(ref)
+	if !strings.HasPrefix(lower, "http://") && !strings.HasPrefix(lower, "https://") {
+		return nil, false, nil
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, ref, nil)
+	if err != nil {
+		return nil, true, err
+	}
+	creds := append([]Credential(nil), h.Credentials...)
+	sort.SliceStable(creds, func(i, j int) bool { return len(creds[i].Prefix) > len(creds[j].Prefix) })
+	for _, c := range creds {
+		if c.matches(req.URL) {
+			req.Header.Set("Authorization", c.Authorization)
+			break
+		}
+	}
+	return req, true, nil
+}
+
+var (
+	gistIDRe  = regexp.MustCompile(`^[0-9A-Za-z]+$`)
+	driveIDRe = regexp.MustCompile(`^[0-9A-Za-z_-]+$`)
+)
+
+// Gist resolves gist:<id> and gist:<id>/<file> through the GitHub API, so
+// secret gists work with a token. A gist with a single file needs no file
+// name.
+type Gist struct {
+	Token string
+	// APIBase is the GitHub API root; empty means https://api.github.com.
+	APIBase string
+}
+
+func (g *Gist) Resolve(ctx context.Context, ref string) (*http.Request, bool, error) {
+	rest, ok := strings.CutPrefix(ref, "gist:")
+	if !ok {
+		return nil, false, nil
+	}
+	id, _, _ := strings.Cut(rest, "/")
+	if !gistIDRe.MatchString(id) {
+		return nil, true, fmt.Errorf("gist reference %q: want gist:<id>/<file>", ref)
+	}
+	base := g.APIBase
+	if base == "" {
+		base = "https://api.github.com"
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(base, "/")+"/gists/"+id, nil)
+	if err != nil {
+		return nil, true, err
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("X-GitHub-Api-Version", "2022-11-28")
+	if g.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+g.Token)
+	}
+	return req, true, nil
+}
+
+// Extract picks the requested file out of the gist.
+func (g *Gist) Extract(ref string, body []byte) ([]byte, error) {
+	var gist struct {
+		Files map[string]struct {
+			Content   string `json:"content"`
+			Truncated bool   `json:"truncated"`
+		} `json:"files"`
+	}
+	if err := json.Unmarshal(body, &gist); err != nil {
+		return nil, fmt.Errorf("decode gist: %w", err)
+	}
+	_, name, _ := strings.Cut(strings.TrimPrefix(ref, "gist:"), "/")
+	if name == "" {
+		if len(gist.Files) != 1 {
+			names := make([]string, 0, len(gist.Files))
+			for n := range gist.Files {
+				names = append(names, n)
+			}
+			sort.Strings(names)
+			return nil, fmt.Errorf("gist has %d files (%s); name one as gist:<id>/<file>", len(names), strings.Join(names, ", "))
+		}
+		for n := range gist.Files {
+			name = n
+		}
+	}
+	file, ok := gist.Files[name]
+	if !ok {
+		return nil, fmt.Errorf("gist has no file %q", name)
+	}
+	if file.Truncated {
+		return nil, fmt.Errorf("gist file %q is too large for the GitHub API", name)
+	}
+	return []byte(file.Content), nil
+}
+
+// GoogleDrive resolves gdoc:<id> (a Google Doc as plain text) and
+// gsheet:<id> (a sheet as CSV). With a token it exports through the Drive
+// API; without one the file must be shared with anyone who has the link.
+type GoogleDrive struct {
+	Token string
+	// APIBase and DocsBase default to https://www.googleapis.com and
+	// https://docs.google.com.
+	APIBase  string
+	DocsBase string
+}
+
+func (g *GoogleDrive) Resolve(ctx context.Context, ref string) (*http.Request, bool, error) {
+	var kind, mimeType, format string
+	id, ok := strings.CutPrefix(ref, "gdoc:")
+	if ok {
+		kind, mimeType, format = "document", "text/plain", "txt"
+	} else if id, ok = strings.CutPrefix(ref, "gsheet:"); ok {
+		kind, mimeType, format = "spreadsheets", "text/csv", "csv"
+	} else {
+		return nil, false, nil
+	}
+	if !driveIDRe.MatchString(id) {
+		return nil, true, fmt.Errorf("google drive reference %q: want gdoc:<id> or gsheet:<id>", ref)
+	}
+
+	var u string
+	if g.Token != "" {
+		base := g.APIBase
+		if base == "" {
+			base = "https://www.googleapis.com"
+		}
+		u = strings.TrimSuffix(base, "/") + "/drive/v3/files/" + id + "/export?mimeType=" + url.QueryEscape(mimeType)
+	} else {
+		base := g.DocsBase
+		if base == "" {
+			base = "https://docs.google.com"
+		}
+		u = strings.TrimSuffix(base, "/") + "/" + kind + "/d/" + id + "/export?format=" + format
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, true, err
+	}
+	if g.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+g.Token)
+	}
+	return req, true, nil
+}
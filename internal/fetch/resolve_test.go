@@ -0,0 +1,149 @@
+package fetch
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aaronromeo/swolegen/internal/cache"
+)
+
+func TestGist(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer ghp_test" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		switch r.URL.Path {
+		case "/gists/abc123":
+			w.Write([]byte(`{"files":{"history.md":{"content":"2025-08-01 squat 225x5"},"notes.md":{"content":"notes"}}}`)) //nolint:errcheck
+		case "/gists/one":
+			w.Write([]byte(`{"files":{"rules.md":{"content":"no deadlifts"}}}`)) //nolint:errcheck
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	f := New(WithAllowPrivate(true), WithResolvers(&Gist{Token: "ghp_test", APIBase: ts.URL}))
+	ctx := context.Background()
+	for ref, want := range map[string]string{
+		"gist:abc123/history.md": "2025-08-01 squat 225x5",
+		"gist:one":               "no deadlifts",
+	} {
+		got, err := f.Fetch(ctx, ref, 0)
+		if err != nil || string(got.Body) != want {
+			t.Fatalf("Fetch(%q) = %q, %v; want %q", ref, got.Body, err, want)
+		}
+	}
+	got, err := f.Fetch(ctx, "gist:abc123/history.md", 10)
+	if err != nil || string(got.Body) != "2025-08-01" || !got.Truncated {
+		t.Fatalf("expected the extracted file cut to the limit, got %q (truncated=%v), %v", got.Body, got.Truncated, err)
+	}
+	for _, ref := range []string{"gist:abc123", "gist:abc123/missing.md", "gist:../../user"} {
+		if _, err := f.Fetch(ctx, ref, 0); err == nil {
+			t.Fatalf("Fetch(%q): expected an error", ref)
+		}
+	}
+}
+
+func TestHTTPCredentials(t *testing.T) {
+	var gotAuth string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotAuth = r.Header.Get("Authorization")
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte("ok")) //nolint:errcheck
+	}))
+	defer ts.Close()
+
+	team, err := ParseCredential(ts.URL + "/team=bearer:team-token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	site, err := ParseCredential(ts.URL + "=basic:user:pa:ss")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := New(WithAllowPrivate(true), WithResolvers(&HTTP{Credentials: []Credential{site, team}}))
+	for path, want := range map[string]string{
+		"/team/log.md":  "Bearer team-token",
+		"/teammates.md": "Basic dXNlcjpwYTpzcw==",
+		"/other.md":     "Basic dXNlcjpwYTpzcw==",
+	} {
+		if _, err := f.Fetch(context.Background(), ts.URL+path, 0); err != nil {
+			t.Fatalf("Fetch(%s): %v", path, err)
+		}
+		if gotAuth != want {
+			t.Fatalf("%s: Authorization %q, want %q", path, gotAuth, want)
+		}
+	}
+
+	// A lookalike host gets nothing.
+	h := &HTTP{Credentials: []Credential{team}}
+	req, _, err := h.Resolve(context.Background(), strings.Replace(ts.URL, "127.0.0.1", "127.0.0.1.evil.test", 1)+"/team/log.md")
+	if err != nil || req.Header.Get("Authorization") != "" {
+		t.Fatalf("expected no credentials for another host, got %q, %v", req.Header.Get("Authorization"), err)
+	}
+
+	for _, bad := range []string{"https://x.example.com", "ftp://x=bearer:t", "https://x.example.com=token:t", "https://x.example.com=bearer:"} {
+		if _, err := ParseCredential(bad); err == nil {
+			t.Fatalf("ParseCredential(%q): expected an error", bad)
+		}
+	}
+	if creds, err := ParseCredentials([]string{"", ts.URL + "=bearer:t", " "}); err != nil || len(creds) != 1 {
+		t.Fatalf("ParseCredentials = %v, %v; want one credential", creds, err)
+	}
+	if _, err := ParseCredentials([]string{"https://x.example.com=token:t"}); err == nil {
+		t.Fatal("ParseCredentials: expected an error")
+	}
+}
+
+func TestGoogleDrive(t *testing.T) {
+	g := &GoogleDrive{}
+	req, ok, err := g.Resolve(context.Background(), "gsheet:1AbC_d-9")
+	if err != nil || !ok || req.URL.String() != "https://docs.google.com/spreadsheets/d/1AbC_d-9/export?format=csv" {
+		t.Fatalf("unexpected public export request %v, %v, %v", req, ok, err)
+	}
+	g.Token = "ya29.test"
+	req, _, err = g.Resolve(context.Background(), "gdoc:1AbC_d-9")
+	if err != nil || req.URL.String() != "https://www.googleapis.com/drive/v3/files/1AbC_d-9/export?mimeType=text%2Fplain" ||
+		req.Header.Get("Authorization") != "Bearer ya29.test" {
+		t.Fatalf("unexpected Drive API request %v, %v", req, err)
+	}
+	if _, ok, err := g.Resolve(context.Background(), "gdoc:../x"); !ok || err == nil {
+		t.Fatalf("expected an invalid id error")
+	}
+}
+
+func TestFetch_RevalidatesCachedResponses(t *testing.T) {
+	downloads := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", `"v1"`)
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		downloads++
+		w.Header().Set("Content-Type", "text/csv")
+		w.Write([]byte("date,exercise\n2025-08-01,squat\n")) //nolint:errcheck
+	}))
+	defer ts.Close()
+
+	f := New(WithAllowPrivate(true), WithCache(cache.NewMemory(1<<20, time.Hour)))
+	for i := 0; i < 3; i++ {
+		got, err := f.Fetch(context.Background(), ts.URL, 0)
+		if err != nil || string(got.Body) != "date,exercise\n2025-08-01,squat\n" {
+			t.Fatalf("fetch %d: %q, %v", i, got.Body, err)
+		}
+		if got.NotModified != (i > 0) {
+			t.Fatalf("fetch %d: NotModified = %v", i, got.NotModified)
+		}
+	}
+	if downloads != 1 {
+		t.Fatalf("expected one download, got %d", downloads)
+	}
+}
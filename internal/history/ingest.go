@@ -1,14 +1,8 @@
 package history
 
 import (
-	"context"
-	"errors"
-	"io"
-	"net/http"
 	"regexp"
 	"strings"
-
-	"github.com/hashicorp/go-retryablehttp"
 )
 
 var lineRx = regexp.MustCompile(`(?i)^(\d{4}-\d{2}-\d{2}).*?([A-Za-z][A-Za-z0-9 \-/()]+).*?(\d+(?:\.\d+)?).*?(\d{1,2})\s*reps?`)
@@ -24,20 +18,6 @@ type DomainHistory struct {
 	Entries []Entry
 }
 
-func FetchURL(ctx context.Context, url string) ([]byte, error) {
-	c := retryablehttp.NewClient()
-	req, _ := retryablehttp.NewRequestWithContext(ctx, http.MethodGet, url, nil)
-	resp, err := c.Do(req)
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-	if resp.StatusCode >= 300 {
-		return nil, errors.New("bad status")
-	}
-	return io.ReadAll(resp.Body)
-}
-
 func ParseHistoryMarkdown(raw []byte) (DomainHistory, error) {
 	var h DomainHistory
 	for _, ln := range strings.Split(string(raw), "\n") {
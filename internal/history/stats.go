@@ -0,0 +1,96 @@
+package history
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/aaronromeo/swolegen/internal/store"
+)
+
+// ExerciseStats summarizes the logged history of one exercise. Loads are in
+// whatever units the sets were logged in.
+type ExerciseStats struct {
+	Exercise  string `json:"exercise"`
+	Sessions  int    `json:"sessions"`
+	Sets      int    `json:"sets"`
+	FirstDate string `json:"first_date"`
+	LastDate  string `json:"last_date"`
+	// BestLoad is the heaviest load lifted, with the reps done at it.
+	BestLoad     float64 `json:"best_load"`
+	BestLoadReps int     `json:"best_load_reps"`
+	// BestE1RM is the best estimated one-rep max (Epley).
+	BestE1RM float64 `json:"best_e1rm"`
+	Volume   float64 `json:"volume"`
+}
+
+// FromSets converts logged sets into the domain history shape so stored and
+// markdown history can be summarized the same way.
+func FromSets(sets []store.LoggedSet) DomainHistory {
+	var h DomainHistory
+	for _, s := range sets {
+		e := Entry{Date: s.Date, Exercise: s.Exercise}
+		if s.ActualWeight != nil {
+			e.LoadRaw = strconv.FormatFloat(*s.ActualWeight, 'f', -1, 64)
+		}
+		if s.ActualReps != nil {
+			e.RepsRaw = strconv.Itoa(*s.ActualReps)
+		}
+		h.Entries = append(h.Entries, e)
+	}
+	return h
+}
+
+// Stats groups entries by exercise (case-insensitively) and returns one
+// summary per exercise, ordered by name. Entries whose load or reps do not
+// parse still count as sets.
+func Stats(h DomainHistory) []ExerciseStats {
+	byKey := map[string]*ExerciseStats{}
+	dates := map[string]map[string]bool{}
+	for _, e := range h.Entries {
+		name := strings.TrimSpace(e.Exercise)
+		if name == "" {
+			continue
+		}
+		key := strings.ToLower(name)
+		st, ok := byKey[key]
+		if !ok {
+			st = &ExerciseStats{Exercise: name}
+			byKey[key] = st
+			dates[key] = map[string]bool{}
+		}
+		st.Sets++
+		if e.Date != "" {
+			dates[key][e.Date] = true
+			if st.FirstDate == "" || e.Date < st.FirstDate {
+				st.FirstDate = e.Date
+			}
+			if e.Date > st.LastDate {
+				st.LastDate = e.Date
+			}
+		}
+
+		load, lerr := strconv.ParseFloat(strings.TrimSpace(e.LoadRaw), 64)
+		reps, rerr := strconv.Atoi(strings.TrimSpace(e.RepsRaw))
+		if lerr != nil || rerr != nil || reps <= 0 {
+			continue
+		}
+		if load > st.BestLoad || (load == st.BestLoad && reps > st.BestLoadReps) {
+			st.BestLoad, st.BestLoadReps = load, reps
+		}
+		if e1rm := load * (1 + float64(reps)/30); e1rm > st.BestE1RM {
+			st.BestE1RM = e1rm
+		}
+		st.Volume += load * float64(reps)
+	}
+
+	out := make([]ExerciseStats, 0, len(byKey))
+	for key, st := range byKey {
+		st.Sessions = len(dates[key])
+		out = append(out, *st)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return strings.ToLower(out[i].Exercise) < strings.ToLower(out[j].Exercise)
+	})
+	return out
+}
@@ -0,0 +1,50 @@
+package history
+
+import (
+	"math"
+	"testing"
+
+	"github.com/aaronromeo/swolegen/internal/store"
+)
+
+func TestStats(t *testing.T) {
+	md := []byte(`2025-08-01 Bench Press: 185 x 5 reps
+2025-08-01 Bench Press: 195 x 3 reps
+2025-08-05 bench press: 195 x 4 reps
+2025-08-05 Pull-up: 0 x 8 reps
+not a set line
+`)
+	h, err := ParseHistoryMarkdown(md)
+	if err != nil {
+		t.Fatalf("ParseHistoryMarkdown: %v", err)
+	}
+	stats := Stats(h)
+	if len(stats) != 2 {
+		t.Fatalf("expected 2 exercises, got %+v", stats)
+	}
+	bench := stats[0]
+	if bench.Exercise != "Bench Press" || bench.Sets != 3 || bench.Sessions != 2 {
+		t.Fatalf("unexpected bench stats: %+v", bench)
+	}
+	if bench.FirstDate != "2025-08-01" || bench.LastDate != "2025-08-05" {
+		t.Fatalf("unexpected date range: %+v", bench)
+	}
+	if bench.BestLoad != 195 || bench.BestLoadReps != 4 {
+		t.Fatalf("expected best 195x4, got %gx%d", bench.BestLoad, bench.BestLoadReps)
+	}
+	if want := 195 * (1 + 4.0/30); math.Abs(bench.BestE1RM-want) > 1e-9 {
+		t.Fatalf("expected e1rm %g, got %g", want, bench.BestE1RM)
+	}
+}
+
+func TestFromSets(t *testing.T) {
+	w, r := 100.0, 8
+	h := FromSets([]store.LoggedSet{
+		{Date: "2025-08-09", Exercise: "Goblet Squat", ActualWeight: &w, ActualReps: &r},
+		{Date: "2025-08-09", Exercise: "Goblet Squat"},
+	})
+	stats := Stats(h)
+	if len(stats) != 1 || stats[0].Sets != 2 || stats[0].Volume != 800 {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+}
@@ -0,0 +1,120 @@
+package httpapi
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/aaronromeo/swolegen/internal/auth"
+	"github.com/aaronromeo/swolegen/internal/logging"
+	"github.com/aaronromeo/swolegen/internal/store"
+	"github.com/gofiber/fiber/v2"
+)
+
+// headerAPIKey carries the caller's key. Authorization is left to the Strava
+// routes, which take the caller's Strava access token there.
+const headerAPIKey = "X-API-Key"
+
+// localAPIKey holds the authenticated store.APIKey in fiber.Ctx locals.
+const localAPIKey = "api_key"
+
+// requireAPIKey authenticates X-API-Key and scopes the request's context to
+// the key's user, so store calls made with c.UserContext() see only that
+// user's data. Without required, requests that send no key run as
+// store.DefaultUser; a key that is sent is still checked.
+func requireAPIKey(st store.Store, logger *slog.Logger, required bool) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		plain := c.Get(headerAPIKey)
+		if plain == "" {
+			if required {
+				return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "missing " + headerAPIKey})
+			}
+			c.SetUserContext(store.WithUser(c.UserContext(), store.DefaultUser))
+			return c.Next()
+		}
+		k, err := auth.Authenticate(c.UserContext(), st, plain)
+		if errors.Is(err, auth.ErrInvalidKey) {
+			return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "invalid api key"})
+		}
+		if err != nil {
+			reqLogger(c, logger).Error("authenticate api key", "error", err)
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "authentication failed"})
+		}
+		c.Locals(localAPIKey, k)
+		ctx := logging.WithLogger(c.UserContext(), reqLogger(c, logger).With("user", k.User))
+		c.SetUserContext(store.WithUser(ctx, k.User))
+		return c.Next()
+	}
+}
+
+// isAdmin reports whether the request was made with an admin key.
+func isAdmin(c *fiber.Ctx) bool {
+	k, ok := c.Locals(localAPIKey).(store.APIKey)
+	return ok && k.Admin
+}
+
+// apiKeyView is an API key as the admin routes return it: never the hash.
+type apiKeyView struct {
+	store.APIKey
+	Hash string `json:"hash,omitempty"`
+	Key  string `json:"key,omitempty"`
+}
+
+// registerAdmin mounts key management under /v1/admin. Every route needs an
+// admin key, even when AuthRequired is off.
+func registerAdmin(app *fiber.App, st store.Store, logger *slog.Logger) {
+	admin := app.Group("/v1/admin", func(c *fiber.Ctx) error {
+		if !isAdmin(c) {
+			return c.Status(http.StatusForbidden).JSON(fiber.Map{"error": "admin api key required"})
+		}
+		return c.Next()
+	})
+
+	admin.Get("/keys", func(c *fiber.Ctx) error {
+		keys, err := st.ListAPIKeys(c.UserContext())
+		if err != nil {
+			reqLogger(c, logger).Error("list api keys", "error", err)
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+		views := make([]apiKeyView, 0, len(keys))
+		for _, k := range keys {
+			views = append(views, apiKeyView{APIKey: k})
+		}
+		return c.JSON(fiber.Map{"keys": views})
+	})
+
+	// The plaintext key is in this response only; it cannot be shown again.
+	admin.Post("/keys", func(c *fiber.Ctx) error {
+		var req struct {
+			User  string `json:"user"`
+			Name  string `json:"name"`
+			Admin bool   `json:"admin"`
+		}
+		if err := c.BodyParser(&req); err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid json: " + err.Error()})
+		}
+		if err := store.ValidateUser(req.User); err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		}
+		k, plain, err := auth.Issue(c.UserContext(), st, req.User, req.Name, req.Admin)
+		if err != nil {
+			reqLogger(c, logger).Error("issue api key", "error", err)
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+		reqLogger(c, logger).Info("issued api key", "id", k.ID, "user", k.User, "admin", k.Admin)
+		return c.Status(http.StatusCreated).JSON(apiKeyView{APIKey: k, Key: plain})
+	})
+
+	admin.Delete("/keys/:id", func(c *fiber.Ctx) error {
+		k, err := auth.Revoke(c.UserContext(), st, c.Params("id"))
+		if errors.Is(err, store.ErrNotFound) {
+			return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "api key not found"})
+		}
+		if err != nil {
+			reqLogger(c, logger).Error("revoke api key", "error", err)
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+		reqLogger(c, logger).Info("revoked api key", "id", k.ID, "user", k.User)
+		return c.JSON(apiKeyView{APIKey: k})
+	})
+}
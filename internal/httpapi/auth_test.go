@@ -0,0 +1,257 @@
+package httpapi
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aaronromeo/swolegen/internal/auth"
+	"github.com/aaronromeo/swolegen/internal/config"
+	"github.com/aaronromeo/swolegen/internal/store"
+	"github.com/aaronromeo/swolegen/internal/strava"
+	"github.com/gofiber/fiber/v2"
+)
+
+// newAuthApp mounts the workout, job, location, Strava and admin routes
+// behind requireAPIKey and issues keys for alice, bob and an admin.
+func newAuthApp(t *testing.T, required bool) (app *fiber.App, st store.Store, keys map[string]string) {
+	t.Helper()
+	st = store.NewMemory()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	app = fiber.New()
+	app.Use("/v1", requireAPIKey(st, logger, required))
+	app.Use("/strava", requireAPIKey(st, logger, required))
+	registerWorkouts(app, st, logger)
+	registerLocations(app, st, logger)
+	registerStravaOAuth(app, &config.Config{}, st, logger, llmDeps{})
+	mgr := registerJobs(app, &config.Config{JobWorkers: 1, JobQueueSize: 4}, logger, st, llmDeps{})
+	t.Cleanup(mgr.Close)
+	registerAdmin(app, st, logger)
+
+	keys = map[string]string{}
+	for _, u := range []struct {
+		user  string
+		admin bool
+	}{{"alice", false}, {"bob", false}, {"ops", true}} {
+		_, plain, err := auth.Issue(context.Background(), st, u.user, "", u.admin)
+		if err != nil {
+			t.Fatalf("Issue: %v", err)
+		}
+		keys[u.user] = plain
+	}
+	return app, st, keys
+}
+
+func doAs(t *testing.T, app *fiber.App, key, method, path, body string) *http.Response {
+	t.Helper()
+	var r io.Reader
+	if body != "" {
+		r = strings.NewReader(body)
+	}
+	req := httptest.NewRequest(method, path, r)
+	req.Header.Set("Content-Type", "application/json")
+	if key != "" {
+		req.Header.Set(headerAPIKey, key)
+	}
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatalf("app.Test error: %v", err)
+	}
+	t.Cleanup(func() { resp.Body.Close() }) //nolint:errcheck
+	return resp
+}
+
+func TestRequireAPIKey(t *testing.T) {
+	app, st, keys := newAuthApp(t, true)
+	ctx := store.WithUser(context.Background(), "alice")
+	if err := st.PutWorkout(ctx, store.Workout{ID: "2025-08-09-home-01", Date: "2025-08-09", Location: "home"}); err != nil {
+		t.Fatalf("PutWorkout: %v", err)
+	}
+
+	for _, key := range []string{"", "sg_nope_nope", keys["alice"] + "x"} {
+		if resp := doAs(t, app, key, "GET", "/v1/workouts", ""); resp.StatusCode != http.StatusUnauthorized {
+			t.Errorf("key %q: expected 401, got %d", key, resp.StatusCode)
+		}
+	}
+	if resp := doAs(t, app, keys["alice"], "GET", "/v1/workouts/2025-08-09-home-01", ""); resp.StatusCode != http.StatusOK {
+		t.Fatalf("alice: expected 200, got %d", resp.StatusCode)
+	}
+
+	// Bob can neither see nor delete alice's workout.
+	if resp := doAs(t, app, keys["bob"], "GET", "/v1/workouts/2025-08-09-home-01", ""); resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("bob: expected 404, got %d", resp.StatusCode)
+	}
+	if resp := doAs(t, app, keys["bob"], "DELETE", "/v1/workouts/2025-08-09-home-01", ""); resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("bob delete: expected 404, got %d", resp.StatusCode)
+	}
+	if _, err := st.GetWorkout(ctx, "2025-08-09-home-01"); err != nil {
+		t.Fatalf("alice's workout is gone: %v", err)
+	}
+
+	t.Run("jobs are private", func(t *testing.T) {
+		useFakeLLM(t, true)
+		resp := doAs(t, app, keys["alice"], "POST", "/v1/jobs", `{"location":"home","duration_minutes":45}`)
+		if resp.StatusCode != http.StatusAccepted {
+			t.Fatalf("expected 202, got %d", resp.StatusCode)
+		}
+		var job struct {
+			ID string `json:"id"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&job); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		if resp := doAs(t, app, keys["bob"], "DELETE", "/v1/jobs/"+job.ID, ""); resp.StatusCode != http.StatusNotFound {
+			t.Fatalf("bob cancel: expected 404, got %d", resp.StatusCode)
+		}
+		if resp := doAs(t, app, keys["alice"], "DELETE", "/v1/jobs/"+job.ID, ""); resp.StatusCode != http.StatusAccepted {
+			t.Fatalf("alice cancel: expected 202, got %d", resp.StatusCode)
+		}
+	})
+
+	t.Run("locations are private", func(t *testing.T) {
+		if resp := doAs(t, app, keys["alice"], "PUT", "/v1/locations/home", `{"equipment":["barbell"]}`); resp.StatusCode != http.StatusOK {
+			t.Fatalf("alice put: expected 200, got %d", resp.StatusCode)
+		}
+		if resp := doAs(t, app, keys["bob"], "GET", "/v1/locations/home", ""); resp.StatusCode != http.StatusNotFound {
+			t.Fatalf("bob get: expected 404, got %d", resp.StatusCode)
+		}
+		resp := doAs(t, app, keys["bob"], "GET", "/v1/locations", "")
+		body, _ := io.ReadAll(resp.Body)
+		if resp.StatusCode != http.StatusOK || strings.Contains(string(body), "barbell") {
+			t.Fatalf("bob list: %d %s", resp.StatusCode, body)
+		}
+		if resp := doAs(t, app, keys["bob"], "DELETE", "/v1/locations/home", ""); resp.StatusCode != http.StatusNotFound {
+			t.Fatalf("bob delete: expected 404, got %d", resp.StatusCode)
+		}
+		l, err := st.GetLocation(ctx, "home")
+		if err != nil || len(l.Equipment) != 1 || l.Equipment[0] != "barbell" {
+			t.Fatalf("alice's location = %+v, %v", l, err)
+		}
+	})
+
+	t.Run("strava tokens are private", func(t *testing.T) {
+		var used []string
+		saved := newStravaClient
+		newStravaClient = func(ts strava.TokenSource, _ config.StravaConfig) stravaClient {
+			tok, err := ts.Current(context.Background())
+			if err != nil {
+				t.Fatalf("Current: %v", err)
+			}
+			used = append(used, tok.AccessToken)
+			return fakeStravaClient{}
+		}
+		t.Cleanup(func() { newStravaClient = saved })
+
+		expires := time.Now().Add(time.Hour).Unix()
+		if err := st.PutStravaToken(ctx, store.StravaToken{AccessToken: "alice-token", RefreshToken: "r", ExpiresAt: expires}); err != nil {
+			t.Fatalf("PutStravaToken: %v", err)
+		}
+		if resp := doAs(t, app, keys["alice"], "GET", "/strava/recent", ""); resp.StatusCode != http.StatusOK {
+			t.Fatalf("alice: expected 200, got %d", resp.StatusCode)
+		}
+		if resp := doAs(t, app, keys["bob"], "GET", "/strava/recent", ""); resp.StatusCode != http.StatusUnauthorized {
+			t.Fatalf("bob: expected 401, got %d", resp.StatusCode)
+		}
+		if resp := doAs(t, app, keys["bob"], "DELETE", "/v1/strava/token", ""); resp.StatusCode != http.StatusNotFound {
+			t.Fatalf("bob delete: expected 404, got %d", resp.StatusCode)
+		}
+		if len(used) != 1 || used[0] != "alice-token" {
+			t.Fatalf("tokens used = %v; want only alice's", used)
+		}
+	})
+
+	t.Run("single user mode", func(t *testing.T) {
+		app, st, keys := newAuthApp(t, false)
+		if err := st.PutWorkout(context.Background(), store.Workout{ID: "2025-08-09-home-02", Date: "2025-08-09"}); err != nil {
+			t.Fatalf("PutWorkout: %v", err)
+		}
+		if resp := doAs(t, app, "", "GET", "/v1/workouts/2025-08-09-home-02", ""); resp.StatusCode != http.StatusOK {
+			t.Fatalf("no key: expected 200, got %d", resp.StatusCode)
+		}
+		if resp := doAs(t, app, keys["alice"]+"x", "GET", "/v1/workouts", ""); resp.StatusCode != http.StatusUnauthorized {
+			t.Fatalf("bad key: expected 401, got %d", resp.StatusCode)
+		}
+	})
+}
+
+func TestAdminKeys(t *testing.T) {
+	app, _, keys := newAuthApp(t, true)
+
+	if resp := doAs(t, app, keys["alice"], "GET", "/v1/admin/keys", ""); resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("non-admin: expected 403, got %d", resp.StatusCode)
+	}
+
+	resp := doAs(t, app, keys["ops"], "POST", "/v1/admin/keys", `{"user":"carol","name":"phone"}`)
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("issue: expected 201, got %d", resp.StatusCode)
+	}
+	var issued apiKeyView
+	if err := json.NewDecoder(resp.Body).Decode(&issued); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if issued.Key == "" || issued.User != "carol" || issued.Hash != "" {
+		t.Fatalf("issued = %+v; want carol's plaintext key and no hash", issued)
+	}
+	if resp := doAs(t, app, issued.Key, "GET", "/v1/workouts", ""); resp.StatusCode != http.StatusOK {
+		t.Fatalf("new key: expected 200, got %d", resp.StatusCode)
+	}
+
+	resp = doAs(t, app, keys["ops"], "GET", "/v1/admin/keys", "")
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK || strings.Contains(string(body), `"hash"`) || !strings.Contains(string(body), `"carol"`) {
+		t.Fatalf("list: %d %s", resp.StatusCode, body)
+	}
+
+	if resp := doAs(t, app, keys["ops"], "DELETE", "/v1/admin/keys/"+issued.ID, ""); resp.StatusCode != http.StatusOK {
+		t.Fatalf("revoke: expected 200, got %d", resp.StatusCode)
+	}
+	if resp := doAs(t, app, issued.Key, "GET", "/v1/workouts", ""); resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("revoked key: expected 401, got %d", resp.StatusCode)
+	}
+	if resp := doAs(t, app, keys["ops"], "DELETE", "/v1/admin/keys/missing", ""); resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("revoke missing: expected 404, got %d", resp.StatusCode)
+	}
+}
+
+func TestNewServer_AdminKeyBootstrap(t *testing.T) {
+	// A default install keeps its store in memory, where no key can be
+	// issued from outside; it needs AUTH_ADMIN_KEY to let anyone in.
+	t.Setenv("OPENAI_API_KEY", "sk-test")
+	t.Setenv("STORE_PATH", "")
+	t.Setenv("AUTH_REQUIRED", "")
+	t.Setenv("AUTH_ADMIN_KEY", "")
+	if _, err := config.Load(""); err == nil || !strings.Contains(err.Error(), "AUTH_ADMIN_KEY") {
+		t.Fatalf("Load without a way to get a key = %v; want an AUTH_REQUIRED error", err)
+	}
+	const adminKey = "sg_boot_0123456789abcdef"
+	t.Setenv("AUTH_ADMIN_KEY", adminKey)
+	cfg, err := config.Load("")
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	app, err := NewServer(cfg, slog.New(slog.NewTextHandler(io.Discard, nil)), store.NewMemory())
+	if err != nil {
+		t.Fatalf("NewServer: %v", err)
+	}
+
+	if resp := doAs(t, app, "", "GET", "/v1/workouts", ""); resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("no key: expected 401, got %d", resp.StatusCode)
+	}
+	resp := doAs(t, app, adminKey, "POST", "/v1/admin/keys", `{"user":"alice"}`)
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("issue with the bootstrap key: expected 201, got %d", resp.StatusCode)
+	}
+	var issued apiKeyView
+	if err := json.NewDecoder(resp.Body).Decode(&issued); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if resp := doAs(t, app, issued.Key, "GET", "/v1/workouts", ""); resp.StatusCode != http.StatusOK {
+		t.Fatalf("issued key: expected 200, got %d", resp.StatusCode)
+	}
+}
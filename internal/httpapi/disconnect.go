@@ -0,0 +1,44 @@
+package httpapi
+
+import (
+	"context"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// disconnectPoll is how often a running request checks whether its client
+// is still connected.
+const disconnectPoll = 250 * time.Millisecond
+
+// requestContext returns the request's context, also canceled once the
+// client disconnects. Fiber never cancels c.UserContext() itself, so without
+// this an abandoned request keeps its LLM calls running to the stage
+// deadline. Cancel it when the handler returns.
+//
+// A closed read side is only a disconnect on keep-alive requests: clients
+// that ask to close the connection may legitimately shut down their write
+// side and wait for the response, so for them only a reset counts, and an
+// abandoned request runs to its deadline. Browsers, fetch and proxies that
+// speak HTTP/1.1 upstream keep connections alive.
+func requestContext(c *fiber.Ctx) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(c.UserContext())
+	conn := c.Context().Conn()
+	keepAlive := c.Context().Request.Header.IsHTTP11() && !c.Context().Request.Header.ConnectionClose()
+	go func() {
+		ticker := time.NewTicker(disconnectPoll)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if peerClosed(conn, keepAlive) {
+					cancel()
+					return
+				}
+			}
+		}
+	}()
+	return ctx, cancel
+}
@@ -0,0 +1,9 @@
+//go:build !unix
+
+package httpapi
+
+import "net"
+
+// peerClosed cannot detect a hang-up on this platform; requests run to their
+// stage deadlines.
+func peerClosed(net.Conn, bool) bool { return false }
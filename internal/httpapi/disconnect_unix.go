@@ -0,0 +1,32 @@
+//go:build unix
+
+package httpapi
+
+import (
+	"errors"
+	"net"
+	"syscall"
+)
+
+// peerClosed reports whether the other end of conn has hung up: reset the
+// connection, or, when eofCloses, shut down its write side, which a
+// half-closing client also does while it waits for the response. It peeks
+// without blocking, so pipelined request bytes are left for the server.
+func peerClosed(conn net.Conn, eofCloses bool) bool {
+	sc, ok := conn.(syscall.Conn)
+	if !ok {
+		return false
+	}
+	raw, err := sc.SyscallConn()
+	if err != nil {
+		return false
+	}
+	closed := false
+	err = raw.Read(func(fd uintptr) bool {
+		var b [1]byte
+		n, _, err := syscall.Recvfrom(int(fd), b[:], syscall.MSG_PEEK|syscall.MSG_DONTWAIT)
+		closed = (eofCloses && n == 0 && err == nil) || errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.EPIPE)
+		return true
+	})
+	return err == nil && closed
+}
@@ -0,0 +1,189 @@
+package httpapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/aaronromeo/swolegen/internal/config"
+	"github.com/aaronromeo/swolegen/internal/jobs"
+	"github.com/aaronromeo/swolegen/internal/llm"
+	"github.com/aaronromeo/swolegen/internal/llm/schemas"
+	"github.com/aaronromeo/swolegen/internal/logging"
+	"github.com/aaronromeo/swolegen/internal/store"
+	"github.com/aaronromeo/swolegen/internal/tracing"
+	"github.com/gofiber/fiber/v2"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// planJobResult is the result of a finished analyze+generate job.
+type planJobResult struct {
+	WorkoutID     string                 `json:"workout_id,omitempty"`
+	Seed          string                 `json:"seed"`
+	InputsHash    string                 `json:"inputs_hash"`
+	Plan          schemas.AnalyzerV1Json `json:"plan"`
+	WorkoutYAML   string                 `json:"workout_yaml"`
+	PromptVersion string                 `json:"prompt_version"`
+	Warnings      []llm.Warning          `json:"warnings,omitempty"`
+	Usage         llm.Usage              `json:"usage"`
+}
+
+// registerJobs mounts the async job endpoints and returns the manager so the
+// caller can stop its workers on shutdown.
+func registerJobs(app *fiber.App, cfg *config.Config, logger *slog.Logger, st store.Store, deps llmDeps) *jobs.Manager {
+	mgr := jobs.NewManager(
+		jobs.WithWorkers(cfg.JobWorkers),
+		jobs.WithQueueSize(cfg.JobQueueSize),
+	)
+
+	app.Post("/v1/jobs", func(c *fiber.Ctx) error {
+		var in llm.AnalyzerInputs
+		if err := json.Unmarshal(c.Body(), &in); err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid json: " + err.Error()})
+		}
+		if err := fillEquipment(c.UserContext(), st, &in); err != nil {
+			reqLogger(c, logger).Error("get location", "error", err)
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+		opts, err := requestOptions(c, deps)
+		if err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		}
+		user := store.UserFrom(c.UserContext())
+		// The job's run outlives this request, so it releases the budget hold.
+		release := takeBudgetHold(c)
+		job, err := mgr.SubmitAs(user, planJob(detach(c.UserContext()), cfg, st, deps, opts, in, release))
+		if err != nil {
+			release()
+		}
+		if errors.Is(err, jobs.ErrQueueFull) || errors.Is(err, jobs.ErrClosed) {
+			return c.Status(http.StatusServiceUnavailable).JSON(fiber.Map{"error": err.Error()})
+		}
+		if err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+		c.Location("/v1/jobs/" + job.ID)
+		return c.Status(http.StatusAccepted).JSON(job)
+	})
+
+	app.Get("/v1/jobs/:id", func(c *fiber.Ctx) error {
+		job, err := ownJob(c, mgr)
+		if errors.Is(err, jobs.ErrNotFound) {
+			return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "job not found"})
+		}
+		return c.JSON(job)
+	})
+
+	app.Delete("/v1/jobs/:id", func(c *fiber.Ctx) error {
+		if _, err := ownJob(c, mgr); err != nil {
+			return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "job not found"})
+		}
+		job, err := mgr.Cancel(c.Params("id"))
+		if errors.Is(err, jobs.ErrNotFound) {
+			return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "job not found"})
+		}
+		return c.Status(http.StatusAccepted).JSON(job)
+	})
+
+	// Server-sent events: each state transition is one event whose id is its
+	// sequence number, so a reconnecting EventSource resumes via Last-Event-ID.
+	// The stream ends after the terminal event.
+	app.Get("/v1/jobs/:id/events", func(c *fiber.Ctx) error {
+		after, _ := strconv.Atoi(c.Get("Last-Event-ID"))
+		if _, err := ownJob(c, mgr); err != nil {
+			return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "job not found"})
+		}
+		past, live, unsubscribe, err := mgr.Subscribe(c.Params("id"), after)
+		if errors.Is(err, jobs.ErrNotFound) {
+			return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "job not found"})
+		}
+
+		streamSSE(c, func(sse *sseStream) {
+			defer unsubscribe()
+			for _, ev := range past {
+				if err := sse.send(strconv.Itoa(ev.Seq), "", ev); err != nil {
+					return
+				}
+			}
+			ticker := time.NewTicker(sseKeepAlive)
+			defer ticker.Stop()
+			for {
+				select {
+				case ev, ok := <-live:
+					if !ok {
+						return
+					}
+					if err := sse.send(strconv.Itoa(ev.Seq), "", ev); err != nil {
+						return
+					}
+				case <-ticker.C:
+					if err := sse.comment("keep-alive"); err != nil {
+						return
+					}
+				}
+			}
+		})
+		return nil
+	})
+
+	return mgr
+}
+
+// ownJob returns the :id job if the caller submitted it. Other users' jobs
+// are reported as not found so their IDs cannot be probed.
+func ownJob(c *fiber.Ctx, mgr *jobs.Manager) (jobs.Job, error) {
+	job, err := mgr.Get(c.Params("id"))
+	if err != nil {
+		return jobs.Job{}, err
+	}
+	if job.Owner != store.UserFrom(c.UserContext()) {
+		return jobs.Job{}, jobs.ErrNotFound
+	}
+	return job, nil
+}
+
+// planJob runs analyze and generate for in, reporting llm stages as job
+// states, and saves the workout like /llm/generate does. reqCtx is the
+// submitting request's detached context; the job runs as its user, logs
+// with its request ID and traces as part of its trace. release runs once the
+// job's usage is recorded.
+func planJob(reqCtx context.Context, cfg *config.Config, st store.Store, deps llmDeps, opts []llm.LLMClientOption, in llm.AnalyzerInputs, release func()) jobs.Func {
+	user, logger := store.UserFrom(reqCtx), logging.FromContext(reqCtx, nil)
+	parent := trace.SpanContextFromContext(reqCtx)
+	return func(ctx context.Context, report jobs.Reporter) (_ any, err error) {
+		defer release()
+		ctx = logging.WithLogger(store.WithUser(ctx, user), logger)
+		ctx, span := tracing.Tracer(tracerName).Start(trace.ContextWithSpanContext(ctx, parent), "job.plan")
+		defer func() { tracing.End(span, err) }()
+		cli, err := newLLMClient(cfg, logger, deps, append(opts, llm.WithProgress(func(stage llm.Stage, attempt int) {
+			report(jobs.State(stage), attempt)
+		}))...)
+		if err != nil {
+			return nil, err
+		}
+		defer func() { recordUsage(reqCtx, st, logger, cli.Usage(), deps.now()) }()
+		a, err := cli.RunAnalysis(ctx, in)
+		if err != nil {
+			return nil, fmt.Errorf("analyze: %w", err)
+		}
+		out, err := cli.Generate(ctx, a.Plan)
+		if err != nil {
+			return nil, fmt.Errorf("generate: %w", err)
+		}
+
+		res := planJobResult{Seed: a.Seed, InputsHash: a.InputsHash, Plan: a.Plan, WorkoutYAML: string(out), PromptVersion: cli.PromptVersion(), Warnings: a.Warnings, Usage: cli.Usage()}
+		w, err := saveWorkout(ctx, st, cli, a.Plan, a.Seed, a.InputsHash, out, deps.now())
+		if err != nil {
+			logger.Error("save workout", "error", err)
+			return res, nil
+		}
+		res.WorkoutID = w.ID
+		res.WorkoutYAML = string(w.YAML)
+		return res, nil
+	}
+}
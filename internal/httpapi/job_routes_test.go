@@ -0,0 +1,206 @@
+package httpapi
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aaronromeo/swolegen/internal/config"
+	"github.com/aaronromeo/swolegen/internal/jobs"
+	"github.com/aaronromeo/swolegen/internal/llm"
+	"github.com/aaronromeo/swolegen/internal/llm/provider"
+	"github.com/aaronromeo/swolegen/internal/store"
+	"github.com/gofiber/fiber/v2"
+)
+
+// stageProvider answers analyzer and generator prompts with fixed replies.
+// When block is set, completions wait for the request context instead.
+type stageProvider struct {
+	plan, workout string
+	block         bool
+}
+
+func (s stageProvider) Complete(ctx context.Context, prf provider.ProviderResponseFormat) (provider.Completion, error) {
+	if s.block {
+		<-ctx.Done()
+		return provider.Completion{}, ctx.Err()
+	}
+	usage := provider.Usage{Model: "gpt-4o-mini-2024-07-18", PromptTokens: 1000, CompletionTokens: 500}
+	if prf.Name == provider.ResponseFormatAnalyzerPlan {
+		return provider.Completion{Text: s.plan, Usage: usage}, nil
+	}
+	return provider.Completion{Text: s.workout, Usage: usage}, nil
+}
+
+func (s stageProvider) Validate() error { return nil }
+
+// useFakeLLM swaps newLLMClient for one backed by testdata replies.
+func useFakeLLM(t *testing.T, block bool) {
+	t.Helper()
+	plan, err := os.ReadFile("testdata/plan.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	workout, err := os.ReadFile("testdata/workout.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	saved := newLLMClient
+	newLLMClient = func(_ *config.Config, _ *slog.Logger, deps llmDeps, opts ...llm.LLMClientOption) (*llm.Client, error) {
+		return llm.New(append([]llm.LLMClientOption{
+			llm.WithProvider(stageProvider{plan: string(plan), workout: string(workout), block: block}),
+			llm.WithCache(deps.cache),
+			llm.WithClock(deps.now),
+			llm.WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil))),
+		}, opts...)...)
+	}
+	t.Cleanup(func() { newLLMClient = saved })
+}
+
+func newJobsApp(t *testing.T) (*fiber.App, store.Store) {
+	t.Helper()
+	st := store.NewMemory()
+	app := fiber.New()
+	mgr := registerJobs(app, &config.Config{JobWorkers: 1, JobQueueSize: 4}, slog.Default(), st, llmDeps{})
+	t.Cleanup(mgr.Close)
+	return app, st
+}
+
+func getJob(t *testing.T, app *fiber.App, id string) jobs.Job {
+	t.Helper()
+	resp, err := app.Test(httptest.NewRequest("GET", "/v1/jobs/"+id, nil))
+	if err != nil {
+		t.Fatalf("app.Test error: %v", err)
+	}
+	defer resp.Body.Close() //nolint:errcheck
+	var j jobs.Job
+	if err := json.NewDecoder(resp.Body).Decode(&j); err != nil {
+		t.Fatalf("decode job: %v", err)
+	}
+	return j
+}
+
+func waitForJob(t *testing.T, app *fiber.App, id string, want jobs.State) jobs.Job {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		j := getJob(t, app, id)
+		if j.State == want {
+			return j
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("job %s: want %s, got %+v", id, want, j)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func submitJob(t *testing.T, app *fiber.App) jobs.Job {
+	t.Helper()
+	req := httptest.NewRequest("POST", "/v1/jobs", strings.NewReader(`{"location":"home","duration_minutes":45,"session_date":"2025-08-09"}`))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatalf("app.Test error: %v", err)
+	}
+	defer resp.Body.Close() //nolint:errcheck
+	if resp.StatusCode != http.StatusAccepted {
+		t.Fatalf("expected 202, got %d", resp.StatusCode)
+	}
+	var j jobs.Job
+	if err := json.NewDecoder(resp.Body).Decode(&j); err != nil {
+		t.Fatalf("decode job: %v", err)
+	}
+	if resp.Header.Get("Location") != "/v1/jobs/"+j.ID {
+		t.Fatalf("unexpected Location %q", resp.Header.Get("Location"))
+	}
+	return j
+}
+
+func TestPlanJob(t *testing.T) {
+	useFakeLLM(t, false)
+	app, st := newJobsApp(t)
+
+	job := submitJob(t, app)
+	done := waitForJob(t, app, job.ID, jobs.StateDone)
+	res, _ := done.Result.(map[string]any)
+	wid, _ := res["workout_id"].(string)
+	if !strings.HasPrefix(wid, "2025-08-09-home-") {
+		t.Fatalf("expected saved workout id in result, got %v", done.Result)
+	}
+	if _, err := st.GetWorkout(context.Background(), wid); err != nil {
+		t.Fatalf("workout not stored: %v", err)
+	}
+
+	resp, err := app.Test(httptest.NewRequest("GET", "/v1/jobs/"+job.ID+"/events", nil))
+	if err != nil {
+		t.Fatalf("app.Test error: %v", err)
+	}
+	defer resp.Body.Close() //nolint:errcheck
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("expected event stream, got %q", ct)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	var states []string
+	for _, ln := range strings.Split(string(body), "\n") {
+		data, ok := strings.CutPrefix(ln, "data: ")
+		if !ok {
+			continue
+		}
+		var ev jobs.Event
+		if err := json.Unmarshal([]byte(data), &ev); err != nil {
+			t.Fatalf("decode event %q: %v", data, err)
+		}
+		states = append(states, string(ev.State))
+	}
+	want := "queued fetching_inputs analyzing generating validating done"
+	if got := strings.Join(states, " "); got != want {
+		t.Fatalf("events: got %q, want %q", got, want)
+	}
+
+	// Resuming after the last event replays nothing.
+	req := httptest.NewRequest("GET", "/v1/jobs/"+job.ID+"/events", nil)
+	req.Header.Set("Last-Event-ID", "6")
+	resp2, err := app.Test(req)
+	if err != nil {
+		t.Fatalf("app.Test error: %v", err)
+	}
+	defer resp2.Body.Close() //nolint:errcheck
+	if rest, _ := io.ReadAll(resp2.Body); strings.Contains(string(rest), "data:") {
+		t.Fatalf("expected no replayed events, got %q", rest)
+	}
+}
+
+func TestCancelJob(t *testing.T) {
+	useFakeLLM(t, true)
+	app, _ := newJobsApp(t)
+
+	job := submitJob(t, app)
+	waitForJob(t, app, job.ID, jobs.State(llm.StageAnalyzing))
+
+	resp, err := app.Test(httptest.NewRequest("DELETE", "/v1/jobs/"+job.ID, nil))
+	if err != nil {
+		t.Fatalf("app.Test error: %v", err)
+	}
+	resp.Body.Close() //nolint:errcheck
+	if resp.StatusCode != http.StatusAccepted {
+		t.Fatalf("expected 202, got %d", resp.StatusCode)
+	}
+	waitForJob(t, app, job.ID, jobs.StateCanceled)
+
+	resp, err = app.Test(httptest.NewRequest("GET", "/v1/jobs/missing", nil))
+	if err != nil {
+		t.Fatalf("app.Test error: %v", err)
+	}
+	resp.Body.Close() //nolint:errcheck
+	if resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("expected 404, got %d", resp.StatusCode)
+	}
+}
@@ -0,0 +1,197 @@
+package httpapi
+
+import (
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/aaronromeo/swolegen/internal/config"
+	"github.com/aaronromeo/swolegen/internal/ratelimit"
+	"github.com/aaronromeo/swolegen/internal/store"
+	"github.com/gofiber/fiber/v2"
+)
+
+// budgets holds the default daily budget and per-user overrides.
+type budgets struct {
+	def   config.Budget
+	users map[string]config.Budget
+}
+
+func (b budgets) forUser(user string) config.Budget {
+	if ub, ok := b.users[user]; ok {
+		return ub
+	}
+	return b.def
+}
+
+// limitRequests applies l per API key, or per client IP for requests made
+// without one. It runs after requireAPIKey.
+func limitRequests(l *ratelimit.Limiter) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		key := "ip:" + c.IP()
+		if k, ok := c.Locals(localAPIKey).(store.APIKey); ok {
+			key = "key:" + k.ID
+		}
+		if ok, wait := l.Allow(key); !ok {
+			return tooManyRequests(c, wait, fmt.Sprintf("rate limit exceeded: %d requests per minute", l.PerMinute()))
+		}
+		return c.Next()
+	}
+}
+
+// localBudgetHold holds the release func of the request's budget hold in
+// fiber.Ctx locals; see takeBudgetHold.
+const localBudgetHold = "budget_hold"
+
+// heldRetry is the Retry-After for a request refused only because runs in
+// progress hold the rest of the budget: they settle within a run's length.
+const heldRetry = 10 * time.Second
+
+// hold is the estimated spend of one LLM run in progress.
+type hold struct {
+	tokens  int64
+	usd     float64
+	expires time.Time
+}
+
+// spendLedger tracks each user's holds, so concurrent runs cannot all pass
+// a budget check made against the same recorded usage.
+type spendLedger struct {
+	mu    sync.Mutex
+	ttl   time.Duration
+	holds map[string]map[*hold]struct{}
+}
+
+// held sums user's unexpired holds, dropping expired ones. Callers hold mu.
+func (l *spendLedger) held(user string, t time.Time) (tokens int64, usd float64) {
+	for h := range l.holds[user] {
+		if t.After(h.expires) {
+			delete(l.holds[user], h)
+			continue
+		}
+		tokens += h.tokens
+		usd += h.usd
+	}
+	return tokens, usd
+}
+
+// add records h for user and returns its release func, which is safe to
+// call more than once. Callers hold mu.
+func (l *spendLedger) add(user string, h *hold) func() {
+	if l.holds[user] == nil {
+		l.holds[user] = map[*hold]struct{}{}
+	}
+	l.holds[user][h] = struct{}{}
+	return func() {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		delete(l.holds[user], h)
+		if len(l.holds[user]) == 0 {
+			delete(l.holds, user)
+		}
+	}
+}
+
+// estimate is what the next run is expected to cost: the mean of the
+// user's runs today, or, before any, all that is left, so the first run of
+// the day runs alone and sets the estimate.
+func estimate(used store.Usage, limit config.Budget) (tokens int64, usd float64) {
+	if used.Requests > 0 {
+		n := int64(used.Requests)
+		return (used.PromptTokens + used.CompletionTokens + n - 1) / n, used.CostUSD / float64(used.Requests)
+	}
+	return max(limit.Tokens-used.PromptTokens-used.CompletionTokens, 0), max(limit.USD-used.CostUSD, 0)
+}
+
+// enforceBudget rejects POSTs, the requests that call the LLM, once the
+// caller's usage today (UTC, as /v1/usage rolls it up) has reached their
+// budget. Each admitted run holds its estimated cost until it ends, and a
+// run is only admitted while usage plus the holds of the caller's runs in
+// progress is under budget, so concurrent requests cannot all spend the
+// same remainder. Spend can still pass the budget by what the last admitted
+// run costs, plus whatever runs in progress cost beyond their estimates.
+// Holds expire after holdFor, in case a job that took one never runs. now
+// is the server clock the day is read from.
+func enforceBudget(st store.Store, logger *slog.Logger, b budgets, holdFor time.Duration, now func() time.Time) fiber.Handler {
+	ledger := &spendLedger{ttl: holdFor, holds: map[string]map[*hold]struct{}{}}
+	return func(c *fiber.Ctx) error {
+		if c.Method() != fiber.MethodPost {
+			return c.Next()
+		}
+		user := store.UserFrom(c.UserContext())
+		limit := b.forUser(user)
+		if limit.Unlimited() {
+			return c.Next()
+		}
+		t := now().UTC()
+		today := t.Format("2006-01-02")
+
+		// Check and hold under one lock, so the user's concurrent requests
+		// see each other's holds.
+		ledger.mu.Lock()
+		rows, err := st.ListUsage(c.UserContext(), store.UsageFilter{From: today, To: today, User: user})
+		if err != nil {
+			ledger.mu.Unlock()
+			reqLogger(c, logger).Error("list usage for budget", "user", user, "error", err)
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "checking llm budget failed"})
+		}
+		var used store.Usage
+		for _, row := range rows {
+			used.Add(row)
+		}
+		tokens := used.PromptTokens + used.CompletionTokens
+		heldTokens, heldUSD := ledger.held(user, t)
+		reset := t.Truncate(24 * time.Hour).Add(24 * time.Hour)
+		var msg string
+		switch {
+		case limit.Tokens > 0 && tokens >= limit.Tokens:
+			msg = fmt.Sprintf("daily llm budget exhausted: %d of %d tokens used", tokens, limit.Tokens)
+		case limit.USD > 0 && used.CostUSD >= limit.USD:
+			msg = fmt.Sprintf("daily llm budget exhausted: $%.2f of $%.2f used", used.CostUSD, limit.USD)
+		case limit.Tokens > 0 && tokens+heldTokens >= limit.Tokens:
+			ledger.mu.Unlock()
+			return tooManyRequests(c, heldRetry, fmt.Sprintf("daily llm budget held: %d of %d tokens used and %d held by runs in progress", tokens, limit.Tokens, heldTokens))
+		case limit.USD > 0 && used.CostUSD+heldUSD >= limit.USD:
+			ledger.mu.Unlock()
+			return tooManyRequests(c, heldRetry, fmt.Sprintf("daily llm budget held: $%.2f of $%.2f used and $%.2f held by runs in progress", used.CostUSD, limit.USD, heldUSD))
+		}
+		if msg != "" {
+			ledger.mu.Unlock()
+			return tooManyRequests(c, reset.Sub(t), msg+"; resets at "+reset.Format(time.RFC3339))
+		}
+		estTokens, estUSD := estimate(used, limit)
+		release := ledger.add(user, &hold{tokens: estTokens, usd: estUSD, expires: t.Add(ledger.ttl)})
+		ledger.mu.Unlock()
+
+		c.Locals(localBudgetHold, release)
+		defer func() {
+			if release, ok := c.Locals(localBudgetHold).(func()); ok {
+				release()
+			}
+		}()
+		return c.Next()
+	}
+}
+
+// takeBudgetHold hands the request's budget hold to a caller whose run
+// outlives the request, such as a background job, which must call the
+// returned func when the run ends. It returns a no-op without a hold.
+func takeBudgetHold(c *fiber.Ctx) func() {
+	release, ok := c.Locals(localBudgetHold).(func())
+	if !ok {
+		return func() {}
+	}
+	c.Locals(localBudgetHold, nil)
+	return release
+}
+
+// tooManyRequests answers 429 with Retry-After in whole seconds.
+func tooManyRequests(c *fiber.Ctx, wait time.Duration, msg string) error {
+	secs := max(int(math.Ceil(wait.Seconds())), 1)
+	c.Set(fiber.HeaderRetryAfter, strconv.Itoa(secs))
+	return c.Status(http.StatusTooManyRequests).JSON(fiber.Map{"error": msg, "retry_after": secs})
+}
@@ -0,0 +1,306 @@
+package httpapi
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aaronromeo/swolegen/internal/auth"
+	"github.com/aaronromeo/swolegen/internal/config"
+	"github.com/aaronromeo/swolegen/internal/llm"
+	"github.com/aaronromeo/swolegen/internal/llm/provider"
+	"github.com/aaronromeo/swolegen/internal/ratelimit"
+	"github.com/aaronromeo/swolegen/internal/store"
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestRateLimit(t *testing.T) {
+	st := store.NewMemory()
+	app := fiber.New()
+	app.Use("/v1", requireAPIKey(st, slog.Default(), false), limitRequests(ratelimit.New(1, 2)))
+	registerWorkouts(app, st, slog.Default())
+
+	for i := range 2 {
+		if resp := doAs(t, app, "", "GET", "/v1/workouts", ""); resp.StatusCode != http.StatusOK {
+			t.Fatalf("request %d: expected 200, got %d", i+1, resp.StatusCode)
+		}
+	}
+	resp := doAs(t, app, "", "GET", "/v1/workouts", "")
+	if resp.StatusCode != http.StatusTooManyRequests {
+		t.Fatalf("expected 429, got %d", resp.StatusCode)
+	}
+	if secs, _ := strconv.Atoi(resp.Header.Get("Retry-After")); secs < 1 || secs > 60 {
+		t.Fatalf("Retry-After = %q; want 1-60 seconds", resp.Header.Get("Retry-After"))
+	}
+	body, _ := io.ReadAll(resp.Body)
+	if !strings.Contains(string(body), "rate limit exceeded") {
+		t.Fatalf("body = %s", body)
+	}
+}
+
+func TestRateLimitClientIP(t *testing.T) {
+	get := func(app *fiber.App, forwardedFor string) int {
+		req := httptest.NewRequest("GET", "/v1/workouts", nil)
+		req.Header.Set("X-Forwarded-For", forwardedFor)
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("app.Test error: %v", err)
+		}
+		resp.Body.Close() //nolint:errcheck
+		return resp.StatusCode
+	}
+	newApp := func(trusted string) *fiber.App {
+		st := store.NewMemory()
+		app := fiber.New(fiberConfig(&config.Config{ProxyHeader: "X-Forwarded-For", TrustedProxies: []string{trusted}}))
+		app.Use("/v1", requireAPIKey(st, slog.Default(), false), limitRequests(ratelimit.New(1, 1)))
+		registerWorkouts(app, st, slog.Default())
+		return app
+	}
+
+	// app.Test connects from 0.0.0.0: behind a trusted proxy each client
+	// gets its own bucket.
+	app := newApp("0.0.0.0")
+	if got := get(app, "203.0.113.7"); got != http.StatusOK {
+		t.Fatalf("first client: expected 200, got %d", got)
+	}
+	if got := get(app, "203.0.113.8"); got != http.StatusOK {
+		t.Fatalf("second client: expected 200, got %d", got)
+	}
+	if got := get(app, "203.0.113.7"); got != http.StatusTooManyRequests {
+		t.Fatalf("first client again: expected 429, got %d", got)
+	}
+
+	// From an untrusted peer the header is ignored, so it cannot be used to
+	// dodge the limit.
+	app = newApp("10.0.0.1")
+	if got := get(app, "203.0.113.7"); got != http.StatusOK {
+		t.Fatalf("first request: expected 200, got %d", got)
+	}
+	if got := get(app, "203.0.113.8"); got != http.StatusTooManyRequests {
+		t.Fatalf("spoofed header: expected 429, got %d", got)
+	}
+}
+
+func TestEnforceBudget_HoldsConcurrentRuns(t *testing.T) {
+	st := store.NewMemory()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	app := fiber.New()
+	app.Use(requireAPIKey(st, logger, false), enforceBudget(st, logger, budgets{def: config.Budget{Tokens: 2000}}, time.Minute, time.Now))
+	started, finish := make(chan struct{}), make(chan struct{})
+	app.Post("/run", func(c *fiber.Ctx) error {
+		started <- struct{}{}
+		<-finish
+		return c.SendStatus(http.StatusOK)
+	})
+	var keep func()
+	app.Post("/job", func(c *fiber.Ctx) error {
+		keep = takeBudgetHold(c)
+		return c.SendStatus(http.StatusAccepted)
+	})
+	post := func(path string) *http.Response {
+		resp, err := app.Test(httptest.NewRequest("POST", path, nil), -1)
+		if err != nil {
+			t.Errorf("app.Test error: %v", err)
+			return nil
+		}
+		resp.Body.Close() //nolint:errcheck
+		return resp
+	}
+
+	// With no usage yet the first run holds the whole budget, so a second
+	// run started meanwhile is refused until the first ends.
+	done := make(chan *http.Response)
+	go func() { done <- post("/run") }()
+	<-started
+	resp := post("/run")
+	if resp == nil || resp.StatusCode != http.StatusTooManyRequests {
+		t.Fatalf("concurrent run: expected 429, got %+v", resp)
+	}
+	if secs, _ := strconv.Atoi(resp.Header.Get("Retry-After")); secs != int(heldRetry.Seconds()) {
+		t.Fatalf("Retry-After = %q; want %v", resp.Header.Get("Retry-After"), heldRetry)
+	}
+	close(finish)
+	if resp := <-done; resp == nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("first run: expected 200, got %+v", resp)
+	}
+
+	// A job keeps its hold after the request ends, until it releases it.
+	if resp := post("/job"); resp == nil || resp.StatusCode != http.StatusAccepted {
+		t.Fatalf("job: expected 202, got %+v", resp)
+	}
+	if resp := post("/job"); resp == nil || resp.StatusCode != http.StatusTooManyRequests {
+		t.Fatalf("while the job runs: expected 429, got %+v", resp)
+	}
+	keep()
+	if resp := post("/job"); resp == nil || resp.StatusCode != http.StatusAccepted {
+		t.Fatalf("after the job: expected 202, got %+v", resp)
+	}
+}
+
+// gatedProvider is stageProvider with generator completions that wait for
+// open, after saying so on started.
+type gatedProvider struct {
+	stageProvider
+	started chan<- struct{}
+	open    <-chan struct{}
+}
+
+func (g gatedProvider) Complete(ctx context.Context, prf provider.ProviderResponseFormat) (provider.Completion, error) {
+	if prf.Name != provider.ResponseFormatAnalyzerPlan {
+		g.started <- struct{}{}
+		<-g.open
+	}
+	return g.stageProvider.Complete(ctx, prf)
+}
+
+func TestEnforceBudget_HoldsConcurrentStreams(t *testing.T) {
+	useFakeLLM(t, false)
+	fake := newLLMClient
+	started, open := make(chan struct{}, 2), make(chan struct{})
+	newLLMClient = func(cfg *config.Config, logger *slog.Logger, deps llmDeps, opts ...llm.LLMClientOption) (*llm.Client, error) {
+		workout, err := os.ReadFile("testdata/workout.json")
+		if err != nil {
+			return nil, err
+		}
+		gated := gatedProvider{stageProvider: stageProvider{workout: string(workout)}, started: started, open: open}
+		return fake(cfg, logger, deps, append(opts, llm.WithProvider(gated))...)
+	}
+	plan, err := os.ReadFile("testdata/plan.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	st := store.NewMemory()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	app := fiber.New()
+	app.Use("/llm", requireAPIKey(st, logger, false), enforceBudget(st, logger, budgets{def: config.Budget{Tokens: 2000}}, time.Minute, time.Now))
+	registerLLM(app, &config.Config{}, logger, st, llmDeps{})
+	stream := func() *http.Response {
+		req := httptest.NewRequest("POST", "/llm/generate/stream", strings.NewReader(string(plan)))
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := app.Test(req, -1)
+		if err != nil {
+			t.Errorf("app.Test error: %v", err)
+			return nil
+		}
+		resp.Body.Close() //nolint:errcheck
+		return resp
+	}
+
+	// The handler returns before the stream runs; the hold must last until
+	// the stream ends, or the second stream spends the same remainder.
+	done := make(chan *http.Response)
+	go func() { done <- stream() }()
+	<-started
+	second := make(chan *http.Response)
+	go func() { second <- stream() }()
+	select {
+	case resp := <-second:
+		if resp == nil || resp.StatusCode != http.StatusTooManyRequests {
+			close(open)
+			t.Fatalf("concurrent stream: expected 429, got %+v", resp)
+		}
+	case <-started:
+		close(open)
+		<-second
+		t.Fatal("concurrent stream reached the provider; expected 429")
+	}
+	close(open)
+	if resp := <-done; resp == nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("first stream: expected 200, got %+v", resp)
+	}
+}
+
+func TestEstimate(t *testing.T) {
+	limit := config.Budget{Tokens: 10000, USD: 1}
+	if tok, usd := estimate(store.Usage{PromptTokens: 4000}, limit); tok != 6000 || usd != 1 {
+		t.Fatalf("estimate without runs = %d, %g; want the remainder", tok, usd)
+	}
+	if tok, usd := estimate(store.Usage{Requests: 3, PromptTokens: 2000, CompletionTokens: 1001, CostUSD: 0.3}, limit); tok != 1001 || usd < 0.099 || usd > 0.101 {
+		t.Fatalf("estimate = %d, %g; want the mean run rounded up", tok, usd)
+	}
+}
+
+func TestEnforceBudget(t *testing.T) {
+	useFakeLLM(t, false)
+	st := store.NewMemory()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	app := fiber.New()
+	b := budgets{def: config.Budget{Tokens: 2000}, users: map[string]config.Budget{"alice": {USD: 0.01}}}
+	app.Use("/llm", requireAPIKey(st, logger, false), enforceBudget(st, logger, b, time.Minute, time.Now))
+	registerLLM(app, &config.Config{}, logger, st, llmDeps{})
+
+	// The fake provider reports 1500 tokens per run: the first run fits
+	// the 2000 token budget, the second starts under it and ends over.
+	for i := range 2 {
+		if resp := doAs(t, app, "", "POST", "/llm/analyze", `{"location":"home","duration_minutes":45}`); resp.StatusCode != http.StatusOK {
+			t.Fatalf("run %d: expected 200, got %d", i+1, resp.StatusCode)
+		}
+	}
+	resp := doAs(t, app, "", "POST", "/llm/analyze", `{"location":"home","duration_minutes":45}`)
+	if resp.StatusCode != http.StatusTooManyRequests {
+		t.Fatalf("expected 429, got %d", resp.StatusCode)
+	}
+	var body struct {
+		Error      string `json:"error"`
+		RetryAfter int    `json:"retry_after"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if !strings.Contains(body.Error, "3000 of 2000 tokens") || body.RetryAfter < 1 || body.RetryAfter > 86400 {
+		t.Fatalf("unexpected 429 body: %+v", body)
+	}
+	if resp.Header.Get("Retry-After") != strconv.Itoa(body.RetryAfter) {
+		t.Fatalf("Retry-After header %q != body %d", resp.Header.Get("Retry-After"), body.RetryAfter)
+	}
+
+	// alice's override is in dollars only, so her tokens are unlimited.
+	_, aliceKey, err := auth.Issue(context.Background(), st, "alice", "", false)
+	if err != nil {
+		t.Fatalf("Issue: %v", err)
+	}
+	today := time.Now().UTC().Format("2006-01-02")
+	if err := st.AddUsage(context.Background(), store.Usage{Date: today, User: "alice", Model: "m", PromptTokens: 1e6, CostUSD: 0.005}); err != nil {
+		t.Fatalf("AddUsage: %v", err)
+	}
+	if resp := doAs(t, app, aliceKey, "POST", "/llm/analyze", `{"location":"home","duration_minutes":45}`); resp.StatusCode != http.StatusOK {
+		t.Fatalf("alice under her dollar budget: expected 200, got %d", resp.StatusCode)
+	}
+	if err := st.AddUsage(context.Background(), store.Usage{Date: today, User: "alice", Model: "m", CostUSD: 0.01}); err != nil {
+		t.Fatalf("AddUsage: %v", err)
+	}
+	if resp := doAs(t, app, aliceKey, "POST", "/llm/analyze", `{"location":"home","duration_minutes":45}`); resp.StatusCode != http.StatusTooManyRequests {
+		t.Fatalf("alice over her dollar budget: expected 429, got %d", resp.StatusCode)
+	}
+}
+
+func TestNewServer_RejectsInvalidSettings(t *testing.T) {
+	// config only checks syntax; user IDs and credentials are checked by
+	// the packages that own them when the server starts.
+	t.Setenv("OPENAI_API_KEY", "sk-test")
+	t.Setenv("AUTH_ADMIN_KEY", "sg_boot_0123456789abcdef")
+	for env, val := range map[string]string{
+		"LLM_DAILY_BUDGETS": "Alice/x=1:1",
+		"FETCH_CREDENTIALS": "https://logs.example.com=token:abc",
+	} {
+		t.Run(env, func(t *testing.T) {
+			t.Setenv(env, val)
+			cfg, err := config.Load("")
+			if err != nil {
+				t.Fatalf("Load: %v", err)
+			}
+			_, err = NewServer(cfg, slog.New(slog.NewTextHandler(io.Discard, nil)), store.NewMemory())
+			if err == nil || !strings.Contains(err.Error(), env) {
+				t.Fatalf("NewServer = %v; want a %s error", err, env)
+			}
+		})
+	}
+}
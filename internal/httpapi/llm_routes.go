@@ -3,34 +3,98 @@ package httpapi
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log/slog"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/aaronromeo/swolegen/internal/cache"
 	"github.com/aaronromeo/swolegen/internal/config"
+	"github.com/aaronromeo/swolegen/internal/fetch"
 	"github.com/aaronromeo/swolegen/internal/llm"
 	"github.com/aaronromeo/swolegen/internal/llm/provider"
 	"github.com/aaronromeo/swolegen/internal/llm/schemas"
+	"github.com/aaronromeo/swolegen/internal/store"
 	"github.com/gofiber/fiber/v2"
 )
 
-func registerLLM(app *fiber.App, cfg *config.Config, logger *slog.Logger) {
+const (
+	headerWorkoutSeed = "X-Workout-Seed"
+	headerInputsHash  = "X-Inputs-Hash"
+	headerWorkoutID   = "X-Workout-ID"
+	// headerPromptVersion selects a prompt set on requests and reports the
+	// version used on responses.
+	headerPromptVersion = "X-Prompt-Version"
+	// headerInputWarnings lists section:code for each change made to the
+	// analyzer's inputs before prompting (see llm.Warning).
+	headerInputWarnings = "X-Input-Warnings"
+)
+
+// llmDeps are the LLM dependencies shared by every request: state such as
+// circuit breakers and cached responses only works if it outlives a client.
+type llmDeps struct {
+	recovery *recoveryExports
+	provider provider.Provider
+	cache    cache.Cache
+	prompts  *llm.PromptRegistry
+	fetcher  fetch.Source
+	prices   llm.Prices
+	location *time.Location
+	// models are those stage overrides may select (see allowedModels).
+	models map[string]bool
+	// clock is the server clock: session dates, Strava activity windows and
+	// the usage day all come from it. Nil means time.Now.
+	clock func() time.Time
+}
+
+// now reads the deps' clock.
+func (d llmDeps) now() time.Time {
+	if d.clock == nil {
+		return time.Now()
+	}
+	return d.clock()
+}
+
+func registerLLM(app *fiber.App, cfg *config.Config, logger *slog.Logger, st store.Store, deps llmDeps) {
 	app.Post("/llm/analyze", func(c *fiber.Ctx) error {
 		var in llm.AnalyzerInputs
 		if err := json.Unmarshal(c.Body(), &in); err != nil {
 			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid json: " + err.Error()})
 		}
+		if err := fillEquipment(c.UserContext(), st, &in); err != nil {
+			reqLogger(c, logger).Error("get location", "error", err)
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
 
-		cli, err := newLLMClient(cfg, logger)
+		opts, err := requestOptions(c, deps)
+		if err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		}
+		cli, err := newLLMClient(cfg, reqLogger(c, logger), deps, opts...)
 		if err != nil {
 			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
 		}
+		c.Set(headerPromptVersion, cli.PromptVersion())
 
-		plan, err := cli.Analyze(context.Background(), in)
+		ctx, cancel := requestContext(c)
+		defer cancel()
+		a, err := cli.RunAnalysis(ctx, in)
+		trackUsage(c, st, logger, cli, deps.now())
 		if err != nil {
-			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+			return llmError(c, err)
 		}
 
-		return c.JSON(plan)
+		// Echo the seed so /llm/generate can derive the same workout_id, and
+		// the inputs hash so the saved workout records what it came from.
+		c.Set(headerWorkoutSeed, a.Seed)
+		c.Set(headerInputsHash, a.InputsHash)
+		if len(a.Warnings) > 0 {
+			c.Set(headerInputWarnings, joinWarnings(a.Warnings))
+		}
+		return c.JSON(a.Plan)
 	})
 
 	app.Post("/llm/generate", func(c *fiber.Ctx) error {
@@ -39,36 +103,186 @@ func registerLLM(app *fiber.App, cfg *config.Config, logger *slog.Logger) {
 			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid json: " + err.Error()})
 		}
 
-		cli, err := newLLMClient(cfg, logger)
+		opts, err := requestOptions(c, deps)
+		if err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		}
+		cli, err := newLLMClient(cfg, reqLogger(c, logger), deps, opts...)
 		if err != nil {
 			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
 		}
+		c.Set(headerPromptVersion, cli.PromptVersion())
+
+		ctx, cancel := requestContext(c)
+		defer cancel()
+		out, err := cli.Generate(ctx, in)
+		trackUsage(c, st, logger, cli, deps.now())
+		if err != nil {
+			return llmError(c, err)
+		}
 
-		plan, err := cli.Generate(context.Background(), in)
+		w, err := saveWorkout(c.UserContext(), st, cli, in, c.Get(headerWorkoutSeed), c.Get(headerInputsHash), out, deps.now())
+		if err != nil {
+			reqLogger(c, logger).Error("save workout", "error", err)
+			return c.JSON(out)
+		}
+
+		c.Set(headerWorkoutID, w.ID)
+		return c.JSON(w.YAML)
+	})
+
+	// Streaming /llm/generate over server-sent events: "stage" events for
+	// progress, "delta" events with raw generator output as it arrives, then
+	// "done" with the saved workout or "error" with validation findings.
+	app.Post("/llm/generate/stream", func(c *fiber.Ctx) error {
+		var in schemas.AnalyzerV1Json
+		if err := json.Unmarshal(c.Body(), &in); err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid json: " + err.Error()})
+		}
+		seed, inputsHash := c.Get(headerWorkoutSeed), c.Get(headerInputsHash)
+		opts, err := requestOptions(c, deps)
 		if err != nil {
 			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
 		}
 
-		return c.JSON(plan)
+		// The stream outlives the request's context, and the handler returns
+		// before it starts, so the stream releases the budget hold.
+		base := detach(c.UserContext())
+		logger := reqLogger(c, logger)
+		release := takeBudgetHold(c)
+		streamSSE(c, func(sse *sseStream) {
+			defer release()
+			// Failed writes (events or keep-alives) mean the client went
+			// away; cancel so the provider call stops too.
+			ctx, cancel := context.WithCancel(base)
+			defer cancel()
+			go sse.keepAlive(ctx, cancel)
+			send := func(event string, v any) {
+				if ctx.Err() != nil {
+					return
+				}
+				if err := sse.send("", event, v); err != nil {
+					cancel()
+				}
+			}
+
+			cli, err := newLLMClient(cfg, logger, deps, append(opts, llm.WithProgress(func(stage llm.Stage, attempt int) {
+				send("stage", fiber.Map{"stage": stage, "attempt": attempt})
+			}))...)
+			if err != nil {
+				send("error", fiber.Map{"error": err.Error()})
+				return
+			}
+			// Headers are already sent, so usage goes in the final event.
+			// ctx may be canceled by now; the spend still happened.
+			defer func() { recordUsage(base, st, logger, cli.Usage(), deps.now()) }()
+			out, err := cli.GenerateStream(ctx, in, func(delta string) {
+				send("delta", fiber.Map{"text": delta})
+			})
+			if err != nil {
+				payload := errorPayload(err)
+				payload["usage"] = cli.Usage()
+				send("error", payload)
+				return
+			}
+			result := fiber.Map{"workout_yaml": string(out), "usage": cli.Usage(), "prompt_version": cli.PromptVersion()}
+			if wk, err := saveWorkout(ctx, st, cli, in, seed, inputsHash, out, deps.now()); err != nil {
+				logger.Error("save workout", "error", err)
+			} else {
+				result["workout_id"] = wk.ID
+				result["workout_yaml"] = string(wk.YAML)
+			}
+			send("done", result)
+		})
+		return nil
 	})
 }
 
-func newLLMClient(cfg *config.Config, logger *slog.Logger) (*llm.Client, error) {
-	llmProvider, err := provider.NewOpenAIProvider(
-		provider.WithAPIKey(cfg.OpenaiKey),
-		provider.WithModel(cfg.LlmModel),
-		provider.WithLogger(logger),
-	)
-	if err != nil {
-		return nil, err
+// errorPayload describes an LLM pipeline error: the stage that ran out of
+// time for timeouts and the schema findings for validation failures.
+func errorPayload(err error) fiber.Map {
+	payload := fiber.Map{"error": err.Error()}
+	var terr *llm.TimeoutError
+	if errors.As(err, &terr) {
+		payload["stage"] = terr.Stage
+	}
+	var verr *llm.ValidationError
+	if errors.As(err, &verr) {
+		payload["findings"] = verr.Findings
+	}
+	var cerr *provider.CircuitOpenError
+	if errors.As(err, &cerr) {
+		payload["retry_after"] = retryAfterSeconds(cerr.RetryAfter)
+	}
+	return payload
+}
+
+// retryAfterSeconds rounds d up to whole seconds for Retry-After.
+func retryAfterSeconds(d time.Duration) int {
+	return int((d + time.Second - 1) / time.Second)
+}
+
+// llmError answers an LLM pipeline error: 503 with Retry-After while the
+// provider circuit is open, 504 when a stage missed its deadline, 400
+// otherwise.
+func llmError(c *fiber.Ctx, err error) error {
+	var cerr *provider.CircuitOpenError
+	if errors.As(err, &cerr) {
+		c.Set(fiber.HeaderRetryAfter, strconv.Itoa(retryAfterSeconds(cerr.RetryAfter)))
+		return c.Status(http.StatusServiceUnavailable).JSON(errorPayload(err))
 	}
-	cli, err := llm.New(
-		llm.WithRetries(cfg.LlmRetries),
-		llm.WithProvider(llmProvider),
-		llm.WithLogger(logger),
-	)
+	var terr *llm.TimeoutError
+	if errors.As(err, &terr) {
+		return c.Status(http.StatusGatewayTimeout).JSON(errorPayload(err))
+	}
+	return c.Status(http.StatusBadRequest).JSON(errorPayload(err))
+}
+
+// newLLMClient builds the per-request LLM client on the shared deps, without
+// touching config files or the network. Tests replace it to avoid real
+// provider calls.
+var newLLMClient = func(cfg *config.Config, logger *slog.Logger, deps llmDeps, opts ...llm.LLMClientOption) (*llm.Client, error) {
+	return llm.NewWithDeps(cfg, logger, llm.Deps{
+		Provider: deps.provider,
+		Cache:    deps.cache,
+		Fetcher:  deps.fetcher,
+		Prices:   deps.prices,
+		Location: deps.location,
+	}, append([]llm.LLMClientOption{llm.WithClock(deps.now)}, opts...)...)
+}
+
+// requestOptions reads the per-request client settings: the caller's
+// recovery export, the prompt set named by X-Prompt-Version, stage settings
+// from the query (see stageOverrides), and Cache-Control: no-cache, which
+// asks for a fresh completion that then replaces the cached one.
+func requestOptions(c *fiber.Ctx, deps llmDeps) ([]llm.LLMClientOption, error) {
+	opts, err := stageOverrides(c, deps.models)
 	if err != nil {
 		return nil, err
 	}
-	return cli, nil
+	opts = append(opts, llm.WithRecovery(deps.recovery.forUser(c.UserContext())))
+	if deps.prompts != nil {
+		set, err := deps.prompts.Get(c.Get(headerPromptVersion))
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, llm.WithPrompts(set))
+	} else if name := c.Get(headerPromptVersion); name != "" && name != llm.EmbeddedPrompts {
+		return nil, fmt.Errorf("%w: %q", llm.ErrUnknownPrompts, name)
+	}
+	for _, d := range strings.Split(c.Get(fiber.HeaderCacheControl), ",") {
+		if d = strings.ToLower(strings.TrimSpace(d)); d == "no-cache" || d == "no-store" {
+			opts = append(opts, llm.WithCacheBypass(true))
+		}
+	}
+	return opts, nil
+}
+
+// joinWarnings renders warnings for headerInputWarnings.
+func joinWarnings(warns []llm.Warning) string {
+	parts := make([]string, len(warns))
+	for i, w := range warns {
+		parts[i] = w.String()
+	}
+	return strings.Join(parts, ", ")
 }
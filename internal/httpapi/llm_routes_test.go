@@ -0,0 +1,420 @@
+package httpapi
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aaronromeo/swolegen/internal/cache"
+	"github.com/aaronromeo/swolegen/internal/config"
+	"github.com/aaronromeo/swolegen/internal/id"
+	"github.com/aaronromeo/swolegen/internal/llm"
+	"github.com/aaronromeo/swolegen/internal/llm/provider"
+	"github.com/aaronromeo/swolegen/internal/llm/schemas"
+	"github.com/aaronromeo/swolegen/internal/store"
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestGenerateStream(t *testing.T) {
+	useFakeLLM(t, false)
+	app := fiber.New()
+	st := store.NewMemory()
+	created := time.Date(2025, 8, 9, 11, 0, 0, 0, time.UTC)
+	registerLLM(app, &config.Config{}, slog.Default(), st, llmDeps{clock: func() time.Time { return created }})
+
+	plan, err := os.ReadFile("testdata/plan.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest("POST", "/llm/generate/stream", strings.NewReader(string(plan)))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(headerWorkoutSeed, "abc")
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatalf("app.Test error: %v", err)
+	}
+	defer resp.Body.Close() //nolint:errcheck
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200, got %d", resp.StatusCode)
+	}
+	body, _ := io.ReadAll(resp.Body)
+
+	var events []string
+	for _, ln := range strings.Split(string(body), "\n") {
+		if ev, ok := strings.CutPrefix(ln, "event: "); ok {
+			events = append(events, ev)
+		}
+	}
+	want := "stage delta stage done"
+	if got := strings.Join(events, " "); got != want {
+		t.Fatalf("events: got %q, want %q\n%s", got, want, body)
+	}
+	if !strings.Contains(string(body), `"workout_id":"2025-08-09-home-`) {
+		t.Fatalf("expected saved workout in done event:\n%s", body)
+	}
+	saved, err := st.ListWorkouts(context.Background(), store.WorkoutFilter{})
+	if err != nil || len(saved) != 1 || !saved[0].CreatedAt.Equal(created) {
+		t.Fatalf("saved workouts = %+v, %v; want one created at %v on the server clock", saved, err, created)
+	}
+}
+
+func TestAnalyzeTimeout(t *testing.T) {
+	useFakeLLM(t, true)
+	fake := newLLMClient
+	newLLMClient = func(cfg *config.Config, logger *slog.Logger, deps llmDeps, opts ...llm.LLMClientOption) (*llm.Client, error) {
+		return fake(cfg, logger, deps, append(opts, llm.WithTimeouts(llm.Timeouts{Analyze: 20 * time.Millisecond}))...)
+	}
+	app := fiber.New()
+	registerLLM(app, &config.Config{}, slog.Default(), store.NewMemory(), llmDeps{})
+
+	req := httptest.NewRequest("POST", "/llm/analyze", strings.NewReader(`{"location":"home","duration_minutes":45}`))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatalf("app.Test error: %v", err)
+	}
+	defer resp.Body.Close() //nolint:errcheck
+	if resp.StatusCode != http.StatusGatewayTimeout {
+		t.Fatalf("expected 504, got %d", resp.StatusCode)
+	}
+	var body map[string]any
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if body["stage"] != string(llm.StageAnalyzing) {
+		t.Fatalf("expected analyzing stage, got %v", body)
+	}
+}
+
+func TestWriteTimeoutCoversStages(t *testing.T) {
+	for _, tc := range []struct {
+		cfg  config.Config
+		want time.Duration
+	}{
+		{config.Config{}, minWriteTimeout},
+		{config.Config{LlmFetchTimeout: 15 * time.Second, LlmAnalyzerTimeout: 90 * time.Second, LlmGeneratorTimeout: 60 * time.Second}, 115 * time.Second},
+		{config.Config{LlmAnalyzerTimeout: 30 * time.Second, LlmGeneratorTimeout: 120 * time.Second}, 130 * time.Second},
+	} {
+		if got := writeTimeout(&tc.cfg); got != tc.want {
+			t.Errorf("writeTimeout(%+v) = %s; want %s", tc.cfg, got, tc.want)
+		}
+	}
+}
+
+// openProvider is a provider whose circuit breaker is open.
+type openProvider struct{}
+
+func (openProvider) Complete(context.Context, provider.ProviderResponseFormat) (provider.Completion, error) {
+	return provider.Completion{}, &provider.CircuitOpenError{Provider: "openai/test", RetryAfter: 1500 * time.Millisecond}
+}
+
+func (openProvider) Validate() error { return nil }
+
+func TestAnalyzeCircuitOpen(t *testing.T) {
+	useFakeLLM(t, false)
+	app := fiber.New()
+	registerLLM(app, &config.Config{}, slog.Default(), store.NewMemory(), llmDeps{})
+	fake := newLLMClient
+	newLLMClient = func(cfg *config.Config, logger *slog.Logger, deps llmDeps, opts ...llm.LLMClientOption) (*llm.Client, error) {
+		return fake(cfg, logger, deps, append(opts, llm.WithProvider(openProvider{}))...)
+	}
+
+	req := httptest.NewRequest("POST", "/llm/analyze", strings.NewReader(`{"location":"home","duration_minutes":45}`))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatalf("app.Test error: %v", err)
+	}
+	defer resp.Body.Close() //nolint:errcheck
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503, got %d", resp.StatusCode)
+	}
+	if got := resp.Header.Get("Retry-After"); got != "2" {
+		t.Fatalf("expected Retry-After 2, got %q", got)
+	}
+}
+
+func TestAnalyzeCache(t *testing.T) {
+	useFakeLLM(t, false)
+	app := fiber.New()
+	registerLLM(app, &config.Config{}, slog.Default(), store.NewMemory(), llmDeps{cache: cache.NewMemory(1<<20, time.Hour)})
+
+	analyze := func(cacheControl string) *http.Response {
+		t.Helper()
+		req := httptest.NewRequest("POST", "/llm/analyze", strings.NewReader(`{"location":"home","duration_minutes":45}`))
+		req.Header.Set("Content-Type", "application/json")
+		if cacheControl != "" {
+			req.Header.Set("Cache-Control", cacheControl)
+		}
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("app.Test error: %v", err)
+		}
+		resp.Body.Close() //nolint:errcheck
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("expected 200, got %d", resp.StatusCode)
+		}
+		return resp
+	}
+
+	for _, tc := range []struct {
+		cacheControl string
+		calls, hits  string
+	}{
+		{"", "1", "0"},
+		{"", "0", "1"},
+		{"no-cache", "1", "0"},
+	} {
+		resp := analyze(tc.cacheControl)
+		if resp.Header.Get(headerLLMCalls) != tc.calls || resp.Header.Get(headerLLMCacheHits) != tc.hits {
+			t.Fatalf("Cache-Control %q: calls=%s hits=%s, want %s/%s", tc.cacheControl,
+				resp.Header.Get(headerLLMCalls), resp.Header.Get(headerLLMCacheHits), tc.calls, tc.hits)
+		}
+	}
+}
+
+func TestAnalyzePromptVersion(t *testing.T) {
+	useFakeLLM(t, false)
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "b"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "b", "analyzer-user.txt"), []byte("Plan {{.DurationMinutes}} minutes."), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	prompts, err := llm.LoadPrompts(dir, "")
+	if err != nil {
+		t.Fatalf("LoadPrompts: %v", err)
+	}
+	app := fiber.New()
+	registerLLM(app, &config.Config{}, slog.Default(), store.NewMemory(), llmDeps{prompts: prompts})
+
+	analyze := func(version string) *http.Response {
+		t.Helper()
+		req := httptest.NewRequest("POST", "/llm/analyze", strings.NewReader(`{"location":"home","duration_minutes":45}`))
+		req.Header.Set("Content-Type", "application/json")
+		if version != "" {
+			req.Header.Set(headerPromptVersion, version)
+		}
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("app.Test error: %v", err)
+		}
+		resp.Body.Close() //nolint:errcheck
+		return resp
+	}
+
+	b, _ := prompts.Get("b")
+	for _, tc := range []struct {
+		version string
+		want    string
+	}{
+		{"", llm.DefaultPrompts().Version},
+		{"b", b.Version},
+		{b.Version, b.Version},
+	} {
+		resp := analyze(tc.version)
+		if resp.StatusCode != http.StatusOK || resp.Header.Get(headerPromptVersion) != tc.want {
+			t.Fatalf("%s %q: status %d version %q, want %q", headerPromptVersion, tc.version,
+				resp.StatusCode, resp.Header.Get(headerPromptVersion), tc.want)
+		}
+	}
+	if resp := analyze("missing"); resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected 400 for an unknown prompt set, got %d", resp.StatusCode)
+	}
+}
+
+func TestAnalyzeSessionDate(t *testing.T) {
+	useFakeLLM(t, false)
+	clock := func() time.Time { return time.Date(2025, 8, 10, 1, 30, 0, 0, time.UTC) }
+	app := fiber.New()
+	registerLLM(app, &config.Config{}, slog.Default(), store.NewMemory(), llmDeps{clock: clock})
+
+	analyze := func(body string) *http.Response {
+		t.Helper()
+		req := httptest.NewRequest("POST", "/llm/analyze", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("app.Test error: %v", err)
+		}
+		resp.Body.Close() //nolint:errcheck
+		return resp
+	}
+
+	in := llm.AnalyzerInputs{Location: "home", DurationMinutes: 45}
+	resp := analyze(`{"location":"home","duration_minutes":45,"timezone":"America/Toronto"}`)
+	if want := id.Seed(in.SeedInputs("2025-08-09", "")); resp.StatusCode != http.StatusOK || resp.Header.Get(headerWorkoutSeed) != want {
+		t.Fatalf("expected the Toronto date's seed %s, got %d %q", want, resp.StatusCode, resp.Header.Get(headerWorkoutSeed))
+	}
+	if want, _ := in.Hash("2025-08-09"); resp.Header.Get(headerInputsHash) != want {
+		t.Fatalf("expected inputs hash %s, got %q", want, resp.Header.Get(headerInputsHash))
+	}
+
+	// The plan's date and location come from the request, whatever the
+	// model echoes back.
+	req := httptest.NewRequest("POST", "/llm/analyze", strings.NewReader(`{"location":"gym:downtown","duration_minutes":45,"session_date":"2025-09-01"}`))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatalf("app.Test error: %v", err)
+	}
+	defer resp.Body.Close() //nolint:errcheck
+	var plan schemas.AnalyzerV1Json
+	if err := json.NewDecoder(resp.Body).Decode(&plan); err != nil {
+		t.Fatalf("decode plan: %v", err)
+	}
+	if got := plan.Meta.Date.Format("2006-01-02"); got != "2025-09-01" || plan.Meta.Location != "gym:downtown" {
+		t.Fatalf("plan meta = %s %q; want the requested date and location", got, plan.Meta.Location)
+	}
+	if resp := analyze(`{"location":"home","duration_minutes":45,"timezone":"Toronto"}`); resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected 400 for an unknown timezone, got %d", resp.StatusCode)
+	}
+}
+
+// hangupProvider blocks until its context ends and reports why.
+type hangupProvider struct {
+	started chan struct{}
+	done    chan error
+}
+
+func (p hangupProvider) Complete(ctx context.Context, _ provider.ProviderResponseFormat) (provider.Completion, error) {
+	close(p.started)
+	<-ctx.Done()
+	p.done <- ctx.Err()
+	return provider.Completion{}, ctx.Err()
+}
+
+func (hangupProvider) Validate() error { return nil }
+
+func TestAnalyzeClientDisconnect(t *testing.T) {
+	useFakeLLM(t, false)
+	hp := hangupProvider{started: make(chan struct{}), done: make(chan error, 1)}
+	fake := newLLMClient
+	newLLMClient = func(cfg *config.Config, logger *slog.Logger, deps llmDeps, opts ...llm.LLMClientOption) (*llm.Client, error) {
+		return fake(cfg, logger, deps, append(opts, llm.WithProvider(hp), llm.WithRetries(0))...)
+	}
+	app := fiber.New(fiber.Config{DisableStartupMessage: true})
+	registerLLM(app, &config.Config{}, slog.Default(), store.NewMemory(), llmDeps{})
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { app.Shutdown() }) //nolint:errcheck
+
+	go app.Listener(ln) //nolint:errcheck
+
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	body := `{"location":"home","duration_minutes":45}`
+	fmt.Fprintf(conn, "POST /llm/analyze HTTP/1.1\r\nHost: test\r\nContent-Type: application/json\r\nContent-Length: %d\r\n\r\n%s", len(body), body)
+	select {
+	case <-hp.started:
+	case <-time.After(5 * time.Second):
+		t.Fatal("analysis never reached the provider")
+	}
+	conn.Close() //nolint:errcheck
+
+	select {
+	case err := <-hp.done:
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("expected the run to be canceled, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("analysis kept running after the client disconnected")
+	}
+}
+
+// releaseProvider is stageProvider with completions that wait for release,
+// reporting on canceled if their context ends first.
+type releaseProvider struct {
+	stageProvider
+	started  chan struct{}
+	release  chan struct{}
+	canceled chan error
+}
+
+func (p releaseProvider) Complete(ctx context.Context, prf provider.ProviderResponseFormat) (provider.Completion, error) {
+	close(p.started)
+	select {
+	case <-p.release:
+		return p.stageProvider.Complete(ctx, prf)
+	case <-ctx.Done():
+		p.canceled <- ctx.Err()
+		return provider.Completion{}, ctx.Err()
+	}
+}
+
+func TestAnalyzeClientHalfClose(t *testing.T) {
+	useFakeLLM(t, false)
+	plan, err := os.ReadFile("testdata/plan.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rp := releaseProvider{
+		stageProvider: stageProvider{plan: string(plan)},
+		started:       make(chan struct{}), release: make(chan struct{}), canceled: make(chan error, 1),
+	}
+	fake := newLLMClient
+	newLLMClient = func(cfg *config.Config, logger *slog.Logger, deps llmDeps, opts ...llm.LLMClientOption) (*llm.Client, error) {
+		return fake(cfg, logger, deps, append(opts, llm.WithProvider(rp), llm.WithRetries(0))...)
+	}
+	app := fiber.New(fiber.Config{DisableStartupMessage: true})
+	registerLLM(app, &config.Config{}, slog.Default(), store.NewMemory(), llmDeps{})
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { app.Shutdown() }) //nolint:errcheck
+
+	go app.Listener(ln) //nolint:errcheck
+
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close() //nolint:errcheck
+	// A client that asks to close the connection may shut down its write
+	// side once the request is sent and still wait for the response.
+	body := `{"location":"home","duration_minutes":45}`
+	fmt.Fprintf(conn, "POST /llm/analyze HTTP/1.1\r\nHost: test\r\nConnection: close\r\nContent-Type: application/json\r\nContent-Length: %d\r\n\r\n%s", len(body), body)
+	if err := conn.(*net.TCPConn).CloseWrite(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-rp.started:
+	case <-time.After(5 * time.Second):
+		t.Fatal("analysis never reached the provider")
+	}
+	select {
+	case err := <-rp.canceled:
+		t.Fatalf("half-closed request was canceled: %v", err)
+	case <-time.After(4 * disconnectPoll):
+	}
+	close(rp.release)
+
+	resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	if err != nil {
+		t.Fatalf("read response: %v", err)
+	}
+	defer resp.Body.Close() //nolint:errcheck
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200 for the half-closed client, got %d", resp.StatusCode)
+	}
+}
@@ -0,0 +1,88 @@
+package httpapi
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/aaronromeo/swolegen/internal/llm"
+	"github.com/aaronromeo/swolegen/internal/store"
+	"github.com/gofiber/fiber/v2"
+)
+
+// registerLocations mounts the caller's location profiles under /v1/locations.
+func registerLocations(app *fiber.App, st store.Store, logger *slog.Logger) {
+	app.Get("/v1/locations", func(c *fiber.Ctx) error {
+		ls, err := st.ListLocations(c.UserContext())
+		if err != nil {
+			reqLogger(c, logger).Error("list locations", "error", err)
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.JSON(fiber.Map{"locations": ls})
+	})
+
+	app.Get("/v1/locations/:name", func(c *fiber.Ctx) error {
+		l, err := st.GetLocation(c.UserContext(), c.Params("name"))
+		if errors.Is(err, store.ErrNotFound) {
+			return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "location not found"})
+		}
+		if err != nil {
+			reqLogger(c, logger).Error("get location", "error", err)
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.JSON(l)
+	})
+
+	app.Put("/v1/locations/:name", func(c *fiber.Ctx) error {
+		var req struct {
+			Equipment []string `json:"equipment"`
+		}
+		if err := c.BodyParser(&req); err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": "invalid json: " + err.Error()})
+		}
+		l := store.LocationProfile{Name: c.Params("name"), Equipment: req.Equipment, UpdatedAt: time.Now().UTC()}
+		if l.Equipment == nil {
+			l.Equipment = []string{}
+		}
+		if err := store.ValidateLocationName(l.Name); err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		}
+		if err := st.PutLocation(c.UserContext(), l); err != nil {
+			reqLogger(c, logger).Error("put location", "error", err)
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.JSON(l)
+	})
+
+	app.Delete("/v1/locations/:name", func(c *fiber.Ctx) error {
+		err := st.DeleteLocation(c.UserContext(), c.Params("name"))
+		if errors.Is(err, store.ErrNotFound) {
+			return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "location not found"})
+		}
+		if err != nil {
+			reqLogger(c, logger).Error("delete location", "error", err)
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.SendStatus(http.StatusNoContent)
+	})
+}
+
+// fillEquipment takes the equipment for in.Location from the caller's saved
+// profile when the request lists none. A location without a profile is
+// left as sent.
+func fillEquipment(ctx context.Context, st store.Store, in *llm.AnalyzerInputs) error {
+	if len(in.EquipmentInventory) > 0 || in.Location == "" {
+		return nil
+	}
+	l, err := st.GetLocation(ctx, in.Location)
+	if errors.Is(err, store.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	in.EquipmentInventory = l.Equipment
+	return nil
+}
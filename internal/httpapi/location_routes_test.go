@@ -0,0 +1,41 @@
+package httpapi
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"github.com/aaronromeo/swolegen/internal/llm"
+	"github.com/aaronromeo/swolegen/internal/store"
+)
+
+func TestFillEquipment(t *testing.T) {
+	st := store.NewMemory()
+	ctx := store.WithUser(context.Background(), "alice")
+	if err := st.PutLocation(ctx, store.LocationProfile{Name: "Home", Equipment: []string{"dumbbell", "bench"}}); err != nil {
+		t.Fatalf("PutLocation: %v", err)
+	}
+
+	cases := []struct {
+		name string
+		ctx  context.Context
+		in   llm.AnalyzerInputs
+		want []string
+	}{
+		{"profile fills an empty inventory", ctx, llm.AnalyzerInputs{Location: "home"}, []string{"dumbbell", "bench"}},
+		{"sent inventory wins", ctx, llm.AnalyzerInputs{Location: "home", EquipmentInventory: []string{"bands"}}, []string{"bands"}},
+		{"unknown location is left alone", ctx, llm.AnalyzerInputs{Location: "gym"}, nil},
+		{"other users' profiles are not used", store.WithUser(context.Background(), "bob"), llm.AnalyzerInputs{Location: "home"}, nil},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			in := tc.in
+			if err := fillEquipment(tc.ctx, st, &in); err != nil {
+				t.Fatalf("fillEquipment: %v", err)
+			}
+			if !slices.Equal(in.EquipmentInventory, tc.want) {
+				t.Fatalf("equipment = %v; want %v", in.EquipmentInventory, tc.want)
+			}
+		})
+	}
+}
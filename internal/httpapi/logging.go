@@ -0,0 +1,99 @@
+package httpapi
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/aaronromeo/swolegen/internal/id"
+	"github.com/aaronromeo/swolegen/internal/logging"
+	"github.com/aaronromeo/swolegen/internal/metrics"
+	"github.com/aaronromeo/swolegen/internal/store"
+	"github.com/gofiber/fiber/v2"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// headerRequestID correlates a request's logs, responses and jobs.
+const headerRequestID = "X-Request-ID"
+
+// requestIDRe limits propagated IDs to what is safe to echo and log.
+var requestIDRe = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+// accessLog assigns the request an ID, or keeps a well-formed one the
+// caller sent, echoes it in X-Request-ID, puts a logger carrying it in the
+// request context and logs one line per request when it completes, timing it
+// in the request histogram by route. Only the path is logged: query strings
+// may carry OAuth codes.
+func accessLog(logger *slog.Logger) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		start := time.Now()
+		reqID := c.Get(headerRequestID)
+		if !requestIDRe.MatchString(reqID) {
+			var err error
+			if reqID, err = id.Random(8); err != nil {
+				logger.Error("request id", "error", err)
+				return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "request id: " + err.Error()})
+			}
+		}
+		c.Set(headerRequestID, reqID)
+		l := logger.With("request_id", reqID)
+		c.SetUserContext(logging.WithRequestID(logging.WithLogger(c.UserContext(), l), reqID))
+
+		err := c.Next()
+
+		status := statusOf(c, err)
+		elapsed := time.Since(start)
+		metrics.HTTPRequests.WithLabelValues(c.Method(), c.Route().Path, strconv.Itoa(status)).Observe(elapsed.Seconds())
+		level := slog.LevelInfo
+		if status >= http.StatusInternalServerError {
+			level = slog.LevelError
+		}
+		reqLogger(c, l).Log(c.UserContext(), level, "http request",
+			"method", c.Method(),
+			"path", c.Path(),
+			"route", c.Route().Path,
+			"status", status,
+			"duration_ms", elapsed.Milliseconds(),
+			"bytes_in", len(c.Request().Body()),
+			"bytes_out", len(c.Response().Body()),
+			"ip", c.IP(),
+		)
+		return err
+	}
+}
+
+// statusOf is the status the response to c will carry once err, returned
+// by the handler chain, has been through the error handler.
+func statusOf(c *fiber.Ctx, err error) int {
+	if err == nil {
+		return c.Response().StatusCode()
+	}
+	var fe *fiber.Error
+	if errors.As(err, &fe) {
+		return fe.Code
+	}
+	return http.StatusInternalServerError
+}
+
+// reqLogger returns the request-scoped logger, or fallback outside
+// accessLog.
+func reqLogger(c *fiber.Ctx, fallback *slog.Logger) *slog.Logger {
+	return logging.FromContext(c.UserContext(), fallback)
+}
+
+// detach returns a context for work that outlives the request (streams and
+// jobs): not canceled with it, but keeping its user, logger, request ID and
+// trace, so its spans join the request's.
+func detach(ctx context.Context) context.Context {
+	out := store.WithUser(context.Background(), store.UserFrom(ctx))
+	out = trace.ContextWithSpanContext(out, trace.SpanContextFromContext(ctx))
+	out = logging.WithLogger(out, logging.FromContext(ctx, nil))
+	if id := logging.RequestID(ctx); id != "" {
+		out = logging.WithRequestID(out, id)
+	}
+	return out
+}
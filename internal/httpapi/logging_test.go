@@ -0,0 +1,81 @@
+package httpapi
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/aaronromeo/swolegen/internal/auth"
+	"github.com/aaronromeo/swolegen/internal/logging"
+	"github.com/aaronromeo/swolegen/internal/store"
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestAccessLog(t *testing.T) {
+	var buf bytes.Buffer
+	policy, err := logging.NewPolicy("strict", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger := slog.New(logging.NewHandler(slog.NewJSONHandler(&buf, nil), policy))
+	st := store.NewMemory()
+	_, key, err := auth.Issue(context.Background(), st, "alice", "", false)
+	if err != nil {
+		t.Fatalf("Issue: %v", err)
+	}
+	app := fiber.New()
+	app.Use(accessLog(logger))
+	app.Use("/v1", requireAPIKey(st, logger, true))
+	registerWorkouts(app, st, logger)
+
+	send := func(id string) *http.Response {
+		req := httptest.NewRequest("GET", "/v1/workouts?token=leak", nil)
+		req.Header.Set(headerAPIKey, key)
+		if id != "" {
+			req.Header.Set(headerRequestID, id)
+		}
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("app.Test error: %v", err)
+		}
+		resp.Body.Close() //nolint:errcheck
+		return resp
+	}
+
+	resp := send("client-req.42")
+	if got := resp.Header.Get(headerRequestID); got != "client-req.42" {
+		t.Fatalf("X-Request-ID = %q; want the caller's ID echoed", got)
+	}
+	var line map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &line); err != nil {
+		t.Fatalf("decode access log %q: %v", buf.String(), err)
+	}
+	for k, v := range map[string]any{"msg": "http request", "request_id": "client-req.42", "user": "alice", "path": "/v1/workouts", "status": 200.0} {
+		if line[k] != v {
+			t.Errorf("access log %s = %v; want %v", k, line[k], v)
+		}
+	}
+	if strings.Contains(buf.String(), "leak") || strings.Contains(buf.String(), key) {
+		t.Errorf("access log leaked the query or key: %s", buf.String())
+	}
+
+	buf.Reset()
+	if got := send("bad id\n").Header.Get(headerRequestID); len(got) != 16 || got == "bad id\n" {
+		t.Fatalf("malformed X-Request-ID should be replaced, got %q", got)
+	}
+}
+
+func TestDetach(t *testing.T) {
+	l := slog.Default().With("request_id", "r1")
+	ctx, cancel := context.WithCancel(logging.WithRequestID(logging.WithLogger(store.WithUser(context.Background(), "bob"), l), "r1"))
+	cancel()
+	d := detach(ctx)
+	if d.Err() != nil || store.UserFrom(d) != "bob" || logging.RequestID(d) != "r1" || logging.FromContext(d, nil) != l {
+		t.Fatalf("detach lost request values or kept the cancellation")
+	}
+}
@@ -0,0 +1,13 @@
+package httpapi
+
+import (
+	"github.com/aaronromeo/swolegen/internal/metrics"
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/adaptor"
+)
+
+// registerMetrics mounts /metrics in the Prometheus exposition format. Like
+// /healthz it is unauthenticated, for scrapers on the private network.
+func registerMetrics(app *fiber.App) {
+	app.Get("/metrics", adaptor.HTTPHandler(metrics.Handler()))
+}
@@ -0,0 +1,41 @@
+package httpapi
+
+import (
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestMetrics(t *testing.T) {
+	app := fiber.New()
+	app.Use(accessLog(slog.New(slog.NewTextHandler(io.Discard, nil))))
+	app.Get("/healthz", func(c *fiber.Ctx) error { return c.SendStatus(http.StatusOK) })
+	registerMetrics(app)
+
+	if _, err := app.Test(httptest.NewRequest("GET", "/healthz", nil)); err != nil {
+		t.Fatalf("app.Test error: %v", err)
+	}
+	resp, err := app.Test(httptest.NewRequest("GET", "/metrics", nil))
+	if err != nil {
+		t.Fatalf("app.Test error: %v", err)
+	}
+	defer resp.Body.Close() //nolint:errcheck
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200, got %d", resp.StatusCode)
+	}
+	b, _ := io.ReadAll(resp.Body)
+	for _, want := range []string{
+		`swolegen_http_request_duration_seconds_count{method="GET",route="/healthz",status="200"}`,
+		"# TYPE swolegen_llm_call_duration_seconds histogram",
+		"go_goroutines",
+	} {
+		if !strings.Contains(string(b), want) {
+			t.Errorf("metrics output missing %q", want)
+		}
+	}
+}
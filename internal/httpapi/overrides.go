@@ -0,0 +1,119 @@
+package httpapi
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/aaronromeo/swolegen/internal/config"
+	"github.com/aaronromeo/swolegen/internal/llm"
+	"github.com/aaronromeo/swolegen/internal/llm/provider"
+	"github.com/gofiber/fiber/v2"
+)
+
+// overrideStages maps the query parameter prefix of each stage's settings
+// to the stage.
+var overrideStages = []struct {
+	prefix string
+	stage  llm.Stage
+}{
+	{"analyzer", llm.StageAnalyzing},
+	{"generator", llm.StageGenerating},
+	{"repair", llm.StageRepairing},
+}
+
+// allowedModels are the models a request may override a stage with: those
+// the server is configured to call and those it has prices for, so callers
+// cannot run up costs the usage rollups would not see.
+func allowedModels(cfg *config.Config, prices llm.Prices) map[string]bool {
+	models := map[string]bool{}
+	for _, m := range append([]string{cfg.LlmModel, cfg.LlmModelGenerator, cfg.LlmModelRepair}, cfg.LlmFallbackModels...) {
+		if m = strings.TrimSpace(m); m != "" {
+			models[m] = true
+		}
+	}
+	for m := range prices {
+		models[m] = true
+	}
+	return models
+}
+
+// stageOverrides reads per-request completion settings from query
+// parameters named <stage>.<setting>, e.g. ?analyzer.temperature=0 or
+// ?generator.model=gpt-4o. They replace the configured settings for this
+// request only; unknown settings, and models not in models, are rejected so
+// typos do not go unnoticed.
+func stageOverrides(c *fiber.Ctx, models map[string]bool) ([]llm.LLMClientOption, error) {
+	found := map[llm.Stage]*provider.Settings{}
+	var err error
+	c.Context().QueryArgs().VisitAll(func(k, v []byte) {
+		if err != nil {
+			return
+		}
+		prefix, key, ok := strings.Cut(string(k), ".")
+		if !ok {
+			return
+		}
+		for _, o := range overrideStages {
+			if o.prefix != prefix {
+				continue
+			}
+			s := found[o.stage]
+			if s == nil {
+				s = &provider.Settings{}
+				found[o.stage] = s
+			}
+			if perr := setOverride(s, key, string(v), models); perr != nil {
+				err = fmt.Errorf("%s: %w", k, perr)
+			}
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	var opts []llm.LLMClientOption
+	for _, o := range overrideStages {
+		s := found[o.stage]
+		if s == nil {
+			continue
+		}
+		if err := s.Validate(); err != nil {
+			return nil, fmt.Errorf("%s: %w", o.prefix, err)
+		}
+		opts = append(opts, llm.WithStageSettings(o.stage, *s))
+	}
+	return opts, nil
+}
+
+func setOverride(s *provider.Settings, key, v string, models map[string]bool) error {
+	switch key {
+	case "model":
+		s.Model = strings.TrimSpace(v)
+		if !models[s.Model] {
+			return fmt.Errorf("model %q is not configured or priced", s.Model)
+		}
+	case "temperature":
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return err
+		}
+		s.Temperature = &f
+	case "max_tokens":
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return err
+		}
+		s.MaxTokens = n
+	case "reasoning_effort":
+		s.ReasoningEffort = strings.ToLower(strings.TrimSpace(v))
+	case "seed":
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return err
+		}
+		s.Seed = &n
+	default:
+		return fmt.Errorf("unknown setting %q", key)
+	}
+	return nil
+}
@@ -0,0 +1,79 @@
+package httpapi
+
+import (
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/aaronromeo/swolegen/internal/config"
+	"github.com/aaronromeo/swolegen/internal/llm"
+	"github.com/aaronromeo/swolegen/internal/store"
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestStageOverrides(t *testing.T) {
+	models := allowedModels(
+		&config.Config{LlmModel: "gpt-4o-mini", LlmFallbackModels: []string{"gpt-4.1-nano"}},
+		llm.Prices{"gpt-4o": {}, "gpt-4.1": {}},
+	)
+	app := fiber.New()
+	app.Get("/", func(c *fiber.Ctx) error {
+		opts, err := stageOverrides(c, models)
+		if err != nil {
+			return c.Status(http.StatusBadRequest).SendString(err.Error())
+		}
+		cli, err := llm.New(append([]llm.LLMClientOption{
+			llm.WithProvider(stageProvider{}),
+			llm.WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil))),
+		}, opts...)...)
+		if err != nil {
+			return err
+		}
+		return c.SendString(cli.StageModel(llm.StageAnalyzing) + " " + cli.StageModel(llm.StageGenerating))
+	})
+
+	for _, tc := range []struct {
+		query  string
+		status int
+		want   string
+	}{
+		{"?analyzer.model=gpt-4o&generator.temperature=0.3&format=yaml", http.StatusOK, "gpt-4o "},
+		{"?generator.model=gpt-4.1&repair.model=gpt-4o-mini&analyzer.seed=3", http.StatusOK, " gpt-4.1"},
+		{"?generator.temperature=high", http.StatusBadRequest, "generator.temperature"},
+		{"?analyzer.temperature=3", http.StatusBadRequest, "analyzer: temperature"},
+		{"?analyzer.reasoning_effort=max", http.StatusBadRequest, "reasoning effort"},
+		{"?repair.top_p=1", http.StatusBadRequest, `unknown setting "top_p"`},
+		{"?generator.model=gpt-4.1-nano", http.StatusOK, " gpt-4.1-nano"},
+		{"?analyzer.model=o1-pro", http.StatusBadRequest, `model "o1-pro" is not configured or priced`},
+		{"?generator.model=gpt-4o-2024-05-13", http.StatusBadRequest, "not configured or priced"},
+	} {
+		resp, err := app.Test(httptest.NewRequest("GET", "/"+tc.query, nil))
+		if err != nil {
+			t.Fatalf("app.Test error: %v", err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close() //nolint:errcheck
+		if resp.StatusCode != tc.status || !strings.Contains(string(body), tc.want) {
+			t.Errorf("%s: %d %q, want %d containing %q", tc.query, resp.StatusCode, body, tc.status, tc.want)
+		}
+	}
+}
+
+func TestAnalyzeRejectsBadOverride(t *testing.T) {
+	useFakeLLM(t, false)
+	app := fiber.New()
+	registerLLM(app, &config.Config{}, slog.Default(), store.NewMemory(), llmDeps{})
+	req := httptest.NewRequest("POST", "/llm/analyze?analyzer.max_tokens=-1", strings.NewReader(`{"location":"home","duration_minutes":45}`))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatalf("app.Test error: %v", err)
+	}
+	resp.Body.Close() //nolint:errcheck
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected 400 for a negative max_tokens, got %d", resp.StatusCode)
+	}
+}
@@ -0,0 +1,83 @@
+package httpapi
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/aaronromeo/swolegen/internal/config"
+	"github.com/aaronromeo/swolegen/internal/llm"
+	"github.com/aaronromeo/swolegen/internal/store"
+	"github.com/aaronromeo/swolegen/internal/strava"
+	"github.com/gofiber/fiber/v2"
+)
+
+// readyTimeout bounds the whole /readyz run.
+const readyTimeout = 5 * time.Second
+
+// readyCheck is one named readiness probe.
+type readyCheck struct {
+	name  string
+	check func(ctx context.Context) error
+}
+
+// checkResult is one check in the /readyz report.
+type checkResult struct {
+	Name       string `json:"name"`
+	Status     string `json:"status"`
+	Error      string `json:"error,omitempty"`
+	DurationMS int64  `json:"duration_ms"`
+}
+
+// readinessChecks builds the /readyz probes. providerErr and promptsErr are
+// the startup errors that left deps.provider or deps.prompts unset.
+func readinessChecks(cfg *config.Config, st store.Store, deps llmDeps, providerErr, promptsErr error) []readyCheck {
+	oauth := strava.NewOAuth(cfg.Strava)
+	return []readyCheck{
+		{"schemas", func(context.Context) error { return llm.CheckSchemas() }},
+		{"prompts", func(context.Context) error {
+			if deps.prompts == nil {
+				return notLoaded(promptsErr)
+			}
+			return deps.prompts.Check()
+		}},
+		{"provider", func(context.Context) error {
+			if deps.provider == nil {
+				return notLoaded(providerErr)
+			}
+			return deps.provider.Validate()
+		}},
+		{"strava", func(context.Context) error { return oauth.CheckConfig() }},
+		{"store", st.Ping},
+	}
+}
+
+func notLoaded(err error) error {
+	if err == nil {
+		return errors.New("not loaded")
+	}
+	return err
+}
+
+// registerReady mounts /readyz: 200 when every check passes, otherwise 503,
+// with a per-check report either way.
+func registerReady(app *fiber.App, checks []readyCheck) {
+	app.Get("/readyz", func(c *fiber.Ctx) error {
+		ctx, cancel := context.WithTimeout(c.UserContext(), readyTimeout)
+		defer cancel()
+		status, code := "ready", http.StatusOK
+		results := make([]checkResult, 0, len(checks))
+		for _, rc := range checks {
+			start := time.Now()
+			res := checkResult{Name: rc.name, Status: "ok"}
+			if err := rc.check(ctx); err != nil {
+				res.Status, res.Error = "fail", err.Error()
+				status, code = "unready", http.StatusServiceUnavailable
+			}
+			res.DurationMS = time.Since(start).Milliseconds()
+			results = append(results, res)
+		}
+		return c.Status(code).JSON(fiber.Map{"status": status, "checks": results})
+	})
+}
@@ -0,0 +1,60 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aaronromeo/swolegen/internal/config"
+	"github.com/aaronromeo/swolegen/internal/llm"
+	"github.com/aaronromeo/swolegen/internal/store"
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestReadyz(t *testing.T) {
+	prompts, err := llm.LoadPrompts("", "")
+	if err != nil {
+		t.Fatalf("LoadPrompts: %v", err)
+	}
+	cfg := &config.Config{Strava: config.StravaConfig{RedirectBaseURL: "x", ClientID: "x", ClientSecret: "x", StateSecret: "x"}}
+
+	readyz := func(deps llmDeps) (int, map[string]checkResult) {
+		t.Helper()
+		app := fiber.New()
+		registerReady(app, readinessChecks(cfg, store.NewMemory(), deps, nil, nil))
+		resp, err := app.Test(httptest.NewRequest("GET", "/readyz", nil))
+		if err != nil {
+			t.Fatalf("app.Test error: %v", err)
+		}
+		defer resp.Body.Close() //nolint:errcheck
+		var body struct {
+			Checks []checkResult `json:"checks"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		byName := map[string]checkResult{}
+		for _, c := range body.Checks {
+			byName[c.Name] = c
+		}
+		return resp.StatusCode, byName
+	}
+
+	code, checks := readyz(llmDeps{prompts: prompts, provider: stageProvider{}})
+	if code != http.StatusOK || len(checks) != 5 {
+		t.Fatalf("expected 200 with five checks, got %d %+v", code, checks)
+	}
+
+	cfg.Strava.ClientSecret = ""
+	code, checks = readyz(llmDeps{prompts: prompts})
+	if code != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503, got %d", code)
+	}
+	if checks["provider"].Status != "fail" || checks["strava"].Error != "STRAVA_CLIENT_SECRET not set" {
+		t.Fatalf("unexpected failures: %+v", checks)
+	}
+	if checks["schemas"].Status != "ok" || checks["store"].Status != "ok" {
+		t.Fatalf("unexpected report: %+v", checks)
+	}
+}
@@ -0,0 +1,72 @@
+package httpapi
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+
+	"github.com/aaronromeo/swolegen/internal/config"
+	"github.com/aaronromeo/swolegen/internal/recovery"
+	"github.com/aaronromeo/swolegen/internal/store"
+)
+
+// recoveryExports loads each user's recovery export on first use, so one
+// user's plans are never built on another's HRV and sleep. RECOVERY_PATH
+// names the export of the default user, or, with a {user} placeholder, one
+// export per user (see recovery.PathFor).
+type recoveryExports struct {
+	source, pattern string
+	logger          *slog.Logger
+
+	mu     sync.Mutex
+	series map[string]*recovery.Series
+}
+
+// newRecoveryExports returns nil when no export is configured.
+func newRecoveryExports(cfg *config.Config, logger *slog.Logger) *recoveryExports {
+	if cfg.RecoveryPath == "" {
+		return nil
+	}
+	return &recoveryExports{
+		source:  cfg.RecoverySource,
+		pattern: cfg.RecoveryPath,
+		logger:  logger,
+		series:  map[string]*recovery.Series{},
+	}
+}
+
+// forUser returns the series of the user ctx is scoped to, or nil when they
+// have none. A missing or broken export is logged once and skipped, so the
+// analyzer still works on manual inputs.
+func (r *recoveryExports) forUser(ctx context.Context) *recovery.Series {
+	if r == nil {
+		return nil
+	}
+	user := store.UserFrom(ctx)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if s, ok := r.series[user]; ok {
+		return s
+	}
+	r.series[user] = r.load(user)
+	return r.series[user]
+}
+
+func (r *recoveryExports) load(user string) *recovery.Series {
+	path := recovery.PathFor(r.pattern, user, store.DefaultUser)
+	if path == "" {
+		return nil
+	}
+	src, err := recovery.NewSource(r.source, path)
+	if err != nil {
+		r.logger.Error("recovery source", "error", err)
+		return nil
+	}
+	series, err := src.Load()
+	if err != nil {
+		r.logger.Error("load recovery export", "source", src.Name(), "path", path, "user", user, "error", err)
+		return nil
+	}
+	r.logger.Info("loaded recovery export", "source", src.Name(), "path", path, "user", user, "days", series.Len())
+	return series
+}
@@ -0,0 +1,43 @@
+package httpapi
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/aaronromeo/swolegen/internal/config"
+	"github.com/aaronromeo/swolegen/internal/recovery"
+	"github.com/aaronromeo/swolegen/internal/store"
+)
+
+func TestRecoveryExports_PerUser(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "alice.csv"), []byte("date,hrv_ms\n2025-08-01,40\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	as := func(user string) context.Context { return store.WithUser(context.Background(), user) }
+
+	per := newRecoveryExports(&config.Config{RecoverySource: recovery.SourceCSV, RecoveryPath: filepath.Join(dir, "{user}.csv")}, logger)
+	if s := per.forUser(as("alice")); s == nil || s.Len() != 1 {
+		t.Fatalf("alice: got %v, want her export", s)
+	}
+	if s := per.forUser(as("bob")); s != nil {
+		t.Fatalf("bob has no export but got %d days", s.Len())
+	}
+
+	// Without a placeholder the export is the default user's alone.
+	shared := newRecoveryExports(&config.Config{RecoverySource: recovery.SourceCSV, RecoveryPath: filepath.Join(dir, "alice.csv")}, logger)
+	if s := shared.forUser(as(store.DefaultUser)); s == nil {
+		t.Fatal("default user: expected the export")
+	}
+	if s := shared.forUser(as("bob")); s != nil {
+		t.Fatal("bob must not see the default user's export")
+	}
+	if s := newRecoveryExports(&config.Config{}, logger).forUser(as("alice")); s != nil {
+		t.Fatal("no RECOVERY_PATH: expected no series")
+	}
+}
@@ -1,26 +1,130 @@
 package httpapi
 
 import (
+	"context"
+	"fmt"
 	"log/slog"
 	"net/http"
 	"time"
 
+	"github.com/aaronromeo/swolegen/internal/auth"
 	"github.com/aaronromeo/swolegen/internal/config"
+	"github.com/aaronromeo/swolegen/internal/fetch"
+	"github.com/aaronromeo/swolegen/internal/llm"
+	"github.com/aaronromeo/swolegen/internal/ratelimit"
+	"github.com/aaronromeo/swolegen/internal/store"
 	"github.com/gofiber/fiber/v2"
 )
 
-func NewServer(cfg *config.Config, logger *slog.Logger) *fiber.App {
-	app := fiber.New(
-		fiber.Config{
-			DisableStartupMessage: true,
-			ReadTimeout:           30 * time.Second,
-			WriteTimeout:          60 * time.Second,
-		},
-	)
+// minWriteTimeout bounds every response; writeTimeout raises it to fit the
+// LLM stage deadlines.
+const minWriteTimeout = 60 * time.Second
+
+// writeTimeout leaves room for the slowest synchronous request, fetching and
+// analyzing for /llm/analyze or generating for /llm/generate, so a stage
+// timeout answers 504 before the connection is cut.
+func writeTimeout(cfg *config.Config) time.Duration {
+	longest := max(cfg.LlmFetchTimeout+cfg.LlmAnalyzerTimeout, cfg.LlmGeneratorTimeout)
+	return max(minWriteTimeout, longest+10*time.Second)
+}
+
+// budgetHoldFor outlasts a background job's run through every stage.
+func budgetHoldFor(cfg *config.Config) time.Duration {
+	return cfg.LlmFetchTimeout + cfg.LlmAnalyzerTimeout + cfg.LlmGeneratorTimeout
+}
+
+// fiberConfig takes the client IP from cfg.ProxyHeader on connections from
+// cfg.TrustedProxies, so per-IP rate limits see clients rather than the
+// proxy.
+func fiberConfig(cfg *config.Config) fiber.Config {
+	return fiber.Config{
+		DisableStartupMessage:   true,
+		ReadTimeout:             30 * time.Second,
+		WriteTimeout:            writeTimeout(cfg),
+		ProxyHeader:             cfg.ProxyHeader,
+		EnableTrustedProxyCheck: true,
+		TrustedProxies:          cfg.TrustedProxies,
+		EnableIPValidation:      true,
+	}
+}
+
+// NewServer mounts every route on a new app. It fails only on settings that
+// config.Validate rejects and on values the owning packages reject (budget
+// user IDs, fetch credentials); dependencies that fail to load are logged
+// and reported by /readyz instead.
+func NewServer(cfg *config.Config, logger *slog.Logger, st store.Store) (*fiber.App, error) {
+	b := budgets{def: config.Budget{Tokens: cfg.LlmDailyTokens, USD: cfg.LlmDailyUSD}}
+	var err error
+	if b.users, err = config.ParseBudgets(cfg.LlmDailyBudgets); err != nil {
+		return nil, fmt.Errorf("LLM_DAILY_BUDGETS: %w", err)
+	}
+	for user := range b.users {
+		if err := store.ValidateUser(user); err != nil {
+			return nil, fmt.Errorf("LLM_DAILY_BUDGETS: %w", err)
+		}
+	}
+	if _, err := fetch.ParseCredentials(cfg.Fetch.Credentials); err != nil {
+		return nil, fmt.Errorf("FETCH_CREDENTIALS: %w", err)
+	}
+	deps := llmDeps{clock: time.Now}
+	if deps.prices, err = llm.ParsePrices(cfg.LlmPrices); err != nil {
+		return nil, fmt.Errorf("LLM_PRICES: %w", err)
+	}
+	deps.models = allowedModels(cfg, deps.prices)
+	if cfg.AuthAdminKey != "" {
+		if _, err := auth.Import(context.Background(), st, cfg.AuthAdminKey, store.DefaultUser, "AUTH_ADMIN_KEY", true); err != nil {
+			return nil, fmt.Errorf("AUTH_ADMIN_KEY: %w", err)
+		}
+	}
+
+	app := fiber.New(fiberConfig(cfg))
+	app.Use(accessLog(logger), traceRequests())
 	app.Get("/healthz", func(c *fiber.Ctx) error { return c.SendStatus(http.StatusOK) })
-	registerStravaOAuth(app, cfg)
-	registerLLM(app, cfg, logger)
+	registerMetrics(app)
+	authn := requireAPIKey(st, logger, cfg.AuthRequired)
+	limit := limitRequests(ratelimit.New(cfg.RateLimitPerMinute, cfg.RateLimitBurst))
+	spend := enforceBudget(st, logger, b, budgetHoldFor(cfg), deps.now)
+	app.Use("/llm", authn, limit, spend)
+	app.Use("/v1", authn, limit)
+	// Strava tokens are stored per user, so the Strava routes authenticate
+	// too; only the OAuth callback stays open (see registerStravaOAuth).
+	app.Use("/strava", authn, limit)
+	app.Use("/oauth/strava/start", authn)
+	app.Use("/v1/jobs", spend)
+	deps.recovery = newRecoveryExports(cfg, logger)
+	// One provider and cache for the whole server, so circuit breakers see
+	// every request's failures and cached responses are reused.
+	var providerErr, promptsErr error
+	if deps.provider, providerErr = llm.NewProvider(cfg, logger); providerErr != nil {
+		logger.Error("llm provider", "error", providerErr)
+	}
+	if deps.cache, err = llm.NewCache(cfg); err != nil {
+		logger.Error("llm cache", "error", err)
+	}
+	if fetcher, err := llm.NewFetcher(&cfg.Fetch); err != nil {
+		logger.Error("llm fetcher", "error", err)
+	} else {
+		deps.fetcher = fetcher
+	}
+	if deps.prompts, promptsErr = llm.LoadPrompts(cfg.LlmPromptsDir, cfg.LlmPromptSet); promptsErr != nil {
+		logger.Error("llm prompts", "error", promptsErr)
+	}
+	if deps.location, err = time.LoadLocation(cfg.Timezone); err != nil {
+		logger.Error("timezone", "error", err)
+	}
+	registerReady(app, readinessChecks(cfg, st, deps, providerErr, promptsErr))
+	registerLLM(app, cfg, logger, st, deps)
+	mgr := registerJobs(app, cfg, logger, st, deps)
+	app.Hooks().OnShutdown(func() error {
+		mgr.Close()
+		return nil
+	})
+	registerStravaOAuth(app, cfg, st, logger, deps)
+	registerWorkouts(app, st, logger)
+	registerLocations(app, st, logger)
+	registerUsage(app, st, logger)
+	registerAdmin(app, st, logger)
 	// Serve a very basic frontend to exercise the OAuth flow and recent activities
 	app.Static("/", "./web")
-	return app
+	return app, nil
 }
@@ -0,0 +1,98 @@
+package httpapi
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	// sseKeepAlive is how often an idle event stream gets a comment line, so
+	// proxies and mobile networks keep it open and a vanished client is
+	// noticed.
+	sseKeepAlive = 15 * time.Second
+	// sseWriteWindow is how far each write pushes the connection's write
+	// deadline. The server applies WriteTimeout once per response, which
+	// would otherwise cut long streams off.
+	sseWriteWindow = 30 * time.Second
+)
+
+// sseStream writes server-sent events to a streamed response. Writes are
+// serialized so keep-alives can run alongside the producer.
+type sseStream struct {
+	mu   sync.Mutex
+	w    *bufio.Writer
+	conn net.Conn
+}
+
+// streamSSE sets the event-stream headers and streams the body through fn.
+// fn runs after the handler returns, so it must not touch c.
+func streamSSE(c *fiber.Ctx, fn func(s *sseStream)) {
+	c.Set(fiber.HeaderContentType, "text/event-stream")
+	c.Set(fiber.HeaderCacheControl, "no-cache")
+	c.Set(fiber.HeaderConnection, "keep-alive")
+	c.Set("X-Accel-Buffering", "no")
+	conn := c.Context().Conn()
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		fn(&sseStream{w: w, conn: conn})
+	})
+}
+
+// send writes one event with a JSON payload. Empty id or event names are
+// left out.
+func (s *sseStream) send(id, event string, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	var b strings.Builder
+	if id != "" {
+		fmt.Fprintf(&b, "id: %s\n", id)
+	}
+	if event != "" {
+		fmt.Fprintf(&b, "event: %s\n", event)
+	}
+	fmt.Fprintf(&b, "data: %s\n\n", data)
+	return s.write(b.String())
+}
+
+func (s *sseStream) comment(text string) error {
+	return s.write(": " + text + "\n\n")
+}
+
+func (s *sseStream) write(msg string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conn != nil {
+		s.conn.SetWriteDeadline(time.Now().Add(sseWriteWindow)) //nolint:errcheck
+	}
+	if _, err := s.w.WriteString(msg); err != nil {
+		return err
+	}
+	return s.w.Flush()
+}
+
+// keepAlive writes a comment every sseKeepAlive until ctx is done and calls
+// gone once a write fails, i.e. the client disconnected.
+func (s *sseStream) keepAlive(ctx context.Context, gone func()) {
+	ticker := time.NewTicker(sseKeepAlive)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.comment("keep-alive"); err != nil {
+				gone()
+				return
+			}
+		}
+	}
+}
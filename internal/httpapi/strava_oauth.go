@@ -2,53 +2,126 @@ package httpapi
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/aaronromeo/swolegen/internal/config"
+	"github.com/aaronromeo/swolegen/internal/llm"
+	"github.com/aaronromeo/swolegen/internal/store"
 	"github.com/aaronromeo/swolegen/internal/strava"
 	"github.com/gofiber/fiber/v2"
 )
 
 type stravaClient interface {
-	GetRecentActivities(ctx context.Context, sinceDays int) ([]strava.Activity, error)
+	GetRecentActivities(ctx context.Context, day time.Time, sinceDays int) ([]strava.Activity, error)
 }
 
 // newStravaClient is a factory for creating Strava clients. Tests may override this
 // to inject a client with a stubbed implementation.
-var newStravaClient = func(ts strava.TokenSource) stravaClient { return strava.NewWithTokenSource(ts) }
+var newStravaClient = func(ts strava.TokenSource, cfg config.StravaConfig) stravaClient {
+	return strava.NewWithTokenSource(ts, strava.WithTimeout(cfg.Timeout))
+}
 
-// OAuth endpoints for Strava (MVP single user).
+// storedToken is a user's Strava token from the store, refreshed and saved
+// back when it is about to expire.
+type storedToken struct {
+	st    store.Store
+	oauth *strava.OAuth
+	tok   *strava.Token
+}
 
-func registerStravaOAuth(app *fiber.App, _ *config.Config) {
+func (s *storedToken) Current(ctx context.Context) (*strava.Token, error) {
+	fresh, err := s.oauth.RefreshIfNeeded(ctx, s.tok)
+	if err != nil {
+		return nil, fmt.Errorf("refresh strava token: %w", err)
+	}
+	if fresh != s.tok {
+		if err := s.Save(ctx, fresh); err != nil {
+			return nil, err
+		}
+	}
+	return s.tok, nil
+}
+
+func (s *storedToken) Save(ctx context.Context, t *strava.Token) error {
+	if t == nil {
+		return nil
+	}
+	if err := s.st.PutStravaToken(ctx, toStoredToken(t)); err != nil {
+		return fmt.Errorf("save strava token: %w", err)
+	}
+	s.tok = t
+	return nil
+}
+
+func toStoredToken(t *strava.Token) store.StravaToken {
+	return store.StravaToken{AccessToken: t.AccessToken, RefreshToken: t.RefreshToken, ExpiresAt: t.ExpiresAt, Scope: t.Scope}
+}
+
+// registerStravaOAuth mounts the Strava OAuth flow and activity fetch. Every
+// route but the callback runs as the authenticated user; the callback is
+// reached from Strava's redirect, so it takes the user from the signed state
+// and stores the granted token under them. Activity windows end on the
+// session date, resolved on deps' clock and zone like the analyzer's.
+func registerStravaOAuth(app *fiber.App, cfg *config.Config, st store.Store, logger *slog.Logger, deps llmDeps) {
+	oauth := strava.NewOAuth(cfg.Strava)
 	app.Get("/oauth/strava/start", func(c *fiber.Ctx) error {
-		u, err := strava.AuthorizeURL()
+		u, err := oauth.AuthorizeURL(store.UserFrom(c.UserContext()))
 		if err != nil {
 			return c.Status(http.StatusInternalServerError).SendString(err.Error())
 		}
 		return c.Redirect(u, http.StatusFound)
 	})
 
+	// Browsers cannot send X-API-Key on a navigation, so the UI asks for the
+	// authorize URL here and then navigates to it.
+	app.Get("/v1/strava/authorize", func(c *fiber.Ctx) error {
+		u, err := oauth.AuthorizeURL(store.UserFrom(c.UserContext()))
+		if err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.JSON(fiber.Map{"authorize_url": u})
+	})
+
+	app.Delete("/v1/strava/token", func(c *fiber.Ctx) error {
+		err := st.DeleteStravaToken(c.UserContext())
+		if errors.Is(err, store.ErrNotFound) {
+			return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "no strava token"})
+		}
+		if err != nil {
+			reqLogger(c, logger).Error("delete strava token", "error", err)
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.SendStatus(http.StatusNoContent)
+	})
+
 	app.Get("/oauth/strava/callback", func(c *fiber.Ctx) error {
-		state := c.Query("state")
-		if err := strava.ValidateState(state); err != nil {
+		user, err := oauth.ValidateState(c.Query("state"))
+		if err != nil {
+			return c.Status(http.StatusBadRequest).SendString("invalid state")
+		}
+		if err := store.ValidateUser(user); err != nil {
 			return c.Status(http.StatusBadRequest).SendString("invalid state")
 		}
 		code := c.Query("code")
 		if code == "" {
 			return c.Status(http.StatusBadRequest).SendString("missing code")
 		}
-		tok, err := strava.ExchangeCode(context.Background(), code)
+		tok, err := oauth.ExchangeCode(c.UserContext(), code)
 		if err != nil {
 			return c.Status(http.StatusInternalServerError).SendString(err.Error())
 		}
-		// Return token JSON so user can persist if desired.
-		c.Set("Content-Type", "application/json")
-		enc := json.NewEncoder(c)
-		enc.SetIndent("", "  ")
-		return enc.Encode(tok)
+		if err := st.PutStravaToken(store.WithUser(c.UserContext(), user), toStoredToken(tok)); err != nil {
+			reqLogger(c, logger).Error("save strava token", "error", err, "user", user)
+			return c.Status(http.StatusInternalServerError).SendString("save strava token failed")
+		}
+		reqLogger(c, logger).Info("connected strava", "user", user)
+		return c.Redirect("/?strava=connected", http.StatusFound)
 	})
 
 	// Fetch recent activities with optional user token (GET and POST)
@@ -58,32 +131,36 @@ func registerStravaOAuth(app *fiber.App, _ *config.Config) {
 		if err != nil || days < 0 {
 			days = 7
 		}
-
-		// Check for user-provided token in Authorization header (OAuth 2.0 standard)
-		var userToken *strava.Token
-		authHeader := c.Get("Authorization")
-		if authHeader != "" && strings.HasPrefix(authHeader, "Bearer ") {
-			accessToken := strings.TrimPrefix(authHeader, "Bearer ")
-			userToken = &strava.Token{AccessToken: accessToken}
+		day, err := llm.SessionDay(c.Query("session_date"), c.Query("timezone"), deps.now(), deps.location)
+		if err != nil {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
 		}
 
-		var cl stravaClient
+		// An Authorization header overrides the caller's stored token.
 		var tokenSource strava.TokenSource
-
-		if userToken != nil {
-			// Try with user-provided token
-			tokenSource = &strava.UserTokenSource{Token: userToken}
-			cl = newStravaClient(tokenSource)
+		if token, ok := strings.CutPrefix(c.Get("Authorization"), "Bearer "); ok && token != "" {
+			tokenSource = &strava.UserTokenSource{Token: &strava.Token{AccessToken: token}}
 		} else {
-			return c.Status(http.StatusUnauthorized).JSON(fiber.Map{
-				"error":          "No user token provided; OAuth handshake required",
-				"oauth_url":      "/oauth/strava/start",
-				"message":        "Please authenticate with Strava first",
-				"requires_oauth": true,
-			})
+			t, err := st.GetStravaToken(c.UserContext())
+			if errors.Is(err, store.ErrNotFound) {
+				return c.Status(http.StatusUnauthorized).JSON(fiber.Map{
+					"error":          "No Strava token for this user; OAuth handshake required",
+					"oauth_url":      "/oauth/strava/start",
+					"message":        "Please authenticate with Strava first",
+					"requires_oauth": true,
+				})
+			}
+			if err != nil {
+				reqLogger(c, logger).Error("get strava token", "error", err)
+				return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+			}
+			tokenSource = &storedToken{st: st, oauth: oauth, tok: &strava.Token{
+				AccessToken: t.AccessToken, RefreshToken: t.RefreshToken, ExpiresAt: t.ExpiresAt, Scope: t.Scope,
+			}}
 		}
+		cl := newStravaClient(tokenSource, cfg.Strava)
 
-		acts, err := cl.GetRecentActivities(context.Background(), days)
+		acts, err := cl.GetRecentActivities(c.UserContext(), day, days)
 		if err != nil {
 			return c.Status(http.StatusUnauthorized).JSON(fiber.Map{
 				"error":          err.Error(),
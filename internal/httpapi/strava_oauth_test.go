@@ -3,12 +3,16 @@ package httpapi
 import (
 	"context"
 	"encoding/json"
+	"io"
+	"log/slog"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/aaronromeo/swolegen/internal/config"
+	"github.com/aaronromeo/swolegen/internal/store"
 	"github.com/aaronromeo/swolegen/internal/strava"
 	"github.com/gofiber/fiber/v2"
 )
@@ -16,9 +20,14 @@ import (
 type fakeStravaClient struct {
 	acts []strava.Activity
 	err  error
+	// day, when set, records the session day the window ends on.
+	day *time.Time
 }
 
-func (f fakeStravaClient) GetRecentActivities(_ context.Context, sinceDays int) ([]strava.Activity, error) {
+func (f fakeStravaClient) GetRecentActivities(_ context.Context, day time.Time, sinceDays int) ([]strava.Activity, error) {
+	if f.day != nil {
+		*f.day = day
+	}
 	return f.acts, f.err
 }
 
@@ -28,12 +37,12 @@ func TestStravaRecentEndpoint(t *testing.T) {
 
 	// By default, use a fake client to avoid real HTTP calls.
 	savedFactory := newStravaClient
-	newStravaClient = func(ts strava.TokenSource) stravaClient {
+	newStravaClient = func(ts strava.TokenSource, _ config.StravaConfig) stravaClient {
 		return fakeStravaClient{acts: []strava.Activity{{Name: "Morning Run", Type: "Run"}}}
 	}
 	t.Cleanup(func() { newStravaClient = savedFactory })
 
-	registerStravaOAuth(app, &config.Config{})
+	registerStravaOAuth(app, &config.Config{}, store.NewMemory(), slog.New(slog.NewTextHandler(io.Discard, nil)), llmDeps{})
 
 	t.Run("no token provided - should suggest OAuth", func(t *testing.T) {
 		req := httptest.NewRequest("GET", "/strava/recent", nil)
@@ -63,7 +72,7 @@ func TestStravaRecentEndpoint(t *testing.T) {
 		if os.Getenv("RUN_STRAVA_REAL") == "1" {
 			// In real mode, restore factory to use the real client
 			saved := newStravaClient
-			newStravaClient = func(ts strava.TokenSource) stravaClient { return strava.NewWithTokenSource(ts) }
+			newStravaClient = func(ts strava.TokenSource, _ config.StravaConfig) stravaClient { return strava.NewWithTokenSource(ts) }
 			t.Cleanup(func() { newStravaClient = saved })
 		}
 
@@ -129,3 +138,52 @@ func TestStravaRecentEndpoint(t *testing.T) {
 		}
 	})
 }
+
+func TestStravaRecentSessionDate(t *testing.T) {
+	var day time.Time
+	savedFactory := newStravaClient
+	newStravaClient = func(strava.TokenSource, config.StravaConfig) stravaClient {
+		return fakeStravaClient{day: &day}
+	}
+	t.Cleanup(func() { newStravaClient = savedFactory })
+	toronto, err := time.LoadLocation("America/Toronto")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 21:30 in Toronto is already the next day in UTC.
+	clock := func() time.Time { return time.Date(2025, 8, 10, 1, 30, 0, 0, time.UTC) }
+	app := fiber.New()
+	registerStravaOAuth(app, &config.Config{}, store.NewMemory(), slog.New(slog.NewTextHandler(io.Discard, nil)),
+		llmDeps{clock: clock, location: toronto})
+
+	for _, tc := range []struct {
+		query string
+		want  time.Time
+	}{
+		{"", time.Date(2025, 8, 9, 0, 0, 0, 0, toronto)},
+		{"?timezone=UTC", time.Date(2025, 8, 10, 0, 0, 0, 0, time.UTC)},
+		{"?session_date=2025-03-01&timezone=Asia/Tokyo", time.Date(2025, 2, 28, 15, 0, 0, 0, time.UTC)},
+	} {
+		req := httptest.NewRequest("GET", "/strava/recent"+tc.query, nil)
+		req.Header.Set("Authorization", "Bearer test-token")
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("app.Test error: %v", err)
+		}
+		resp.Body.Close() //nolint:errcheck
+		if resp.StatusCode != http.StatusOK || !day.Equal(tc.want) {
+			t.Errorf("%q: status %d, window ends on %v; want %v", tc.query, resp.StatusCode, day, tc.want)
+		}
+	}
+
+	req := httptest.NewRequest("GET", "/strava/recent?session_date=08/09/2025", nil)
+	req.Header.Set("Authorization", "Bearer test-token")
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatalf("app.Test error: %v", err)
+	}
+	defer resp.Body.Close() //nolint:errcheck
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected 400 for a malformed session_date, got %d", resp.StatusCode)
+	}
+}
@@ -0,0 +1,52 @@
+package httpapi
+
+import (
+	"net/http"
+
+	"github.com/aaronromeo/swolegen/internal/logging"
+	"github.com/aaronromeo/swolegen/internal/tracing"
+	"github.com/gofiber/fiber/v2"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "github.com/aaronromeo/swolegen/internal/httpapi"
+
+// headerCarrier reads trace context from request headers.
+type headerCarrier struct{ c *fiber.Ctx }
+
+func (h headerCarrier) Get(key string) string { return h.c.Get(key) }
+func (h headerCarrier) Set(string, string)    {}
+func (h headerCarrier) Keys() []string        { return nil }
+
+// traceRequests starts a server span per request, continuing the trace a
+// caller sent in traceparent, and adds its trace_id to the request logger.
+// The span is named by the matched route, not the path, to keep span names
+// low-cardinality.
+func traceRequests() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		ctx := otel.GetTextMapPropagator().Extract(c.UserContext(), headerCarrier{c})
+		ctx, span := tracing.Tracer(tracerName).Start(ctx, c.Method(), trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(attribute.String("http.request.method", c.Method())))
+		if sc := span.SpanContext(); sc.IsValid() {
+			ctx = logging.WithLogger(ctx, logging.FromContext(ctx, nil).With("trace_id", sc.TraceID().String()))
+		}
+		c.SetUserContext(ctx)
+
+		err := c.Next()
+
+		status := statusOf(c, err)
+		span.SetName(c.Method() + " " + c.Route().Path)
+		span.SetAttributes(
+			attribute.String("http.route", c.Route().Path),
+			attribute.Int("http.response.status_code", status),
+		)
+		if status >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(status))
+		}
+		span.End()
+		return err
+	}
+}
@@ -0,0 +1,120 @@
+package httpapi
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/aaronromeo/swolegen/internal/llm"
+	"github.com/aaronromeo/swolegen/internal/logging"
+	"github.com/aaronromeo/swolegen/internal/store"
+	"github.com/gofiber/fiber/v2"
+)
+
+// Response headers carrying the LLM usage of the request.
+const (
+	headerLLMCalls            = "X-LLM-Calls"
+	headerLLMRepairs          = "X-LLM-Repairs"
+	headerLLMCacheHits        = "X-LLM-Cache-Hits"
+	headerLLMPromptTokens     = "X-LLM-Prompt-Tokens"
+	headerLLMCompletionTokens = "X-LLM-Completion-Tokens"
+	headerLLMCost             = "X-LLM-Cost-USD"
+)
+
+// usageDay is one day of /v1/usage: the day's totals and its per-model
+// rollups.
+type usageDay struct {
+	store.Usage
+	Models []store.Usage `json:"models"`
+}
+
+// registerUsage mounts /v1/usage, which reports the caller's own spend.
+// Admins may pass ?user=<id> for another user or ?user=* for everyone.
+func registerUsage(app *fiber.App, st store.Store, logger *slog.Logger) {
+	app.Get("/v1/usage", func(c *fiber.Ctx) error {
+		user := store.UserFrom(c.UserContext())
+		if q := c.Query("user"); q != "" && q != user {
+			if !isAdmin(c) {
+				return c.Status(http.StatusForbidden).JSON(fiber.Map{"error": "admin api key required for another user's usage"})
+			}
+			user = q
+			if q == "*" {
+				user = ""
+			}
+		}
+		rows, err := st.ListUsage(c.UserContext(), store.UsageFilter{
+			From: c.Query("from"),
+			To:   c.Query("to"),
+			User: user,
+		})
+		if err != nil {
+			reqLogger(c, logger).Error("list usage", "error", err)
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+
+		days := []usageDay{}
+		total := store.Usage{}
+		for _, row := range rows {
+			if len(days) == 0 || days[len(days)-1].Date != row.Date {
+				days = append(days, usageDay{Usage: store.Usage{Date: row.Date}})
+			}
+			day := &days[len(days)-1]
+			day.Add(row)
+			day.Models = append(day.Models, row)
+			total.Add(row)
+		}
+		return c.JSON(fiber.Map{"days": days, "total": total})
+	})
+}
+
+// trackUsage reports the LLM usage of cli in the response headers and adds
+// it to the rollups of the day at falls on. Failed runs are tracked too;
+// they still cost.
+func trackUsage(c *fiber.Ctx, st store.Store, logger *slog.Logger, cli *llm.Client, at time.Time) {
+	u := cli.Usage()
+	c.Set(headerLLMCalls, strconv.Itoa(len(u.Calls)))
+	c.Set(headerLLMRepairs, strconv.Itoa(u.Repairs))
+	c.Set(headerLLMCacheHits, strconv.Itoa(u.CacheHits))
+	c.Set(headerLLMPromptTokens, strconv.FormatInt(u.PromptTokens, 10))
+	c.Set(headerLLMCompletionTokens, strconv.FormatInt(u.CompletionTokens, 10))
+	c.Set(headerLLMCost, strconv.FormatFloat(u.CostUSD, 'f', 6, 64))
+	recordUsage(c.UserContext(), st, logger, u, at)
+}
+
+// recordUsage adds u to the store's rollups for the UTC day at falls on,
+// one row per model, under the user ctx is scoped to.
+func recordUsage(ctx context.Context, st store.Store, logger *slog.Logger, u llm.Usage, at time.Time) {
+	if len(u.Calls) == 0 {
+		return
+	}
+	date := at.UTC().Format("2006-01-02")
+	user := store.UserFrom(ctx)
+	rows := map[string]*store.Usage{}
+	var order []string
+	for _, call := range u.Calls {
+		row, ok := rows[call.Model]
+		if !ok {
+			row = &store.Usage{Date: date, User: user, Model: call.Model}
+			rows[call.Model] = row
+			order = append(order, call.Model)
+		}
+		row.Calls++
+		if call.Attempt > 0 {
+			row.Repairs++
+		}
+		if call.Failed {
+			row.Failed++
+		}
+		row.PromptTokens += call.PromptTokens
+		row.CompletionTokens += call.CompletionTokens
+		row.CostUSD += call.CostUSD
+	}
+	rows[order[0]].Requests = 1
+	for _, model := range order {
+		if err := st.AddUsage(ctx, *rows[model]); err != nil {
+			logging.FromContext(ctx, logger).Error("record llm usage", "model", model, "error", err)
+		}
+	}
+}
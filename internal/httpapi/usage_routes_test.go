@@ -0,0 +1,62 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/aaronromeo/swolegen/internal/config"
+	"github.com/aaronromeo/swolegen/internal/llm"
+	"github.com/aaronromeo/swolegen/internal/store"
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestUsageAccounting(t *testing.T) {
+	useFakeLLM(t, false)
+	fake := newLLMClient
+	newLLMClient = func(cfg *config.Config, logger *slog.Logger, deps llmDeps, opts ...llm.LLMClientOption) (*llm.Client, error) {
+		return fake(cfg, logger, deps, append(opts, llm.WithPrices(llm.Prices{"gpt-4o-mini": {Input: 0.15, Output: 0.60}}))...)
+	}
+	st := store.NewMemory()
+	app := fiber.New()
+	registerLLM(app, &config.Config{}, slog.Default(), st, llmDeps{})
+	registerUsage(app, st, slog.Default())
+
+	for range 2 {
+		req := httptest.NewRequest("POST", "/llm/analyze", strings.NewReader(`{"location":"home","duration_minutes":45}`))
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("app.Test error: %v", err)
+		}
+		resp.Body.Close() //nolint:errcheck
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("expected 200, got %d", resp.StatusCode)
+		}
+		if resp.Header.Get(headerLLMCalls) != "1" || resp.Header.Get(headerLLMPromptTokens) != "1000" || resp.Header.Get(headerLLMCost) != "0.000450" {
+			t.Fatalf("unexpected usage headers: %v", resp.Header)
+		}
+	}
+
+	resp, err := app.Test(httptest.NewRequest("GET", "/v1/usage", nil))
+	if err != nil {
+		t.Fatalf("app.Test error: %v", err)
+	}
+	defer resp.Body.Close() //nolint:errcheck
+	var body struct {
+		Days  []usageDay  `json:"days"`
+		Total store.Usage `json:"total"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(body.Days) != 1 || body.Days[0].Requests != 2 || len(body.Days[0].Models) != 1 {
+		t.Fatalf("expected one day with two requests, got %+v", body.Days)
+	}
+	if body.Total.PromptTokens != 2000 || body.Total.CompletionTokens != 1000 {
+		t.Fatalf("unexpected totals: %+v", body.Total)
+	}
+}
@@ -0,0 +1,148 @@
+package httpapi
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/aaronromeo/swolegen/internal/llm"
+	"github.com/aaronromeo/swolegen/internal/llm/schemas"
+	"github.com/aaronromeo/swolegen/internal/store"
+	"github.com/aaronromeo/swolegen/internal/workout"
+	"github.com/gofiber/fiber/v2"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
+)
+
+// workoutSummary is the listing view of a stored workout (no YAML or plan).
+type workoutSummary struct {
+	WorkoutID     string    `json:"workout_id"`
+	Date          string    `json:"date"`
+	Location      string    `json:"location"`
+	SessionType   string    `json:"session_type"`
+	CreatedAt     time.Time `json:"created_at"`
+	InputsHash    string    `json:"inputs_hash,omitempty"`
+	Provider      string    `json:"provider,omitempty"`
+	Model         string    `json:"model,omitempty"`
+	PromptVersion string    `json:"prompt_version,omitempty"`
+}
+
+// workoutDetail is the JSON view of a stored workout.
+type workoutDetail struct {
+	workoutSummary
+	Plan    *schemas.AnalyzerV1Json `json:"plan,omitempty"`
+	Workout any                     `json:"workout"`
+}
+
+func summarize(w store.Workout) workoutSummary {
+	return workoutSummary{
+		WorkoutID:     w.ID,
+		Date:          w.Date,
+		Location:      w.Location,
+		SessionType:   w.SessionType,
+		CreatedAt:     w.CreatedAt,
+		InputsHash:    w.InputsHash,
+		Provider:      w.Provider,
+		Model:         w.Model,
+		PromptVersion: w.PromptVersion,
+	}
+}
+
+func registerWorkouts(app *fiber.App, st store.Store, logger *slog.Logger) {
+	app.Get("/v1/workouts", func(c *fiber.Ctx) error {
+		limit := c.QueryInt("limit", defaultPageSize)
+		if limit <= 0 || limit > maxPageSize {
+			limit = defaultPageSize
+		}
+
+		// Ask for one extra workout to learn whether another page follows.
+		list, err := st.ListWorkouts(c.UserContext(), store.WorkoutFilter{
+			From:        c.Query("from"),
+			To:          c.Query("to"),
+			Location:    c.Query("location"),
+			SessionType: c.Query("session_type"),
+			Before:      c.Query("cursor"),
+			Limit:       limit + 1,
+		})
+		if err != nil {
+			reqLogger(c, logger).Error("list workouts", "error", err)
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+
+		page := []workoutSummary{}
+		for i := 0; i < len(list) && i < limit; i++ {
+			page = append(page, summarize(list[i]))
+		}
+		resp := fiber.Map{
+			"workouts": page,
+			"limit":    limit,
+		}
+		if len(list) > limit {
+			resp["next_cursor"] = list[limit-1].ID
+		}
+		return c.JSON(resp)
+	})
+
+	app.Get("/v1/workouts/:workout_id", func(c *fiber.Ctx) error {
+		w, err := st.GetWorkout(c.UserContext(), c.Params("workout_id"))
+		if errors.Is(err, store.ErrNotFound) {
+			return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "workout not found"})
+		}
+		if err != nil {
+			reqLogger(c, logger).Error("get workout", "error", err)
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+
+		if wantsYAML(c) {
+			c.Set(fiber.HeaderContentType, "application/yaml")
+			return c.Send(w.YAML)
+		}
+		var doc any
+		if err := yaml.Unmarshal(w.YAML, &doc); err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "stored workout yaml: " + err.Error()})
+		}
+		return c.JSON(workoutDetail{workoutSummary: summarize(w), Plan: w.Plan, Workout: doc})
+	})
+
+	app.Delete("/v1/workouts/:workout_id", func(c *fiber.Ctx) error {
+		err := st.DeleteWorkout(c.UserContext(), c.Params("workout_id"))
+		if errors.Is(err, store.ErrNotFound) {
+			return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": "workout not found"})
+		}
+		if err != nil {
+			reqLogger(c, logger).Error("delete workout", "error", err)
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.SendStatus(http.StatusNoContent)
+	})
+}
+
+// wantsYAML picks YAML when asked for via ?format=yaml or the Accept header.
+func wantsYAML(c *fiber.Ctx) bool {
+	if f := strings.ToLower(c.Query("format")); f != "" {
+		return f == "yaml" || f == "yml"
+	}
+	accept := strings.ToLower(c.Get(fiber.HeaderAccept))
+	return strings.Contains(accept, "yaml")
+}
+
+// saveWorkout records a generated workout, created at now, with the client's
+// provenance and the seed and inputs hash of the analysis that produced plan.
+func saveWorkout(ctx context.Context, st store.Store, cli *llm.Client, plan schemas.AnalyzerV1Json, seed, inputsHash string, out []byte, now time.Time) (store.Workout, error) {
+	providerName, _ := cli.ProviderInfo()
+	model := cli.StageModel(llm.StageGenerating)
+	return workout.Save(ctx, st, plan, out, workout.Provenance{
+		Seed:          seed,
+		InputsHash:    inputsHash,
+		Provider:      providerName,
+		Model:         model,
+		PromptVersion: cli.PromptVersion(),
+	}, now)
+}
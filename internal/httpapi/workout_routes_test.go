@@ -0,0 +1,171 @@
+package httpapi
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aaronromeo/swolegen/internal/store"
+	"github.com/gofiber/fiber/v2"
+)
+
+func newWorkoutsApp(t *testing.T) (*fiber.App, store.Store) {
+	t.Helper()
+	st := store.NewMemory()
+	ctx := context.Background()
+	for _, w := range []store.Workout{
+		{ID: "2025-08-07-home-11", Date: "2025-08-07", Location: "home", SessionType: "pull", YAML: []byte("workout_id: 2025-08-07-home-11\n")},
+		{ID: "2025-08-08-gym-22", Date: "2025-08-08", Location: "gym", SessionType: "push", YAML: []byte("workout_id: 2025-08-08-gym-22\n")},
+		{ID: "2025-08-09-home-33", Date: "2025-08-09", Location: "home", SessionType: "lower", YAML: []byte("workout_id: 2025-08-09-home-33\nlocation: home\n"), Model: "gpt-4o-mini", CreatedAt: time.Now()},
+	} {
+		if err := st.PutWorkout(ctx, w); err != nil {
+			t.Fatalf("PutWorkout: %v", err)
+		}
+	}
+	app := fiber.New()
+	registerWorkouts(app, st, slog.Default())
+	return app, st
+}
+
+func TestListWorkouts(t *testing.T) {
+	app, _ := newWorkoutsApp(t)
+
+	t.Run("filter and paginate", func(t *testing.T) {
+		resp, err := app.Test(httptest.NewRequest("GET", "/v1/workouts?location=home&limit=1", nil))
+		if err != nil {
+			t.Fatalf("app.Test error: %v", err)
+		}
+		defer resp.Body.Close() //nolint:errcheck
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("expected 200, got %d", resp.StatusCode)
+		}
+		var result struct {
+			Workouts   []workoutSummary `json:"workouts"`
+			NextCursor string           `json:"next_cursor"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		if len(result.Workouts) != 1 || result.Workouts[0].WorkoutID != "2025-08-09-home-33" {
+			t.Fatalf("unexpected page: %+v", result)
+		}
+		if result.NextCursor != "2025-08-09-home-33" {
+			t.Fatalf("expected next_cursor 2025-08-09-home-33, got %q", result.NextCursor)
+		}
+
+		resp, err = app.Test(httptest.NewRequest("GET", "/v1/workouts?location=home&limit=1&cursor="+result.NextCursor, nil))
+		if err != nil {
+			t.Fatalf("app.Test error: %v", err)
+		}
+		defer resp.Body.Close() //nolint:errcheck
+		result.NextCursor = ""
+		if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		if len(result.Workouts) != 1 || result.Workouts[0].WorkoutID != "2025-08-07-home-11" || result.NextCursor != "" {
+			t.Fatalf("unexpected last page: %+v", result)
+		}
+	})
+
+	t.Run("date range", func(t *testing.T) {
+		resp, err := app.Test(httptest.NewRequest("GET", "/v1/workouts?from=2025-08-08&to=2025-08-08&session_type=push", nil))
+		if err != nil {
+			t.Fatalf("app.Test error: %v", err)
+		}
+		defer resp.Body.Close() //nolint:errcheck
+		var result struct {
+			Workouts []workoutSummary `json:"workouts"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		if len(result.Workouts) != 1 {
+			t.Fatalf("expected 1 workout, got %d", len(result.Workouts))
+		}
+	})
+}
+
+func TestGetWorkout(t *testing.T) {
+	app, _ := newWorkoutsApp(t)
+
+	t.Run("json", func(t *testing.T) {
+		resp, err := app.Test(httptest.NewRequest("GET", "/v1/workouts/2025-08-09-home-33", nil))
+		if err != nil {
+			t.Fatalf("app.Test error: %v", err)
+		}
+		defer resp.Body.Close() //nolint:errcheck
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("expected 200, got %d", resp.StatusCode)
+		}
+		var result map[string]any
+		if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		if result["model"] != "gpt-4o-mini" {
+			t.Fatalf("expected model in detail, got %v", result["model"])
+		}
+		doc, ok := result["workout"].(map[string]any)
+		if !ok || doc["location"] != "home" {
+			t.Fatalf("expected parsed workout document, got %v", result["workout"])
+		}
+	})
+
+	t.Run("yaml via accept", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/v1/workouts/2025-08-09-home-33", nil)
+		req.Header.Set("Accept", "application/yaml")
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("app.Test error: %v", err)
+		}
+		defer resp.Body.Close() //nolint:errcheck
+		body, _ := io.ReadAll(resp.Body)
+		if !strings.HasPrefix(string(body), "workout_id: 2025-08-09-home-33") {
+			t.Fatalf("expected raw yaml, got %q", body)
+		}
+		if ct := resp.Header.Get("Content-Type"); ct != "application/yaml" {
+			t.Fatalf("expected application/yaml, got %q", ct)
+		}
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		resp, err := app.Test(httptest.NewRequest("GET", "/v1/workouts/nope", nil))
+		if err != nil {
+			t.Fatalf("app.Test error: %v", err)
+		}
+		defer resp.Body.Close() //nolint:errcheck
+		if resp.StatusCode != http.StatusNotFound {
+			t.Fatalf("expected 404, got %d", resp.StatusCode)
+		}
+	})
+}
+
+func TestDeleteWorkout(t *testing.T) {
+	app, st := newWorkoutsApp(t)
+
+	resp, err := app.Test(httptest.NewRequest("DELETE", "/v1/workouts/2025-08-07-home-11", nil))
+	if err != nil {
+		t.Fatalf("app.Test error: %v", err)
+	}
+	defer resp.Body.Close() //nolint:errcheck
+	if resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("expected 204, got %d", resp.StatusCode)
+	}
+	if _, err := st.GetWorkout(context.Background(), "2025-08-07-home-11"); err == nil {
+		t.Fatalf("expected workout to be deleted")
+	}
+
+	resp2, err := app.Test(httptest.NewRequest("DELETE", "/v1/workouts/2025-08-07-home-11", nil))
+	if err != nil {
+		t.Fatalf("app.Test error: %v", err)
+	}
+	defer resp2.Body.Close() //nolint:errcheck
+	if resp2.StatusCode != http.StatusNotFound {
+		t.Fatalf("expected 404 on second delete, got %d", resp2.StatusCode)
+	}
+}
@@ -1,13 +1,21 @@
 package id
 
 import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"regexp"
+	"sort"
 	"strings"
 
 	"github.com/cespare/xxhash/v2"
 )
 
+// seedVersion prefixes the canonical seed encoding; bump it only if the
+// encoding changes, since that changes every derived workout_id.
+const seedVersion = "v1"
+
 var nonAlnum = regexp.MustCompile(`[^A-Za-z0-9]+`)
 var multiDash = regexp.MustCompile(`-+`)
 
@@ -33,13 +41,69 @@ func Slug(name string) string {
 	return s
 }
 
+// SeedInputs are the generation inputs a workout_id is derived from.
+type SeedInputs struct {
+	Date            string
+	Location        string
+	DurationMinutes int
+	Units           string
+	Equipment       []string
+	// HistoryDigest identifies the training history the session was planned
+	// from (see Digest).
+	HistoryDigest string
+}
+
+// Seed returns the canonical seed for in: a hex SHA-256 over a normalized,
+// order-independent encoding, so equal inputs always yield the same seed.
+func Seed(in SeedInputs) string {
+	units := strings.ToLower(strings.TrimSpace(in.Units))
+	if units == "" {
+		units = "lbs"
+	}
+	seen := map[string]bool{}
+	equipment := []string{}
+	for _, e := range in.Equipment {
+		e = strings.ToLower(strings.TrimSpace(e))
+		if e == "" || seen[e] {
+			continue
+		}
+		seen[e] = true
+		equipment = append(equipment, e)
+	}
+	sort.Strings(equipment)
+
+	canonical := strings.Join([]string{
+		seedVersion,
+		"date=" + strings.TrimSpace(in.Date),
+		"location=" + strings.ToLower(strings.TrimSpace(in.Location)),
+		fmt.Sprintf("duration=%d", in.DurationMinutes),
+		"units=" + units,
+		"equipment=" + strings.Join(equipment, ","),
+		"history=" + in.HistoryDigest,
+	}, "\n")
+	return Digest([]byte(canonical))
+}
+
+// Digest returns the hex SHA-256 of b.
+func Digest(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
 // WorkoutID builds YYYY-MM-DD-<kebab-location>-NN where NN is xxhash(seed)%100.
 func WorkoutID(dateISO, location string, seedInput []byte) string {
+	return WorkoutIDAttempt(dateISO, location, seedInput, 0)
+}
+
+// WorkoutIDAttempt is WorkoutID with NN bumped by attempt (mod 100). Callers
+// resolve collisions by trying attempts 0, 1, 2, … in order, which keeps the
+// chosen ID deterministic for a given store state.
+func WorkoutIDAttempt(dateISO, location string, seedInput []byte, attempt int) string {
 	loc := strings.ToLower(location)
 	loc = nonAlnum.ReplaceAllString(loc, "-")
 	loc = multiDash.ReplaceAllString(loc, "-")
 	loc = strings.Trim(loc, "-")
-	h := xxhash.Sum64(seedInput) % 100
+	h := (xxhash.Sum64(seedInput)%100 + uint64(attempt)) % 100
 	return fmt.Sprintf("%s-%s-%02d", dateISO, loc, h)
 }
 
@@ -50,3 +114,13 @@ func SetID(tier, slug string, n int, warmup bool) string {
 	}
 	return fmt.Sprintf("%s-%s-%d", strings.ToUpper(tier), Slug(slug), n)
 }
+
+// Random returns n random bytes, hex encoded, for IDs that must not be
+// guessed. Callers handle the error rather than panic or ignore it.
+func Random(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("random id: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -74,3 +74,53 @@ func TestSetID_Table(t *testing.T) {
 		}
 	}
 }
+
+func TestSeed_Canonical(t *testing.T) {
+	base := SeedInputs{
+		Date: "2025-08-09", Location: "Home", DurationMinutes: 45,
+		Equipment: []string{"barbell", "db_set_5-100", "Barbell "}, HistoryDigest: "abc",
+	}
+	reordered := SeedInputs{
+		Date: "2025-08-09", Location: " home", DurationMinutes: 45, Units: "LBS",
+		Equipment: []string{"db_set_5-100", "barbell"}, HistoryDigest: "abc",
+	}
+	if Seed(base) != Seed(reordered) {
+		t.Fatalf("equivalent inputs produced different seeds")
+	}
+
+	changed := base
+	changed.HistoryDigest = "abd"
+	if Seed(base) == Seed(changed) {
+		t.Fatalf("history digest change did not change the seed")
+	}
+	changed = base
+	changed.DurationMinutes = 60
+	if Seed(base) == Seed(changed) {
+		t.Fatalf("duration change did not change the seed")
+	}
+}
+
+func TestWorkoutIDAttempt_Bumps(t *testing.T) {
+	seed := []byte("seed")
+	base := int(xxhash.Sum64(seed) % 100)
+	for attempt := 0; attempt < 101; attempt++ {
+		want := fmt.Sprintf("2025-08-09-home-%02d", (base+attempt)%100)
+		if got := WorkoutIDAttempt("2025-08-09", "home", seed, attempt); got != want {
+			t.Fatalf("attempt %d: got %q; want %q", attempt, got, want)
+		}
+	}
+	if WorkoutIDAttempt("2025-08-09", "home", seed, 0) != WorkoutID("2025-08-09", "home", seed) {
+		t.Fatalf("attempt 0 must match WorkoutID")
+	}
+}
+
+func TestRandom(t *testing.T) {
+	a, err := Random(8)
+	if err != nil {
+		t.Fatalf("Random: %v", err)
+	}
+	b, _ := Random(8)
+	if len(a) != 16 || a == b {
+		t.Fatalf("Random(8) = %q, %q; want 16 distinct hex chars", a, b)
+	}
+}
@@ -0,0 +1,342 @@
+// Package jobs runs long analyze/generate work in the background on a
+// bounded worker pool, recording each job's state transitions so clients can
+// poll or stream them.
+package jobs
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/aaronromeo/swolegen/internal/id"
+)
+
+var (
+	// ErrNotFound is returned for unknown (or pruned) job IDs.
+	ErrNotFound = errors.New("jobs: not found")
+	// ErrQueueFull is returned when every worker is busy and the queue is full.
+	ErrQueueFull = errors.New("jobs: queue full")
+	// ErrClosed is returned by Submit after Close.
+	ErrClosed = errors.New("jobs: manager closed")
+)
+
+const (
+	defaultWorkers   = 2
+	defaultQueueSize = 16
+	defaultRetention = time.Hour
+	// subscriberBuffer bounds the events buffered per stream; a subscriber
+	// that falls further behind is dropped and should resume from its last
+	// seen sequence number.
+	subscriberBuffer = 32
+)
+
+// State is a job's lifecycle state. Running jobs report their own states
+// (e.g. the llm stages) between StateQueued and a terminal state.
+type State string
+
+const (
+	StateQueued   State = "queued"
+	StateDone     State = "done"
+	StateFailed   State = "failed"
+	StateCanceled State = "canceled"
+)
+
+// Terminal reports whether no further transitions follow s.
+func (s State) Terminal() bool {
+	return s == StateDone || s == StateFailed || s == StateCanceled
+}
+
+// Job is a snapshot of a job's status. Owner is set by SubmitAs and never
+// serialized.
+type Job struct {
+	ID        string    `json:"id"`
+	Owner     string    `json:"-"`
+	State     State     `json:"state"`
+	Attempt   int       `json:"attempt,omitempty"`
+	Error     string    `json:"error,omitempty"`
+	Result    any       `json:"result,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Event is one state transition. Seq starts at 1 and increases by one per
+// event within a job.
+type Event struct {
+	Seq     int       `json:"seq"`
+	State   State     `json:"state"`
+	Attempt int       `json:"attempt,omitempty"`
+	Error   string    `json:"error,omitempty"`
+	At      time.Time `json:"at"`
+}
+
+// Reporter records that a running job entered state.
+type Reporter func(state State, attempt int)
+
+// Func is the work a job performs. It should return promptly once ctx is
+// canceled; its result is exposed as Job.Result.
+type Func func(ctx context.Context, report Reporter) (any, error)
+
+type entry struct {
+	job    Job
+	events []Event
+	subs   map[chan Event]struct{}
+	fn     Func
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// Manager owns the worker pool and the in-memory job table. Finished jobs
+// are kept for the retention period so clients can still fetch results.
+type Manager struct {
+	mu        sync.Mutex
+	jobs      map[string]*entry
+	queue     chan *entry
+	closed    bool
+	workers   int
+	queueSize int
+	retention time.Duration
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+type Option func(*Manager)
+
+// WithWorkers sets how many jobs run concurrently.
+func WithWorkers(n int) Option {
+	return func(m *Manager) {
+		if n > 0 {
+			m.workers = n
+		}
+	}
+}
+
+// WithQueueSize sets how many jobs may wait for a worker.
+func WithQueueSize(n int) Option {
+	return func(m *Manager) {
+		if n >= 0 {
+			m.queueSize = n
+		}
+	}
+}
+
+// WithRetention sets how long finished jobs stay queryable.
+func WithRetention(d time.Duration) Option {
+	return func(m *Manager) {
+		if d > 0 {
+			m.retention = d
+		}
+	}
+}
+
+// NewManager starts the worker pool. Call Close to stop it.
+func NewManager(opts ...Option) *Manager {
+	m := &Manager{
+		jobs:      map[string]*entry{},
+		workers:   defaultWorkers,
+		queueSize: defaultQueueSize,
+		retention: defaultRetention,
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+	m.ctx, m.cancel = context.WithCancel(context.Background())
+	m.queue = make(chan *entry, m.queueSize)
+	for i := 0; i < m.workers; i++ {
+		m.wg.Add(1)
+		go m.work()
+	}
+	return m
+}
+
+// Submit queues fn and returns the new job.
+func (m *Manager) Submit(fn Func) (Job, error) {
+	return m.SubmitAs("", fn)
+}
+
+// SubmitAs queues fn as a job owned by owner. The manager only records the
+// owner; callers check Job.Owner before exposing a job.
+func (m *Manager) SubmitAs(owner string, fn Func) (Job, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return Job{}, ErrClosed
+	}
+	m.prune()
+
+	jobID, err := id.Random(12)
+	if err != nil {
+		return Job{}, err
+	}
+	now := time.Now().UTC()
+	ctx, cancel := context.WithCancel(m.ctx)
+	e := &entry{
+		job:    Job{ID: jobID, Owner: owner, State: StateQueued, CreatedAt: now, UpdatedAt: now},
+		subs:   map[chan Event]struct{}{},
+		fn:     fn,
+		ctx:    ctx,
+		cancel: cancel,
+	}
+	select {
+	case m.queue <- e:
+	default:
+		cancel()
+		return Job{}, ErrQueueFull
+	}
+	m.jobs[e.job.ID] = e
+	m.record(e, StateQueued, 0, nil)
+	return e.job, nil
+}
+
+// Get returns the current status of a job.
+func (m *Manager) Get(id string) (Job, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	e, ok := m.jobs[id]
+	if !ok {
+		return Job{}, ErrNotFound
+	}
+	return e.job, nil
+}
+
+// Cancel cancels a job's context. A queued job is marked canceled at once;
+// a running job is marked canceled when its Func returns.
+func (m *Manager) Cancel(id string) (Job, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	e, ok := m.jobs[id]
+	if !ok {
+		return Job{}, ErrNotFound
+	}
+	e.cancel()
+	if e.job.State == StateQueued {
+		m.record(e, StateCanceled, 0, context.Canceled)
+	}
+	return e.job, nil
+}
+
+// Subscribe returns the events after seq recorded so far and a channel of
+// the events that follow. The channel is closed after the terminal event, or
+// early if the subscriber falls behind; call unsubscribe when done reading.
+func (m *Manager) Subscribe(id string, after int) (past []Event, live <-chan Event, unsubscribe func(), err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	e, ok := m.jobs[id]
+	if !ok {
+		return nil, nil, nil, ErrNotFound
+	}
+	for _, ev := range e.events {
+		if ev.Seq > after {
+			past = append(past, ev)
+		}
+	}
+	ch := make(chan Event, subscriberBuffer)
+	if e.job.State.Terminal() {
+		close(ch)
+		return past, ch, func() {}, nil
+	}
+	e.subs[ch] = struct{}{}
+	return past, ch, func() {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		if _, ok := e.subs[ch]; ok {
+			delete(e.subs, ch)
+			close(ch)
+		}
+	}, nil
+}
+
+// Close cancels running jobs, stops the workers and waits for them to exit.
+func (m *Manager) Close() {
+	m.mu.Lock()
+	if m.closed {
+		m.mu.Unlock()
+		return
+	}
+	m.closed = true
+	m.cancel()
+	close(m.queue)
+	m.mu.Unlock()
+	m.wg.Wait()
+}
+
+func (m *Manager) work() {
+	defer m.wg.Done()
+	for e := range m.queue {
+		m.run(e)
+	}
+}
+
+func (m *Manager) run(e *entry) {
+	if e.ctx.Err() != nil {
+		m.finish(e, nil, e.ctx.Err())
+		return
+	}
+	report := func(state State, attempt int) {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		if !e.job.State.Terminal() {
+			m.record(e, state, attempt, nil)
+		}
+	}
+	res, err := e.fn(e.ctx, report)
+	m.finish(e, res, err)
+}
+
+func (m *Manager) finish(e *entry, res any, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	defer e.cancel()
+	if e.job.State.Terminal() {
+		return
+	}
+	switch {
+	case err == nil:
+		e.job.Result = res
+		m.record(e, StateDone, 0, nil)
+	case e.ctx.Err() != nil:
+		m.record(e, StateCanceled, 0, err)
+	default:
+		m.record(e, StateFailed, 0, err)
+	}
+}
+
+// record applies a transition and fans it out; callers hold m.mu.
+func (m *Manager) record(e *entry, state State, attempt int, err error) {
+	now := time.Now().UTC()
+	e.job.State = state
+	e.job.Attempt = attempt
+	e.job.UpdatedAt = now
+	ev := Event{Seq: len(e.events) + 1, State: state, Attempt: attempt, At: now}
+	if err != nil {
+		e.job.Error = err.Error()
+		ev.Error = err.Error()
+	}
+	e.events = append(e.events, ev)
+	for ch := range e.subs {
+		select {
+		case ch <- ev:
+		default:
+			// Too slow; drop it rather than block the job.
+			delete(e.subs, ch)
+			close(ch)
+			continue
+		}
+		if state.Terminal() {
+			delete(e.subs, ch)
+			close(ch)
+		}
+	}
+}
+
+// prune forgets finished jobs past the retention period; callers hold m.mu.
+func (m *Manager) prune() {
+	cutoff := time.Now().Add(-m.retention)
+	for id, e := range m.jobs {
+		if e.job.State.Terminal() && e.job.UpdatedAt.Before(cutoff) {
+			delete(m.jobs, id)
+		}
+	}
+}
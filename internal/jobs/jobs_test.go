@@ -0,0 +1,142 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func waitFor(t *testing.T, m *Manager, id string, want State) Job {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		j, err := m.Get(id)
+		if err != nil {
+			t.Fatalf("Get: %v", err)
+		}
+		if j.State == want {
+			return j
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	j, _ := m.Get(id)
+	t.Fatalf("job %s: want state %s, got %s", id, want, j.State)
+	return Job{}
+}
+
+func TestManager_RunsAndRecordsEvents(t *testing.T) {
+	m := NewManager(WithWorkers(1))
+	defer m.Close()
+
+	job, err := m.Submit(func(ctx context.Context, report Reporter) (any, error) {
+		report("analyzing", 0)
+		report("repairing", 1)
+		return "ok", nil
+	})
+	if err != nil {
+		t.Fatalf("Submit: %v", err)
+	}
+	done := waitFor(t, m, job.ID, StateDone)
+	if done.Result != "ok" {
+		t.Fatalf("unexpected result: %v", done.Result)
+	}
+
+	past, live, unsubscribe, err := m.Subscribe(job.ID, 1)
+	if err != nil {
+		t.Fatalf("Subscribe: %v", err)
+	}
+	defer unsubscribe()
+	if _, ok := <-live; ok {
+		t.Fatalf("expected closed channel for finished job")
+	}
+	var states []State
+	for _, ev := range past {
+		states = append(states, ev.State)
+	}
+	want := []State{"analyzing", "repairing", StateDone}
+	if len(states) != len(want) {
+		t.Fatalf("events after seq 1: got %v, want %v", states, want)
+	}
+	for i := range want {
+		if states[i] != want[i] {
+			t.Fatalf("events after seq 1: got %v, want %v", states, want)
+		}
+	}
+	if past[1].Attempt != 1 {
+		t.Fatalf("expected repair attempt 1, got %d", past[1].Attempt)
+	}
+}
+
+func TestManager_Failure(t *testing.T) {
+	m := NewManager()
+	defer m.Close()
+	job, _ := m.Submit(func(ctx context.Context, report Reporter) (any, error) {
+		return nil, errors.New("boom")
+	})
+	j := waitFor(t, m, job.ID, StateFailed)
+	if j.Error != "boom" {
+		t.Fatalf("expected error recorded, got %q", j.Error)
+	}
+}
+
+func TestManager_CancelRunningAndQueued(t *testing.T) {
+	m := NewManager(WithWorkers(1), WithQueueSize(1))
+	defer m.Close()
+
+	started := make(chan struct{})
+	running, _ := m.Submit(func(ctx context.Context, report Reporter) (any, error) {
+		close(started)
+		<-ctx.Done()
+		return nil, ctx.Err()
+	})
+	<-started
+	queued, err := m.Submit(func(ctx context.Context, report Reporter) (any, error) {
+		t.Error("canceled job should not run")
+		return nil, nil
+	})
+	if err != nil {
+		t.Fatalf("Submit queued: %v", err)
+	}
+	if _, err := m.Submit(func(context.Context, Reporter) (any, error) { return nil, nil }); !errors.Is(err, ErrQueueFull) {
+		t.Fatalf("expected ErrQueueFull, got %v", err)
+	}
+
+	if j, _ := m.Cancel(queued.ID); j.State != StateCanceled {
+		t.Fatalf("queued job should cancel immediately, got %s", j.State)
+	}
+	if _, err := m.Cancel(running.ID); err != nil {
+		t.Fatalf("Cancel: %v", err)
+	}
+	waitFor(t, m, running.ID, StateCanceled)
+
+	if _, err := m.Cancel("nope"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestManager_LiveSubscription(t *testing.T) {
+	m := NewManager()
+	defer m.Close()
+
+	release := make(chan struct{})
+	job, _ := m.Submit(func(ctx context.Context, report Reporter) (any, error) {
+		<-release
+		report("generating", 0)
+		return nil, nil
+	})
+	_, live, unsubscribe, err := m.Subscribe(job.ID, 1)
+	if err != nil {
+		t.Fatalf("Subscribe: %v", err)
+	}
+	defer unsubscribe()
+	close(release)
+
+	var got []State
+	for ev := range live {
+		got = append(got, ev.State)
+	}
+	if len(got) != 2 || got[0] != "generating" || got[1] != StateDone {
+		t.Fatalf("unexpected live events: %v", got)
+	}
+}
@@ -0,0 +1,86 @@
+package llm
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+
+	"github.com/aaronromeo/swolegen/internal/cache"
+	"github.com/aaronromeo/swolegen/internal/config"
+	"github.com/aaronromeo/swolegen/internal/llm/provider"
+	"github.com/aaronromeo/swolegen/internal/metrics"
+)
+
+// WithCache caches validated analyzer and generator output. Entries are
+// keyed by the rendered prompts, the response schema and the model, so
+// identical inputs skip the provider entirely.
+func WithCache(c cache.Cache) LLMClientOption {
+	return func(cl *Client) {
+		cl.cache = c
+	}
+}
+
+// WithCacheBypass skips cache lookups while still storing fresh results,
+// like an HTTP request with Cache-Control: no-cache.
+func WithCacheBypass(bypass bool) LLMClientOption {
+	return func(c *Client) {
+		c.cacheBypass = bypass
+	}
+}
+
+// NewCache builds the configured response cache: on disk under
+// cfg.LlmCacheDir when set, in memory otherwise. It returns nil when caching
+// is disabled. Like NewProvider, long-running callers should build it once.
+func NewCache(cfg *config.Config) (cache.Cache, error) {
+	if cfg.LlmCacheTTL <= 0 || cfg.LlmCacheMaxBytes <= 0 {
+		return nil, nil
+	}
+	if cfg.LlmCacheDir != "" {
+		d, err := cache.NewDisk(cfg.LlmCacheDir, cfg.LlmCacheMaxBytes, cfg.LlmCacheTTL)
+		if err != nil {
+			return nil, err
+		}
+		return d, nil
+	}
+	return cache.NewMemory(cfg.LlmCacheMaxBytes, cfg.LlmCacheTTL), nil
+}
+
+// cacheKey identifies a completion by everything that shapes its output,
+// including the model and settings of the stage's first attempt.
+func (c *Client) cacheKey(stage Stage, prf provider.ProviderResponseFormat) string {
+	settings, _ := json.Marshal(c.stageSettings(stage, 0))
+	h := sha256.New()
+	for _, part := range []string{string(stage), c.model(stage, 0), string(settings), prf.Schema, prf.SystemPrompt, prf.UserPrompt} {
+		h.Write([]byte(part))
+		h.Write([]byte{0})
+	}
+	return string(stage) + "/" + hex.EncodeToString(h.Sum(nil))
+}
+
+// cached returns the output stored under key, counting the hit.
+func (c *Client) cached(key string) (string, bool) {
+	if c.cache == nil || c.cacheBypass {
+		return "", false
+	}
+	out, ok := c.cache.Get(key)
+	metrics.CacheResult("llm", ok)
+	if !ok {
+		return "", false
+	}
+	c.usageMu.Lock()
+	c.usage.CacheHits++
+	c.usageMu.Unlock()
+	c.logger.Debug("llm cache hit", "key", key)
+	return string(out), true
+}
+
+// storeCached saves validated output under key. Failures only cost a
+// future cache miss.
+func (c *Client) storeCached(key, out string) {
+	if c.cache == nil {
+		return
+	}
+	if err := c.cache.Set(key, []byte(out)); err != nil {
+		c.logger.Warn("llm cache store", "key", key, "error", err)
+	}
+}
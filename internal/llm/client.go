@@ -5,15 +5,21 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"io"
 	"log/slog"
-	"net/http"
-	"os"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/aaronromeo/swolegen/internal/cache"
+	"github.com/aaronromeo/swolegen/internal/config"
+	"github.com/aaronromeo/swolegen/internal/fetch"
+	"github.com/aaronromeo/swolegen/internal/id"
 	"github.com/aaronromeo/swolegen/internal/llm/provider"
 	"github.com/aaronromeo/swolegen/internal/llm/schemas"
+	"github.com/aaronromeo/swolegen/internal/recovery"
+	"github.com/aaronromeo/swolegen/internal/tracing"
+	"github.com/atombender/go-jsonschema/pkg/types"
+	"go.opentelemetry.io/otel/attribute"
 	"gopkg.in/yaml.v3"
 )
 
@@ -43,9 +49,62 @@ type AnalyzerInputs struct {
 	DurationMinutes int `json:"duration_minutes"`
 	// units – "lbs" or "kg" (default "lbs").
 	Units string `json:"units,omitempty"`
-	// Optional recovery signals (0–100). Use pointers so omission is distinguishable from 0.
+	// Optional recovery signals (0–100) from any device. Use pointers so omission
+	// is distinguishable from 0. Readiness scores map onto body_battery.
+	SleepScore  *int `json:"sleep_score,omitempty"`
+	BodyBattery *int `json:"body_battery,omitempty"`
+	// Deprecated: use SleepScore/BodyBattery. Kept for existing clients; the
+	// device-neutral fields win when both are set.
 	GarminSleepScore  *int `json:"garmin_sleep_score,omitempty"`
 	GarminBodyBattery *int `json:"garmin_body_battery,omitempty"`
+	// session_date – YYYY-MM-DD the workout is for. Defaults to today in
+	// timezone; it feeds the workout_id and the history windows.
+	SessionDate string `json:"session_date,omitempty"`
+	// timezone – IANA zone (e.g. "America/Toronto") today is taken in when
+	// session_date is omitted. Defaults to the client's zone (see WithTimezone).
+	Timezone string `json:"timezone,omitempty"`
+	// recovery – daily metrics and baselines for the session date. When omitted,
+	// it is derived from the client's recovery series (see WithRecovery).
+	Recovery *recovery.Snapshot `json:"recovery,omitempty"`
+}
+
+// SeedInputs returns the normalized fields the workout_id seed is derived
+// from, given the session date and the fetched history text.
+func (in AnalyzerInputs) SeedInputs(date, historyText string) id.SeedInputs {
+	return id.SeedInputs{
+		Date:            date,
+		Location:        in.Location,
+		DurationMinutes: in.DurationMinutes,
+		Units:           in.Units,
+		Equipment:       in.EquipmentInventory,
+		HistoryDigest:   id.Digest([]byte(historyText)),
+	}
+}
+
+// Hash identifies the request itself: a digest of the inputs as sent, with
+// the session date resolved so a request for "today" hashes to the day it
+// ran.
+func (in AnalyzerInputs) Hash(date string) (string, error) {
+	in.SessionDate, in.Timezone = date, ""
+	b, err := json.Marshal(in)
+	if err != nil {
+		return "", fmt.Errorf("hash analyzer inputs: %w", err)
+	}
+	return id.Digest(b), nil
+}
+
+// Analysis is the analyzer result plus the metadata callers need to store
+// or reproduce it.
+type Analysis struct {
+	Plan schemas.AnalyzerV1Json
+	// Seed is the canonical workout_id seed for the inputs (see id.Seed).
+	Seed string
+	// InputsHash identifies the request the plan was analyzed from (see
+	// AnalyzerInputs.Hash).
+	InputsHash string
+	// Warnings lists the changes made to fetched or free-text inputs before
+	// they were prompted.
+	Warnings []Warning
 }
 
 // // ToJSON marshals the plan to JSON bytes.
@@ -65,7 +124,22 @@ type Client struct {
 	provider      provider.Provider
 	retries       int
 	maxFetchBytes int
+	budgets       Budgets
+	fetcher       fetch.Source
 	logger        *slog.Logger
+	recovery      *recovery.Series
+	progress      ProgressFunc
+	timeouts      Timeouts
+	prices        Prices
+	cache         cache.Cache
+	cacheBypass   bool
+	prompts       *PromptSet
+	settings      map[Stage]provider.Settings
+	now           func() time.Time
+	location      *time.Location
+
+	usageMu sync.Mutex
+	usage   Usage
 }
 
 type LLMClientOption func(*Client)
@@ -94,11 +168,34 @@ func WithMaxFetchBytes(n int) LLMClientOption {
 	}
 }
 
+// WithFetcher sets the source instructions and history are fetched from.
+// Clients default to fetch.New(): public http(s) hosts only, no local files.
+func WithFetcher(f fetch.Source) LLMClientOption {
+	return func(c *Client) {
+		if f != nil {
+			c.fetcher = f
+		}
+	}
+}
+
+// WithRecovery supplies imported recovery metrics used to fill the
+// recovery signals for the session date.
+func WithRecovery(s *recovery.Series) LLMClientOption {
+	return func(c *Client) {
+		c.recovery = s
+	}
+}
+
 func New(opts ...LLMClientOption) (*Client, error) {
 	c := &Client{
 		retries:       defaultRetries,
 		maxFetchBytes: defaultMaxFetchBytes,
+		budgets:       DefaultBudgets,
+		prompts:       DefaultPrompts(),
+		now:           time.Now,
+		location:      time.Local,
 	}
+	c.fetcher = fetch.New()
 	for _, opt := range opts {
 		opt(c)
 	}
@@ -109,6 +206,176 @@ func New(opts ...LLMClientOption) (*Client, error) {
 	return c, nil
 }
 
+// Deps are a client's long-lived dependencies. Servers build them once and
+// share them across requests, so circuit breakers, cached responses and
+// loaded prompts outlive any one client.
+type Deps struct {
+	Provider provider.Provider
+	Cache    cache.Cache
+	Fetcher  fetch.Source
+	// Prompts is the default prompt set; nil uses DefaultPrompts.
+	Prompts  *PromptSet
+	Prices   Prices
+	Location *time.Location
+}
+
+// NewDeps builds the dependencies cfg configures: the provider and its
+// breakers, the price table, the response cache, the fetcher, the default
+// prompt set and the timezone.
+func NewDeps(cfg *config.Config, logger *slog.Logger) (Deps, error) {
+	llmProvider, err := NewProvider(cfg, logger)
+	if err != nil {
+		return Deps{}, err
+	}
+	prices, err := ParsePrices(cfg.LlmPrices)
+	if err != nil {
+		return Deps{}, fmt.Errorf("LLM_PRICES: %w", err)
+	}
+	respCache, err := NewCache(cfg)
+	if err != nil {
+		return Deps{}, err
+	}
+	fetcher, err := NewFetcher(&cfg.Fetch)
+	if err != nil {
+		return Deps{}, err
+	}
+	registry, err := LoadPrompts(cfg.LlmPromptsDir, cfg.LlmPromptSet)
+	if err != nil {
+		return Deps{}, err
+	}
+	prompts, err := registry.Get("")
+	if err != nil {
+		return Deps{}, err
+	}
+	loc, err := time.LoadLocation(cfg.Timezone)
+	if err != nil {
+		return Deps{}, fmt.Errorf("TIMEZONE: %w", err)
+	}
+	return Deps{
+		Provider: llmProvider,
+		Cache:    respCache,
+		Fetcher:  fetcher,
+		Prompts:  prompts,
+		Prices:   prices,
+		Location: loc,
+	}, nil
+}
+
+// NewFromConfig builds a Client and its dependencies from cfg, for one-shot
+// callers such as the CLI. opts are applied after the config-derived
+// options.
+func NewFromConfig(cfg *config.Config, logger *slog.Logger, opts ...LLMClientOption) (*Client, error) {
+	deps, err := NewDeps(cfg, logger)
+	if err != nil {
+		return nil, err
+	}
+	return NewWithDeps(cfg, logger, deps, opts...)
+}
+
+// NewWithDeps builds a Client with cfg's settings on prebuilt deps. It does
+// no I/O, so servers can call it per request. opts are applied after the
+// config-derived options.
+func NewWithDeps(cfg *config.Config, logger *slog.Logger, deps Deps, opts ...LLMClientOption) (*Client, error) {
+	if deps.Provider == nil {
+		return nil, errors.New("llm provider not configured")
+	}
+	return New(append(append(configSettings(cfg),
+		WithRetries(cfg.LlmRetries),
+		WithMaxFetchBytes(cfg.LlmMaxFetchBytes),
+		WithBudgets(Budgets{
+			Instructions:   cfg.LlmBudgetInstructions,
+			History:        cfg.LlmBudgetHistory,
+			UpcomingCardio: cfg.LlmBudgetUpcomingCardio,
+		}),
+		WithTimeouts(Timeouts{
+			Fetch:    cfg.LlmFetchTimeout,
+			Analyze:  cfg.LlmAnalyzerTimeout,
+			Generate: cfg.LlmGeneratorTimeout,
+		}),
+		WithFetcher(deps.Fetcher),
+		WithPrices(deps.Prices),
+		WithCache(deps.Cache),
+		WithPrompts(deps.Prompts),
+		WithTimezone(deps.Location),
+		WithProvider(deps.Provider),
+		WithLogger(logger),
+	), opts...)...)
+}
+
+// NewFetcher builds the fetcher for instructions and history from
+// cfg.Fetch. Its revalidation cache lives in the fetcher, so long-running
+// callers should build it once.
+func NewFetcher(cfg *config.FetchConfig) (*fetch.Fetcher, error) {
+	creds, err := fetch.ParseCredentials(cfg.Credentials)
+	if err != nil {
+		return nil, fmt.Errorf("FETCH_CREDENTIALS: %w", err)
+	}
+	opts := []fetch.Option{
+		fetch.WithAllowedHosts(cfg.Hosts...),
+		fetch.WithAllowPrivate(cfg.AllowPrivate),
+		fetch.WithBaseDir(cfg.BaseDir),
+		fetch.WithMaxRedirects(cfg.MaxRedirects),
+		fetch.WithTimeout(cfg.Timeout),
+		fetch.WithResolvers(
+			&fetch.Gist{Token: cfg.GistToken},
+			&fetch.GoogleDrive{Token: cfg.GoogleToken},
+			&fetch.HTTP{Credentials: creds},
+		),
+	}
+	if len(cfg.Schemes) > 0 {
+		opts = append(opts, fetch.WithSchemes(cfg.Schemes...))
+	}
+	if len(cfg.ContentTypes) > 0 {
+		opts = append(opts, fetch.WithContentTypes(cfg.ContentTypes...))
+	}
+	if cfg.CacheMaxBytes > 0 {
+		opts = append(opts, fetch.WithCache(cache.NewMemory(cfg.CacheMaxBytes, 24*time.Hour)))
+	}
+	return fetch.New(opts...), nil
+}
+
+// NewProvider builds the configured provider: the primary model followed by
+// any fallback models, each behind its own circuit breaker. Breaker state
+// lives in the returned provider, so long-running callers should build it
+// once and pass it to every client with WithProvider.
+func NewProvider(cfg *config.Config, logger *slog.Logger) (provider.Provider, error) {
+	models := append([]string{cfg.LlmModel}, cfg.LlmFallbackModels...)
+	providers := make([]provider.Provider, 0, len(models))
+	for _, model := range models {
+		op, err := provider.NewOpenAIProvider(
+			provider.WithAPIKey(cfg.OpenaiKey),
+			provider.WithModel(model),
+			provider.WithLogger(logger),
+		)
+		if err != nil {
+			return nil, err
+		}
+		var p provider.Provider = op
+		if cfg.LlmBreakerFailures > 0 {
+			p = provider.NewBreaker(p,
+				provider.WithFailureThreshold(cfg.LlmBreakerFailures),
+				provider.WithFailureWindow(cfg.LlmBreakerWindow),
+				provider.WithCooldown(cfg.LlmBreakerCooldown),
+				provider.WithBreakerLogger(logger),
+			)
+		}
+		providers = append(providers, p)
+	}
+	if len(providers) == 1 {
+		return providers[0], nil
+	}
+	return provider.NewChain(logger, providers...), nil
+}
+
+// ProviderInfo reports the provider and model serving completions, when the
+// provider exposes them.
+func (c *Client) ProviderInfo() (name, model string) {
+	if d, ok := c.provider.(provider.Describer); ok {
+		return d.ProviderName(), d.Model()
+	}
+	return "", ""
+}
+
 func (c *Client) Validate() error {
 	if c.provider == nil {
 		return errors.New("llm provider not configured")
@@ -130,102 +397,237 @@ func (c *Client) Validate() error {
 
 // Analyze assembles prompts, calls the provider, and parses the plan.
 func (c *Client) Analyze(ctx context.Context, in AnalyzerInputs) (schemas.AnalyzerV1Json, error) {
+	a, err := c.RunAnalysis(ctx, in)
+	return a.Plan, err
+}
+
+// RunAnalysis is Analyze returning the plan together with its workout_id seed.
+func (c *Client) RunAnalysis(ctx context.Context, in AnalyzerInputs) (_ Analysis, err error) {
 	if c.provider == nil {
-		return schemas.AnalyzerV1Json{}, errors.New("llm provider not configured")
+		return Analysis{}, errors.New("llm provider not configured")
 	}
 	if err := c.Validate(); err != nil {
-		return schemas.AnalyzerV1Json{}, err
+		return Analysis{}, err
 	}
+	ctx, span := c.startStage(ctx, StageAnalyzing)
+	defer func() { span.end(err) }()
 
 	units := in.Units
 	if strings.TrimSpace(units) == "" {
 		units = "lbs"
 	}
-	date := time.Now().Format("2006-01-02")
+	dates, err := c.sessionDates(in)
+	if err != nil {
+		return Analysis{}, err
+	}
+	date := dates.Date
+	inputsHash, err := in.Hash(date)
+	if err != nil {
+		return Analysis{}, err
+	}
 	var stravaJSON string
 	if len(in.StravaRecent) > 0 {
 		stravaJSON = string(in.StravaRecent)
 	} else {
 		stravaJSON = "null"
 	}
-	sleep := "null"
-	if in.GarminSleepScore != nil {
-		sleep = fmt.Sprintf("%d", *in.GarminSleepScore)
-	}
-	bb := "null"
-	if in.GarminBodyBattery != nil {
-		bb = fmt.Sprintf("%d", *in.GarminBodyBattery)
+	snap, err := c.recoverySnapshot(in, date)
+	if err != nil {
+		return Analysis{}, err
+	}
+	sleep, bb := "null", "null"
+	hrv, rhr := "null", "null"
+	baseline, trends := "null", "[]"
+	if snap != nil {
+		if snap.Today.SleepScore != nil {
+			sleep = fmt.Sprintf("%d", *snap.Today.SleepScore)
+		}
+		if snap.Today.BodyBattery != nil {
+			bb = fmt.Sprintf("%d", *snap.Today.BodyBattery)
+		}
+		if snap.Today.HRV != nil {
+			hrv = fmt.Sprintf("%g", *snap.Today.HRV)
+		}
+		if snap.Today.RestingHR != nil {
+			rhr = fmt.Sprintf("%d", *snap.Today.RestingHR)
+		}
+		b, err := json.Marshal(snap.Baseline)
+		if err != nil {
+			return Analysis{}, fmt.Errorf("marshal recovery baseline: %w", err)
+		}
+		baseline = string(b)
+		t, err := json.Marshal(snap.Trends)
+		if err != nil {
+			return Analysis{}, fmt.Errorf("marshal recovery trends: %w", err)
+		}
+		trends = string(t)
 	}
 	invJSON, err := json.Marshal(in.EquipmentInventory)
 	if err != nil {
-		return schemas.AnalyzerV1Json{}, fmt.Errorf("marshal equipment_inventory: %w", err)
+		return Analysis{}, fmt.Errorf("marshal equipment_inventory: %w", err)
 	}
 
-	instructionsText, err := fetchText(ctx, in.InstructionsURL, c.maxFetchBytes)
+	c.report(StageFetchingInputs, 0)
+	instructionsText, historyText, warns, err := c.fetchInputs(ctx, in)
 	if err != nil {
-		return schemas.AnalyzerV1Json{}, fmt.Errorf("fetch instructions: %w", err)
+		return Analysis{}, err
+	}
+	// The seed hashes the history as fetched so sanitizing changes cannot
+	// move a workout_id.
+	seed := id.Seed(in.SeedInputs(date, historyText))
+	_, sspan := tracing.Tracer(tracerName).Start(ctx, "llm.sanitize_inputs")
+	instructionsText, w := sanitizeSection(SectionInstructions, instructionsText, c.budgets.Instructions)
+	warns = append(warns, w...)
+	historyText, w = sanitizeSection(SectionHistory, historyText, c.budgets.History)
+	warns = append(warns, w...)
+	cardio, w := sanitizeSection(SectionUpcomingCardio, in.UpcomingCardioText, c.budgets.UpcomingCardio)
+	warns = append(warns, w...)
+	sspan.SetAttributes(attribute.Int("swolegen.input.warnings", len(warns)))
+	sspan.End()
+	for _, w := range warns {
+		c.logger.Warn("analyzer input", "section", w.Section, "code", w.Code, "message", w.Message)
+	}
+
+	user, err := c.prompts.render(promptAnalyzerUser, AnalyzerPromptData{
+		Instructions:       instructionsText,
+		History:            historyText,
+		StravaRecent:       stravaJSON,
+		UpcomingCardio:     cardio,
+		SleepScore:         sleep,
+		BodyBattery:        bb,
+		HRV:                hrv,
+		RestingHR:          rhr,
+		RecoveryBaseline:   baseline,
+		RecoveryTrends:     trends,
+		EquipmentInventory: string(invJSON),
+		SessionDate:        date,
+		RecentBestsFrom:    dates.RecentBestsFrom,
+		AntiRepeatFrom:     dates.AntiRepeatFrom,
+		Location:           in.Location,
+		Units:              units,
+		DurationMinutes:    in.DurationMinutes,
+	})
+	if err != nil {
+		return Analysis{}, err
 	}
-	c.logger.Debug("analyzer plan", "instructions", instructionsText)
 
-	historyText, err := fetchText(ctx, in.HistoryURL, c.maxFetchBytes)
+	userJSON, err := json.Marshal(user)
 	if err != nil {
-		return schemas.AnalyzerV1Json{}, fmt.Errorf("fetch history: %w", err)
+		return Analysis{}, fmt.Errorf("marshal user prompt: %w", err)
 	}
-	c.logger.Debug("analyzer plan", "history", historyText)
 
-	// indent multi-line blocks for YAML literal style
-	instructionsBlock := indentForBlock(instructionsText)
-	historyBlock := indentForBlock(historyText)
+	// The initial completion and its repairs share the analyzer deadline.
+	actx, cancel := stageContext(ctx, c.timeouts.Analyze)
+	defer cancel()
+	plan, err := c.completePlan(actx, span, string(userJSON))
+	if err != nil {
+		return Analysis{}, stageError(ctx, actx, StageAnalyzing, c.timeouts.Analyze, err)
+	}
+	// The date and location decide the workout_id and where the workout is
+	// filed, so they come from the request rather than the model's echo.
+	plan.Meta.Date = types.SerializableDate{Time: dates.Day}
+	if in.Location != "" {
+		plan.Meta.Location = in.Location
+	}
+	return Analysis{Plan: plan, Seed: seed, InputsHash: inputsHash, Warnings: warns}, nil
+}
 
-	user := fmt.Sprintf(AnalyzerUser,
-		instructionsBlock, historyBlock, stravaJSON, in.UpcomingCardioText,
-		sleep, bb, string(invJSON), date, in.Location, units, in.DurationMinutes,
-	)
+// fetchInputs downloads the instructions and history under the fetch
+// deadline, warning when either was cut at the fetch size limit.
+func (c *Client) fetchInputs(ctx context.Context, in AnalyzerInputs) (instructions, history string, warns []Warning, err error) {
+	ctx, span := tracing.Tracer(tracerName).Start(ctx, "llm.fetch_inputs")
+	defer func() { tracing.End(span, err) }()
+	fctx, cancel := stageContext(ctx, c.timeouts.Fetch)
+	defer cancel()
 
-	userJSON, err := json.Marshal(user)
+	instructions, truncated, err := c.fetchText(fctx, in.InstructionsURL)
 	if err != nil {
-		return schemas.AnalyzerV1Json{}, fmt.Errorf("marshal user prompt: %w", err)
+		return "", "", nil, stageError(ctx, fctx, StageFetchingInputs, c.timeouts.Fetch, fmt.Errorf("fetch instructions: %w", err))
 	}
+	if truncated {
+		warns = append(warns, fetchTruncated(SectionInstructions, c.maxFetchBytes))
+	}
+	c.logger.Debug("analyzer plan", "instructions", instructions)
+
+	history, truncated, err = c.fetchText(fctx, in.HistoryURL)
+	if err != nil {
+		return "", "", nil, stageError(ctx, fctx, StageFetchingInputs, c.timeouts.Fetch, fmt.Errorf("fetch history: %w", err))
+	}
+	if truncated {
+		warns = append(warns, fetchTruncated(SectionHistory, c.maxFetchBytes))
+	}
+	c.logger.Debug("analyzer plan", "history", history)
+	return instructions, history, warns, nil
+}
 
-	// initial completion
-	out, err := c.provider.Complete(ctx, provider.ProviderResponseFormat{
+func fetchTruncated(section string, limit int) Warning {
+	return Warning{Section: section, Code: WarnTruncated,
+		Message: fmt.Sprintf("%s is larger than the %d byte fetch limit; only the start was read", section, limit)}
+}
+
+// completePlan asks for the analyzer plan, repairing invalid replies up to
+// the retry limit. It stops as soon as ctx is done.
+func (c *Client) completePlan(ctx context.Context, span *stageSpan, userPrompt string) (schemas.AnalyzerV1Json, error) {
+	c.report(StageAnalyzing, 0)
+	prf := provider.ProviderResponseFormat{
 		Name:         provider.ResponseFormatAnalyzerPlan,
 		Description:  provider.ResponseFormatAnalyzerPlanDescription,
 		Schema:       AnalyzerSchema,
-		SystemPrompt: AnalyzerSystem,
-		UserPrompt:   string(userJSON),
-	})
-	if err != nil {
-		return schemas.AnalyzerV1Json{}, err
+		SystemPrompt: c.prompts.analyzerSystem(),
+		UserPrompt:   userPrompt,
+	}
+	key := c.cacheKey(StageAnalyzing, prf)
+	out, hit := c.cached(key)
+	span.SetAttributes(tracing.AttrCacheHit.Bool(hit))
+	if !hit {
+		var err error
+		if out, err = c.complete(ctx, StageAnalyzing, 0, prf, nil); err != nil {
+			return schemas.AnalyzerV1Json{}, err
+		}
 	}
 
 	plan := schemas.AnalyzerV1Json{}
-	err = plan.UnmarshalJSON([]byte(out))
+	err := c.validate(ctx, span, 0, func() error { return plan.UnmarshalJSON([]byte(out)) })
 	if err == nil {
 		c.logger.Debug("analyzer plan", "plan", plan)
+		c.storeCached(key, out)
 		return plan, nil
 	}
 
 	// Retry loop using repair prompt if validation/parsing fails
 	lastErr := fmt.Errorf("failed to parse analyzer plan: %w", err)
 	for i := 0; i < c.retries; i++ {
-		repairUser := fmt.Sprintf(RepairAnalyzer, lastErr.Error(), AnalyzerSchema)
-		out, err := c.provider.Complete(ctx, provider.ProviderResponseFormat{
+		if ctx.Err() != nil {
+			return schemas.AnalyzerV1Json{}, ctx.Err()
+		}
+		c.report(StageRepairing, i+1)
+		span.repair()
+		repairUser, err := c.prompts.render(promptRepairAnalyzer, RepairPromptData{Errors: lastErr.Error(), Schema: AnalyzerSchema})
+		if err != nil {
+			return schemas.AnalyzerV1Json{}, err
+		}
+		out, err := c.complete(ctx, StageAnalyzing, i+1, provider.ProviderResponseFormat{
 			Name:         provider.ResponseFormatAnalyzerPlan,
 			Description:  provider.ResponseFormatAnalyzerPlanDescription,
 			Schema:       AnalyzerSchema,
-			SystemPrompt: AnalyzerSystem,
+			SystemPrompt: c.prompts.analyzerSystem(),
 			UserPrompt:   repairUser,
-		})
+		}, nil)
 		if err != nil {
+			// A repair cannot succeed once the caller is gone or every
+			// provider is rejecting calls.
+			if ctx.Err() != nil || errors.Is(err, provider.ErrCircuitOpen) {
+				return schemas.AnalyzerV1Json{}, err
+			}
 			lastErr = err
 			continue
 		}
 
 		plan := schemas.AnalyzerV1Json{}
-		err = plan.UnmarshalJSON([]byte(out))
+		err = c.validate(ctx, span, i+1, func() error { return plan.UnmarshalJSON([]byte(out)) })
 		if err == nil {
 			c.logger.Debug("analyzer plan", "plan", plan)
+			c.storeCached(key, out)
 			return plan, nil
 		}
 		lastErr = fmt.Errorf("failed to parse analyzer plan: %w", err)
@@ -233,102 +635,65 @@ func (c *Client) Analyze(ctx context.Context, in AnalyzerInputs) (schemas.Analyz
 	return schemas.AnalyzerV1Json{}, lastErr
 }
 
-// fetchText downloads the content at a URL and returns it as a string.
-// It supports http(s) and file URLs; for empty or invalid URLs, returns empty string.
-
-// fetchToTmp downloads text and writes it to a temp file. Returns path and content.
-func fetchToTmp(ctx context.Context, url, prefix string, maxFetchBytes int) (string, string, error) {
-	content, err := fetchText(ctx, url, maxFetchBytes)
-	if err != nil {
-		return "", "", err
-	}
-	f, err := os.CreateTemp("", "swolegen-"+prefix+"-*.txt")
-	if err != nil {
-		return "", content, err
-	}
-	defer func() {
-		f.Close()           //nolint:errcheck
-		os.Remove(f.Name()) //nolint:errcheck
-	}()
-	if _, err := f.WriteString(content); err != nil {
-		return f.Name(), content, err
-	}
-	return f.Name(), content, nil
-}
-
-func fetchText(ctx context.Context, url string, maxFetchBytes int) (string, error) {
-	url = strings.TrimSpace(url)
-	if url == "" {
-		return "", nil
-	}
-	// Local files support (file:// or relative path)
-	if strings.HasPrefix(url, "file://") {
-		p := strings.TrimPrefix(url, "file://")
-		if strings.HasPrefix(url, "file://") {
-			if pp, ok := strings.CutPrefix(url, "file://"); ok {
-				p = pp
-			}
-		}
-		f, err := os.Open(p)
+// recoverySnapshot resolves the recovery signals for date. An explicit
+// snapshot wins, then the imported series; manually entered scores override
+// the matching fields of either.
+func (c *Client) recoverySnapshot(in AnalyzerInputs, date string) (*recovery.Snapshot, error) {
+	var snap *recovery.Snapshot
+	switch {
+	case in.Recovery != nil:
+		s := *in.Recovery
+		snap = &s
+	case c.recovery != nil:
+		s, err := c.recovery.Snapshot(date, recovery.DefaultBaselineDays)
 		if err != nil {
-			return "", err
+			return nil, fmt.Errorf("recovery snapshot: %w", err)
 		}
-		defer f.Close() //nolint:errcheck
-		lr := &io.LimitedReader{R: f, N: int64(maxFetchBytes)}
-		b, err := io.ReadAll(lr)
-		if err != nil {
-			return "", err
+		if !s.Empty() {
+			snap = &s
 		}
-		return string(b), nil
 	}
-	if !strings.HasPrefix(url, "http://") && !strings.HasPrefix(url, "https://") {
-		// treat as local path
-		f, err := os.Open(url)
-		if err != nil {
-			return "", err
-		}
-		defer f.Close() //nolint:errcheck
-		lr := &io.LimitedReader{R: f, N: int64(maxFetchBytes)}
-		b, err := io.ReadAll(lr)
-		if err != nil {
-			return "", err
-		}
-		return string(b), nil
+	manual := recovery.Day{SleepScore: in.SleepScore, BodyBattery: in.BodyBattery}
+	if manual.SleepScore == nil {
+		manual.SleepScore = in.GarminSleepScore
 	}
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
-	if err != nil {
-		return "", err
+	if manual.BodyBattery == nil {
+		manual.BodyBattery = in.GarminBodyBattery
 	}
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
-		return "", err
+	if manual.SleepScore == nil && manual.BodyBattery == nil {
+		return snap, nil
 	}
-	defer resp.Body.Close() //nolint:errcheck
-	if resp.StatusCode >= 300 {
-		return "", fmt.Errorf("GET %s: %d", url, resp.StatusCode)
+	if snap == nil {
+		snap = &recovery.Snapshot{Date: date, Today: recovery.Day{Date: date}}
 	}
-	lr := &io.LimitedReader{R: resp.Body, N: int64(maxFetchBytes)}
-	b, err := io.ReadAll(lr)
+	o := snap.Override(manual)
+	snap = &o
+	return snap, nil
+}
+
+// fetchText downloads the content at a URL through the client's fetcher,
+// reporting whether it was cut at the fetch size limit. An empty URL yields
+// an empty string.
+func (c *Client) fetchText(ctx context.Context, url string) (string, bool, error) {
+	res, err := c.fetcher.Fetch(ctx, url, int64(c.maxFetchBytes))
 	if err != nil {
-		return "", err
+		return "", false, err
 	}
-	return string(b), nil
+	return string(res.Body), res.Truncated, nil
 }
 
-// indentForBlock indents each line by two spaces for YAML literal blocks.
-func indentForBlock(s string) string {
-	if s == "" {
-		return ""
-	}
-	lines := strings.Split(s, "\n")
-	for i := range lines {
-		lines[i] = "  " + lines[i]
-	}
+func (c *Client) Generate(ctx context.Context, plan schemas.AnalyzerV1Json) ([]byte, error) {
+	return c.generate(ctx, plan, nil)
+}
 
-	return strings.Join(lines, "\n")
+// GenerateStream is Generate, passing the generator's raw output to onDelta
+// as it is produced. Each repair attempt starts a new output, announced by
+// StageRepairing on the progress hook (see WithProgress).
+func (c *Client) GenerateStream(ctx context.Context, plan schemas.AnalyzerV1Json, onDelta DeltaFunc) ([]byte, error) {
+	return c.generate(ctx, plan, onDelta)
 }
 
-func (c *Client) Generate(ctx context.Context, plan schemas.AnalyzerV1Json) ([]byte, error) {
+func (c *Client) generate(ctx context.Context, plan schemas.AnalyzerV1Json, onDelta DeltaFunc) (_ []byte, err error) {
 	if c.provider == nil {
 		return nil, errors.New("llm provider not configured")
 	}
@@ -336,6 +701,15 @@ func (c *Client) Generate(ctx context.Context, plan schemas.AnalyzerV1Json) ([]b
 		return nil, err
 	}
 
+	ctx, span := c.startStage(ctx, StageGenerating)
+	defer func() { span.end(err) }()
+
+	// The initial completion and its repairs share the generator deadline.
+	parent := ctx
+	ctx, cancel := stageContext(parent, c.timeouts.Generate)
+	defer cancel()
+	defer func() { err = stageError(parent, ctx, StageGenerating, c.timeouts.Generate, err) }()
+
 	// Convert plan to JSON for the prompt
 	planJSON, err := json.Marshal(&plan)
 	if err != nil {
@@ -343,48 +717,149 @@ func (c *Client) Generate(ctx context.Context, plan schemas.AnalyzerV1Json) ([]b
 	}
 
 	// Build user prompt with the plan
-	user := fmt.Sprintf(GeneratorUser, string(planJSON))
+	user, err := c.prompts.render(promptGeneratorUser, GeneratorPromptData{Plan: string(planJSON)})
+	if err != nil {
+		return nil, err
+	}
 
 	// Initial completion (expects YAML output)
-	workoutOutput, err := c.provider.Complete(ctx, provider.ProviderResponseFormat{
+	c.report(StageGenerating, 0)
+	prf := provider.ProviderResponseFormat{
 		Name:         provider.ResponseFormatGeneratorOutput,
 		Description:  provider.ResponseFormatGeneratorOutputDescription,
 		Schema:       WorkoutSchema,
-		SystemPrompt: GeneratorSystem,
+		SystemPrompt: c.prompts.generatorSystem(),
 		UserPrompt:   user,
-	})
-	if err != nil {
+	}
+	key := c.cacheKey(StageGenerating, prf)
+	workoutOutput, hit := c.cached(key)
+	span.SetAttributes(tracing.AttrCacheHit.Bool(hit))
+	if hit {
+		if onDelta != nil {
+			onDelta(workoutOutput)
+		}
+	} else if workoutOutput, err = c.complete(ctx, StageGenerating, 0, prf, onDelta); err != nil {
 		return nil, err
 	}
 
 	// Validate against workout schema
+	c.report(StageValidating, 0)
 	c.logger.Debug("workout json", "json", workoutOutput)
-	if wv, err := ValidateWorkoutJSON([]byte(workoutOutput)); err == nil {
-		return yaml.Marshal(wv)
+	var wv *schemas.WorkoutV12Json
+	err = c.validate(ctx, span, 0, func() (err error) {
+		wv, err = ValidateWorkoutJSON([]byte(workoutOutput))
+		return err
+	})
+	if err == nil {
+		c.storeCached(key, workoutOutput)
+		return workoutYAML(wv)
 	}
 
 	// Retry loop using repair prompt if validation fails
-	lastErr := fmt.Errorf("failed to validate workout yaml: %w", err)
+	verr := &ValidationError{Findings: []string{err.Error()}}
+	var lastErr error = verr
 	for i := 0; i < c.retries; i++ {
-		repairUser := fmt.Sprintf(RepairGenerator, lastErr.Error())
-		workoutOutput, err := c.provider.Complete(ctx, provider.ProviderResponseFormat{
+		// Don't spend tokens on repairs nobody is waiting for.
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		c.report(StageRepairing, i+1)
+		span.repair()
+		repairUser, err := c.prompts.render(promptRepairGenerator, RepairPromptData{Errors: lastErr.Error()})
+		if err != nil {
+			return nil, err
+		}
+		workoutOutput, err := c.complete(ctx, StageGenerating, i+1, provider.ProviderResponseFormat{
 			Name:         provider.ResponseFormatGeneratorOutput,
 			Description:  provider.ResponseFormatGeneratorOutputDescription,
 			Schema:       WorkoutSchema,
-			SystemPrompt: GeneratorSystem,
+			SystemPrompt: c.prompts.generatorSystem(),
 			UserPrompt:   repairUser,
-		})
+		}, onDelta)
 
 		if err != nil {
+			// A repair cannot succeed once the caller is gone or every
+			// provider is rejecting calls.
+			if ctx.Err() != nil || errors.Is(err, provider.ErrCircuitOpen) {
+				return nil, err
+			}
 			lastErr = err
 			continue
 		}
-		var wv *schemas.WorkoutV12Json
 		c.logger.Debug("workout json", "json", workoutOutput)
-		if wv, err = ValidateWorkoutJSON([]byte(workoutOutput)); err != nil {
-			return nil, fmt.Errorf("failed to validate workout yaml: %w", err)
+		c.report(StageValidating, 0)
+		var wv *schemas.WorkoutV12Json
+		err = c.validate(ctx, span, i+1, func() (err error) {
+			wv, err = ValidateWorkoutJSON([]byte(workoutOutput))
+			return err
+		})
+		if err != nil {
+			verr.Findings = append(verr.Findings, err.Error())
+			return nil, verr
 		}
-		return yaml.Marshal(wv)
+		c.storeCached(key, workoutOutput)
+		return workoutYAML(wv)
 	}
 	return nil, lastErr
 }
+
+// complete runs one completion for stage with the stage's settings in its
+// own span and records its usage, streaming it to onDelta when set.
+func (c *Client) complete(ctx context.Context, stage Stage, attempt int, prf provider.ProviderResponseFormat, onDelta DeltaFunc) (string, error) {
+	prf.Settings = c.stageSettings(stage, attempt)
+	ctx, span := c.startCall(ctx, stage, attempt)
+	out, usage, err := c.completeCall(ctx, prf, onDelta)
+	c.recordUsage(stage, attempt, usage, err)
+	endCall(span, usage, err)
+	return out, err
+}
+
+// completeCall asks the provider for one completion. Providers without
+// streaming support deliver the whole completion as one delta.
+func (c *Client) completeCall(ctx context.Context, prf provider.ProviderResponseFormat, onDelta DeltaFunc) (string, provider.Usage, error) {
+	if onDelta == nil {
+		out, err := c.provider.Complete(ctx, prf)
+		return out.Text, out.Usage, err
+	}
+	streamer, ok := c.provider.(provider.Streamer)
+	if !ok {
+		out, err := c.provider.Complete(ctx, prf)
+		if err == nil {
+			onDelta(out.Text)
+		}
+		return out.Text, out.Usage, err
+	}
+	var b strings.Builder
+	var usage provider.Usage
+	for chunk, err := range streamer.Stream(ctx, prf) {
+		if chunk.Usage != (provider.Usage{}) {
+			usage = chunk.Usage
+		}
+		if err != nil {
+			return "", usage, err
+		}
+		if chunk.Text != "" {
+			b.WriteString(chunk.Text)
+			onDelta(chunk.Text)
+		}
+	}
+	out := strings.TrimSpace(b.String())
+	if out == "" {
+		return "", usage, errors.New("no message content")
+	}
+	return out, usage, nil
+}
+
+// workoutYAML renders a validated workout as YAML via its JSON encoding, so
+// the date keeps the schema's YYYY-MM-DD form instead of a full timestamp.
+func workoutYAML(wv *schemas.WorkoutV12Json) ([]byte, error) {
+	b, err := json.Marshal(wv)
+	if err != nil {
+		return nil, fmt.Errorf("marshal workout: %w", err)
+	}
+	var doc map[string]any
+	if err := yaml.Unmarshal(b, &doc); err != nil {
+		return nil, fmt.Errorf("marshal workout: %w", err)
+	}
+	return yaml.Marshal(doc)
+}
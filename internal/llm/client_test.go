@@ -4,16 +4,21 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"iter"
 	"log/slog"
-	"net/http"
-	"net/http/httptest"
+	"math"
 	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 	"time"
 
+	"github.com/aaronromeo/swolegen/internal/cache"
+	"github.com/aaronromeo/swolegen/internal/config"
 	"github.com/aaronromeo/swolegen/internal/llm/provider"
 	"github.com/aaronromeo/swolegen/internal/llm/schemas"
+	"github.com/aaronromeo/swolegen/internal/recovery"
 	"github.com/atombender/go-jsonschema/pkg/types"
 )
 
@@ -22,8 +27,8 @@ type fakeProvider struct {
 	err   error
 }
 
-func (f fakeProvider) Complete(ctx context.Context, prf provider.ProviderResponseFormat) (string, error) {
-	return f.reply, f.err
+func (f fakeProvider) Complete(ctx context.Context, prf provider.ProviderResponseFormat) (provider.Completion, error) {
+	return provider.Completion{Text: f.reply}, f.err
 }
 
 func (f fakeProvider) Validate() error { return nil }
@@ -150,62 +155,517 @@ type sequenceProvider struct {
 	i       int
 }
 
-func (s *sequenceProvider) Complete(ctx context.Context, prf provider.ProviderResponseFormat) (string, error) {
+func (s *sequenceProvider) Complete(ctx context.Context, prf provider.ProviderResponseFormat) (provider.Completion, error) {
 	if s.i >= len(s.replies) {
-		return "", errors.New("no more replies")
+		return provider.Completion{}, errors.New("no more replies")
 	}
 	r := s.replies[s.i]
 	s.i++
-	return r, nil
+	return provider.Completion{Text: r, Usage: provider.Usage{Model: "gpt-4o-mini-2024-07-18", PromptTokens: 1000, CompletionTokens: 200}}, nil
 }
 
 func (s *sequenceProvider) Validate() error { return nil }
 
-func TestFetchText_CapsSize(t *testing.T) {
-	// Serve a large response and ensure we cap reads
-	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.WriteHeader(200)
-		if _, err := w.Write([]byte(strings.Repeat("x", 200000))); err != nil {
-			t.Fatalf("write: %v", err)
+// recordingProvider captures the request and fails, so tests can inspect the
+// rendered prompt without building a full plan reply.
+type recordingProvider struct {
+	last provider.ProviderResponseFormat
+}
+
+func (r *recordingProvider) Complete(ctx context.Context, prf provider.ProviderResponseFormat) (provider.Completion, error) {
+	r.last = prf
+	return provider.Completion{}, errors.New("recorded")
+}
+
+func (r *recordingProvider) Validate() error { return nil }
+
+func TestAnalyze_RecoveryFromSeries(t *testing.T) {
+	series := recovery.NewSeries()
+	today := time.Now()
+	for i := 1; i <= 7; i++ {
+		hrv := 50.0
+		if err := series.Add(recovery.Day{Date: today.AddDate(0, 0, -i).Format("2006-01-02"), HRV: &hrv}); err != nil {
+			t.Fatalf("Add: %v", err)
 		}
-	}))
-	defer ts.Close()
-	got, err := fetchText(context.Background(), ts.URL, 1024)
+	}
+	hrv := 40.0
+	if err := series.Add(recovery.Day{Date: today.Format("2006-01-02"), HRV: &hrv}); err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+
+	p := &recordingProvider{}
+	cli, err := New(WithProvider(p), WithLogger(slog.Default()), WithRecovery(series))
 	if err != nil {
-		t.Fatalf("fetchText: %v", err)
+		t.Fatalf("New: %v", err)
+	}
+	sleep := 55
+	in := AnalyzerInputs{Location: "gym", EquipmentInventory: []string{"barbell"}, DurationMinutes: 45, GarminSleepScore: &sleep}
+	if _, err := cli.Analyze(context.Background(), in); err == nil {
+		t.Fatalf("expected recorded error")
 	}
-	if len(got) != 1024 {
-		t.Fatalf("expected 1024 bytes, got %d", len(got))
+
+	var user string
+	if err := json.Unmarshal([]byte(p.last.UserPrompt), &user); err != nil {
+		t.Fatalf("unmarshal user prompt: %v", err)
+	}
+	for _, want := range []string{"sleep_score: 55", "hrv_ms: 40", "HRV 20% below 7-day baseline"} {
+		if !strings.Contains(user, want) {
+			t.Fatalf("user prompt missing %q:\n%s", want, user)
+		}
 	}
 }
 
-func TestFetchToTmp_CreatesAndOptionallyRemoves(t *testing.T) {
-	// Use a file URL
-	f, err := os.CreateTemp("", "swolegen-test-*.txt")
+// validWorkoutJSON is a minimal generator reply that passes the workout schema.
+const validWorkoutJSON = `{"version":1.2,"workout_id":"2025-08-09-home-00","date":"2025-08-09","location":"home","units":"lbs",
+"duration_minutes":45,"goal":"hypertrophy","notes_to_user":null,"cut_order":["A"],
+"sets":[{"id":"A-GOBLET-SQ-1","tier":"A","must":true,"superset":null,"order":1,"exercise":"Goblet Squat","equipment":"dumbbell",
+"target_reps":"8-10","target_weight":60,"rir":2,"rest_s":90,"actual_weight":null,"actual_reps":null,"notes":null}],
+"post_workout":{"perceived_difficulty":null,"completion_time_minutes":null,"notes":null}}`
+
+func TestGenerate_DateMatchesSchema(t *testing.T) {
+	cli, err := New(WithProvider(fakeProvider{reply: validWorkoutJSON}), WithLogger(slog.Default()))
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	out, err := cli.Generate(context.Background(), schemas.AnalyzerV1Json{})
+	if err != nil {
+		t.Fatalf("Generate: %v", err)
+	}
+	if !strings.Contains(string(out), "date: \"2025-08-09\"\n") {
+		t.Fatalf("expected a YYYY-MM-DD date, got:\n%s", out)
+	}
+}
+
+func TestAnalyze_ReportsProgress(t *testing.T) {
+	var stages []string
+	cli, err := New(
+		WithProvider(&sequenceProvider{replies: []string{`{"bad": true}`, `{"still": "bad"}`}}),
+		WithRetries(1),
+		WithLogger(slog.Default()),
+		WithProgress(func(stage Stage, attempt int) {
+			stages = append(stages, fmt.Sprintf("%s/%d", stage, attempt))
+		}),
+	)
 	if err != nil {
-		t.Fatalf("tmp: %v", err)
+		t.Fatalf("New: %v", err)
 	}
-	defer func() {
-		if err := os.Remove(f.Name()); err != nil {
-			t.Fatalf("remove: %v", err)
+	if _, err := cli.Analyze(context.Background(), AnalyzerInputs{Location: "gym", DurationMinutes: 45}); err == nil {
+		t.Fatalf("expected analyze to fail")
+	}
+	want := "fetching_inputs/0 analyzing/0 repairing/1"
+	if got := strings.Join(stages, " "); got != want {
+		t.Fatalf("progress: got %q, want %q", got, want)
+	}
+}
+
+// chunkProvider streams its reply in fixed-size chunks.
+type chunkProvider struct {
+	reply string
+	size  int
+}
+
+func (p chunkProvider) Complete(ctx context.Context, prf provider.ProviderResponseFormat) (provider.Completion, error) {
+	return provider.Completion{Text: p.reply}, nil
+}
+
+func (p chunkProvider) Stream(ctx context.Context, prf provider.ProviderResponseFormat) iter.Seq2[provider.Completion, error] {
+	return func(yield func(provider.Completion, error) bool) {
+		for s := p.reply; s != ""; {
+			n := min(p.size, len(s))
+			if !yield(provider.Completion{Text: s[:n]}, nil) {
+				return
+			}
+			s = s[n:]
 		}
-	}()
-	if _, err := f.WriteString("hello world"); err != nil {
-		t.Fatalf("write: %v", err)
 	}
-	if err := f.Close(); err != nil {
-		t.Fatalf("close: %v", err)
+}
+
+func (p chunkProvider) Validate() error { return nil }
+
+func TestGenerateStream(t *testing.T) {
+	cli, err := New(WithProvider(chunkProvider{reply: validWorkoutJSON, size: 64}), WithLogger(slog.Default()))
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	var deltas []string
+	out, err := cli.GenerateStream(context.Background(), schemas.AnalyzerV1Json{}, func(d string) {
+		deltas = append(deltas, d)
+	})
+	if err != nil {
+		t.Fatalf("GenerateStream: %v", err)
+	}
+	if len(deltas) < 2 || strings.Join(deltas, "") != validWorkoutJSON {
+		t.Fatalf("expected the reply in several deltas, got %d", len(deltas))
+	}
+	if !strings.Contains(string(out), "workout_id: 2025-08-09-home-00") {
+		t.Fatalf("expected validated yaml, got:\n%s", out)
 	}
-	p, content, err := fetchToTmp(context.Background(), "file://"+f.Name(), "instructions", 65536)
+}
+
+func TestGenerate_ValidationFindings(t *testing.T) {
+	cli, err := New(
+		WithProvider(&sequenceProvider{replies: []string{`{"version": 1.2}`, `{"sets": []}`}}),
+		WithRetries(1),
+		WithLogger(slog.Default()),
+	)
 	if err != nil {
-		t.Fatalf("fetchToTmp: %v", err)
+		t.Fatalf("New: %v", err)
+	}
+	_, err = cli.Generate(context.Background(), schemas.AnalyzerV1Json{})
+	var verr *ValidationError
+	if !errors.As(err, &verr) {
+		t.Fatalf("expected ValidationError, got %v", err)
+	}
+	if len(verr.Findings) != 2 {
+		t.Fatalf("expected a finding per attempt, got %q", verr.Findings)
+	}
+}
+
+// blockingProvider waits for the request context and counts its calls.
+type blockingProvider struct{ calls int }
+
+func (b *blockingProvider) Complete(ctx context.Context, prf provider.ProviderResponseFormat) (provider.Completion, error) {
+	b.calls++
+	<-ctx.Done()
+	return provider.Completion{}, ctx.Err()
+}
+
+func (b *blockingProvider) Validate() error { return nil }
+
+func TestStageTimeouts(t *testing.T) {
+	p := &blockingProvider{}
+	cli, err := New(
+		WithProvider(p),
+		WithRetries(2),
+		WithTimeouts(Timeouts{Analyze: 20 * time.Millisecond, Generate: 20 * time.Millisecond}),
+		WithLogger(slog.Default()),
+	)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+
+	_, err = cli.Analyze(context.Background(), AnalyzerInputs{Location: "gym", DurationMinutes: 45})
+	var terr *TimeoutError
+	if !errors.As(err, &terr) || terr.Stage != StageAnalyzing {
+		t.Fatalf("expected analyzing timeout, got %v", err)
+	}
+	_, err = cli.Generate(context.Background(), schemas.AnalyzerV1Json{})
+	if !errors.As(err, &terr) || terr.Stage != StageGenerating {
+		t.Fatalf("expected generating timeout, got %v", err)
+	}
+	if p.calls != 2 {
+		t.Fatalf("expected no repairs after a timeout, got %d calls", p.calls)
+	}
+}
+
+func TestCanceledContextStopsRepairs(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	p := &sequenceProvider{replies: []string{`{"bad": true}`, `{"bad": true}`, `{"bad": true}`}}
+	cli, err := New(
+		WithProvider(p),
+		WithRetries(2),
+		WithLogger(slog.Default()),
+		WithProgress(func(stage Stage, attempt int) {
+			if stage == StageValidating {
+				cancel()
+			}
+		}),
+	)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	_, err = cli.Generate(ctx, schemas.AnalyzerV1Json{})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+	var terr *TimeoutError
+	if errors.As(err, &terr) {
+		t.Fatalf("caller cancellation should not be a stage timeout: %v", err)
+	}
+	if p.i != 1 {
+		t.Fatalf("expected one provider call, got %d", p.i)
+	}
+}
+
+func TestUsage_CountsRepairs(t *testing.T) {
+	prices, err := ParsePrices("gpt-4o=2.50:10.00, gpt-4o-mini=0.15:0.60")
+	if err != nil {
+		t.Fatalf("ParsePrices: %v", err)
+	}
+	cli, err := New(
+		WithProvider(&sequenceProvider{replies: []string{`{"version": 1.2}`, validWorkoutJSON}}),
+		WithRetries(2),
+		WithPrices(prices),
+		WithLogger(slog.Default()),
+	)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	if _, err := cli.Generate(context.Background(), schemas.AnalyzerV1Json{}); err != nil {
+		t.Fatalf("Generate: %v", err)
+	}
+	u := cli.Usage()
+	if len(u.Calls) != 2 || u.Repairs != 1 || u.Calls[1].Attempt != 1 || u.Calls[1].Stage != StageGenerating {
+		t.Fatalf("expected the repair to be accounted, got %+v", u)
+	}
+	if u.PromptTokens != 2000 || u.CompletionTokens != 400 {
+		t.Fatalf("unexpected token totals: %+v", u)
 	}
-	if content != "hello world" {
-		t.Fatalf("content mismatch: %q", content)
+	// The dated model matches the longest configured prefix, gpt-4o-mini.
+	if want := 2 * (1000*0.15 + 200*0.60) / 1e6; math.Abs(u.CostUSD-want) > 1e-12 {
+		t.Fatalf("cost: got %v, want %v", u.CostUSD, want)
 	}
-	if _, statErr := os.Stat(p); statErr == nil {
-		if _, err2 := os.Stat(p); err2 == nil {
-			t.Fatalf("expected tmp file to be removed: %s", p)
+
+	if _, err := ParsePrices("gpt-4o=cheap"); err == nil {
+		t.Fatalf("expected malformed price to fail")
+	}
+}
+
+func TestCache_SkipsProvider(t *testing.T) {
+	c := cache.NewMemory(1<<20, time.Hour)
+	newClient := func(p provider.Provider, opts ...LLMClientOption) *Client {
+		cli, err := New(append([]LLMClientOption{WithProvider(p), WithCache(c), WithLogger(slog.Default())}, opts...)...)
+		if err != nil {
+			t.Fatalf("New: %v", err)
+		}
+		return cli
+	}
+
+	first := &sequenceProvider{replies: []string{validWorkoutJSON}}
+	want, err := newClient(first).Generate(context.Background(), schemas.AnalyzerV1Json{})
+	if err != nil {
+		t.Fatalf("Generate: %v", err)
+	}
+
+	cli := newClient(&sequenceProvider{})
+	var deltas []string
+	got, err := cli.GenerateStream(context.Background(), schemas.AnalyzerV1Json{}, func(d string) { deltas = append(deltas, d) })
+	if err != nil {
+		t.Fatalf("cached Generate: %v", err)
+	}
+	if string(got) != string(want) || len(deltas) != 1 {
+		t.Fatalf("expected the cached workout as one delta, got %d deltas:\n%s", len(deltas), got)
+	}
+	if u := cli.Usage(); u.CacheHits != 1 || len(u.Calls) != 0 {
+		t.Fatalf("expected a cache hit and no calls, got %+v", u)
+	}
+
+	// A different plan is a different prompt, and bypass skips the lookup.
+	other := schemas.AnalyzerV1Json{TimeBudget: schemas.AnalyzerV1JsonTimeBudget{TargetSetCount: 9}}
+	if _, err := newClient(&sequenceProvider{}).Generate(context.Background(), other); err == nil {
+		t.Fatalf("expected a miss for a different plan")
+	}
+	if _, err := newClient(&sequenceProvider{}, WithStageSettings(StageGenerating, provider.Settings{Model: "gpt-4o"})).Generate(context.Background(), schemas.AnalyzerV1Json{}); err == nil {
+		t.Fatalf("expected a miss for a different model")
+	}
+	refresh := &sequenceProvider{replies: []string{validWorkoutJSON}}
+	if _, err := newClient(refresh, WithCacheBypass(true)).Generate(context.Background(), schemas.AnalyzerV1Json{}); err != nil || refresh.i != 1 {
+		t.Fatalf("expected bypass to call the provider, err=%v calls=%d", err, refresh.i)
+	}
+}
+
+func TestLoadPrompts_OverridesAndFallsBack(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(dir+"/terse", 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(dir+"/terse/analyzer-user.txt", []byte("Plan {{.DurationMinutes}} minutes at {{.Location}}."), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	reg, err := LoadPrompts(dir, "terse")
+	if err != nil {
+		t.Fatalf("LoadPrompts: %v", err)
+	}
+	terse, err := reg.Get("")
+	if err != nil || terse.Name != "terse" {
+		t.Fatalf("expected terse as the default set, got %v, %v", terse, err)
+	}
+	if terse.Version == DefaultPrompts().Version || !strings.HasPrefix(terse.Version, "terse-") {
+		t.Fatalf("expected a distinct terse version, got %q", terse.Version)
+	}
+	if byVersion, err := reg.Get(terse.Version); err != nil || byVersion != terse {
+		t.Fatalf("Get(version): %v, %v", byVersion, err)
+	}
+	if _, err := reg.Get("missing"); !errors.Is(err, ErrUnknownPrompts) {
+		t.Fatalf("expected ErrUnknownPrompts, got %v", err)
+	}
+	if _, err := LoadPrompts(dir, "missing"); !errors.Is(err, ErrUnknownPrompts) {
+		t.Fatalf("expected ErrUnknownPrompts for an unknown default, got %v", err)
+	}
+
+	p := &recordingProvider{}
+	cli, err := New(WithProvider(p), WithLogger(slog.Default()), WithPrompts(terse))
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	if cli.PromptVersion() != terse.Version {
+		t.Fatalf("PromptVersion = %q, want %q", cli.PromptVersion(), terse.Version)
+	}
+	_, _ = cli.Analyze(context.Background(), AnalyzerInputs{Location: "gym", DurationMinutes: 30})
+	var user string
+	if err := json.Unmarshal([]byte(p.last.UserPrompt), &user); err != nil {
+		t.Fatalf("unmarshal user prompt: %v", err)
+	}
+	if user != "Plan 30 minutes at gym." {
+		t.Fatalf("unexpected user prompt %q", user)
+	}
+	// The set left the system prompt out, so the embedded one is used.
+	if p.last.SystemPrompt != DefaultPrompts().analyzerSystem() {
+		t.Fatalf("expected the embedded analyzer system prompt")
+	}
+}
+
+func TestReadinessChecks(t *testing.T) {
+	if err := CheckSchemas(); err != nil {
+		t.Fatalf("CheckSchemas: %v", err)
+	}
+	if err := checkSchema(`{"type":"object","properties":{"a":{"$ref":"#/$defs/missing"}}}`); err == nil {
+		t.Fatalf("expected an unresolved $ref to fail")
+	}
+
+	dir := t.TempDir()
+	if err := os.MkdirAll(dir+"/typo", 0o755); err != nil {
+		t.Fatal(err)
+	}
+	// Parses, but fails when executed against GeneratorPromptData.
+	if err := os.WriteFile(dir+"/typo/generator-user.txt", []byte("{{.Plann}}"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	reg, err := LoadPrompts(dir, "")
+	if err != nil {
+		t.Fatalf("LoadPrompts: %v", err)
+	}
+	if err := reg.Check(); err == nil || !strings.Contains(err.Error(), "typo/generator-user.txt") {
+		t.Fatalf("Check = %v; want the typo set's generator prompt to fail", err)
+	}
+	if reg, _ := LoadPrompts("", ""); reg.Check() != nil {
+		t.Fatalf("embedded prompts fail to render: %v", reg.Check())
+	}
+}
+
+// settingsRecorder records the settings of every request and replies with
+// output that never validates, so each stage runs through its repairs.
+type settingsRecorder struct {
+	got []provider.Settings
+}
+
+func (r *settingsRecorder) Complete(ctx context.Context, prf provider.ProviderResponseFormat) (provider.Completion, error) {
+	r.got = append(r.got, prf.Settings)
+	return provider.Completion{Text: "{}"}, nil
+}
+
+func (r *settingsRecorder) Validate() error { return nil }
+
+func TestStageSettings(t *testing.T) {
+	seed := int64(42)
+	cfg := &config.Config{
+		LlmModel:                "gpt-4o-mini",
+		LlmModelGenerator:       "gpt-4.1-mini",
+		LlmModelRepair:          "gpt-4o-mini",
+		LlmTemperatureAnalyzer:  0.1,
+		LlmTemperatureGenerator: 0.4,
+		LlmMaxTokensGenerator:   4000,
+		LlmSeedAnalyzer:         &seed,
+	}
+	override := 0.9
+	rec := &settingsRecorder{}
+	cli, err := New(append(configSettings(cfg),
+		WithProvider(rec),
+		WithRetries(1),
+		WithLogger(slog.Default()),
+		WithStageSettings(StageGenerating, provider.Settings{Temperature: &override}),
+	)...)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	_, _ = cli.Analyze(context.Background(), AnalyzerInputs{Location: "gym", DurationMinutes: 45})
+	_, _ = cli.Generate(context.Background(), schemas.AnalyzerV1Json{})
+	if len(rec.got) != 4 {
+		t.Fatalf("expected a completion and a repair per stage, got %d", len(rec.got))
+	}
+
+	analyze, analyzeRepair, generate, generateRepair := rec.got[0], rec.got[1], rec.got[2], rec.got[3]
+	if analyze.Model != "gpt-4o-mini" || *analyze.Temperature != 0.1 || analyze.Seed == nil || *analyze.Seed != 42 {
+		t.Errorf("analyzer settings = %+v", analyze)
+	}
+	if analyzeRepair.Model != "gpt-4o-mini" || *analyzeRepair.Temperature != 0.1 {
+		t.Errorf("analyzer repair should keep the analyzer's settings, got %+v", analyzeRepair)
+	}
+	if generate.Model != "gpt-4.1-mini" || *generate.Temperature != 0.9 || generate.MaxTokens != 4000 || generate.Seed != nil {
+		t.Errorf("generator settings = %+v", generate)
+	}
+	if generateRepair.Model != "gpt-4o-mini" || generateRepair.MaxTokens != 4000 {
+		t.Errorf("generator repair should use the repair model with the generator's settings, got %+v", generateRepair)
+	}
+	if got := cli.StageModel(StageGenerating); got != "gpt-4.1-mini" {
+		t.Errorf("StageModel(generating) = %q", got)
+	}
+}
+
+func TestSessionDates(t *testing.T) {
+	toronto, err := time.LoadLocation("America/Toronto")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 21:30 in Toronto is already the next day in UTC.
+	fixed := time.Date(2025, 8, 10, 1, 30, 0, 0, time.UTC)
+	rec := &recordingProvider{}
+	cli, err := New(
+		WithProvider(rec),
+		WithRetries(0),
+		WithLogger(slog.Default()),
+		WithClock(func() time.Time { return fixed }),
+		WithTimezone(toronto),
+	)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+
+	for _, tc := range []struct {
+		in   AnalyzerInputs
+		want [3]string
+	}{
+		{AnalyzerInputs{}, [3]string{"2025-08-09", "2025-05-11", "2025-07-26"}},
+		{AnalyzerInputs{Timezone: "UTC"}, [3]string{"2025-08-10", "2025-05-12", "2025-07-27"}},
+		{AnalyzerInputs{SessionDate: "2025-03-01", Timezone: "Asia/Tokyo"}, [3]string{"2025-03-01", "2024-12-01", "2025-02-15"}},
+	} {
+		d, err := cli.sessionDates(tc.in)
+		got := [3]string{d.Date, d.RecentBestsFrom, d.AntiRepeatFrom}
+		if err != nil || got != tc.want || d.Day.Format(dateLayout) != d.Date {
+			t.Errorf("sessionDates(%+v) = %+v, %v; want %+v", tc.in, got, err, tc.want)
+		}
+	}
+	day, err := SessionDay("2025-03-01", "Asia/Tokyo", fixed, nil)
+	if err != nil || !day.Equal(time.Date(2025, 2, 28, 15, 0, 0, 0, time.UTC)) {
+		t.Errorf("SessionDay = %v, %v; want midnight in Tokyo", day, err)
+	}
+	for _, in := range []AnalyzerInputs{{Timezone: "Mars/Olympus"}, {SessionDate: "08/09/2025"}} {
+		if _, err := cli.RunAnalysis(context.Background(), in); err == nil {
+			t.Errorf("RunAnalysis(%+v): expected an input error", in)
+		}
+	}
+
+	_, _ = cli.RunAnalysis(context.Background(), AnalyzerInputs{Location: "home", DurationMinutes: 45})
+	for _, want := range []string{`session_date: \"2025-08-09\"`, `recent_bests_from: \"2025-05-11\"`, `anti_repeat_from: \"2025-07-26\"`} {
+		if !strings.Contains(rec.last.UserPrompt, want) {
+			t.Errorf("prompt missing %s:\n%s", want, rec.last.UserPrompt)
 		}
 	}
 }
+
+func TestNewWithDeps(t *testing.T) {
+	// Nothing is read from disk: loading prompts is NewDeps' job.
+	cfg := &config.Config{LlmPromptsDir: filepath.Join(t.TempDir(), "missing"), LlmRetries: 1}
+	prompts := DefaultPrompts()
+	cli, err := NewWithDeps(cfg, slog.Default(), Deps{Provider: &recordingProvider{}, Prompts: prompts})
+	if err != nil {
+		t.Fatalf("NewWithDeps: %v", err)
+	}
+	if cli.retries != 1 || cli.prompts != prompts {
+		t.Fatalf("client missed its config or deps: retries %d", cli.retries)
+	}
+	if _, err := NewWithDeps(cfg, slog.Default(), Deps{}); err == nil {
+		t.Fatalf("NewWithDeps: expected an error without a provider")
+	}
+}
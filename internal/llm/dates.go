@@ -0,0 +1,86 @@
+package llm
+
+import (
+	"fmt"
+	"time"
+)
+
+const (
+	dateLayout = "2006-01-02"
+	// recentBestsDays and antiRepeatDays are the history windows the
+	// analyzer infers recent bests from and avoids repeating sessions in,
+	// counted back from the session date.
+	recentBestsDays = 90
+	antiRepeatDays  = 14
+)
+
+// WithClock sets the clock the session date is taken from when the inputs
+// do not name one. Default time.Now.
+func WithClock(now func() time.Time) LLMClientOption {
+	return func(c *Client) {
+		if now != nil {
+			c.now = now
+		}
+	}
+}
+
+// WithTimezone sets the zone "today" is taken in for inputs that name
+// neither a session date nor a timezone. Default the server's local zone.
+func WithTimezone(loc *time.Location) LLMClientOption {
+	return func(c *Client) {
+		if loc != nil {
+			c.location = loc
+		}
+	}
+}
+
+// sessionDates are the session date and the history windows that end on it.
+type sessionDates struct {
+	// Day is the session date at midnight UTC; Date formats it.
+	Day             time.Time
+	Date            string
+	RecentBestsFrom string
+	AntiRepeatFrom  string
+}
+
+// SessionDay resolves the date a session is for: date (YYYY-MM-DD) when
+// set, otherwise today at now in timezone, falling back to loc, or the
+// local zone when loc is nil. The day is returned at midnight in the
+// resolved zone, so callers can bound activity windows by it.
+func SessionDay(date, timezone string, now time.Time, loc *time.Location) (time.Time, error) {
+	if loc == nil {
+		loc = time.Local
+	}
+	if timezone != "" {
+		l, err := time.LoadLocation(timezone)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("timezone: %w", err)
+		}
+		loc = l
+	}
+	if date != "" {
+		d, err := time.ParseInLocation(dateLayout, date, loc)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("session_date: want YYYY-MM-DD, got %q", date)
+		}
+		return d, nil
+	}
+	now = now.In(loc)
+	return time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, loc), nil
+}
+
+// sessionDates resolves the session date of in on the client's clock and
+// zone (see SessionDay).
+func (c *Client) sessionDates(in AnalyzerInputs) (sessionDates, error) {
+	d, err := SessionDay(in.SessionDate, in.Timezone, c.now(), c.location)
+	if err != nil {
+		return sessionDates{}, err
+	}
+	day := time.Date(d.Year(), d.Month(), d.Day(), 0, 0, 0, 0, time.UTC)
+	return sessionDates{
+		Day:             day,
+		Date:            day.Format(dateLayout),
+		RecentBestsFrom: day.AddDate(0, 0, -recentBestsDays).Format(dateLayout),
+		AntiRepeatFrom:  day.AddDate(0, 0, -antiRepeatDays).Format(dateLayout),
+	}, nil
+}
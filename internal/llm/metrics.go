@@ -0,0 +1,81 @@
+package llm
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+
+	"github.com/aaronromeo/swolegen/internal/llm/provider"
+	"github.com/aaronromeo/swolegen/internal/metrics"
+)
+
+// metricStage labels a completion analyze, generate or repair.
+func metricStage(stage Stage, attempt int) string {
+	switch {
+	case attempt > 0:
+		return "repair"
+	case stage == StageAnalyzing:
+		return "analyze"
+	default:
+		return "generate"
+	}
+}
+
+// observeCall exports a completion's latency and tokens.
+func (c *Client) observeCall(stage Stage, attempt int, u provider.Usage, err error) {
+	name, _ := c.ProviderInfo()
+	model := c.model(stage, attempt)
+	if u.Model != "" {
+		model = u.Model
+	}
+	s := metricStage(stage, attempt)
+	outcome := "ok"
+	if err != nil {
+		outcome = "error"
+	}
+	metrics.LLMCalls.WithLabelValues(name, model, s, outcome).Observe(u.Latency.Seconds())
+	metrics.LLMTokens.WithLabelValues(name, model, s, "prompt").Add(float64(u.PromptTokens))
+	metrics.LLMTokens.WithLabelValues(name, model, s, "completion").Add(float64(u.CompletionTokens))
+}
+
+// observeRepair counts a repair prompt for stage.
+func observeRepair(stage Stage) {
+	metrics.LLMRepairs.WithLabelValues(metricStage(stage, 0)).Inc()
+}
+
+// observeInvalid counts output for stage that failed validation.
+func observeInvalid(stage Stage, err error) {
+	metrics.LLMValidationFailures.WithLabelValues(metricStage(stage, 0), validationCategory(err)).Inc()
+}
+
+// validationCategory names the kind of rule err reports broken, from the
+// decoder's error types and the messages of the generated schema types.
+func validationCategory(err error) string {
+	var syntax *json.SyntaxError
+	var typ *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &syntax), errors.Is(err, io.ErrUnexpectedEOF):
+		return "syntax"
+	case errors.As(err, &typ):
+		return "type"
+	}
+	msg := err.Error()
+	switch {
+	case strings.HasSuffix(msg, ": required"):
+		return "required"
+	case strings.Contains(msg, "expected one of"):
+		return "enum"
+	case strings.Contains(msg, " length: must be"):
+		return "length"
+	case strings.Contains(msg, "must be >=") || strings.Contains(msg, "must be <="):
+		return "range"
+	case strings.Contains(msg, "pattern match"):
+		return "pattern"
+	case strings.Contains(msg, "invalid character") || strings.Contains(msg, "unexpected end of JSON input"):
+		return "syntax"
+	case strings.Contains(msg, "cannot unmarshal"):
+		return "type"
+	}
+	return "other"
+}
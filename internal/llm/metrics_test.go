@@ -0,0 +1,69 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"testing"
+
+	"github.com/aaronromeo/swolegen/internal/llm/schemas"
+	"github.com/aaronromeo/swolegen/internal/metrics"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestValidationCategory(t *testing.T) {
+	var plan schemas.AnalyzerV1Json
+	for _, tc := range []struct {
+		in   string
+		want string
+	}{
+		{`{"meta":`, "syntax"},
+		{`not json`, "syntax"},
+		{`[]`, "type"},
+		{`{}`, "required"},
+	} {
+		if got := validationCategory(plan.UnmarshalJSON([]byte(tc.in))); got != tc.want {
+			t.Errorf("%s: got %q, want %q", tc.in, got, tc.want)
+		}
+	}
+	for msg, want := range map[string]string{
+		`invalid value (expected one of []interface {}{"lbs", "kg"}): "stone"`: "enum",
+		"field exercise length: must be >= 1":                                  "length",
+		"field rir: must be <= 5":                                              "range",
+		"field set_id pattern match: must match ^[A-Z]":                        "pattern",
+		"something else": "other",
+	} {
+		if got := validationCategory(errors.New(msg)); got != want {
+			t.Errorf("%s: got %q, want %q", msg, got, want)
+		}
+	}
+}
+
+func TestMetrics_CountsRepairsAndFailures(t *testing.T) {
+	repairs := metrics.LLMRepairs.WithLabelValues("generate")
+	invalid := metrics.LLMValidationFailures.WithLabelValues("generate", "required")
+	tokens := metrics.LLMTokens.WithLabelValues("", "gpt-4o-mini-2024-07-18", "repair", "prompt")
+	beforeRepairs, beforeInvalid, beforeTokens := testutil.ToFloat64(repairs), testutil.ToFloat64(invalid), testutil.ToFloat64(tokens)
+
+	cli, err := New(
+		WithProvider(&sequenceProvider{replies: []string{`{"version": 1.2}`, `{"sets": []}`}}),
+		WithRetries(1),
+		WithLogger(slog.Default()),
+	)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	if _, err := cli.Generate(context.Background(), schemas.AnalyzerV1Json{}); err == nil {
+		t.Fatal("expected validation error")
+	}
+
+	if d := testutil.ToFloat64(repairs) - beforeRepairs; d != 1 {
+		t.Errorf("repairs: got %v, want 1", d)
+	}
+	if d := testutil.ToFloat64(invalid) - beforeInvalid; d != 2 {
+		t.Errorf("validation failures: got %v, want 2", d)
+	}
+	if d := testutil.ToFloat64(tokens) - beforeTokens; d != 1000 {
+		t.Errorf("repair prompt tokens: got %v, want 1000", d)
+	}
+}
@@ -0,0 +1,33 @@
+package llm
+
+// Stage names a step of an analyze or generate run.
+type Stage string
+
+const (
+	StageFetchingInputs Stage = "fetching_inputs"
+	StageAnalyzing      Stage = "analyzing"
+	StageRepairing      Stage = "repairing"
+	StageGenerating     Stage = "generating"
+	StageValidating     Stage = "validating"
+)
+
+// ProgressFunc observes stage transitions. attempt is the 1-based repair
+// attempt for StageRepairing and 0 otherwise.
+type ProgressFunc func(stage Stage, attempt int)
+
+// WithProgress reports each stage of Analyze/Generate to fn as it starts.
+// fn runs on the calling goroutine and must not block.
+func WithProgress(fn ProgressFunc) LLMClientOption {
+	return func(c *Client) {
+		c.progress = fn
+	}
+}
+
+func (c *Client) report(stage Stage, attempt int) {
+	if c.progress != nil {
+		c.progress(stage, attempt)
+	}
+}
+
+// DeltaFunc receives streamed generator output (see GenerateStream).
+type DeltaFunc func(delta string)
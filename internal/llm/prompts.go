@@ -0,0 +1,277 @@
+package llm
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+)
+
+// Prompt template files. A prompt directory may provide any subset; the
+// rest come from the embedded defaults.
+const (
+	promptAnalyzerSystem  = "analyzer-system.txt"
+	promptAnalyzerUser    = "analyzer-user.txt"
+	promptGeneratorSystem = "generator-system.txt"
+	promptGeneratorUser   = "generator-user.txt"
+	promptRepairAnalyzer  = "repair-analyzer.txt"
+	promptRepairGenerator = "repair-generator.txt"
+)
+
+var promptFiles = []string{
+	promptAnalyzerSystem, promptAnalyzerUser,
+	promptGeneratorSystem, promptGeneratorUser,
+	promptRepairAnalyzer, promptRepairGenerator,
+}
+
+// EmbeddedPrompts names the prompt set compiled into the binary.
+const EmbeddedPrompts = "embedded"
+
+// ErrUnknownPrompts is returned when a requested prompt set is not loaded.
+var ErrUnknownPrompts = errors.New("llm: unknown prompt set")
+
+// AnalyzerPromptData fills the analyzer user prompt. Values other than the
+// free-text blocks and quoted strings are pre-rendered JSON or "null".
+type AnalyzerPromptData struct {
+	Instructions       string
+	History            string
+	StravaRecent       string
+	UpcomingCardio     string
+	SleepScore         string
+	BodyBattery        string
+	HRV                string
+	RestingHR          string
+	RecoveryBaseline   string
+	RecoveryTrends     string
+	EquipmentInventory string
+	SessionDate        string
+	RecentBestsFrom    string
+	AntiRepeatFrom     string
+	Location           string
+	Units              string
+	DurationMinutes    int
+}
+
+// GeneratorPromptData fills the generator user prompt; Plan is the analyzer
+// plan as JSON.
+type GeneratorPromptData struct {
+	Plan string
+}
+
+// RepairPromptData fills the repair prompts. Schema is only set for the
+// analyzer repair.
+type RepairPromptData struct {
+	Errors string
+	Schema string
+}
+
+var promptFuncs = template.FuncMap{
+	// quote renders a string as a double-quoted literal.
+	"quote": strconv.Quote,
+	// indent indents every line after the first by n spaces, for values
+	// placed inside YAML-style literal blocks.
+	"indent": func(n int, s string) string {
+		return strings.ReplaceAll(s, "\n", "\n"+strings.Repeat(" ", n))
+	},
+}
+
+// PromptSet is one version of the analyzer and generator prompts. Version
+// combines the set's name with a hash of its templates, so any edit yields
+// a new version.
+type PromptSet struct {
+	Name    string
+	Version string
+
+	tmpl *template.Template
+}
+
+// parsePromptSet parses the prompt files in fsys, taking missing ones from
+// fallback.
+func parsePromptSet(name string, fsys, fallback fs.FS) (*PromptSet, error) {
+	root := template.New(name).Funcs(promptFuncs).Option("missingkey=error")
+	h := sha256.New()
+	for _, file := range promptFiles {
+		raw, err := fs.ReadFile(fsys, file)
+		if errors.Is(err, fs.ErrNotExist) && fallback != nil {
+			raw, err = fs.ReadFile(fallback, file)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("prompt set %s: %w", name, err)
+		}
+		if _, err := root.New(file).Parse(string(raw)); err != nil {
+			return nil, fmt.Errorf("prompt set %s: %w", name, err)
+		}
+		h.Write(raw)
+	}
+	return &PromptSet{
+		Name:    name,
+		Version: name + "-" + hex.EncodeToString(h.Sum(nil))[:12],
+		tmpl:    root,
+	}, nil
+}
+
+func (p *PromptSet) render(file string, data any) (string, error) {
+	var b bytes.Buffer
+	if err := p.tmpl.ExecuteTemplate(&b, file, data); err != nil {
+		return "", fmt.Errorf("render prompt %s/%s: %w", p.Name, file, err)
+	}
+	return b.String(), nil
+}
+
+// The system prompts take no data; they parsed, so rendering cannot fail
+// beyond what parsePromptSet already caught.
+func (p *PromptSet) analyzerSystem() string {
+	s, _ := p.render(promptAnalyzerSystem, nil)
+	return s
+}
+
+func (p *PromptSet) generatorSystem() string {
+	s, _ := p.render(promptGeneratorSystem, nil)
+	return s
+}
+
+var (
+	embeddedOnce sync.Once
+	embeddedSet  *PromptSet
+)
+
+// DefaultPrompts returns the embedded prompt set.
+func DefaultPrompts() *PromptSet {
+	embeddedOnce.Do(func() {
+		sub, err := fs.Sub(embeddedPrompts, "prompts")
+		if err == nil {
+			embeddedSet, err = parsePromptSet(EmbeddedPrompts, sub, nil)
+		}
+		if err != nil {
+			panic(fmt.Sprintf("embedded prompts: %v", err))
+		}
+	})
+	return embeddedSet
+}
+
+// PromptRegistry holds the prompt sets a server can choose between per
+// request.
+type PromptRegistry struct {
+	sets map[string]*PromptSet
+	def  string
+}
+
+// LoadPrompts builds a registry of the embedded prompts plus one set per
+// subdirectory of dir, named after the subdirectory. Files a subdirectory
+// leaves out fall back to the embedded defaults, so a set can override just
+// one prompt. def names the default set; empty means the embedded one. An
+// empty dir loads only the embedded set.
+func LoadPrompts(dir, def string) (*PromptRegistry, error) {
+	embedded := DefaultPrompts()
+	r := &PromptRegistry{sets: map[string]*PromptSet{EmbeddedPrompts: embedded}, def: EmbeddedPrompts}
+	if dir != "" {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			return nil, fmt.Errorf("prompt dir: %w", err)
+		}
+		fallback, _ := fs.Sub(embeddedPrompts, "prompts")
+		for _, e := range entries {
+			if !e.IsDir() || e.Name() == EmbeddedPrompts {
+				continue
+			}
+			set, err := parsePromptSet(e.Name(), os.DirFS(filepath.Join(dir, e.Name())), fallback)
+			if err != nil {
+				return nil, err
+			}
+			r.sets[e.Name()] = set
+		}
+	}
+	if def != "" {
+		if _, ok := r.sets[def]; !ok {
+			return nil, fmt.Errorf("%w: %q", ErrUnknownPrompts, def)
+		}
+		r.def = def
+	}
+	return r, nil
+}
+
+// Get returns the set with the given name or full version, or the default
+// set for an empty name.
+func (r *PromptRegistry) Get(name string) (*PromptSet, error) {
+	if name == "" {
+		name = r.def
+	}
+	if set, ok := r.sets[name]; ok {
+		return set, nil
+	}
+	for _, set := range r.sets {
+		if set.Version == name {
+			return set, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %q", ErrUnknownPrompts, name)
+}
+
+// Names lists the loaded sets.
+func (r *PromptRegistry) Names() []string {
+	names := make([]string, 0, len(r.sets))
+	for name := range r.sets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Check renders every loaded set with sample data. Sets parse when loaded,
+// but a template can still fail at execution, e.g. on a misspelled field.
+func (r *PromptRegistry) Check() error {
+	var errs []error
+	for _, name := range r.Names() {
+		errs = append(errs, r.sets[name].check())
+	}
+	return errors.Join(errs...)
+}
+
+func (p *PromptSet) check() error {
+	samples := map[string]any{
+		promptAnalyzerSystem: nil,
+		promptAnalyzerUser: AnalyzerPromptData{
+			Instructions: "sample", History: "sample", StravaRecent: "[]", UpcomingCardio: "sample",
+			SleepScore: "null", BodyBattery: "null", HRV: "null", RestingHR: "null",
+			RecoveryBaseline: "null", RecoveryTrends: "null", EquipmentInventory: "[]",
+			SessionDate: "2025-01-01", RecentBestsFrom: "2024-10-03", AntiRepeatFrom: "2024-12-18",
+			Location: "home", Units: "lbs", DurationMinutes: 45,
+		},
+		promptGeneratorSystem: nil,
+		promptGeneratorUser:   GeneratorPromptData{Plan: "{}"},
+		promptRepairAnalyzer:  RepairPromptData{Errors: "sample", Schema: "{}"},
+		promptRepairGenerator: RepairPromptData{Errors: "sample"},
+	}
+	var errs []error
+	for _, file := range promptFiles {
+		if _, err := p.render(file, samples[file]); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// WithPrompts selects the prompt set used by the client. Clients default to
+// the embedded set; nil keeps the current one.
+func WithPrompts(p *PromptSet) LLMClientOption {
+	return func(c *Client) {
+		if p != nil {
+			c.prompts = p
+		}
+	}
+}
+
+// PromptVersion reports the version of the prompts the client renders, for
+// recording alongside its output.
+func (c *Client) PromptVersion() string {
+	return c.prompts.Version
+}
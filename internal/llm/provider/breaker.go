@@ -0,0 +1,265 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"iter"
+	"log/slog"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/openai/openai-go/v2"
+)
+
+// ErrCircuitOpen is matched by errors returned while a breaker rejects calls.
+var ErrCircuitOpen = errors.New("provider circuit open")
+
+// CircuitOpenError is returned without calling the provider while its
+// breaker is open. RetryAfter is how long until the breaker lets a probe
+// through.
+type CircuitOpenError struct {
+	Provider   string
+	RetryAfter time.Duration
+}
+
+func (e *CircuitOpenError) Error() string {
+	if e.Provider == "" {
+		return fmt.Sprintf("%s; retry after %s", ErrCircuitOpen, e.RetryAfter)
+	}
+	return fmt.Sprintf("%s: %s; retry after %s", ErrCircuitOpen, e.Provider, e.RetryAfter)
+}
+
+func (e *CircuitOpenError) Is(target error) bool { return target == ErrCircuitOpen }
+
+// BreakerState is the state of a circuit breaker.
+type BreakerState string
+
+const (
+	// BreakerClosed passes calls through and counts failures.
+	BreakerClosed BreakerState = "closed"
+	// BreakerOpen rejects calls until the cooldown has passed.
+	BreakerOpen BreakerState = "open"
+	// BreakerHalfOpen lets a single probe through; its outcome closes or
+	// reopens the breaker.
+	BreakerHalfOpen BreakerState = "half_open"
+)
+
+// Breaker is a Provider decorator that stops calling a failing provider.
+// It opens after threshold failures within a sliding window, rejects calls
+// with *CircuitOpenError for the cooldown, then probes with one call.
+// A Breaker must be shared between requests for its state to mean anything.
+type Breaker struct {
+	p         Provider
+	name      string
+	threshold int
+	window    time.Duration
+	cooldown  time.Duration
+	now       func() time.Time
+	logger    *slog.Logger
+
+	mu       sync.Mutex
+	state    BreakerState
+	failures []time.Time
+	openedAt time.Time
+	probing  bool
+}
+
+type BreakerOption func(*Breaker)
+
+// WithFailureThreshold sets how many failures within the window open the
+// breaker. Default 5.
+func WithFailureThreshold(n int) BreakerOption {
+	return func(b *Breaker) {
+		b.threshold = n
+	}
+}
+
+// WithFailureWindow sets the sliding window failures are counted in.
+// Default one minute.
+func WithFailureWindow(d time.Duration) BreakerOption {
+	return func(b *Breaker) {
+		b.window = d
+	}
+}
+
+// WithCooldown sets how long an open breaker rejects calls before probing.
+// Default 30s.
+func WithCooldown(d time.Duration) BreakerOption {
+	return func(b *Breaker) {
+		b.cooldown = d
+	}
+}
+
+// WithBreakerLogger logs state transitions.
+func WithBreakerLogger(logger *slog.Logger) BreakerOption {
+	return func(b *Breaker) {
+		b.logger = logger
+	}
+}
+
+func NewBreaker(p Provider, opts ...BreakerOption) *Breaker {
+	b := &Breaker{
+		p:         p,
+		threshold: 5,
+		window:    time.Minute,
+		cooldown:  30 * time.Second,
+		now:       time.Now,
+		logger:    slog.Default(),
+		state:     BreakerClosed,
+	}
+	for _, opt := range opts {
+		opt(b)
+	}
+	if d, ok := p.(Describer); ok {
+		b.name = d.ProviderName() + "/" + d.Model()
+	}
+	return b
+}
+
+// State reports the breaker's current state.
+func (b *Breaker) State() BreakerState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == BreakerOpen && !b.now().Before(b.openedAt.Add(b.cooldown)) {
+		return BreakerHalfOpen
+	}
+	return b.state
+}
+
+func (b *Breaker) Complete(ctx context.Context, req ProviderResponseFormat) (Completion, error) {
+	if err := b.allow(); err != nil {
+		return Completion{}, err
+	}
+	out, err := b.p.Complete(ctx, req)
+	b.record(ctx, err)
+	return out, err
+}
+
+func (b *Breaker) Stream(ctx context.Context, req ProviderResponseFormat) iter.Seq2[Completion, error] {
+	return func(yield func(Completion, error) bool) {
+		if err := b.allow(); err != nil {
+			yield(Completion{}, err)
+			return
+		}
+		var err error
+		defer func() { b.record(ctx, err) }()
+		for chunk, serr := range stream(ctx, b.p, req) {
+			if serr != nil {
+				err = serr
+				yield(chunk, serr)
+				return
+			}
+			if !yield(chunk, nil) {
+				return
+			}
+		}
+	}
+}
+
+func (b *Breaker) Validate() error { return b.p.Validate() }
+
+func (b *Breaker) ProviderName() string {
+	if d, ok := b.p.(Describer); ok {
+		return d.ProviderName()
+	}
+	return ""
+}
+
+func (b *Breaker) Model() string {
+	if d, ok := b.p.(Describer); ok {
+		return d.Model()
+	}
+	return ""
+}
+
+// allow reports whether a call may go through, claiming the probe slot when
+// the cooldown has passed.
+func (b *Breaker) allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := b.now()
+	switch b.state {
+	case BreakerOpen:
+		if wait := b.openedAt.Add(b.cooldown).Sub(now); wait > 0 {
+			return &CircuitOpenError{Provider: b.name, RetryAfter: wait}
+		}
+		b.transition(BreakerHalfOpen)
+		b.probing = true
+	case BreakerHalfOpen:
+		if b.probing {
+			return &CircuitOpenError{Provider: b.name, RetryAfter: b.cooldown}
+		}
+		b.probing = true
+	}
+	return nil
+}
+
+// record counts the outcome of a call. Only outages count against the
+// provider (see IsOutage); any other answer shows it is up. A caller
+// canceling or running out of time says nothing about the provider, so it
+// only frees the probe slot.
+func (b *Breaker) record(ctx context.Context, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := b.now()
+	probe := b.state == BreakerHalfOpen
+	if probe {
+		b.probing = false
+	}
+	switch {
+	case ctx.Err() != nil || errors.Is(err, context.Canceled):
+	case !IsOutage(err):
+		if probe {
+			b.failures = nil
+			b.transition(BreakerClosed)
+		}
+	case probe:
+		b.trip(now)
+	case b.state == BreakerClosed:
+		cutoff := now.Add(-b.window)
+		kept := b.failures[:0]
+		for _, t := range b.failures {
+			if t.After(cutoff) {
+				kept = append(kept, t)
+			}
+		}
+		b.failures = append(kept, now)
+		if len(b.failures) >= b.threshold {
+			b.trip(now)
+		}
+	}
+}
+
+// IsOutage reports whether err says the provider itself is failing: a
+// transport error, or an API error with status 429 or 5xx. Other API errors
+// are the request's fault, and errors that are neither (invalid replies,
+// for one) came from a provider that answered.
+func IsOutage(err error) bool {
+	if err == nil {
+		return false
+	}
+	var apiErr *openai.Error
+	if errors.As(err, &apiErr) {
+		return apiErr.StatusCode == http.StatusTooManyRequests || apiErr.StatusCode >= http.StatusInternalServerError
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+func (b *Breaker) trip(now time.Time) {
+	b.openedAt = now
+	b.failures = nil
+	b.transition(BreakerOpen)
+}
+
+func (b *Breaker) transition(to BreakerState) {
+	if b.state == to {
+		return
+	}
+	b.logger.Warn("llm circuit breaker", "provider", b.name, "from", b.state, "to", to)
+	b.state = to
+}
@@ -0,0 +1,231 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/openai/openai-go/v2"
+)
+
+var errOutage = apiError(http.StatusServiceUnavailable)
+
+// apiError is the error the OpenAI SDK returns for an HTTP status.
+func apiError(status int) error {
+	return &openai.Error{
+		StatusCode: status,
+		Request:    httptest.NewRequest("POST", "https://api.openai.com/v1/chat/completions", nil),
+		Response:   &http.Response{StatusCode: status},
+	}
+}
+
+// scriptedProvider returns its errors in order, then succeeds with reply.
+type scriptedProvider struct {
+	reply string
+	errs  []error
+	calls int
+}
+
+func (s *scriptedProvider) Complete(ctx context.Context, req ProviderResponseFormat) (Completion, error) {
+	s.calls++
+	if len(s.errs) > 0 {
+		err := s.errs[0]
+		s.errs = s.errs[1:]
+		if err != nil {
+			return Completion{}, err
+		}
+	}
+	return Completion{Text: s.reply}, nil
+}
+
+func (s *scriptedProvider) Validate() error { return nil }
+
+var quiet = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+type fakeClock struct{ t time.Time }
+
+func (c *fakeClock) now() time.Time          { return c.t }
+func (c *fakeClock) advance(d time.Duration) { c.t = c.t.Add(d) }
+
+func newTestBreaker(p Provider, clock *fakeClock) *Breaker {
+	b := NewBreaker(p,
+		WithFailureThreshold(2),
+		WithFailureWindow(time.Minute),
+		WithCooldown(30*time.Second),
+		WithBreakerLogger(quiet),
+	)
+	b.now = clock.now
+	return b
+}
+
+func TestBreaker_OpensWithinWindow(t *testing.T) {
+	clock := &fakeClock{t: time.Unix(0, 0)}
+	p := &scriptedProvider{reply: "ok", errs: []error{errOutage, errOutage, errOutage}}
+	b := newTestBreaker(p, clock)
+	ctx := context.Background()
+
+	// Failures further apart than the window do not add up.
+	b.Complete(ctx, ProviderResponseFormat{}) //nolint:errcheck
+	clock.advance(2 * time.Minute)
+	b.Complete(ctx, ProviderResponseFormat{}) //nolint:errcheck
+	if b.State() != BreakerClosed {
+		t.Fatalf("expected closed, got %s", b.State())
+	}
+	clock.advance(10 * time.Second)
+	b.Complete(ctx, ProviderResponseFormat{}) //nolint:errcheck
+	if b.State() != BreakerOpen {
+		t.Fatalf("expected open, got %s", b.State())
+	}
+
+	clock.advance(10 * time.Second)
+	_, err := b.Complete(ctx, ProviderResponseFormat{})
+	var cerr *CircuitOpenError
+	if !errors.As(err, &cerr) || !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("expected CircuitOpenError, got %v", err)
+	}
+	if cerr.RetryAfter != 20*time.Second {
+		t.Fatalf("expected 20s retry, got %s", cerr.RetryAfter)
+	}
+	if p.calls != 3 {
+		t.Fatalf("open breaker should not call the provider, got %d calls", p.calls)
+	}
+}
+
+func TestBreaker_HalfOpenProbe(t *testing.T) {
+	clock := &fakeClock{t: time.Unix(0, 0)}
+	p := &scriptedProvider{reply: "ok", errs: []error{errOutage, errOutage, errOutage}}
+	b := newTestBreaker(p, clock)
+	ctx := context.Background()
+	b.Complete(ctx, ProviderResponseFormat{}) //nolint:errcheck
+	b.Complete(ctx, ProviderResponseFormat{}) //nolint:errcheck
+
+	// A failed probe reopens for another cooldown.
+	clock.advance(30 * time.Second)
+	if b.State() != BreakerHalfOpen {
+		t.Fatalf("expected half-open after cooldown, got %s", b.State())
+	}
+	if _, err := b.Complete(ctx, ProviderResponseFormat{}); !errors.Is(err, errOutage) {
+		t.Fatalf("expected probe to reach the provider, got %v", err)
+	}
+	if b.State() != BreakerOpen {
+		t.Fatalf("expected reopened, got %s", b.State())
+	}
+
+	clock.advance(30 * time.Second)
+	if out, err := b.Complete(ctx, ProviderResponseFormat{}); err != nil || out.Text != "ok" {
+		t.Fatalf("expected successful probe, got %q %v", out, err)
+	}
+	if b.State() != BreakerClosed {
+		t.Fatalf("expected closed after successful probe, got %s", b.State())
+	}
+}
+
+func TestBreaker_IgnoresCallerCancel(t *testing.T) {
+	clock := &fakeClock{t: time.Unix(0, 0)}
+	p := &scriptedProvider{errs: []error{context.Canceled, context.Canceled, context.Canceled}}
+	b := newTestBreaker(p, clock)
+	for range 3 {
+		b.Complete(context.Background(), ProviderResponseFormat{}) //nolint:errcheck
+	}
+	if b.State() != BreakerClosed {
+		t.Fatalf("cancellations should not open the breaker, got %s", b.State())
+	}
+}
+
+func TestIsOutage(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"success", nil, false},
+		{"server error", apiError(http.StatusInternalServerError), true},
+		{"bad gateway", apiError(http.StatusBadGateway), true},
+		{"rate limited", apiError(http.StatusTooManyRequests), true},
+		{"bad request", apiError(http.StatusBadRequest), false},
+		{"unknown model", apiError(http.StatusNotFound), false},
+		{"connection refused", &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}, true},
+		{"cut off", io.ErrUnexpectedEOF, true},
+		{"invalid reply", errors.New("reply is not valid JSON"), false},
+	} {
+		if got := IsOutage(tc.err); got != tc.want {
+			t.Errorf("%s: IsOutage(%v) = %v; want %v", tc.name, tc.err, got, tc.want)
+		}
+	}
+}
+
+func TestBreaker_IgnoresNonOutages(t *testing.T) {
+	expired, cancel := context.WithDeadline(context.Background(), time.Unix(0, 0))
+	defer cancel()
+	for _, tc := range []struct {
+		name string
+		ctx  context.Context
+		err  error
+	}{
+		{"client error", context.Background(), apiError(http.StatusBadRequest)},
+		{"validation failure", context.Background(), errors.New("reply does not match the schema")},
+		{"caller deadline", expired, context.DeadlineExceeded},
+	} {
+		clock := &fakeClock{t: time.Unix(0, 0)}
+		p := &scriptedProvider{errs: []error{tc.err, tc.err, tc.err}}
+		b := newTestBreaker(p, clock)
+		for range 3 {
+			b.Complete(tc.ctx, ProviderResponseFormat{}) //nolint:errcheck
+		}
+		if b.State() != BreakerClosed || p.calls != 3 {
+			t.Errorf("%s: breaker %s after %d calls; want closed after 3", tc.name, b.State(), p.calls)
+		}
+	}
+
+	// A provider answering a probe with a client error is up again.
+	clock := &fakeClock{t: time.Unix(0, 0)}
+	p := &scriptedProvider{errs: []error{errOutage, errOutage, apiError(http.StatusBadRequest)}}
+	b := newTestBreaker(p, clock)
+	b.Complete(context.Background(), ProviderResponseFormat{}) //nolint:errcheck
+	b.Complete(context.Background(), ProviderResponseFormat{}) //nolint:errcheck
+	clock.advance(30 * time.Second)
+	b.Complete(context.Background(), ProviderResponseFormat{}) //nolint:errcheck
+	if b.State() != BreakerClosed {
+		t.Fatalf("expected a 4xx probe to close the breaker, got %s", b.State())
+	}
+}
+
+func TestChain_FailsOver(t *testing.T) {
+	clock := &fakeClock{t: time.Unix(0, 0)}
+	primary := &scriptedProvider{errs: []error{errOutage, errOutage, errOutage}}
+	backup := &scriptedProvider{reply: "backup"}
+	c := NewChain(quiet, newTestBreaker(primary, clock), backup)
+
+	for range 3 {
+		out, err := c.Complete(context.Background(), ProviderResponseFormat{})
+		if err != nil || out.Text != "backup" {
+			t.Fatalf("expected fallback reply, got %q %v", out, err)
+		}
+	}
+	if primary.calls != 2 {
+		t.Fatalf("expected the open primary to be skipped, got %d calls", primary.calls)
+	}
+
+	var got strings.Builder
+	for chunk, err := range c.Stream(context.Background(), ProviderResponseFormat{}) {
+		if err != nil {
+			t.Fatalf("Stream: %v", err)
+		}
+		got.WriteString(chunk.Text)
+	}
+	if got.String() != "backup" {
+		t.Fatalf("expected streamed fallback, got %q", got.String())
+	}
+
+	down := NewChain(quiet, &scriptedProvider{errs: []error{errOutage}}, &scriptedProvider{errs: []error{errOutage}})
+	if _, err := down.Complete(context.Background(), ProviderResponseFormat{}); !errors.Is(err, errOutage) {
+		t.Fatalf("expected joined provider errors, got %v", err)
+	}
+}
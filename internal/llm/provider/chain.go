@@ -0,0 +1,147 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"iter"
+	"log/slog"
+)
+
+// Chain is a Provider that tries each of its providers in order until one
+// succeeds. Put each provider behind its own Breaker so an outage fails over
+// immediately instead of waiting out a timeout on every request. A model
+// requested in the request's Settings goes to the first provider only;
+// fallbacks serve their own models.
+type Chain struct {
+	providers []Provider
+	logger    *slog.Logger
+}
+
+func NewChain(logger *slog.Logger, providers ...Provider) *Chain {
+	return &Chain{providers: providers, logger: logger}
+}
+
+// Complete returns the first successful completion. When every provider
+// fails the errors are joined, so errors.Is(err, ErrCircuitOpen) holds when
+// any of them was rejected by its breaker.
+func (c *Chain) Complete(ctx context.Context, req ProviderResponseFormat) (Completion, error) {
+	var errs []error
+	for i, p := range c.providers {
+		out, err := p.Complete(ctx, fallbackRequest(req, i))
+		if err == nil {
+			return out, nil
+		}
+		if ctx.Err() != nil {
+			return out, err
+		}
+		errs = append(errs, err)
+		c.fallback(i, err)
+	}
+	return Completion{}, c.failed(errs)
+}
+
+// Stream fails over only until the first delta; once output has been
+// yielded an error ends the stream.
+func (c *Chain) Stream(ctx context.Context, req ProviderResponseFormat) iter.Seq2[Completion, error] {
+	return func(yield func(Completion, error) bool) {
+		var errs []error
+		for i, p := range c.providers {
+			started := false
+			var err error
+			var last Completion
+			for chunk, serr := range stream(ctx, p, fallbackRequest(req, i)) {
+				if serr != nil {
+					err, last = serr, chunk
+					break
+				}
+				started = started || chunk.Text != ""
+				if !yield(chunk, nil) {
+					return
+				}
+			}
+			if err == nil {
+				return
+			}
+			if started || ctx.Err() != nil {
+				yield(last, err)
+				return
+			}
+			errs = append(errs, err)
+			c.fallback(i, err)
+		}
+		yield(Completion{}, c.failed(errs))
+	}
+}
+
+// Validate requires every provider in the chain to be usable.
+func (c *Chain) Validate() error {
+	if len(c.providers) == 0 {
+		return errors.New("no providers configured")
+	}
+	var errs []error
+	for _, p := range c.providers {
+		errs = append(errs, p.Validate())
+	}
+	return errors.Join(errs...)
+}
+
+// ProviderName and Model describe the primary provider.
+func (c *Chain) ProviderName() string {
+	if len(c.providers) > 0 {
+		if d, ok := c.providers[0].(Describer); ok {
+			return d.ProviderName()
+		}
+	}
+	return ""
+}
+
+func (c *Chain) Model() string {
+	if len(c.providers) > 0 {
+		if d, ok := c.providers[0].(Describer); ok {
+			return d.Model()
+		}
+	}
+	return ""
+}
+
+// fallbackRequest is req as sent to the i'th provider.
+func fallbackRequest(req ProviderResponseFormat, i int) ProviderResponseFormat {
+	if i > 0 {
+		req.Settings.Model = ""
+	}
+	return req
+}
+
+func (c *Chain) fallback(i int, err error) {
+	if i+1 == len(c.providers) {
+		return
+	}
+	// An open breaker is already logged once when it trips.
+	level := slog.LevelWarn
+	if errors.Is(err, ErrCircuitOpen) {
+		level = slog.LevelDebug
+	}
+	c.logger.Log(context.Background(), level, "llm provider failed, trying fallback", "provider", i, "error", err)
+}
+
+func (c *Chain) failed(errs []error) error {
+	if len(errs) == 0 {
+		return errors.New("no providers configured")
+	}
+	if len(errs) == 1 {
+		return errs[0]
+	}
+	return errors.Join(errs...)
+}
+
+// stream streams from p, or delivers its whole completion as one delta when
+// it cannot stream.
+func stream(ctx context.Context, p Provider, req ProviderResponseFormat) iter.Seq2[Completion, error] {
+	if s, ok := p.(Streamer); ok {
+		return s.Stream(ctx, req)
+	}
+	return func(yield func(Completion, error) bool) {
+		out, err := p.Complete(ctx, req)
+		yield(out, err)
+	}
+}
@@ -4,8 +4,11 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"iter"
 	"strings"
+	"time"
 
+	"github.com/aaronromeo/swolegen/internal/logging"
 	"github.com/openai/openai-go/v2"
 	"github.com/openai/openai-go/v2/option"
 )
@@ -28,16 +31,41 @@ func (p *OpenAIProvider) Validate() error {
 	return nil
 }
 
-func (p *OpenAIProvider) Complete(ctx context.Context, prf ProviderResponseFormat) (string, error) {
+func (p *OpenAIProvider) ProviderName() string { return "openai" }
+
+func (p *OpenAIProvider) Model() string { return p.model }
+
+// modelFor is the model serving prf: its settings' model when set.
+func (p *OpenAIProvider) modelFor(prf ProviderResponseFormat) string {
+	if prf.Settings.Model != "" {
+		return prf.Settings.Model
+	}
+	return p.model
+}
+
+// params builds the chat request for prf, constraining the reply to its
+// JSON schema when it has one. Reasoning models reject a temperature, so
+// it is dropped when a reasoning effort is set.
+func (p *OpenAIProvider) params(prf ProviderResponseFormat) openai.ChatCompletionNewParams {
 	params := openai.ChatCompletionNewParams{
 		Messages: []openai.ChatCompletionMessageParamUnion{
 			openai.SystemMessage(prf.SystemPrompt),
 			openai.UserMessage(prf.UserPrompt),
 		},
-		Model: openai.ChatModel(p.model),
+		Model: openai.ChatModel(p.modelFor(prf)),
+	}
+	s := prf.Settings
+	if s.ReasoningEffort != "" {
+		params.ReasoningEffort = openai.ReasoningEffort(s.ReasoningEffort)
+	} else if s.Temperature != nil {
+		params.Temperature = openai.Float(*s.Temperature)
+	}
+	if s.MaxTokens > 0 {
+		params.MaxCompletionTokens = openai.Int(s.MaxTokens)
+	}
+	if s.Seed != nil {
+		params.Seed = openai.Int(*s.Seed)
 	}
-
-	p.logger.Debug("llm request", "params", params)
 
 	var schemaObj map[string]any
 	if err := json.Unmarshal([]byte(prf.Schema), &schemaObj); err == nil {
@@ -52,9 +80,22 @@ func (p *OpenAIProvider) Complete(ctx context.Context, prf ProviderResponseForma
 			},
 		}
 	}
+	return params
+}
+
+func (p *OpenAIProvider) Complete(ctx context.Context, prf ProviderResponseFormat) (Completion, error) {
+	start := time.Now()
+	params := p.params(prf)
+	logging.FromContext(ctx, p.logger).Debug("llm request", "model", params.Model, "format", prf.Name, "params", params)
 	chat, err := p.Client.Chat.Completions.New(ctx, params)
 	if err != nil {
-		return "", err
+		return Completion{Usage: Usage{Model: params.Model, Latency: time.Since(start)}}, err
+	}
+	usage := Usage{
+		Model:            chat.Model,
+		PromptTokens:     chat.Usage.PromptTokens,
+		CompletionTokens: chat.Usage.CompletionTokens,
+		Latency:          time.Since(start),
 	}
 	// Extract assistant message content as a plain string
 	var s string
@@ -96,7 +137,43 @@ func (p *OpenAIProvider) Complete(ctx context.Context, prf ProviderResponseForma
 	}
 	s = strings.TrimSpace(s)
 	if s == "" {
-		return "", fmt.Errorf("no message content")
+		return Completion{Usage: usage}, fmt.Errorf("no message content")
+	}
+	return Completion{Text: s, Usage: usage}, nil
+}
+
+// Stream implements Streamer over the chat completions streaming API,
+// asking for usage on the final chunk.
+func (p *OpenAIProvider) Stream(ctx context.Context, prf ProviderResponseFormat) iter.Seq2[Completion, error] {
+	return func(yield func(Completion, error) bool) {
+		start := time.Now()
+		params := p.params(prf)
+		logging.FromContext(ctx, p.logger).Debug("llm request", "model", params.Model, "format", prf.Name, "stream", true, "params", params)
+		params.StreamOptions = openai.ChatCompletionStreamOptionsParam{IncludeUsage: openai.Bool(true)}
+		stream := p.Client.Chat.Completions.NewStreaming(ctx, params)
+		defer stream.Close() //nolint:errcheck
+		usage := Usage{Model: params.Model}
+		for stream.Next() {
+			chunk := stream.Current()
+			if chunk.Model != "" {
+				usage.Model = chunk.Model
+			}
+			if chunk.Usage.TotalTokens > 0 {
+				usage.PromptTokens = chunk.Usage.PromptTokens
+				usage.CompletionTokens = chunk.Usage.CompletionTokens
+			}
+			if len(chunk.Choices) == 0 || chunk.Choices[0].Delta.Content == "" {
+				continue
+			}
+			if !yield(Completion{Text: chunk.Choices[0].Delta.Content}, nil) {
+				return
+			}
+		}
+		usage.Latency = time.Since(start)
+		if err := stream.Err(); err != nil {
+			yield(Completion{Usage: usage}, err)
+			return
+		}
+		yield(Completion{Usage: usage}, nil)
 	}
-	return s, nil
 }
@@ -0,0 +1,69 @@
+package provider
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"testing"
+)
+
+func TestOpenAIParams_Settings(t *testing.T) {
+	p, err := NewOpenAIProvider(WithAPIKey("sk-test"), WithModel("gpt-4o-mini"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	temp, seed := 0.2, int64(7)
+
+	params := p.params(ProviderResponseFormat{})
+	if params.Model != "gpt-4o-mini" || params.Temperature.Valid() || params.MaxCompletionTokens.Valid() || params.Seed.Valid() {
+		t.Fatalf("zero settings should send only the model: %+v", params)
+	}
+
+	params = p.params(ProviderResponseFormat{Settings: Settings{Model: "gpt-4o", Temperature: &temp, MaxTokens: 900, Seed: &seed}})
+	if params.Model != "gpt-4o" || params.Temperature.Value != temp || params.MaxCompletionTokens.Value != 900 || params.Seed.Value != seed {
+		t.Fatalf("settings not applied: %+v", params)
+	}
+
+	params = p.params(ProviderResponseFormat{Settings: Settings{Temperature: &temp, ReasoningEffort: "low"}})
+	if params.ReasoningEffort != "low" || params.Temperature.Valid() {
+		t.Fatalf("reasoning effort should replace the temperature: %+v", params)
+	}
+}
+
+func TestSettings_MergeAndValidate(t *testing.T) {
+	low, high := 0.1, 2.5
+	base := Settings{Model: "gpt-4o-mini", Temperature: &low, MaxTokens: 500}
+	got := base.Merge(Settings{Model: "gpt-4o", MaxTokens: 0})
+	if got.Model != "gpt-4o" || got.Temperature != &low || got.MaxTokens != 500 {
+		t.Fatalf("Merge = %+v", got)
+	}
+	for _, bad := range []Settings{{Temperature: &high}, {MaxTokens: -1}, {ReasoningEffort: "max"}} {
+		if err := bad.Validate(); err == nil {
+			t.Errorf("Validate(%+v) = nil, want error", bad)
+		}
+	}
+	if err := got.Validate(); err != nil {
+		t.Errorf("Validate(%+v) = %v", got, err)
+	}
+}
+
+// modelRecorder records the requested model and fails.
+type modelRecorder struct{ models *[]string }
+
+func (m modelRecorder) Complete(ctx context.Context, req ProviderResponseFormat) (Completion, error) {
+	*m.models = append(*m.models, req.Settings.Model)
+	return Completion{}, errOutage
+}
+
+func (m modelRecorder) Validate() error { return nil }
+
+func TestChain_ModelOverridePrimaryOnly(t *testing.T) {
+	var models []string
+	c := NewChain(slog.New(slog.NewTextHandler(io.Discard, nil)), modelRecorder{&models}, modelRecorder{&models})
+	if _, err := c.Complete(context.Background(), ProviderResponseFormat{Settings: Settings{Model: "gpt-4o"}}); err == nil {
+		t.Fatal("expected the chain to fail")
+	}
+	if len(models) != 2 || models[0] != "gpt-4o" || models[1] != "" {
+		t.Fatalf("requested models = %q, want the override for the primary only", models)
+	}
+}
@@ -2,7 +2,12 @@ package provider
 
 import (
 	"context"
+	"fmt"
+	"iter"
 	"log/slog"
+	"slices"
+	"strings"
+	"time"
 
 	"github.com/openai/openai-go/v2"
 )
@@ -17,10 +22,40 @@ const (
 
 // Provider defines the minimal interface for LLM completion.
 type Provider interface {
-	Complete(ctx context.Context, req ProviderResponseFormat) (string, error)
+	Complete(ctx context.Context, req ProviderResponseFormat) (Completion, error)
 	Validate() error
 }
 
+// Completion is a provider reply and the tokens it took.
+type Completion struct {
+	Text  string
+	Usage Usage
+}
+
+// Usage is the token accounting for one completion. Model is the model
+// that actually served it, which may differ from the one requested.
+type Usage struct {
+	Model            string        `json:"model,omitempty"`
+	PromptTokens     int64         `json:"prompt_tokens"`
+	CompletionTokens int64         `json:"completion_tokens"`
+	Latency          time.Duration `json:"latency"`
+}
+
+// Describer is implemented by providers that can report which backend and
+// model serve their completions.
+type Describer interface {
+	ProviderName() string
+	Model() string
+}
+
+// Streamer is implemented by providers that can stream a completion as it
+// is produced. The sequence yields Completions whose Text is the next
+// content delta; usage arrives on the last one. A non-nil error is the last
+// value yielded.
+type Streamer interface {
+	Stream(ctx context.Context, req ProviderResponseFormat) iter.Seq2[Completion, error]
+}
+
 // OpenAIProvider implements Provider using the official openai-go client.
 type OpenAIProvider struct {
 	apiKey string
@@ -56,4 +91,54 @@ type ProviderResponseFormat struct {
 	Schema       string
 	SystemPrompt string
 	UserPrompt   string
+	Settings     Settings
+}
+
+// ReasoningEfforts are the accepted Settings.ReasoningEffort values.
+var ReasoningEfforts = []string{"minimal", "low", "medium", "high"}
+
+// Settings tune a single completion. Zero values keep the provider's
+// defaults: an empty Model uses the model the provider was built with, and
+// a nil Temperature or Seed, zero MaxTokens or empty ReasoningEffort is not
+// sent.
+type Settings struct {
+	Model           string   `json:"model,omitempty"`
+	Temperature     *float64 `json:"temperature,omitempty"`
+	MaxTokens       int64    `json:"max_tokens,omitempty"`
+	ReasoningEffort string   `json:"reasoning_effort,omitempty"`
+	Seed            *int64   `json:"seed,omitempty"`
+}
+
+// Merge returns s with every field set in o replacing its own.
+func (s Settings) Merge(o Settings) Settings {
+	if o.Model != "" {
+		s.Model = o.Model
+	}
+	if o.Temperature != nil {
+		s.Temperature = o.Temperature
+	}
+	if o.MaxTokens != 0 {
+		s.MaxTokens = o.MaxTokens
+	}
+	if o.ReasoningEffort != "" {
+		s.ReasoningEffort = o.ReasoningEffort
+	}
+	if o.Seed != nil {
+		s.Seed = o.Seed
+	}
+	return s
+}
+
+// Validate checks the settings are within what providers accept.
+func (s Settings) Validate() error {
+	if s.Temperature != nil && (*s.Temperature < 0 || *s.Temperature > 2) {
+		return fmt.Errorf("temperature must be between 0 and 2, got %g", *s.Temperature)
+	}
+	if s.MaxTokens < 0 {
+		return fmt.Errorf("max tokens must not be negative, got %d", s.MaxTokens)
+	}
+	if s.ReasoningEffort != "" && !slices.Contains(ReasoningEfforts, s.ReasoningEffort) {
+		return fmt.Errorf("reasoning effort must be one of %s, got %q", strings.Join(ReasoningEfforts, ", "), s.ReasoningEffort)
+	}
+	return nil
 }
@@ -0,0 +1,163 @@
+package llm
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Sections of the analyzer prompt filled from user-supplied text.
+const (
+	SectionInstructions   = "instructions"
+	SectionHistory        = "history"
+	SectionUpcomingCardio = "upcoming_cardio"
+)
+
+// Warning codes reported when user-supplied text had to be altered before it
+// went into a prompt.
+const (
+	WarnTruncated    = "truncated"
+	WarnDelimiter    = "delimiter"
+	WarnControlChars = "control_chars"
+	WarnInvalidUTF8  = "invalid_utf8"
+	WarnBinary       = "binary"
+)
+
+// Warning describes a change made to an input section before prompting. The
+// run still goes ahead; callers surface warnings so the user knows the model
+// saw something other than the original text.
+type Warning struct {
+	Section string `json:"section"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func (w Warning) String() string { return w.Section + ":" + w.Code }
+
+// Budgets caps the approximate token count of each user-supplied section.
+// Zero leaves a section uncapped.
+type Budgets struct {
+	Instructions   int
+	History        int
+	UpcomingCardio int
+}
+
+// DefaultBudgets leaves room for the schema and system prompt within small
+// context windows.
+var DefaultBudgets = Budgets{Instructions: 4000, History: 12000, UpcomingCardio: 500}
+
+// WithBudgets sets the per-section token budgets.
+func WithBudgets(b Budgets) LLMClientOption {
+	return func(c *Client) {
+		c.budgets = b
+	}
+}
+
+// bytesPerToken approximates the tokenizer; English text and CSV history
+// average about four bytes per token.
+const bytesPerToken = 4
+
+func approxTokens(s string) int {
+	return (len(s) + bytesPerToken - 1) / bytesPerToken
+}
+
+// delimiterRe matches the section markers the prompt templates use
+// (---BEGIN_HISTORY---, --- end_instructions ---, ...), so fetched text
+// cannot close its own section and continue as instructions.
+var delimiterRe = regexp.MustCompile(`(?i)-{2,}\s*(?:BEGIN|END)_[A-Z0-9_]*\s*-{2,}`)
+
+const delimiterRemoved = "[delimiter removed]"
+
+// sanitizeSection prepares untrusted text for a prompt section: binary
+// content is dropped, invalid UTF-8 replaced, control and invisible format
+// characters stripped, section delimiters neutralized, and the result cut to
+// budget tokens with an explicit notice. Every change is reported.
+func sanitizeSection(section, s string, budget int) (string, []Warning) {
+	if s == "" {
+		return "", nil
+	}
+	var warns []Warning
+	warn := func(code, format string, args ...any) {
+		warns = append(warns, Warning{Section: section, Code: code, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if looksBinary(s) {
+		warn(WarnBinary, "%s looks like binary data (%d bytes) and was dropped", section, len(s))
+		return "", warns
+	}
+	if !utf8.ValidString(s) {
+		s = strings.ToValidUTF8(s, "�")
+		warn(WarnInvalidUTF8, "%s is not valid UTF-8; invalid bytes were replaced", section)
+	}
+
+	s = strings.ReplaceAll(s, "\r\n", "\n")
+	removed := 0
+	s = strings.Map(func(r rune) rune {
+		switch {
+		case r == '\n' || r == '\t':
+			return r
+		case r == '\r':
+			return '\n'
+		case unicode.IsControl(r) || unicode.Is(unicode.Cf, r):
+			removed++
+			return -1
+		}
+		return r
+	}, s)
+	if removed > 0 {
+		warn(WarnControlChars, "removed %d control or invisible formatting characters from %s", removed, section)
+	}
+
+	if n := len(delimiterRe.FindAllStringIndex(s, -1)); n > 0 {
+		s = delimiterRe.ReplaceAllString(s, delimiterRemoved)
+		warn(WarnDelimiter, "%s contained %d prompt section marker(s); they were removed", section, n)
+	}
+
+	if budget > 0 && approxTokens(s) > budget {
+		total := approxTokens(s)
+		s = cutText(s, budget*bytesPerToken)
+		s += fmt.Sprintf("\n[truncated: kept about %d of %d tokens]", approxTokens(s), total)
+		warn(WarnTruncated, "%s was cut to about %d of %d tokens", section, budget, total)
+	}
+	return s, warns
+}
+
+// looksBinary reports content that is not text: a NUL byte, or a sample in
+// which more than a tenth of the bytes are invalid UTF-8 or control bytes.
+func looksBinary(s string) bool {
+	if strings.IndexByte(s, 0) >= 0 {
+		return true
+	}
+	sample := s
+	if len(sample) > 4096 {
+		sample = sample[:4096]
+	}
+	bad := 0
+	for i := 0; i < len(sample); {
+		r, size := utf8.DecodeRuneInString(sample[i:])
+		if (r == utf8.RuneError && size == 1 && len(sample)-i >= utf8.UTFMax) ||
+			(r < 0x20 && r != '\n' && r != '\r' && r != '\t') {
+			bad++
+		}
+		i += size
+	}
+	return bad*10 > len(sample)
+}
+
+// cutText cuts s to at most n bytes on a rune boundary, preferring the end
+// of a line when one falls in the second half.
+func cutText(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	s = s[:n]
+	if i := strings.LastIndexByte(s, '\n'); i >= n/2 {
+		s = s[:i]
+	}
+	return s
+}
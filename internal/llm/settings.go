@@ -0,0 +1,67 @@
+package llm
+
+import (
+	"github.com/aaronromeo/swolegen/internal/config"
+	"github.com/aaronromeo/swolegen/internal/llm/provider"
+)
+
+// WithStageSettings tunes the completions of stage: StageAnalyzing,
+// StageGenerating, or StageRepairing for the repairs of either. Fields set
+// in s replace those set by earlier options, so per-request overrides can
+// be layered on the configured settings.
+func WithStageSettings(stage Stage, s provider.Settings) LLMClientOption {
+	return func(c *Client) {
+		if c.settings == nil {
+			c.settings = map[Stage]provider.Settings{}
+		}
+		c.settings[stage] = c.settings[stage].Merge(s)
+	}
+}
+
+// configSettings are the stage settings configured by cfg.
+func configSettings(cfg *config.Config) []LLMClientOption {
+	ta, tg := cfg.LlmTemperatureAnalyzer, cfg.LlmTemperatureGenerator
+	analyzer := provider.Settings{
+		Model:           cfg.LlmModel,
+		Temperature:     &ta,
+		MaxTokens:       cfg.LlmMaxTokensAnalyzer,
+		ReasoningEffort: cfg.LlmReasoningEffortAnalyzer,
+		Seed:            cfg.LlmSeedAnalyzer,
+	}
+	generator := provider.Settings{
+		Model:           cfg.LlmModel,
+		Temperature:     &tg,
+		MaxTokens:       cfg.LlmMaxTokensGenerator,
+		ReasoningEffort: cfg.LlmReasoningEffortGenerator,
+		Seed:            cfg.LlmSeedGenerator,
+	}.Merge(provider.Settings{Model: cfg.LlmModelGenerator})
+	return []LLMClientOption{
+		WithStageSettings(StageAnalyzing, analyzer),
+		WithStageSettings(StageGenerating, generator),
+		WithStageSettings(StageRepairing, provider.Settings{Model: cfg.LlmModelRepair}),
+	}
+}
+
+// stageSettings are the settings of attempt at stage: a repair (attempt
+// > 0) takes the repair settings over those of the stage it repairs.
+func (c *Client) stageSettings(stage Stage, attempt int) provider.Settings {
+	s := c.settings[stage]
+	if attempt > 0 {
+		s = s.Merge(c.settings[StageRepairing])
+	}
+	return s
+}
+
+// model is the model requested for attempt at stage.
+func (c *Client) model(stage Stage, attempt int) string {
+	if m := c.stageSettings(stage, attempt).Model; m != "" {
+		return m
+	}
+	_, model := c.ProviderInfo()
+	return model
+}
+
+// StageModel reports the model first asked to complete stage.
+func (c *Client) StageModel(stage Stage) string {
+	return c.model(stage, 0)
+}
@@ -0,0 +1,53 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Timeouts bounds each stage of a run. Repair attempts count against their
+// stage's deadline. A zero duration leaves the stage bounded only by the
+// caller's context.
+type Timeouts struct {
+	Fetch    time.Duration
+	Analyze  time.Duration
+	Generate time.Duration
+}
+
+// WithTimeouts sets per-stage deadlines.
+func WithTimeouts(t Timeouts) LLMClientOption {
+	return func(c *Client) {
+		c.timeouts = t
+	}
+}
+
+// TimeoutError reports a stage that ran past its own deadline.
+type TimeoutError struct {
+	Stage   Stage
+	Timeout time.Duration
+	Err     error
+}
+
+func (e *TimeoutError) Error() string {
+	return fmt.Sprintf("llm: %s timed out after %s", e.Stage, e.Timeout)
+}
+
+func (e *TimeoutError) Unwrap() error { return e.Err }
+
+func stageContext(ctx context.Context, d time.Duration) (context.Context, context.CancelFunc) {
+	if d <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, d)
+}
+
+// stageError turns err into a *TimeoutError when the stage context hit its
+// own deadline. Cancellation or deadlines of the caller's ctx pass through.
+func stageError(ctx, stageCtx context.Context, stage Stage, d time.Duration, err error) error {
+	if err == nil || d <= 0 || ctx.Err() != nil || !errors.Is(stageCtx.Err(), context.DeadlineExceeded) {
+		return err
+	}
+	return &TimeoutError{Stage: stage, Timeout: d, Err: err}
+}
@@ -0,0 +1,87 @@
+package llm
+
+import (
+	"context"
+
+	"github.com/aaronromeo/swolegen/internal/llm/provider"
+	"github.com/aaronromeo/swolegen/internal/tracing"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "github.com/aaronromeo/swolegen/internal/llm"
+
+// stageSpan is the span of an analyze or generate run. It counts the
+// repairs and rejected outputs of the run for its attributes.
+type stageSpan struct {
+	trace.Span
+	stage   Stage
+	repairs int
+	invalid int
+}
+
+// startStage starts the span for stage, tagged with the model and prompt
+// version serving it.
+func (c *Client) startStage(ctx context.Context, stage Stage) (context.Context, *stageSpan) {
+	name, _ := c.ProviderInfo()
+	ctx, span := tracing.Tracer(tracerName).Start(ctx, "llm."+metricStage(stage, 0), trace.WithAttributes(
+		tracing.AttrProvider.String(name),
+		tracing.AttrModel.String(c.model(stage, 0)),
+		tracing.AttrPromptVersion.String(c.prompts.Version),
+	))
+	return ctx, &stageSpan{Span: span, stage: stage}
+}
+
+// repair counts a repair attempt.
+func (s *stageSpan) repair() {
+	s.repairs++
+	observeRepair(s.stage)
+}
+
+func (s *stageSpan) end(err error) {
+	s.SetAttributes(tracing.AttrRepairs.Int(s.repairs), tracing.AttrValidationErrors.Int(s.invalid))
+	tracing.End(s.Span, err)
+}
+
+// validate runs fn, the schema check of the output of attempt, in its own
+// span and counts a failure against the stage.
+func (c *Client) validate(ctx context.Context, s *stageSpan, attempt int, fn func() error) error {
+	_, span := tracing.Tracer(tracerName).Start(ctx, "llm.validate", trace.WithAttributes(
+		tracing.AttrStage.String(string(s.stage)),
+		tracing.AttrAttempt.Int(attempt),
+	))
+	err := fn()
+	if err != nil {
+		s.invalid++
+		observeInvalid(s.stage, err)
+		span.SetAttributes(tracing.AttrValidationErrors.Int(1), tracing.AttrValidationError.String(validationCategory(err)))
+	} else {
+		span.SetAttributes(tracing.AttrValidationErrors.Int(0))
+	}
+	tracing.End(span, err)
+	return err
+}
+
+// startCall starts the span of one provider completion. attempt is 0 for
+// the first completion of a stage and the repair number after it.
+func (c *Client) startCall(ctx context.Context, stage Stage, attempt int) (context.Context, trace.Span) {
+	name, _ := c.ProviderInfo()
+	return tracing.Tracer(tracerName).Start(ctx, "llm.complete", trace.WithAttributes(
+		tracing.AttrStage.String(metricStage(stage, attempt)),
+		tracing.AttrAttempt.Int(attempt),
+		tracing.AttrProvider.String(name),
+		tracing.AttrModel.String(c.model(stage, attempt)),
+		tracing.AttrPromptVersion.String(c.prompts.Version),
+	))
+}
+
+// endCall records the model that served a completion and its tokens.
+func endCall(span trace.Span, u provider.Usage, err error) {
+	if u.Model != "" {
+		span.SetAttributes(tracing.AttrModel.String(u.Model))
+	}
+	span.SetAttributes(
+		tracing.AttrPromptTokens.Int64(u.PromptTokens),
+		tracing.AttrCompletionTokens.Int64(u.CompletionTokens),
+	)
+	tracing.End(span, err)
+}
@@ -0,0 +1,77 @@
+package llm
+
+import (
+	"context"
+	"log/slog"
+	"testing"
+
+	"github.com/aaronromeo/swolegen/internal/llm/schemas"
+	"github.com/aaronromeo/swolegen/internal/tracing"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestTracing_RepairAttempts(t *testing.T) {
+	rec := tracetest.NewSpanRecorder()
+	prev := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(rec)))
+	t.Cleanup(func() { otel.SetTracerProvider(prev) })
+
+	cli, err := New(
+		WithProvider(&sequenceProvider{replies: []string{`{"version": 1.2}`, validWorkoutJSON}}),
+		WithRetries(2),
+		WithLogger(slog.Default()),
+	)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	if _, err := cli.Generate(context.Background(), schemas.AnalyzerV1Json{}); err != nil {
+		t.Fatalf("Generate: %v", err)
+	}
+
+	attrs := func(s sdktrace.ReadOnlySpan) map[attribute.Key]attribute.Value {
+		m := map[attribute.Key]attribute.Value{}
+		for _, kv := range s.Attributes() {
+			m[kv.Key] = kv.Value
+		}
+		return m
+	}
+	var stage sdktrace.ReadOnlySpan
+	var calls, validations []map[attribute.Key]attribute.Value
+	for _, s := range rec.Ended() {
+		switch s.Name() {
+		case "llm.generate":
+			stage = s
+		case "llm.complete":
+			calls = append(calls, attrs(s))
+		case "llm.validate":
+			validations = append(validations, attrs(s))
+		}
+	}
+	if stage == nil {
+		t.Fatal("no llm.generate span")
+	}
+	if len(calls) != 2 || calls[1][tracing.AttrAttempt].AsInt64() != 1 || calls[1][tracing.AttrStage].AsString() != "repair" {
+		t.Fatalf("expected first completion and repair attempt 1, got %v", calls)
+	}
+	if got := calls[0][tracing.AttrPromptTokens].AsInt64(); got != 1000 {
+		t.Errorf("prompt tokens: got %d", got)
+	}
+	if len(validations) != 2 || validations[0][tracing.AttrValidationError].AsString() != "required" || validations[1][tracing.AttrValidationErrors].AsInt64() != 0 {
+		t.Errorf("unexpected validate spans: %v", validations)
+	}
+	sa := attrs(stage)
+	if sa[tracing.AttrRepairs].AsInt64() != 1 || sa[tracing.AttrValidationErrors].AsInt64() != 1 {
+		t.Errorf("unexpected stage attributes: %v", sa)
+	}
+	if sa[tracing.AttrPromptVersion].AsString() == "" {
+		t.Error("stage span has no prompt version")
+	}
+	for _, s := range rec.Ended() {
+		if s.Name() != "llm.generate" && s.Parent().SpanID() != stage.SpanContext().SpanID() {
+			t.Errorf("%s is not a child of llm.generate", s.Name())
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package llm
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aaronromeo/swolegen/internal/config"
+	"github.com/aaronromeo/swolegen/internal/llm/provider"
+)
+
+// Price is what a model charges, in USD per million tokens.
+type Price = config.Price
+
+// Prices maps model names to their price. Providers report dated model
+// names (gpt-4o-mini-2024-07-18), so lookups fall back to the longest
+// configured prefix.
+type Prices map[string]Price
+
+// ParsePrices reads a price table written as "model=input:output,...",
+// e.g. "gpt-4o-mini=0.15:0.60".
+func ParsePrices(s string) (Prices, error) {
+	prices, err := config.ParsePrices(s)
+	return Prices(prices), err
+}
+
+// Cost prices u. Unknown models cost nothing rather than failing the run.
+func (p Prices) Cost(u provider.Usage) float64 {
+	price, ok := p[u.Model]
+	if !ok {
+		best := ""
+		for model, mp := range p {
+			if strings.HasPrefix(u.Model, model) && len(model) > len(best) {
+				best, price = model, mp
+			}
+		}
+	}
+	return (float64(u.PromptTokens)*price.Input + float64(u.CompletionTokens)*price.Output) / 1e6
+}
+
+// WithPrices sets the price table used to cost completions.
+func WithPrices(p Prices) LLMClientOption {
+	return func(c *Client) {
+		c.prices = p
+	}
+}
+
+// Call is one provider completion made by a client. Attempt is 0 for the
+// first completion of a stage and counts repairs after it.
+type Call struct {
+	Stage   Stage `json:"stage"`
+	Attempt int   `json:"attempt"`
+	provider.Usage
+	CostUSD float64 `json:"cost_usd"`
+	Failed  bool    `json:"failed,omitempty"`
+}
+
+// Usage totals the completions a client has made, repairs included.
+type Usage struct {
+	Calls            []Call        `json:"calls"`
+	Repairs          int           `json:"repairs"`
+	CacheHits        int           `json:"cache_hits"`
+	PromptTokens     int64         `json:"prompt_tokens"`
+	CompletionTokens int64         `json:"completion_tokens"`
+	CostUSD          float64       `json:"cost_usd"`
+	Latency          time.Duration `json:"latency"`
+}
+
+func (u *Usage) add(call Call) {
+	u.Calls = append(u.Calls, call)
+	if call.Attempt > 0 {
+		u.Repairs++
+	}
+	u.PromptTokens += call.PromptTokens
+	u.CompletionTokens += call.CompletionTokens
+	u.CostUSD += call.CostUSD
+	u.Latency += call.Latency
+}
+
+// Models lists the models that served the calls.
+func (u Usage) Models() []string {
+	seen := map[string]bool{}
+	var models []string
+	for _, call := range u.Calls {
+		if call.Model != "" && !seen[call.Model] {
+			seen[call.Model] = true
+			models = append(models, call.Model)
+		}
+	}
+	sort.Strings(models)
+	return models
+}
+
+// Usage reports the completions made by c so far. Clients are cheap, so
+// build one per request to account per request.
+func (c *Client) Usage() Usage {
+	c.usageMu.Lock()
+	defer c.usageMu.Unlock()
+	u := c.usage
+	u.Calls = append([]Call(nil), c.usage.Calls...)
+	return u
+}
+
+func (c *Client) recordUsage(stage Stage, attempt int, u provider.Usage, err error) {
+	if errors.Is(err, provider.ErrCircuitOpen) {
+		return // rejected before reaching the provider
+	}
+	call := Call{Stage: stage, Attempt: attempt, Usage: u, CostUSD: c.prices.Cost(u), Failed: err != nil}
+	c.observeCall(stage, attempt, u, err)
+	c.usageMu.Lock()
+	c.usage.add(call)
+	c.usageMu.Unlock()
+	c.logger.Debug("llm usage", "stage", stage, "attempt", attempt, "model", u.Model,
+		"prompt_tokens", u.PromptTokens, "completion_tokens", u.CompletionTokens,
+		"latency", u.Latency, "cost_usd", call.CostUSD)
+}
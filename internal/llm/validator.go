@@ -2,7 +2,9 @@ package llm
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"strings"
 
 	"github.com/aaronromeo/swolegen/internal/llm/schemas"
 )
@@ -22,3 +24,83 @@ func ValidateWorkoutJSON(b []byte) (*schemas.WorkoutV12Json, error) {
 	}
 	return &wv, nil
 }
+
+// ValidationError reports generator output that still failed the workout
+// schema after repairs. Findings holds the problem found in each attempt.
+type ValidationError struct {
+	Findings []string
+}
+
+func (e *ValidationError) Error() string {
+	return "failed to validate workout yaml: " + strings.Join(e.Findings, "; ")
+}
+
+// CheckSchemas checks that the embedded schemas are JSON Schema documents
+// whose local $refs all resolve, so a bad edit is caught at startup rather
+// than by the first provider call that sends it.
+func CheckSchemas() error {
+	var errs []error
+	for name, raw := range map[string]string{"analyzer-v1": AnalyzerSchema, "workout-v1.2": WorkoutSchema} {
+		if err := checkSchema(raw); err != nil {
+			errs = append(errs, fmt.Errorf("schema %s: %w", name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func checkSchema(raw string) error {
+	var doc map[string]any
+	if err := json.Unmarshal([]byte(raw), &doc); err != nil {
+		return err
+	}
+	if _, ok := doc["type"].(string); !ok {
+		return errors.New("no top-level type")
+	}
+	var walk func(v any) error
+	walk = func(v any) error {
+		switch v := v.(type) {
+		case map[string]any:
+			if ref, ok := v["$ref"].(string); ok {
+				if _, err := resolvePointer(doc, ref); err != nil {
+					return err
+				}
+			}
+			for _, child := range v {
+				if err := walk(child); err != nil {
+					return err
+				}
+			}
+		case []any:
+			for _, child := range v {
+				if err := walk(child); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+	return walk(doc)
+}
+
+// resolvePointer follows a local "#/a/b" reference within doc.
+func resolvePointer(doc map[string]any, ref string) (any, error) {
+	path, ok := strings.CutPrefix(ref, "#")
+	if !ok {
+		return nil, fmt.Errorf("$ref %q: only local references are supported", ref)
+	}
+	var cur any = doc
+	for _, tok := range strings.Split(strings.TrimPrefix(path, "/"), "/") {
+		if tok == "" {
+			continue
+		}
+		tok = strings.ReplaceAll(strings.ReplaceAll(tok, "~1", "/"), "~0", "~")
+		m, ok := cur.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("$ref %q does not resolve", ref)
+		}
+		if cur, ok = m[tok]; !ok {
+			return nil, fmt.Errorf("$ref %q does not resolve", ref)
+		}
+	}
+	return cur, nil
+}
@@ -0,0 +1,41 @@
+// Package logging carries a request-scoped slog.Logger and request ID
+// through contexts, and redacts secrets and personal data from log records.
+package logging
+
+import (
+	"context"
+	"log/slog"
+)
+
+type loggerKey struct{}
+
+type requestIDKey struct{}
+
+// WithLogger returns a context carrying l. Code that logs on behalf of a
+// request should prefer FromContext over a logger it was built with, so its
+// records carry the request's ID.
+func WithLogger(ctx context.Context, l *slog.Logger) context.Context {
+	return context.WithValue(ctx, loggerKey{}, l)
+}
+
+// FromContext returns the logger ctx carries, or fallback, or slog.Default.
+func FromContext(ctx context.Context, fallback *slog.Logger) *slog.Logger {
+	if l, ok := ctx.Value(loggerKey{}).(*slog.Logger); ok && l != nil {
+		return l
+	}
+	if fallback != nil {
+		return fallback
+	}
+	return slog.Default()
+}
+
+// WithRequestID returns a context carrying the request's correlation ID.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestID reports the correlation ID ctx carries, if any.
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
@@ -0,0 +1,162 @@
+package logging
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"strings"
+)
+
+// Mode selects how much a Policy removes from log records.
+type Mode string
+
+const (
+	// ModeStrict redacts secrets and replaces personal data (training
+	// history, instructions, prompts, plans) with its size.
+	ModeStrict Mode = "strict"
+	// ModeSecrets redacts secrets only, for debugging prompt content.
+	ModeSecrets Mode = "secrets"
+	// ModeOff logs records unchanged.
+	ModeOff Mode = "off"
+)
+
+// DefaultSecretKeys are attribute keys whose values are always redacted. A
+// key matches exactly or as a suffix after "_" or "-", so "token" also
+// covers "access_token".
+var DefaultSecretKeys = []string{
+	"authorization", "cookie", "password", "secret", "token",
+	"api_key", "apikey", "x-api-key",
+}
+
+// DefaultPIIKeys are attribute keys holding user content, redacted in
+// ModeStrict.
+var DefaultPIIKeys = []string{
+	"instructions", "history", "params", "plan", "json", "prompt",
+	"strava_recent", "upcoming_cardio", "workout_yaml", "body",
+}
+
+// secretValues catches secrets logged under innocent keys, such as a
+// bearer token inside an error message.
+var secretValues = []struct {
+	re   *regexp.Regexp
+	repl string
+}{
+	{regexp.MustCompile(`(?i)\b(bearer|basic)\s+[A-Za-z0-9._~+/=-]+`), "$1 [REDACTED]"},
+	{regexp.MustCompile(`\bsk-[A-Za-z0-9_-]{16,}`), "[REDACTED]"},
+	{regexp.MustCompile(`\bsg_[0-9a-f]{8,}_[0-9a-f]{8,}`), "[REDACTED]"},
+	{regexp.MustCompile(`(?i)\b((?:access_|refresh_)?token|client_secret|api_key|code)=[^&\s"]+`), "$1=[REDACTED]"},
+}
+
+const redacted = "[REDACTED]"
+
+// Policy decides what NewHandler removes.
+type Policy struct {
+	Mode       Mode
+	SecretKeys []string
+	PIIKeys    []string
+}
+
+// NewPolicy builds a policy for mode ("" means strict) from the default
+// keys plus the extra ones given.
+func NewPolicy(mode string, secretKeys, piiKeys []string) (Policy, error) {
+	p := Policy{
+		Mode:       Mode(strings.ToLower(strings.TrimSpace(mode))),
+		SecretKeys: append(append([]string(nil), DefaultSecretKeys...), secretKeys...),
+		PIIKeys:    append(append([]string(nil), DefaultPIIKeys...), piiKeys...),
+	}
+	switch p.Mode {
+	case "":
+		p.Mode = ModeStrict
+	case ModeStrict, ModeSecrets, ModeOff:
+	default:
+		return Policy{}, fmt.Errorf("log redaction mode %q: want strict, secrets or off", mode)
+	}
+	return p, nil
+}
+
+// NewHandler wraps h so every record passes through p first.
+func NewHandler(h slog.Handler, p Policy) slog.Handler {
+	if p.Mode == ModeOff {
+		return h
+	}
+	return &redactor{h: h, p: p}
+}
+
+type redactor struct {
+	h slog.Handler
+	p Policy
+}
+
+func (r *redactor) Enabled(ctx context.Context, level slog.Level) bool {
+	return r.h.Enabled(ctx, level)
+}
+
+func (r *redactor) Handle(ctx context.Context, rec slog.Record) error {
+	out := slog.NewRecord(rec.Time, rec.Level, rec.Message, rec.PC)
+	rec.Attrs(func(a slog.Attr) bool {
+		out.AddAttrs(r.p.attr(a))
+		return true
+	})
+	return r.h.Handle(ctx, out)
+}
+
+func (r *redactor) WithAttrs(as []slog.Attr) slog.Handler {
+	cp := make([]slog.Attr, len(as))
+	for i, a := range as {
+		cp[i] = r.p.attr(a)
+	}
+	return &redactor{h: r.h.WithAttrs(cp), p: r.p}
+}
+
+func (r *redactor) WithGroup(name string) slog.Handler {
+	return &redactor{h: r.h.WithGroup(name), p: r.p}
+}
+
+func (p Policy) attr(a slog.Attr) slog.Attr {
+	a.Value = a.Value.Resolve()
+	key := strings.ToLower(a.Key)
+	if matchKey(key, p.SecretKeys) {
+		return slog.String(a.Key, redacted)
+	}
+	if p.Mode == ModeStrict && matchKey(key, p.PIIKeys) {
+		if a.Value.Kind() == slog.KindString {
+			return slog.String(a.Key, fmt.Sprintf("[redacted %d bytes]", len(a.Value.String())))
+		}
+		return slog.String(a.Key, "[redacted]")
+	}
+	switch a.Value.Kind() {
+	case slog.KindGroup:
+		group := a.Value.Group()
+		cp := make([]any, len(group))
+		for i, ga := range group {
+			cp[i] = p.attr(ga)
+		}
+		return slog.Group(a.Key, cp...)
+	case slog.KindString:
+		return slog.String(a.Key, ScrubString(a.Value.String()))
+	case slog.KindAny:
+		if err, ok := a.Value.Any().(error); ok {
+			return slog.String(a.Key, ScrubString(err.Error()))
+		}
+	}
+	return a
+}
+
+func matchKey(key string, keys []string) bool {
+	for _, k := range keys {
+		k = strings.ToLower(k)
+		if key == k || strings.HasSuffix(key, "_"+k) || strings.HasSuffix(key, "-"+k) {
+			return true
+		}
+	}
+	return false
+}
+
+// ScrubString redacts credentials that appear inside free text.
+func ScrubString(s string) string {
+	for _, sv := range secretValues {
+		s = sv.re.ReplaceAllString(s, sv.repl)
+	}
+	return s
+}
@@ -0,0 +1,85 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func logJSON(t *testing.T, mode string, fn func(l *slog.Logger)) map[string]any {
+	t.Helper()
+	p, err := NewPolicy(mode, []string{"strava_code"}, nil)
+	if err != nil {
+		t.Fatalf("NewPolicy: %v", err)
+	}
+	var buf bytes.Buffer
+	fn(slog.New(NewHandler(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}), p)))
+	var rec map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &rec); err != nil {
+		t.Fatalf("decode %q: %v", buf.String(), err)
+	}
+	return rec
+}
+
+func TestRedact(t *testing.T) {
+	rec := logJSON(t, "", func(l *slog.Logger) {
+		l.With("access_token", "abc").Info("msg",
+			"X-API-Key", "sg_0123456789abcdef_0123456789abcdef",
+			"strava_code", "xyz",
+			"history", "2025-08-09 squat 225x5",
+			"params", struct{ Prompt string }{"secret plan"},
+			"error", errors.New(`GET https://x.test/?access_token=abc&page=2: Bearer abc.def`),
+			slog.Group("req", "authorization", "Basic Zm9v", "path", "/llm/analyze"),
+		)
+	})
+	want := map[string]any{
+		"access_token": "[REDACTED]",
+		"X-API-Key":    "[REDACTED]",
+		"strava_code":  "[REDACTED]",
+		"history":      "[redacted 22 bytes]",
+		"params":       "[redacted]",
+		"error":        "GET https://x.test/?access_token=[REDACTED]&page=2: Bearer [REDACTED]",
+	}
+	for k, v := range want {
+		if rec[k] != v {
+			t.Errorf("%s = %v; want %v", k, rec[k], v)
+		}
+	}
+	if req := rec["req"].(map[string]any); req["authorization"] != "[REDACTED]" || req["path"] != "/llm/analyze" {
+		t.Errorf("req group = %v", req)
+	}
+
+	rec = logJSON(t, "secrets", func(l *slog.Logger) {
+		l.Info("msg", "history", "squat 225x5", "token", "abc")
+	})
+	if rec["history"] != "squat 225x5" || rec["token"] != "[REDACTED]" {
+		t.Errorf("secrets mode = %v", rec)
+	}
+
+	rec = logJSON(t, "off", func(l *slog.Logger) { l.Info("msg", "token", "abc") })
+	if rec["token"] != "abc" {
+		t.Errorf("off mode = %v", rec)
+	}
+
+	if _, err := NewPolicy("loud", nil, nil); err == nil || !strings.Contains(err.Error(), "loud") {
+		t.Errorf("NewPolicy(loud) = %v", err)
+	}
+}
+
+func TestFromContext(t *testing.T) {
+	ctx := context.Background()
+	fallback := slog.New(slog.NewTextHandler(io.Discard, nil))
+	if FromContext(ctx, fallback) != fallback || FromContext(ctx, nil) != slog.Default() {
+		t.Fatalf("FromContext without a logger should use the fallback")
+	}
+	l := slog.New(slog.NewTextHandler(io.Discard, nil))
+	ctx = WithRequestID(WithLogger(ctx, l), "req-1")
+	if FromContext(ctx, fallback) != l || RequestID(ctx) != "req-1" {
+		t.Fatalf("FromContext/RequestID did not return the stored values")
+	}
+}
@@ -0,0 +1,117 @@
+// Package metrics holds the Prometheus collectors the server exports on
+// /metrics. Collectors are package-level so the packages that observe them
+// need no extra wiring; they register on Registry rather than the global
+// default registry so tests and embedders see only swolegen's series.
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "swolegen"
+
+// Registry holds every swolegen collector plus the Go runtime and process
+// collectors.
+var Registry = prometheus.NewRegistry()
+
+var (
+	// HTTPRequests times API requests by method, matched route and status.
+	HTTPRequests = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "HTTP request latency by method, route and status.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+
+	// LLMCalls times provider completions. stage is analyze, generate or
+	// repair; outcome is ok or error.
+	LLMCalls = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "llm_call_duration_seconds",
+		Help:      "LLM completion latency by provider, model, stage and outcome.",
+		Buckets:   []float64{0.5, 1, 2.5, 5, 10, 20, 30, 60, 90, 120},
+	}, []string{"provider", "model", "stage", "outcome"})
+
+	// LLMTokens counts tokens by provider, model, stage and kind (prompt or
+	// completion).
+	LLMTokens = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "llm_tokens_total",
+		Help:      "LLM tokens by provider, model, stage and kind.",
+	}, []string{"provider", "model", "stage", "kind"})
+
+	// LLMRepairs counts repair attempts by the stage being repaired
+	// (analyze or generate).
+	LLMRepairs = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "llm_repair_attempts_total",
+		Help:      "Repair prompts sent, by the stage being repaired.",
+	}, []string{"stage"})
+
+	// LLMValidationFailures counts model output rejected by the schemas, by
+	// stage and the kind of rule broken: syntax, type, required, enum,
+	// range, length, pattern or other.
+	LLMValidationFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "llm_validation_failures_total",
+		Help:      "Model output that failed schema validation, by stage and error category.",
+	}, []string{"stage", "category"})
+
+	// CacheRequests counts cache lookups by cache (llm or fetch) and result
+	// (hit or miss).
+	CacheRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "cache_requests_total",
+		Help:      "Cache lookups by cache and result.",
+	}, []string{"cache", "result"})
+
+	// StravaRequests counts Strava API calls by endpoint and status code;
+	// transport failures have status "error".
+	StravaRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "strava_requests_total",
+		Help:      "Strava API calls by endpoint and status.",
+	}, []string{"endpoint", "status"})
+
+	// StravaRateLimit mirrors the last X-RateLimit-Limit and
+	// X-RateLimit-Usage headers Strava sent, by window (15m or daily) and
+	// kind (limit or usage).
+	StravaRateLimit = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "strava_rate_limit",
+		Help:      "Strava rate limit and usage from the last API response, by window.",
+	}, []string{"window", "kind"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		HTTPRequests,
+		LLMCalls,
+		LLMTokens,
+		LLMRepairs,
+		LLMValidationFailures,
+		CacheRequests,
+		StravaRequests,
+		StravaRateLimit,
+	)
+}
+
+// Handler serves Registry in the Prometheus exposition format.
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{Registry: Registry})
+}
+
+// CacheResult records one lookup in the named cache.
+func CacheResult(cache string, hit bool) {
+	result := "miss"
+	if hit {
+		result = "hit"
+	}
+	CacheRequests.WithLabelValues(cache, result).Inc()
+}
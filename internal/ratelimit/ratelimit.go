@@ -0,0 +1,80 @@
+// Package ratelimit keeps a token bucket per key (an API key or client IP)
+// so one caller cannot monopolize the server.
+package ratelimit
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// Limiter allows Burst requests at once per key, refilled at PerMinute
+// requests a minute. A zero PerMinute disables limiting.
+type Limiter struct {
+	perMinute float64
+	burst     float64
+	now       func() time.Time
+
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	swept   time.Time
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// New returns a limiter; a burst below 1 is raised to 1.
+func New(perMinute, burst int) *Limiter {
+	return &Limiter{
+		perMinute: float64(perMinute),
+		burst:     math.Max(float64(burst), 1),
+		now:       time.Now,
+		buckets:   map[string]*bucket{},
+	}
+}
+
+// PerMinute reports the refill rate.
+func (l *Limiter) PerMinute() int { return int(l.perMinute) }
+
+// Allow takes a token from key's bucket. When the bucket is empty it returns
+// false and how long until a token is available.
+func (l *Limiter) Allow(key string) (bool, time.Duration) {
+	if l == nil || l.perMinute <= 0 {
+		return true, 0
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+	l.sweep(now)
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: l.burst, last: now}
+		l.buckets[key] = b
+	}
+	b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.last).Minutes()*l.perMinute)
+	b.last = now
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	wait := time.Duration((1 - b.tokens) / l.perMinute * float64(time.Minute))
+	return false, wait
+}
+
+// sweep drops buckets that have refilled completely, at most once per
+// refill period, so idle keys do not accumulate.
+func (l *Limiter) sweep(now time.Time) {
+	full := time.Duration(l.burst / l.perMinute * float64(time.Minute))
+	if now.Sub(l.swept) < full {
+		return
+	}
+	l.swept = now
+	for k, b := range l.buckets {
+		if now.Sub(b.last) >= full {
+			delete(l.buckets, k)
+		}
+	}
+}
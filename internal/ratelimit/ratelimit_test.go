@@ -0,0 +1,41 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLimiter(t *testing.T) {
+	now := time.Date(2025, 8, 9, 12, 0, 0, 0, time.UTC)
+	l := New(60, 2)
+	l.now = func() time.Time { return now }
+
+	for i := range 2 {
+		if ok, _ := l.Allow("a"); !ok {
+			t.Fatalf("request %d within burst was limited", i+1)
+		}
+	}
+	ok, wait := l.Allow("a")
+	if ok || wait != time.Second {
+		t.Fatalf("third request = %v, %v; want limited for 1s", ok, wait)
+	}
+	if ok, _ := l.Allow("b"); !ok {
+		t.Fatalf("another key shares a's bucket")
+	}
+
+	now = now.Add(time.Second)
+	if ok, _ := l.Allow("a"); !ok {
+		t.Fatalf("bucket did not refill after 1s")
+	}
+
+	// Idle buckets are swept once full again.
+	now = now.Add(time.Minute)
+	l.Allow("c")
+	if _, ok := l.buckets["a"]; ok {
+		t.Fatalf("idle bucket for a was kept")
+	}
+
+	if ok, _ := New(0, 0).Allow("a"); !ok {
+		t.Fatalf("a zero rate should disable limiting")
+	}
+}
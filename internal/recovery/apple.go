@@ -0,0 +1,198 @@
+package recovery
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Apple Health record types that carry recovery signals.
+const (
+	appleSleep     = "HKCategoryTypeIdentifierSleepAnalysis"
+	appleHRV       = "HKQuantityTypeIdentifierHeartRateVariabilitySDNN"
+	appleRestingHR = "HKQuantityTypeIdentifierRestingHeartRate"
+
+	appleTimeLayout = "2006-01-02 15:04:05 -0700"
+)
+
+// AppleHealthExport is the export.xml produced by Health → Export All Health
+// Data, or the export.zip that wraps it.
+type AppleHealthExport struct {
+	Path string
+}
+
+func (a AppleHealthExport) Name() string { return SourceAppleHealth }
+
+func (a AppleHealthExport) Load() (*Series, error) {
+	if strings.EqualFold(path.Ext(a.Path), ".zip") {
+		zr, err := zip.OpenReader(a.Path)
+		if err != nil {
+			return nil, fmt.Errorf("open apple health export: %w", err)
+		}
+		defer zr.Close() //nolint:errcheck
+		for _, f := range zr.File {
+			if path.Base(f.Name) != "export.xml" {
+				continue
+			}
+			r, err := f.Open()
+			if err != nil {
+				return nil, err
+			}
+			defer r.Close() //nolint:errcheck
+			return ParseAppleHealth(r)
+		}
+		return nil, fmt.Errorf("apple health export: export.xml not found in %s", a.Path)
+	}
+
+	f, err := os.Open(a.Path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close() //nolint:errcheck
+	return ParseAppleHealth(f)
+}
+
+type appleRecord struct {
+	Type      string `xml:"type,attr"`
+	StartDate string `xml:"startDate,attr"`
+	EndDate   string `xml:"endDate,attr"`
+	Value     string `xml:"value,attr"`
+}
+
+// appleDay accumulates the raw samples for one date before averaging.
+type appleDay struct {
+	sleep     []span
+	hrv       []float64
+	restingHR []float64
+}
+
+// span is one asleep sample.
+type span struct{ start, end time.Time }
+
+// asleepSeconds is the time covered by spans. The iPhone and the Watch both
+// record the same night, so overlapping samples are counted once.
+func asleepSeconds(spans []span) float64 {
+	sorted := slices.Clone(spans)
+	slices.SortFunc(sorted, func(a, b span) int { return a.start.Compare(b.start) })
+	var total time.Duration
+	var cur span
+	for i, s := range sorted {
+		switch {
+		case i == 0:
+			cur = s
+		case !s.start.After(cur.end):
+			if s.end.After(cur.end) {
+				cur.end = s.end
+			}
+		default:
+			total += cur.end.Sub(cur.start)
+			cur = s
+		}
+	}
+	if len(sorted) > 0 {
+		total += cur.end.Sub(cur.start)
+	}
+	return total.Seconds()
+}
+
+// ParseAppleHealth streams an Apple Health export.xml and returns normalized
+// daily metrics. Sleep is attributed to the date the night ends on, with
+// samples from several devices merged; HRV and resting HR are averaged per
+// day.
+func ParseAppleHealth(r io.Reader) (*Series, error) {
+	days := map[string]*appleDay{}
+	get := func(date string) *appleDay {
+		d, ok := days[date]
+		if !ok {
+			d = &appleDay{}
+			days[date] = d
+		}
+		return d
+	}
+
+	dec := xml.NewDecoder(r)
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("apple health xml: %w", err)
+		}
+		se, ok := tok.(xml.StartElement)
+		if !ok || se.Name.Local != "Record" {
+			continue
+		}
+		var rec appleRecord
+		if err := dec.DecodeElement(&rec, &se); err != nil {
+			return nil, fmt.Errorf("apple health record: %w", err)
+		}
+		switch rec.Type {
+		case appleSleep:
+			if !appleAsleep(rec.Value) {
+				continue
+			}
+			start, err := time.Parse(appleTimeLayout, rec.StartDate)
+			if err != nil {
+				return nil, fmt.Errorf("apple health sleep start %q: %w", rec.StartDate, err)
+			}
+			end, err := time.Parse(appleTimeLayout, rec.EndDate)
+			if err != nil {
+				return nil, fmt.Errorf("apple health sleep end %q: %w", rec.EndDate, err)
+			}
+			if end.After(start) {
+				d := get(end.Format(dateLayout))
+				d.sleep = append(d.sleep, span{start, end})
+			}
+		case appleHRV, appleRestingHR:
+			start, err := time.Parse(appleTimeLayout, rec.StartDate)
+			if err != nil {
+				return nil, fmt.Errorf("apple health %s date %q: %w", rec.Type, rec.StartDate, err)
+			}
+			v, err := strconv.ParseFloat(rec.Value, 64)
+			if err != nil {
+				return nil, fmt.Errorf("apple health %s value %q: %w", rec.Type, rec.Value, err)
+			}
+			d := get(start.Format(dateLayout))
+			if rec.Type == appleHRV {
+				d.hrv = append(d.hrv, v)
+			} else {
+				d.restingHR = append(d.restingHR, v)
+			}
+		}
+	}
+
+	s := NewSeries()
+	for date, ad := range days {
+		d := Day{Date: date}
+		if secs := asleepSeconds(ad.sleep); secs > 0 {
+			v := int(secs)
+			d.SleepSeconds = &v
+		}
+		d.HRV = mean(ad.hrv)
+		if m := mean(ad.restingHR); m != nil {
+			v := int(math.Round(*m))
+			d.RestingHR = &v
+		}
+		if err := s.Add(d); err != nil {
+			return nil, err
+		}
+	}
+	s.Normalize()
+	return s, nil
+}
+
+// appleAsleep reports whether a sleep-analysis value counts as sleep (as
+// opposed to in-bed or awake time). Older exports only use "Asleep"; watchOS 9+
+// splits it into core, deep and REM stages.
+func appleAsleep(v string) bool {
+	return strings.HasPrefix(v, "HKCategoryValueSleepAnalysisAsleep")
+}
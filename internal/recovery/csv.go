@@ -0,0 +1,130 @@
+package recovery
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// CSV columns understood by ParseCSV. Only date is required; see
+// docs/RECOVERY_IMPORT.md for the full format.
+const (
+	csvDate        = "date"
+	csvSleepScore  = "sleep_score"
+	csvSleepHours  = "sleep_hours"
+	csvHRV         = "hrv_ms"
+	csvRestingHR   = "resting_hr"
+	csvReadiness   = "readiness"
+	csvBodyBattery = "body_battery"
+)
+
+// CSVExport is a generic recovery CSV for devices without a dedicated importer.
+type CSVExport struct {
+	Path string
+}
+
+func (c CSVExport) Name() string { return SourceCSV }
+
+func (c CSVExport) Load() (*Series, error) {
+	f, err := os.Open(c.Path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close() //nolint:errcheck
+	return ParseCSV(f)
+}
+
+// ParseCSV reads a header-led recovery CSV and returns normalized daily
+// metrics. Column names are case-insensitive, unknown columns are ignored and
+// empty cells mean "not recorded".
+func ParseCSV(r io.Reader) (*Series, error) {
+	cr := csv.NewReader(r)
+	cr.TrimLeadingSpace = true
+	cr.FieldsPerRecord = -1
+
+	header, err := cr.Read()
+	if err != nil {
+		return nil, fmt.Errorf("recovery csv header: %w", err)
+	}
+	cols := map[string]int{}
+	for i, h := range header {
+		cols[strings.ToLower(strings.TrimSpace(h))] = i
+	}
+	if _, ok := cols[csvDate]; !ok {
+		return nil, errors.New("recovery csv: missing date column")
+	}
+
+	s := NewSeries()
+	for line := 2; ; line++ {
+		rec, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("recovery csv line %d: %w", line, err)
+		}
+		cell := func(name string) string {
+			i, ok := cols[name]
+			if !ok || i >= len(rec) {
+				return ""
+			}
+			return strings.TrimSpace(rec[i])
+		}
+
+		d := Day{Date: cell(csvDate)}
+		if d.SleepScore, err = csvInt(cell(csvSleepScore)); err != nil {
+			return nil, fmt.Errorf("recovery csv line %d %s: %w", line, csvSleepScore, err)
+		}
+		hours, err := csvFloat(cell(csvSleepHours))
+		if err != nil {
+			return nil, fmt.Errorf("recovery csv line %d %s: %w", line, csvSleepHours, err)
+		}
+		if hours != nil {
+			v := int(*hours * 3600)
+			d.SleepSeconds = &v
+		}
+		if d.HRV, err = csvFloat(cell(csvHRV)); err != nil {
+			return nil, fmt.Errorf("recovery csv line %d %s: %w", line, csvHRV, err)
+		}
+		if d.RestingHR, err = csvInt(cell(csvRestingHR)); err != nil {
+			return nil, fmt.Errorf("recovery csv line %d %s: %w", line, csvRestingHR, err)
+		}
+		if d.Readiness, err = csvInt(cell(csvReadiness)); err != nil {
+			return nil, fmt.Errorf("recovery csv line %d %s: %w", line, csvReadiness, err)
+		}
+		if d.BodyBattery, err = csvInt(cell(csvBodyBattery)); err != nil {
+			return nil, fmt.Errorf("recovery csv line %d %s: %w", line, csvBodyBattery, err)
+		}
+		if err := s.Add(d); err != nil {
+			return nil, fmt.Errorf("recovery csv line %d: %w", line, err)
+		}
+	}
+	s.Normalize()
+	return s, nil
+}
+
+func csvFloat(v string) (*float64, error) {
+	if v == "" {
+		return nil, nil
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		return nil, err
+	}
+	return &f, nil
+}
+
+// csvInt accepts decimals ("52.0") since spreadsheet exports often add them.
+func csvInt(v string) (*int, error) {
+	f, err := csvFloat(v)
+	if err != nil || f == nil {
+		return nil, err
+	}
+	n := int(math.Round(*f))
+	return &n, nil
+}
@@ -0,0 +1,203 @@
+package recovery
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"math"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Garmin Connect exports (Account → Export Your Data) ship one JSON array per
+// metric family. Only the files below carry recovery signals; everything else
+// in the archive is ignored.
+var garminFilePatterns = []string{
+	"sleepdata",        // DI-Connect-Wellness/*_sleepData.json
+	"udsfile",          // DI-Connect-Aggregator/UDSFile_*.json (resting HR, body battery)
+	"hrv",              // HRV status summaries
+	"restingheartrate", // standalone resting heart-rate history
+}
+
+// garminRecord is the union of the fields recovery cares about across the
+// Garmin export files. Every file keys its rows by calendarDate.
+type garminRecord struct {
+	CalendarDate string `json:"calendarDate"`
+
+	// sleepData
+	SleepScores       *garminSleepScores `json:"sleepScores"`
+	DeepSleepSeconds  *int               `json:"deepSleepSeconds"`
+	LightSleepSeconds *int               `json:"lightSleepSeconds"`
+	RemSleepSeconds   *int               `json:"remSleepSeconds"`
+
+	// UDSFile
+	RestingHeartRate *int               `json:"restingHeartRate"`
+	BodyBattery      *garminBodyBattery `json:"bodyBattery"`
+
+	// restingHeartRate history
+	CurrentDayRestingHeartRate *int `json:"currentDayRestingHeartRate"`
+
+	// HRV status
+	LastNightAvg *float64 `json:"lastNightAvg"`
+}
+
+type garminSleepScores struct {
+	OverallScore json.RawMessage `json:"overallScore"`
+}
+
+type garminBodyBattery struct {
+	StatList []struct {
+		Type  string `json:"bodyBatteryStatType"`
+		Value *int   `json:"statsValue"`
+	} `json:"bodyBatteryStatList"`
+}
+
+// overall returns the 0–100 sleep score, which Garmin serialises either as a
+// bare number or as {"value": n}.
+func (s *garminSleepScores) overall() *int {
+	if s == nil || len(s.OverallScore) == 0 {
+		return nil
+	}
+	var n float64
+	if err := json.Unmarshal(s.OverallScore, &n); err == nil {
+		v := int(math.Round(n))
+		return &v
+	}
+	var obj struct {
+		Value *float64 `json:"value"`
+	}
+	if err := json.Unmarshal(s.OverallScore, &obj); err == nil && obj.Value != nil {
+		v := int(math.Round(*obj.Value))
+		return &v
+	}
+	return nil
+}
+
+// morning returns the day's peak body battery, which is the charge carried
+// out of the night's sleep.
+func (b *garminBodyBattery) morning() *int {
+	if b == nil {
+		return nil
+	}
+	for _, st := range b.StatList {
+		if st.Type == "HIGHEST" && st.Value != nil {
+			v := *st.Value
+			return &v
+		}
+	}
+	return nil
+}
+
+func (r garminRecord) day() Day {
+	d := Day{Date: r.CalendarDate}
+	d.SleepScore = r.SleepScores.overall()
+	if r.DeepSleepSeconds != nil || r.LightSleepSeconds != nil || r.RemSleepSeconds != nil {
+		total := deref(r.DeepSleepSeconds) + deref(r.LightSleepSeconds) + deref(r.RemSleepSeconds)
+		d.SleepSeconds = &total
+	}
+	d.BodyBattery = r.BodyBattery.morning()
+	d.RestingHR = r.RestingHeartRate
+	if r.CurrentDayRestingHeartRate != nil {
+		d.RestingHR = r.CurrentDayRestingHeartRate
+	}
+	d.HRV = r.LastNightAvg
+	return d
+}
+
+func deref(p *int) int {
+	if p == nil {
+		return 0
+	}
+	return *p
+}
+
+// ParseGarminExport reads a Garmin Connect data export, either the .zip
+// archive or the directory it extracts to, and returns its daily metrics.
+func ParseGarminExport(p string) (*Series, error) {
+	st, err := os.Stat(p)
+	if err != nil {
+		return nil, err
+	}
+	s := NewSeries()
+	if st.IsDir() {
+		err = parseGarminFS(os.DirFS(p), s)
+	} else {
+		var zr *zip.ReadCloser
+		zr, err = zip.OpenReader(p)
+		if err != nil {
+			return nil, fmt.Errorf("open garmin export: %w", err)
+		}
+		defer zr.Close() //nolint:errcheck
+		err = parseGarminFS(zr, s)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func parseGarminFS(fsys fs.FS, s *Series) error {
+	return fs.WalkDir(fsys, ".", func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || !isGarminRecoveryFile(p) {
+			return nil
+		}
+		f, err := fsys.Open(p)
+		if err != nil {
+			return err
+		}
+		defer f.Close() //nolint:errcheck
+		b, err := io.ReadAll(f)
+		if err != nil {
+			return err
+		}
+		if err := ParseGarminJSON(b, s); err != nil {
+			return fmt.Errorf("%s: %w", p, err)
+		}
+		return nil
+	})
+}
+
+func isGarminRecoveryFile(p string) bool {
+	if !strings.EqualFold(filepath.Ext(p), ".json") {
+		return false
+	}
+	name := strings.ToLower(path.Base(p))
+	for _, pat := range garminFilePatterns {
+		if strings.Contains(name, pat) {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseGarminJSON decodes one Garmin export file and adds its rows to s.
+// Files are either a bare array of daily rows or an object wrapping them
+// (HRV exports use {"hrvSummaries": [...]}).
+func ParseGarminJSON(b []byte, s *Series) error {
+	var rows []garminRecord
+	if err := json.Unmarshal(b, &rows); err != nil {
+		var wrapped struct {
+			HRVSummaries []garminRecord `json:"hrvSummaries"`
+		}
+		if err2 := json.Unmarshal(b, &wrapped); err2 != nil {
+			return fmt.Errorf("garmin json: %w", err)
+		}
+		rows = wrapped.HRVSummaries
+	}
+	for _, r := range rows {
+		if r.CalendarDate == "" {
+			continue
+		}
+		if err := s.Add(r.day()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
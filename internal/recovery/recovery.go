@@ -0,0 +1,235 @@
+package recovery
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+const (
+	dateLayout = "2006-01-02"
+
+	// DefaultBaselineDays is the rolling window used for baselines.
+	DefaultBaselineDays = 7
+)
+
+// Day holds the recovery metrics recorded for a single calendar date.
+// Pointers distinguish "not recorded" from a zero reading.
+type Day struct {
+	// Date is the calendar date (YYYY-MM-DD) the metrics belong to.
+	Date string `json:"date"`
+	// SleepScore is the 0–100 sleep score for the night ending on Date.
+	SleepScore *int `json:"sleep_score,omitempty"`
+	// SleepSeconds is the total sleep time for the night ending on Date.
+	SleepSeconds *int `json:"sleep_seconds,omitempty"`
+	// BodyBattery is the 0–100 morning energy reserve.
+	BodyBattery *int `json:"body_battery,omitempty"`
+	// HRV is the overnight average heart-rate variability in milliseconds.
+	HRV *float64 `json:"hrv_ms,omitempty"`
+	// RestingHR is the resting heart rate in beats per minute.
+	RestingHR *int `json:"resting_hr,omitempty"`
+	// Readiness is a 0–100 device readiness/recovery score (Oura, Whoop, …).
+	Readiness *int `json:"readiness,omitempty"`
+}
+
+// merge copies every recorded field of o onto d.
+func (d *Day) merge(o Day) {
+	if o.SleepScore != nil {
+		d.SleepScore = o.SleepScore
+	}
+	if o.SleepSeconds != nil {
+		d.SleepSeconds = o.SleepSeconds
+	}
+	if o.BodyBattery != nil {
+		d.BodyBattery = o.BodyBattery
+	}
+	if o.HRV != nil {
+		d.HRV = o.HRV
+	}
+	if o.RestingHR != nil {
+		d.RestingHR = o.RestingHR
+	}
+	if o.Readiness != nil {
+		d.Readiness = o.Readiness
+	}
+}
+
+// Series is a collection of daily recovery metrics keyed by date.
+type Series struct {
+	days map[string]Day
+}
+
+func NewSeries() *Series {
+	return &Series{days: map[string]Day{}}
+}
+
+// Add records d, merging it with any metrics already stored for the same date.
+func (s *Series) Add(d Day) error {
+	if _, err := time.Parse(dateLayout, d.Date); err != nil {
+		return fmt.Errorf("recovery day %q: %w", d.Date, err)
+	}
+	cur := s.days[d.Date]
+	cur.Date = d.Date
+	cur.merge(d)
+	s.days[d.Date] = cur
+	return nil
+}
+
+// Get returns the metrics stored for date.
+func (s *Series) Get(date string) (Day, bool) {
+	d, ok := s.days[date]
+	return d, ok
+}
+
+// Dates returns the stored dates in ascending order.
+func (s *Series) Dates() []string {
+	out := make([]string, 0, len(s.days))
+	for k := range s.days {
+		out = append(out, k)
+	}
+	sort.Strings(out)
+	return out
+}
+
+func (s *Series) Len() int { return len(s.days) }
+
+// Baseline holds rolling means over the days preceding a session date.
+// A nil field means no day in the window recorded that metric.
+type Baseline struct {
+	Days        int      `json:"days"`
+	SleepScore  *float64 `json:"sleep_score,omitempty"`
+	BodyBattery *float64 `json:"body_battery,omitempty"`
+	HRV         *float64 `json:"hrv_ms,omitempty"`
+	RestingHR   *float64 `json:"resting_hr,omitempty"`
+}
+
+// Snapshot is the recovery picture for one session date: the day's own
+// metrics, the rolling baseline before it, and human-readable trends.
+type Snapshot struct {
+	Date     string   `json:"date"`
+	Today    Day      `json:"today"`
+	Baseline Baseline `json:"baseline"`
+	Trends   []string `json:"trends"`
+}
+
+// Snapshot builds the recovery snapshot for date using a baseline over the
+// preceding window days (the session date itself is excluded).
+func (s *Series) Snapshot(date string, window int) (Snapshot, error) {
+	day, err := time.Parse(dateLayout, date)
+	if err != nil {
+		return Snapshot{}, fmt.Errorf("recovery snapshot date %q: %w", date, err)
+	}
+	if window <= 0 {
+		window = DefaultBaselineDays
+	}
+
+	today, _ := s.Get(date)
+	today.Date = date
+
+	var sleep, bb, hrv, rhr []float64
+	for i := 1; i <= window; i++ {
+		d, ok := s.Get(day.AddDate(0, 0, -i).Format(dateLayout))
+		if !ok {
+			continue
+		}
+		if d.SleepScore != nil {
+			sleep = append(sleep, float64(*d.SleepScore))
+		}
+		if d.BodyBattery != nil {
+			bb = append(bb, float64(*d.BodyBattery))
+		}
+		if d.HRV != nil {
+			hrv = append(hrv, *d.HRV)
+		}
+		if d.RestingHR != nil {
+			rhr = append(rhr, float64(*d.RestingHR))
+		}
+	}
+
+	snap := Snapshot{
+		Date:  date,
+		Today: today,
+		Baseline: Baseline{
+			Days:        window,
+			SleepScore:  mean(sleep),
+			BodyBattery: mean(bb),
+			HRV:         mean(hrv),
+			RestingHR:   mean(rhr),
+		},
+	}
+	snap.Trends = snap.trends()
+	return snap, nil
+}
+
+// Override returns a copy of the snapshot with d's recorded metrics laid
+// over today's values and the trends recomputed.
+func (s Snapshot) Override(d Day) Snapshot {
+	s.Today.merge(d)
+	s.Trends = s.trends()
+	return s
+}
+
+// Empty reports whether the snapshot carries no metrics for its date.
+func (s Snapshot) Empty() bool {
+	t := s.Today
+	return t.SleepScore == nil && t.SleepSeconds == nil && t.BodyBattery == nil && t.HRV == nil && t.RestingHR == nil && t.Readiness == nil
+}
+
+// trends describes how each of today's metrics compares with its baseline,
+// e.g. "HRV 15% below 7-day baseline (38 vs 45 ms)".
+func (s Snapshot) trends() []string {
+	out := []string{}
+	b := s.Baseline
+	if s.Today.HRV != nil && b.HRV != nil {
+		out = append(out, describe("HRV", *s.Today.HRV, *b.HRV, b.Days, "ms"))
+	}
+	if s.Today.RestingHR != nil && b.RestingHR != nil {
+		out = append(out, describe("Resting HR", float64(*s.Today.RestingHR), *b.RestingHR, b.Days, "bpm"))
+	}
+	if s.Today.SleepScore != nil && b.SleepScore != nil {
+		out = append(out, describe("Sleep score", float64(*s.Today.SleepScore), *b.SleepScore, b.Days, ""))
+	}
+	if s.Today.BodyBattery != nil && b.BodyBattery != nil {
+		out = append(out, describe("Body battery", float64(*s.Today.BodyBattery), *b.BodyBattery, b.Days, ""))
+	}
+	return out
+}
+
+func describe(label string, today, base float64, days int, unit string) string {
+	if unit != "" {
+		unit = " " + unit
+	}
+	values := fmt.Sprintf("(%s vs %s%s)", formatNum(today), formatNum(base), unit)
+	if base == 0 {
+		return fmt.Sprintf("%s at %d-day baseline %s", label, days, values)
+	}
+	pct := math.Round((today - base) / base * 100)
+	switch {
+	case pct > 0:
+		return fmt.Sprintf("%s %.0f%% above %d-day baseline %s", label, pct, days, values)
+	case pct < 0:
+		return fmt.Sprintf("%s %.0f%% below %d-day baseline %s", label, -pct, days, values)
+	default:
+		return fmt.Sprintf("%s at %d-day baseline %s", label, days, values)
+	}
+}
+
+func formatNum(f float64) string {
+	if f == math.Trunc(f) {
+		return fmt.Sprintf("%.0f", f)
+	}
+	return fmt.Sprintf("%.1f", f)
+}
+
+func mean(xs []float64) *float64 {
+	if len(xs) == 0 {
+		return nil
+	}
+	var sum float64
+	for _, x := range xs {
+		sum += x
+	}
+	m := math.Round(sum/float64(len(xs))*10) / 10
+	return &m
+}
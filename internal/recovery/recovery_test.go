@@ -0,0 +1,249 @@
+package recovery
+
+import (
+	"archive/zip"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func intp(v int) *int { return &v }
+
+func TestParseGarminExport_Dir(t *testing.T) {
+	s, err := ParseGarminExport(filepath.Join("testdata", "garmin"))
+	if err != nil {
+		t.Fatalf("ParseGarminExport: %v", err)
+	}
+	if s.Len() != 8 {
+		t.Fatalf("expected 8 days, got %d", s.Len())
+	}
+	d, ok := s.Get("2025-08-08")
+	if !ok {
+		t.Fatalf("missing 2025-08-08")
+	}
+	if d.SleepScore == nil || *d.SleepScore != 62 {
+		t.Fatalf("sleep score = %v; want 62", d.SleepScore)
+	}
+	if d.BodyBattery == nil || *d.BodyBattery != 45 {
+		t.Fatalf("body battery = %v; want 45", d.BodyBattery)
+	}
+	if d.HRV == nil || *d.HRV != 38 {
+		t.Fatalf("hrv = %v; want 38", d.HRV)
+	}
+	if d.RestingHR == nil || *d.RestingHR != 56 {
+		t.Fatalf("resting hr = %v; want 56", d.RestingHR)
+	}
+	if d.SleepSeconds == nil || *d.SleepSeconds != 25800 {
+		t.Fatalf("sleep seconds = %v; want 25800", d.SleepSeconds)
+	}
+	// Object-form sleep score ({"value": n}) on odd days.
+	d2, _ := s.Get("2025-08-02")
+	if d2.SleepScore == nil || *d2.SleepScore != 82 {
+		t.Fatalf("object sleep score = %v; want 82", d2.SleepScore)
+	}
+}
+
+func TestParseGarminExport_Zip(t *testing.T) {
+	zp := filepath.Join(t.TempDir(), "export.zip")
+	f, err := os.Create(zp)
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	zw := zip.NewWriter(f)
+	root := filepath.Join("testdata", "garmin")
+	err = filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		rel, _ := filepath.Rel(root, p)
+		w, err := zw.Create(filepath.ToSlash(rel))
+		if err != nil {
+			return err
+		}
+		src, err := os.Open(p)
+		if err != nil {
+			return err
+		}
+		defer src.Close() //nolint:errcheck
+		_, err = io.Copy(w, src)
+		return err
+	})
+	if err != nil {
+		t.Fatalf("build zip: %v", err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("zip close: %v", err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+
+	s, err := ParseGarminExport(zp)
+	if err != nil {
+		t.Fatalf("ParseGarminExport(zip): %v", err)
+	}
+	if s.Len() != 8 {
+		t.Fatalf("expected 8 days, got %d", s.Len())
+	}
+}
+
+func TestSnapshot_Trends(t *testing.T) {
+	s, err := ParseGarminExport(filepath.Join("testdata", "garmin"))
+	if err != nil {
+		t.Fatalf("ParseGarminExport: %v", err)
+	}
+	snap, err := s.Snapshot("2025-08-08", DefaultBaselineDays)
+	if err != nil {
+		t.Fatalf("Snapshot: %v", err)
+	}
+	if snap.Baseline.HRV == nil || *snap.Baseline.HRV != 45.3 {
+		t.Fatalf("hrv baseline = %v; want 45.3", snap.Baseline.HRV)
+	}
+	want := "HRV 16% below 7-day baseline (38 vs 45.3 ms)"
+	if len(snap.Trends) == 0 || snap.Trends[0] != want {
+		t.Fatalf("trends = %q; want first %q", snap.Trends, want)
+	}
+	if !strings.HasPrefix(snap.Trends[1], "Resting HR 12% above") {
+		t.Fatalf("resting hr trend = %q", snap.Trends[1])
+	}
+}
+
+func TestSnapshot_NoData(t *testing.T) {
+	s := NewSeries()
+	if err := s.Add(Day{Date: "2025-08-01", SleepScore: intp(70)}); err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+	snap, err := s.Snapshot("2025-08-20", 7)
+	if err != nil {
+		t.Fatalf("Snapshot: %v", err)
+	}
+	if !snap.Empty() || len(snap.Trends) != 0 || snap.Baseline.SleepScore != nil {
+		t.Fatalf("expected empty snapshot, got %+v", snap)
+	}
+	if err := s.Add(Day{Date: "08/01/2025"}); err == nil {
+		t.Fatalf("expected error for bad date")
+	}
+}
+
+func TestAppleHealthExport_Load(t *testing.T) {
+	src, err := NewSource(SourceAppleHealth, filepath.Join("testdata", "apple_export.xml"))
+	if err != nil {
+		t.Fatalf("NewSource: %v", err)
+	}
+	s, err := src.Load()
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	d, ok := s.Get("2025-08-08")
+	if !ok {
+		t.Fatalf("missing 2025-08-08")
+	}
+	// 3h core + 2h deep + 1h REM; in-bed and awake segments are excluded.
+	if d.SleepSeconds == nil || *d.SleepSeconds != 6*3600 {
+		t.Fatalf("sleep seconds = %v; want %d", d.SleepSeconds, 6*3600)
+	}
+	if d.SleepScore == nil || *d.SleepScore != 75 {
+		t.Fatalf("normalized sleep score = %v; want 75", d.SleepScore)
+	}
+	if d.HRV == nil || *d.HRV != 42 {
+		t.Fatalf("hrv = %v; want 42", d.HRV)
+	}
+	if d.RestingHR == nil || *d.RestingHR != 54 {
+		t.Fatalf("resting hr = %v; want 54", d.RestingHR)
+	}
+	if prev, _ := s.Get("2025-08-07"); prev.RestingHR == nil || *prev.RestingHR != 50 {
+		t.Fatalf("previous resting hr = %v; want 50", prev.RestingHR)
+	}
+}
+
+func TestAppleHealthExport_OverlappingSources(t *testing.T) {
+	src, err := NewSource(SourceAppleHealth, filepath.Join("testdata", "apple_overlap.xml"))
+	if err != nil {
+		t.Fatalf("NewSource: %v", err)
+	}
+	s, err := src.Load()
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	d, ok := s.Get("2025-08-08")
+	if !ok {
+		t.Fatalf("missing 2025-08-08")
+	}
+	// The iPhone's 22:45–05:00 and the Watch's stages to 05:15 cover one
+	// 6.5h night; summing the records would report 12.25h.
+	if d.SleepSeconds == nil || *d.SleepSeconds != 6*3600+30*60 {
+		t.Fatalf("sleep seconds = %v; want %d", d.SleepSeconds, 6*3600+30*60)
+	}
+	if d.SleepScore == nil || *d.SleepScore != 81 {
+		t.Fatalf("normalized sleep score = %v; want 81", d.SleepScore)
+	}
+}
+
+func TestCSVExport_Load(t *testing.T) {
+	src, err := NewSource(SourceCSV, filepath.Join("testdata", "recovery.csv"))
+	if err != nil {
+		t.Fatalf("NewSource: %v", err)
+	}
+	s, err := src.Load()
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	cases := []struct {
+		date        string
+		sleepScore  *int
+		bodyBattery *int
+	}{
+		{"2025-08-06", intp(81), nil},
+		{"2025-08-07", intp(75), intp(70)}, // sleep from hours, body battery from readiness
+		{"2025-08-08", nil, intp(33)},
+	}
+	for _, tc := range cases {
+		d, ok := s.Get(tc.date)
+		if !ok {
+			t.Fatalf("missing %s", tc.date)
+		}
+		if !sameInt(d.SleepScore, tc.sleepScore) {
+			t.Fatalf("%s sleep score = %v; want %v", tc.date, d.SleepScore, tc.sleepScore)
+		}
+		if !sameInt(d.BodyBattery, tc.bodyBattery) {
+			t.Fatalf("%s body battery = %v; want %v", tc.date, d.BodyBattery, tc.bodyBattery)
+		}
+	}
+	if _, err := ParseCSV(strings.NewReader("day,hrv_ms\n2025-08-01,40\n")); err == nil {
+		t.Fatalf("expected error for missing date column")
+	}
+	if _, err := ParseCSV(strings.NewReader("date,hrv_ms\n2025-08-01,forty\n")); err == nil {
+		t.Fatalf("expected error for bad number")
+	}
+}
+
+func TestNewSource_Unknown(t *testing.T) {
+	if _, err := NewSource("fitbit", "x"); err == nil {
+		t.Fatalf("expected error for unknown source")
+	}
+	if _, err := NewSource(SourceCSV, ""); err == nil {
+		t.Fatalf("expected error for empty path")
+	}
+}
+
+func TestPathFor(t *testing.T) {
+	for _, tc := range []struct{ pattern, user, want string }{
+		{"/data/{user}/export.zip", "alice", "/data/alice/export.zip"},
+		{"/data/export.zip", "default", "/data/export.zip"},
+		{"/data/export.zip", "alice", ""},
+	} {
+		if got := PathFor(tc.pattern, tc.user, "default"); got != tc.want {
+			t.Errorf("PathFor(%q, %q) = %q; want %q", tc.pattern, tc.user, got, tc.want)
+		}
+	}
+}
+
+func sameInt(a, b *int) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
@@ -0,0 +1,102 @@
+package recovery
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// Source kinds accepted by NewSource.
+const (
+	SourceGarmin      = "garmin"
+	SourceAppleHealth = "apple_health"
+	SourceCSV         = "csv"
+)
+
+// fullNightSeconds is the sleep duration that maps to a sleep score of 100
+// for sources that only report duration.
+const fullNightSeconds = 8 * 60 * 60
+
+// Source loads daily recovery signals from a device or app export. Loaded
+// series are normalized so every source fills the same 0–100 sleep score and
+// body battery scales the analyzer expects.
+type Source interface {
+	Name() string
+	Load() (*Series, error)
+}
+
+// UserPlaceholder in an export path stands for the user the export belongs
+// to, e.g. /data/recovery/{user}.zip.
+const UserPlaceholder = "{user}"
+
+// PathFor returns the path of user's export under pattern: pattern with
+// UserPlaceholder replaced by user, or, when pattern has no placeholder and
+// so names one person's export, pattern for owner and "" for anyone else.
+func PathFor(pattern, user, owner string) string {
+	if !strings.Contains(pattern, UserPlaceholder) {
+		if user != owner {
+			return ""
+		}
+		return pattern
+	}
+	return strings.ReplaceAll(pattern, UserPlaceholder, user)
+}
+
+// NewSource returns the importer for kind reading from path.
+func NewSource(kind, path string) (Source, error) {
+	if strings.TrimSpace(path) == "" {
+		return nil, fmt.Errorf("recovery source %q: path not set", kind)
+	}
+	switch strings.ToLower(strings.TrimSpace(kind)) {
+	case SourceGarmin, "":
+		return GarminExport{Path: path}, nil
+	case SourceAppleHealth:
+		return AppleHealthExport{Path: path}, nil
+	case SourceCSV:
+		return CSVExport{Path: path}, nil
+	default:
+		return nil, fmt.Errorf("unknown recovery source %q", kind)
+	}
+}
+
+// GarminExport is a Garmin Connect data export (.zip or extracted directory).
+type GarminExport struct {
+	Path string
+}
+
+func (g GarminExport) Name() string { return SourceGarmin }
+
+func (g GarminExport) Load() (*Series, error) {
+	s, err := ParseGarminExport(g.Path)
+	if err != nil {
+		return nil, err
+	}
+	s.Normalize()
+	return s, nil
+}
+
+// Normalize derives the 0–100 scores a source did not report itself:
+// sleep score from sleep duration, and body battery from readiness.
+func (s *Series) Normalize() {
+	for date, d := range s.days {
+		if d.SleepScore == nil && d.SleepSeconds != nil {
+			v := SleepScoreFromDuration(*d.SleepSeconds)
+			d.SleepScore = &v
+		}
+		if d.BodyBattery == nil && d.Readiness != nil {
+			v := clampScore(float64(*d.Readiness))
+			d.BodyBattery = &v
+		}
+		s.days[date] = d
+	}
+}
+
+// SleepScoreFromDuration maps total sleep linearly onto 0–100, with eight
+// hours or more scoring 100.
+func SleepScoreFromDuration(seconds int) int {
+	return clampScore(float64(seconds) / fullNightSeconds * 100)
+}
+
+func clampScore(f float64) int {
+	return int(math.Max(0, math.Min(100, math.Round(f))))
+}
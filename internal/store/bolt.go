@@ -0,0 +1,577 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	bucketMeta       = []byte("meta")
+	bucketWorkouts   = []byte("workouts")
+	bucketSets       = []byte("sets")
+	bucketExercises  = []byte("exercises")
+	bucketActivities = []byte("activities")
+	bucketUsage      = []byte("usage")
+	bucketAPIKeys    = []byte("api_keys")
+	bucketTokens     = []byte("strava_tokens")
+	bucketLocations  = []byte("locations")
+
+	keySchemaVersion = []byte("schema_version")
+)
+
+// migration upgrades the on-disk layout by one version. Migrations run in
+// order inside a single transaction each and are never edited once shipped.
+type migration struct {
+	version int
+	name    string
+	up      func(tx *bolt.Tx) error
+}
+
+var migrations = []migration{
+	{1, "create buckets", func(tx *bolt.Tx) error {
+		for _, b := range [][]byte{bucketWorkouts, bucketSets, bucketExercises, bucketActivities} {
+			if _, err := tx.CreateBucketIfNotExists(b); err != nil {
+				return err
+			}
+		}
+		return nil
+	}},
+	{2, "create usage bucket", func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(bucketUsage)
+		return err
+	}},
+	{3, "scope records by user", func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{bucketWorkouts, bucketSets, bucketActivities} {
+			if err := prefixKeys(tx.Bucket(name), DefaultUser+"/"); err != nil {
+				return err
+			}
+		}
+		_, err := tx.CreateBucketIfNotExists(bucketAPIKeys)
+		return err
+	}},
+	{4, "create strava token and location buckets", func(tx *bolt.Tx) error {
+		for _, b := range [][]byte{bucketTokens, bucketLocations} {
+			if _, err := tx.CreateBucketIfNotExists(b); err != nil {
+				return err
+			}
+		}
+		return nil
+	}},
+}
+
+// prefixKeys moves every record in bk under prefix. Keys are collected first
+// because bbolt cursors are invalidated by writes.
+func prefixKeys(bk *bolt.Bucket, prefix string) error {
+	type kv struct{ k, v []byte }
+	var all []kv
+	err := bk.ForEach(func(k, v []byte) error {
+		all = append(all, kv{bytes.Clone(k), bytes.Clone(v)})
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, r := range all {
+		if err := bk.Delete(r.k); err != nil {
+			return err
+		}
+		if err := bk.Put(append([]byte(prefix), r.k...), r.v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Bolt is a Store backed by an embedded bbolt file. Records are stored as
+// JSON. Per-user records are keyed "<user>/<id>" so a user's records are
+// contiguous, and sets "<user>/<workout_id>/<set_id>" so a workout's are.
+type Bolt struct {
+	db *bolt.DB
+}
+
+// OpenBolt opens (creating if needed) the database at path and applies any
+// pending migrations.
+func OpenBolt(path string) (*Bolt, error) {
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: 2 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("open store %s: %w", path, err)
+	}
+	b := &Bolt{db: db}
+	if err := b.migrate(); err != nil {
+		db.Close() //nolint:errcheck
+		return nil, err
+	}
+	return b, nil
+}
+
+// SchemaVersion reports the applied migration version.
+func (b *Bolt) SchemaVersion() (int, error) {
+	var v int
+	err := b.db.View(func(tx *bolt.Tx) error {
+		v = schemaVersion(tx)
+		return nil
+	})
+	return v, err
+}
+
+func schemaVersion(tx *bolt.Tx) int {
+	meta := tx.Bucket(bucketMeta)
+	if meta == nil {
+		return 0
+	}
+	raw := meta.Get(keySchemaVersion)
+	if len(raw) != 8 {
+		return 0
+	}
+	return int(binary.BigEndian.Uint64(raw))
+}
+
+func (b *Bolt) migrate() error {
+	for _, m := range migrations {
+		err := b.db.Update(func(tx *bolt.Tx) error {
+			if schemaVersion(tx) >= m.version {
+				return nil
+			}
+			if err := m.up(tx); err != nil {
+				return err
+			}
+			meta, err := tx.CreateBucketIfNotExists(bucketMeta)
+			if err != nil {
+				return err
+			}
+			v := make([]byte, 8)
+			binary.BigEndian.PutUint64(v, uint64(m.version))
+			return meta.Put(keySchemaVersion, v)
+		})
+		if err != nil {
+			return fmt.Errorf("store migration %d (%s): %w", m.version, m.name, err)
+		}
+	}
+	return nil
+}
+
+func putJSON(bk *bolt.Bucket, key string, v any) error {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return bk.Put([]byte(key), raw)
+}
+
+// forEachPrefix calls fn for each record whose key starts with prefix.
+func forEachPrefix(bk *bolt.Bucket, prefix string, fn func(raw []byte) error) error {
+	p := []byte(prefix)
+	c := bk.Cursor()
+	for k, v := c.Seek(p); k != nil && bytes.HasPrefix(k, p); k, v = c.Next() {
+		if err := fn(v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (b *Bolt) PutWorkout(ctx context.Context, w Workout) error {
+	if err := validateWorkout(w); err != nil {
+		return err
+	}
+	return b.db.Update(func(tx *bolt.Tx) error {
+		return putJSON(tx.Bucket(bucketWorkouts), scoped(ctx, w.ID), w)
+	})
+}
+
+func (b *Bolt) CreateWorkout(ctx context.Context, w Workout, stamp func(*Workout) error) (Workout, error) {
+	err := b.db.Update(func(tx *bolt.Tx) error {
+		wb := tx.Bucket(bucketWorkouts)
+		wid, err := reserveWorkoutID(w.Date, w.Location, w.Seed, func(id string) (Workout, error) {
+			var got Workout
+			raw := wb.Get([]byte(scoped(ctx, id)))
+			if raw == nil {
+				return got, ErrNotFound
+			}
+			return got, json.Unmarshal(raw, &got)
+		})
+		if err != nil {
+			return err
+		}
+		w.ID = wid
+		if err := stamp(&w); err != nil {
+			return err
+		}
+		return putJSON(wb, scoped(ctx, w.ID), w)
+	})
+	if err != nil {
+		return Workout{}, err
+	}
+	return w, nil
+}
+
+func (b *Bolt) GetWorkout(ctx context.Context, id string) (Workout, error) {
+	var w Workout
+	err := b.db.View(func(tx *bolt.Tx) error {
+		raw := tx.Bucket(bucketWorkouts).Get([]byte(scoped(ctx, id)))
+		if raw == nil {
+			return ErrNotFound
+		}
+		return json.Unmarshal(raw, &w)
+	})
+	return w, err
+}
+
+// ListWorkouts walks the user's keys backwards. Keys are "<user>/<id>" and
+// IDs begin with the session date, so the walk is newest first: it starts at
+// the cursor (or the To bound), stops at From and ends once a page is full.
+func (b *Bolt) ListWorkouts(ctx context.Context, f WorkoutFilter) ([]Workout, error) {
+	prefix := userPrefix(ctx)
+	start := prefix + "\xff"
+	switch {
+	case f.Before != "":
+		start = prefix + f.Before
+	case f.To != "":
+		start = prefix + f.To + "\xff"
+	}
+	out := []Workout{}
+	err := b.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(bucketWorkouts).Cursor()
+		k, v := c.Seek([]byte(start))
+		if k == nil {
+			k, v = c.Last()
+		} else {
+			k, v = c.Prev()
+		}
+		for ; k != nil && bytes.HasPrefix(k, []byte(prefix)); k, v = c.Prev() {
+			if f.From != "" && string(k[len(prefix):]) < f.From {
+				return nil
+			}
+			var w Workout
+			if err := json.Unmarshal(v, &w); err != nil {
+				return err
+			}
+			if !f.match(w) {
+				continue
+			}
+			out = append(out, w)
+			if f.Limit > 0 && len(out) == f.Limit {
+				return nil
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (b *Bolt) DeleteWorkout(ctx context.Context, id string) error {
+	key := scoped(ctx, id)
+	return b.db.Update(func(tx *bolt.Tx) error {
+		wb := tx.Bucket(bucketWorkouts)
+		if wb.Get([]byte(key)) == nil {
+			return ErrNotFound
+		}
+		if err := wb.Delete([]byte(key)); err != nil {
+			return err
+		}
+		return deleteSets(tx.Bucket(bucketSets), key)
+	})
+}
+
+// deleteSets removes the sets of the workout stored under key.
+func deleteSets(sb *bolt.Bucket, key string) error {
+	prefix := []byte(key + "/")
+	c := sb.Cursor()
+	for k, _ := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, _ = c.Seek(prefix) {
+		if err := sb.Delete(k); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (b *Bolt) PutSets(ctx context.Context, workoutID string, sets []LoggedSet) error {
+	if workoutID == "" {
+		return errors.New("store: workout id required")
+	}
+	key := scoped(ctx, workoutID)
+	return b.db.Update(func(tx *bolt.Tx) error {
+		sb := tx.Bucket(bucketSets)
+		if err := deleteSets(sb, key); err != nil {
+			return err
+		}
+		for _, s := range sets {
+			s.WorkoutID = workoutID
+			if err := putJSON(sb, key+"/"+s.SetID, s); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (b *Bolt) ListSets(ctx context.Context, f SetFilter) ([]LoggedSet, error) {
+	out := []LoggedSet{}
+	err := b.db.View(func(tx *bolt.Tx) error {
+		return forEachPrefix(tx.Bucket(bucketSets), userPrefix(ctx), func(raw []byte) error {
+			var s LoggedSet
+			if err := json.Unmarshal(raw, &s); err != nil {
+				return err
+			}
+			if f.match(s) {
+				out = append(out, s)
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	sortSets(out)
+	return out, nil
+}
+
+func (b *Bolt) PutExercise(_ context.Context, e Exercise) error {
+	if e.Slug == "" {
+		return errors.New("store: exercise slug required")
+	}
+	return b.db.Update(func(tx *bolt.Tx) error {
+		return putJSON(tx.Bucket(bucketExercises), e.Slug, e)
+	})
+}
+
+func (b *Bolt) ListExercises(_ context.Context) ([]Exercise, error) {
+	out := []Exercise{}
+	err := b.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketExercises).ForEach(func(_, raw []byte) error {
+			var e Exercise
+			if err := json.Unmarshal(raw, &e); err != nil {
+				return err
+			}
+			out = append(out, e)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	sortExercises(out)
+	return out, nil
+}
+
+func (b *Bolt) PutActivities(ctx context.Context, acts []Activity) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		ab := tx.Bucket(bucketActivities)
+		for _, a := range acts {
+			if err := putJSON(ab, scoped(ctx, activityKey(a)), a); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (b *Bolt) ListActivities(ctx context.Context, f ActivityFilter) ([]Activity, error) {
+	out := []Activity{}
+	err := b.db.View(func(tx *bolt.Tx) error {
+		return forEachPrefix(tx.Bucket(bucketActivities), userPrefix(ctx), func(raw []byte) error {
+			var a Activity
+			if err := json.Unmarshal(raw, &a); err != nil {
+				return err
+			}
+			if f.match(a) {
+				out = append(out, a)
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	sortActivities(out)
+	return out, nil
+}
+
+// AddUsage reads, adds to and rewrites the rollup in one transaction, so
+// concurrent requests do not lose counts.
+func (b *Bolt) AddUsage(_ context.Context, u Usage) error {
+	if err := validateUsage(u); err != nil {
+		return err
+	}
+	return b.db.Update(func(tx *bolt.Tx) error {
+		ub := tx.Bucket(bucketUsage)
+		key := usageKey(u)
+		cur := Usage{Date: u.Date, User: u.User, Model: u.Model}
+		if raw := ub.Get([]byte(key)); raw != nil {
+			if err := json.Unmarshal(raw, &cur); err != nil {
+				return err
+			}
+		}
+		cur.Add(u)
+		return putJSON(ub, key, cur)
+	})
+}
+
+func (b *Bolt) ListUsage(_ context.Context, f UsageFilter) ([]Usage, error) {
+	out := []Usage{}
+	err := b.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketUsage).ForEach(func(_, raw []byte) error {
+			var u Usage
+			if err := json.Unmarshal(raw, &u); err != nil {
+				return err
+			}
+			if f.match(u) {
+				out = append(out, u)
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	sortUsage(out)
+	return out, nil
+}
+
+// stravaTokenKey is the one key under a user's prefix in the token bucket.
+const stravaTokenKey = "strava"
+
+func (b *Bolt) PutStravaToken(ctx context.Context, t StravaToken) error {
+	if err := validateStravaToken(t); err != nil {
+		return err
+	}
+	return b.db.Update(func(tx *bolt.Tx) error {
+		return putJSON(tx.Bucket(bucketTokens), scoped(ctx, stravaTokenKey), t)
+	})
+}
+
+func (b *Bolt) GetStravaToken(ctx context.Context) (StravaToken, error) {
+	var t StravaToken
+	err := b.db.View(func(tx *bolt.Tx) error {
+		raw := tx.Bucket(bucketTokens).Get([]byte(scoped(ctx, stravaTokenKey)))
+		if raw == nil {
+			return ErrNotFound
+		}
+		return json.Unmarshal(raw, &t)
+	})
+	return t, err
+}
+
+func (b *Bolt) DeleteStravaToken(ctx context.Context) error {
+	key := []byte(scoped(ctx, stravaTokenKey))
+	return b.db.Update(func(tx *bolt.Tx) error {
+		bk := tx.Bucket(bucketTokens)
+		if bk.Get(key) == nil {
+			return ErrNotFound
+		}
+		return bk.Delete(key)
+	})
+}
+
+func (b *Bolt) PutLocation(ctx context.Context, l LocationProfile) error {
+	if err := validateLocation(l); err != nil {
+		return err
+	}
+	return b.db.Update(func(tx *bolt.Tx) error {
+		return putJSON(tx.Bucket(bucketLocations), scoped(ctx, locationKey(l.Name)), l)
+	})
+}
+
+func (b *Bolt) GetLocation(ctx context.Context, name string) (LocationProfile, error) {
+	var l LocationProfile
+	err := b.db.View(func(tx *bolt.Tx) error {
+		raw := tx.Bucket(bucketLocations).Get([]byte(scoped(ctx, locationKey(name))))
+		if raw == nil {
+			return ErrNotFound
+		}
+		return json.Unmarshal(raw, &l)
+	})
+	return l, err
+}
+
+func (b *Bolt) ListLocations(ctx context.Context) ([]LocationProfile, error) {
+	out := []LocationProfile{}
+	err := b.db.View(func(tx *bolt.Tx) error {
+		return forEachPrefix(tx.Bucket(bucketLocations), userPrefix(ctx), func(raw []byte) error {
+			var l LocationProfile
+			if err := json.Unmarshal(raw, &l); err != nil {
+				return err
+			}
+			out = append(out, l)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	sortLocations(out)
+	return out, nil
+}
+
+func (b *Bolt) DeleteLocation(ctx context.Context, name string) error {
+	key := []byte(scoped(ctx, locationKey(name)))
+	return b.db.Update(func(tx *bolt.Tx) error {
+		bk := tx.Bucket(bucketLocations)
+		if bk.Get(key) == nil {
+			return ErrNotFound
+		}
+		return bk.Delete(key)
+	})
+}
+
+func (b *Bolt) PutAPIKey(_ context.Context, k APIKey) error {
+	if err := validateAPIKey(k); err != nil {
+		return err
+	}
+	return b.db.Update(func(tx *bolt.Tx) error {
+		return putJSON(tx.Bucket(bucketAPIKeys), k.ID, k)
+	})
+}
+
+func (b *Bolt) GetAPIKey(_ context.Context, id string) (APIKey, error) {
+	var k APIKey
+	err := b.db.View(func(tx *bolt.Tx) error {
+		raw := tx.Bucket(bucketAPIKeys).Get([]byte(id))
+		if raw == nil {
+			return ErrNotFound
+		}
+		return json.Unmarshal(raw, &k)
+	})
+	return k, err
+}
+
+func (b *Bolt) ListAPIKeys(_ context.Context) ([]APIKey, error) {
+	out := []APIKey{}
+	err := b.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketAPIKeys).ForEach(func(_, raw []byte) error {
+			var k APIKey
+			if err := json.Unmarshal(raw, &k); err != nil {
+				return err
+			}
+			out = append(out, k)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	sortAPIKeys(out)
+	return out, nil
+}
+
+// Ping runs a read transaction, which fails once the file is closed.
+func (b *Bolt) Ping(context.Context) error {
+	return b.db.View(func(tx *bolt.Tx) error {
+		if schemaVersion(tx) == 0 {
+			return errors.New("store: schema not initialized")
+		}
+		return nil
+	})
+}
+
+func (b *Bolt) Close() error { return b.db.Close() }
@@ -0,0 +1,329 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+)
+
+// Memory is an in-process Store for tests and single-run tools. Records are
+// copied in and out so callers cannot mutate stored state. Per-user records
+// are keyed "<user>/<id>" as in Bolt.
+type Memory struct {
+	mu         sync.RWMutex
+	workouts   map[string]Workout
+	sets       map[string][]LoggedSet
+	exercises  map[string]Exercise
+	activities map[string]Activity
+	usage      map[string]Usage
+	keys       map[string]APIKey
+	tokens     map[string]StravaToken
+	locations  map[string]LocationProfile
+}
+
+func NewMemory() *Memory {
+	return &Memory{
+		workouts:   map[string]Workout{},
+		sets:       map[string][]LoggedSet{},
+		exercises:  map[string]Exercise{},
+		activities: map[string]Activity{},
+		usage:      map[string]Usage{},
+		keys:       map[string]APIKey{},
+		tokens:     map[string]StravaToken{},
+		locations:  map[string]LocationProfile{},
+	}
+}
+
+func (m *Memory) PutWorkout(ctx context.Context, w Workout) error {
+	if err := validateWorkout(w); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	w.YAML = append([]byte(nil), w.YAML...)
+	m.workouts[scoped(ctx, w.ID)] = w
+	return nil
+}
+
+func (m *Memory) CreateWorkout(ctx context.Context, w Workout, stamp func(*Workout) error) (Workout, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	wid, err := reserveWorkoutID(w.Date, w.Location, w.Seed, func(id string) (Workout, error) {
+		got, ok := m.workouts[scoped(ctx, id)]
+		if !ok {
+			return Workout{}, ErrNotFound
+		}
+		return got, nil
+	})
+	if err != nil {
+		return Workout{}, err
+	}
+	w.ID = wid
+	if err := stamp(&w); err != nil {
+		return Workout{}, err
+	}
+	w.YAML = append([]byte(nil), w.YAML...)
+	m.workouts[scoped(ctx, w.ID)] = w
+	return w, nil
+}
+
+func (m *Memory) GetWorkout(ctx context.Context, id string) (Workout, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	w, ok := m.workouts[scoped(ctx, id)]
+	if !ok {
+		return Workout{}, ErrNotFound
+	}
+	w.YAML = append([]byte(nil), w.YAML...)
+	return w, nil
+}
+
+func (m *Memory) ListWorkouts(ctx context.Context, f WorkoutFilter) ([]Workout, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	prefix := userPrefix(ctx)
+	out := []Workout{}
+	for k, w := range m.workouts {
+		if strings.HasPrefix(k, prefix) && f.match(w) && (f.Before == "" || w.ID < f.Before) {
+			out = append(out, w)
+		}
+	}
+	sortWorkouts(out)
+	if f.Limit > 0 && len(out) > f.Limit {
+		out = out[:f.Limit]
+	}
+	return out, nil
+}
+
+func (m *Memory) DeleteWorkout(ctx context.Context, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	key := scoped(ctx, id)
+	if _, ok := m.workouts[key]; !ok {
+		return ErrNotFound
+	}
+	delete(m.workouts, key)
+	delete(m.sets, key)
+	return nil
+}
+
+func (m *Memory) PutSets(ctx context.Context, workoutID string, sets []LoggedSet) error {
+	if workoutID == "" {
+		return errors.New("store: workout id required")
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	cp := make([]LoggedSet, len(sets))
+	for i, s := range sets {
+		s.WorkoutID = workoutID
+		cp[i] = s
+	}
+	m.sets[scoped(ctx, workoutID)] = cp
+	return nil
+}
+
+func (m *Memory) ListSets(ctx context.Context, f SetFilter) ([]LoggedSet, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	prefix := userPrefix(ctx)
+	out := []LoggedSet{}
+	for k, ss := range m.sets {
+		if !strings.HasPrefix(k, prefix) {
+			continue
+		}
+		for _, s := range ss {
+			if f.match(s) {
+				out = append(out, s)
+			}
+		}
+	}
+	sortSets(out)
+	return out, nil
+}
+
+func (m *Memory) PutExercise(_ context.Context, e Exercise) error {
+	if e.Slug == "" {
+		return errors.New("store: exercise slug required")
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.exercises[e.Slug] = e
+	return nil
+}
+
+func (m *Memory) ListExercises(_ context.Context) ([]Exercise, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	out := make([]Exercise, 0, len(m.exercises))
+	for _, e := range m.exercises {
+		out = append(out, e)
+	}
+	sortExercises(out)
+	return out, nil
+}
+
+func (m *Memory) PutActivities(ctx context.Context, acts []Activity) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, a := range acts {
+		m.activities[scoped(ctx, activityKey(a))] = a
+	}
+	return nil
+}
+
+func (m *Memory) ListActivities(ctx context.Context, f ActivityFilter) ([]Activity, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	prefix := userPrefix(ctx)
+	out := []Activity{}
+	for k, a := range m.activities {
+		if strings.HasPrefix(k, prefix) && f.match(a) {
+			out = append(out, a)
+		}
+	}
+	sortActivities(out)
+	return out, nil
+}
+
+func (m *Memory) AddUsage(_ context.Context, u Usage) error {
+	if err := validateUsage(u); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	key := usageKey(u)
+	cur, ok := m.usage[key]
+	if !ok {
+		cur = Usage{Date: u.Date, User: u.User, Model: u.Model}
+	}
+	cur.Add(u)
+	m.usage[key] = cur
+	return nil
+}
+
+func (m *Memory) ListUsage(_ context.Context, f UsageFilter) ([]Usage, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	out := []Usage{}
+	for _, u := range m.usage {
+		if f.match(u) {
+			out = append(out, u)
+		}
+	}
+	sortUsage(out)
+	return out, nil
+}
+
+func (m *Memory) PutStravaToken(ctx context.Context, t StravaToken) error {
+	if err := validateStravaToken(t); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.tokens[UserFrom(ctx)] = t
+	return nil
+}
+
+func (m *Memory) GetStravaToken(ctx context.Context) (StravaToken, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	t, ok := m.tokens[UserFrom(ctx)]
+	if !ok {
+		return StravaToken{}, ErrNotFound
+	}
+	return t, nil
+}
+
+func (m *Memory) DeleteStravaToken(ctx context.Context) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.tokens[UserFrom(ctx)]; !ok {
+		return ErrNotFound
+	}
+	delete(m.tokens, UserFrom(ctx))
+	return nil
+}
+
+func (m *Memory) PutLocation(ctx context.Context, l LocationProfile) error {
+	if err := validateLocation(l); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	l.Equipment = append([]string(nil), l.Equipment...)
+	m.locations[scoped(ctx, locationKey(l.Name))] = l
+	return nil
+}
+
+func (m *Memory) GetLocation(ctx context.Context, name string) (LocationProfile, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	l, ok := m.locations[scoped(ctx, locationKey(name))]
+	if !ok {
+		return LocationProfile{}, ErrNotFound
+	}
+	l.Equipment = append([]string(nil), l.Equipment...)
+	return l, nil
+}
+
+func (m *Memory) ListLocations(ctx context.Context) ([]LocationProfile, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	prefix := userPrefix(ctx)
+	out := []LocationProfile{}
+	for k, l := range m.locations {
+		if strings.HasPrefix(k, prefix) {
+			l.Equipment = append([]string(nil), l.Equipment...)
+			out = append(out, l)
+		}
+	}
+	sortLocations(out)
+	return out, nil
+}
+
+func (m *Memory) DeleteLocation(ctx context.Context, name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	key := scoped(ctx, locationKey(name))
+	if _, ok := m.locations[key]; !ok {
+		return ErrNotFound
+	}
+	delete(m.locations, key)
+	return nil
+}
+
+func (m *Memory) PutAPIKey(_ context.Context, k APIKey) error {
+	if err := validateAPIKey(k); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.keys[k.ID] = k
+	return nil
+}
+
+func (m *Memory) GetAPIKey(_ context.Context, id string) (APIKey, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	k, ok := m.keys[id]
+	if !ok {
+		return APIKey{}, ErrNotFound
+	}
+	return k, nil
+}
+
+func (m *Memory) ListAPIKeys(_ context.Context) ([]APIKey, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	out := make([]APIKey, 0, len(m.keys))
+	for _, k := range m.keys {
+		out = append(out, k)
+	}
+	sortAPIKeys(out)
+	return out, nil
+}
+
+func (m *Memory) Ping(context.Context) error { return nil }
+
+func (m *Memory) Close() error { return nil }
@@ -0,0 +1,388 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aaronromeo/swolegen/internal/id"
+	"github.com/aaronromeo/swolegen/internal/llm/schemas"
+)
+
+var (
+	// ErrNotFound is returned when a record does not exist.
+	ErrNotFound = errors.New("store: not found")
+	// ErrIDSpaceExhausted is returned when every NN suffix for a date and
+	// location is taken by other workouts.
+	ErrIDSpaceExhausted = errors.New("store: no free workout_id for date and location")
+)
+
+// Store persists generated workouts, logged sets, exercises and activities.
+// Workouts, sets, activities, Strava tokens and location profiles belong to
+// the user the call's context is scoped to (see WithUser); exercises are
+// shared. Implementations must be safe for concurrent use.
+type Store interface {
+	PutWorkout(ctx context.Context, w Workout) error
+	// CreateWorkout stores a new workout under the first free workout_id for
+	// its date, location and seed (see reserveWorkoutID). Choosing the ID and
+	// writing the workout happen in one step, so concurrent saves never take
+	// the same ID. stamp runs once w.ID is set, before the write.
+	CreateWorkout(ctx context.Context, w Workout, stamp func(*Workout) error) (Workout, error)
+	GetWorkout(ctx context.Context, id string) (Workout, error)
+	ListWorkouts(ctx context.Context, f WorkoutFilter) ([]Workout, error)
+	DeleteWorkout(ctx context.Context, id string) error
+
+	// PutSets replaces the logged sets recorded for a workout.
+	PutSets(ctx context.Context, workoutID string, sets []LoggedSet) error
+	ListSets(ctx context.Context, f SetFilter) ([]LoggedSet, error)
+
+	PutExercise(ctx context.Context, e Exercise) error
+	ListExercises(ctx context.Context) ([]Exercise, error)
+
+	PutActivities(ctx context.Context, acts []Activity) error
+	ListActivities(ctx context.Context, f ActivityFilter) ([]Activity, error)
+
+	// The context's user has at most one Strava token.
+	PutStravaToken(ctx context.Context, t StravaToken) error
+	GetStravaToken(ctx context.Context) (StravaToken, error)
+	DeleteStravaToken(ctx context.Context) error
+
+	// Location profiles are keyed by name, case-insensitively.
+	PutLocation(ctx context.Context, l LocationProfile) error
+	GetLocation(ctx context.Context, name string) (LocationProfile, error)
+	ListLocations(ctx context.Context) ([]LocationProfile, error)
+	DeleteLocation(ctx context.Context, name string) error
+
+	// AddUsage adds u's counters to the rollup for its date, user and model.
+	AddUsage(ctx context.Context, u Usage) error
+	ListUsage(ctx context.Context, f UsageFilter) ([]Usage, error)
+
+	// API keys are global: they are how a request's user is determined.
+	PutAPIKey(ctx context.Context, k APIKey) error
+	GetAPIKey(ctx context.Context, id string) (APIKey, error)
+	ListAPIKeys(ctx context.Context) ([]APIKey, error)
+
+	// Ping reports whether the store can serve requests.
+	Ping(ctx context.Context) error
+	Close() error
+}
+
+// Open returns a bbolt-backed store at path, or an in-memory store when path
+// is empty.
+func Open(path string) (Store, error) {
+	if strings.TrimSpace(path) == "" {
+		return NewMemory(), nil
+	}
+	return OpenBolt(path)
+}
+
+// reserveWorkoutID returns the workout_id to store a workout generated from
+// seed under, looking IDs up with get. The first free ID in
+// id.WorkoutIDAttempt order wins; an ID already held by a workout with the
+// same seed is reused, which makes regenerating the same inputs idempotent.
+func reserveWorkoutID(date, location, seed string, get func(id string) (Workout, error)) (string, error) {
+	for attempt := 0; attempt < 100; attempt++ {
+		wid := id.WorkoutIDAttempt(date, location, []byte(seed), attempt)
+		w, err := get(wid)
+		if errors.Is(err, ErrNotFound) {
+			return wid, nil
+		}
+		if err != nil {
+			return "", err
+		}
+		if w.Seed == seed {
+			return wid, nil
+		}
+	}
+	return "", ErrIDSpaceExhausted
+}
+
+// Workout is a generated session: the workout YAML plus the analyzer plan
+// that produced it and enough provenance to reproduce or compare it.
+type Workout struct {
+	ID          string                  `json:"id"`
+	Date        string                  `json:"date"`
+	Location    string                  `json:"location"`
+	SessionType string                  `json:"session_type"`
+	YAML        []byte                  `json:"yaml"`
+	Plan        *schemas.AnalyzerV1Json `json:"plan,omitempty"`
+	CreatedAt   time.Time               `json:"created_at"`
+
+	// Seed is the canonical id.Seed the workout_id was derived from.
+	Seed string `json:"seed,omitempty"`
+	// InputsHash identifies the generator inputs the workout was built from.
+	InputsHash    string `json:"inputs_hash,omitempty"`
+	Provider      string `json:"provider,omitempty"`
+	Model         string `json:"model,omitempty"`
+	PromptVersion string `json:"prompt_version,omitempty"`
+}
+
+// LoggedSet is one performed set, as filled in by the user on a workout.
+type LoggedSet struct {
+	WorkoutID    string   `json:"workout_id"`
+	SetID        string   `json:"set_id"`
+	Date         string   `json:"date"`
+	Exercise     string   `json:"exercise"`
+	Tier         string   `json:"tier"`
+	Units        string   `json:"units"`
+	TargetReps   string   `json:"target_reps,omitempty"`
+	TargetWeight *float64 `json:"target_weight,omitempty"`
+	ActualWeight *float64 `json:"actual_weight,omitempty"`
+	ActualReps   *int     `json:"actual_reps,omitempty"`
+	RIR          *int     `json:"rir,omitempty"`
+	Notes        string   `json:"notes,omitempty"`
+}
+
+// Exercise is a known movement keyed by its set-ID slug.
+type Exercise struct {
+	Slug      string   `json:"slug"`
+	Name      string   `json:"name"`
+	Equipment []string `json:"equipment,omitempty"`
+}
+
+// Activity is a cardio or training activity imported from an external
+// service such as Strava.
+type Activity struct {
+	Source         string  `json:"source"`
+	ID             string  `json:"id"`
+	Name           string  `json:"name"`
+	Type           string  `json:"type"`
+	Start          string  `json:"start_date"`
+	ElapsedSeconds int     `json:"elapsed_seconds"`
+	Effort         float64 `json:"effort"`
+}
+
+// Usage is LLM spend rolled up per day, user and model. Requests counts the
+// API requests whose first completion used the model, so summing a day's
+// rollups counts each request once.
+type Usage struct {
+	Date             string  `json:"date"`
+	User             string  `json:"user,omitempty"`
+	Model            string  `json:"model"`
+	Requests         int     `json:"requests"`
+	Calls            int     `json:"calls"`
+	Repairs          int     `json:"repairs"`
+	Failed           int     `json:"failed"`
+	PromptTokens     int64   `json:"prompt_tokens"`
+	CompletionTokens int64   `json:"completion_tokens"`
+	CostUSD          float64 `json:"cost_usd"`
+}
+
+// Add accumulates o's counters into u.
+func (u *Usage) Add(o Usage) {
+	u.Requests += o.Requests
+	u.Calls += o.Calls
+	u.Repairs += o.Repairs
+	u.Failed += o.Failed
+	u.PromptTokens += o.PromptTokens
+	u.CompletionTokens += o.CompletionTokens
+	u.CostUSD += o.CostUSD
+}
+
+// StravaToken is a user's Strava OAuth token, kept so the server can fetch
+// their activities and refresh it for them.
+type StravaToken struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresAt    int64  `json:"expires_at"` // unix seconds
+	Scope        string `json:"scope,omitempty"`
+}
+
+// LocationProfile is a named place a user trains at and the equipment there,
+// e.g. "home" or "gym:downtown".
+type LocationProfile struct {
+	Name      string    `json:"name"`
+	Equipment []string  `json:"equipment"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// APIKey authenticates requests as User. Only a hash of the secret is
+// stored; ID is the public part of the key, used to find it.
+type APIKey struct {
+	ID        string     `json:"id"`
+	User      string     `json:"user"`
+	Name      string     `json:"name,omitempty"`
+	Admin     bool       `json:"admin,omitempty"`
+	Hash      string     `json:"hash"`
+	CreatedAt time.Time  `json:"created_at"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+}
+
+// Revoked reports whether the key has been revoked.
+func (k APIKey) Revoked() bool { return k.RevokedAt != nil }
+
+// WorkoutFilter narrows ListWorkouts. Zero values match everything; dates
+// are inclusive YYYY-MM-DD bounds.
+type WorkoutFilter struct {
+	From        string
+	To          string
+	Location    string
+	SessionType string
+	// Before resumes a listing after the workout with this ID, the last one
+	// of the previous page.
+	Before string
+	// Limit caps the workouts returned; 0 returns every match.
+	Limit int
+}
+
+// SetFilter narrows ListSets.
+type SetFilter struct {
+	WorkoutID string
+	Exercise  string
+	From      string
+	To        string
+}
+
+// ActivityFilter narrows ListActivities by start date.
+type ActivityFilter struct {
+	From string
+	To   string
+}
+
+// UsageFilter narrows ListUsage by inclusive dates and user.
+type UsageFilter struct {
+	From string
+	To   string
+	User string
+}
+
+func (f UsageFilter) match(u Usage) bool {
+	return inRange(u.Date, f.From, f.To) && (f.User == "" || f.User == u.User)
+}
+
+func (f WorkoutFilter) match(w Workout) bool {
+	return inRange(w.Date, f.From, f.To) &&
+		(f.Location == "" || strings.EqualFold(f.Location, w.Location)) &&
+		(f.SessionType == "" || strings.EqualFold(f.SessionType, w.SessionType))
+}
+
+func (f SetFilter) match(s LoggedSet) bool {
+	return inRange(s.Date, f.From, f.To) &&
+		(f.WorkoutID == "" || f.WorkoutID == s.WorkoutID) &&
+		(f.Exercise == "" || strings.EqualFold(f.Exercise, s.Exercise))
+}
+
+func (f ActivityFilter) match(a Activity) bool {
+	return inRange(dateOf(a.Start), f.From, f.To)
+}
+
+// inRange compares ISO dates lexically, which orders them chronologically.
+func inRange(date, from, to string) bool {
+	return (from == "" || date >= from) && (to == "" || date <= to)
+}
+
+// dateOf trims an RFC 3339 timestamp to its date.
+func dateOf(ts string) string {
+	if len(ts) >= 10 {
+		return ts[:10]
+	}
+	return ts
+}
+
+// Listings are returned newest first so callers can paginate recent history.
+
+// sortWorkouts orders newest first. Workout IDs begin with the session date,
+// so descending ID order is date order and matches Bolt's key order.
+func sortWorkouts(ws []Workout) {
+	sort.SliceStable(ws, func(i, j int) bool { return ws[i].ID > ws[j].ID })
+}
+
+func sortSets(ss []LoggedSet) {
+	sort.SliceStable(ss, func(i, j int) bool {
+		if ss[i].Date != ss[j].Date {
+			return ss[i].Date > ss[j].Date
+		}
+		if ss[i].WorkoutID != ss[j].WorkoutID {
+			return ss[i].WorkoutID > ss[j].WorkoutID
+		}
+		return ss[i].SetID < ss[j].SetID
+	})
+}
+
+func sortActivities(as []Activity) {
+	sort.SliceStable(as, func(i, j int) bool { return as[i].Start > as[j].Start })
+}
+
+// Usage is listed oldest day first, for charting.
+func sortUsage(us []Usage) {
+	sort.SliceStable(us, func(i, j int) bool { return usageKey(us[i]) < usageKey(us[j]) })
+}
+
+func usageKey(u Usage) string {
+	return u.Date + "/" + u.User + "/" + u.Model
+}
+
+func sortAPIKeys(ks []APIKey) {
+	sort.SliceStable(ks, func(i, j int) bool {
+		if ks[i].User != ks[j].User {
+			return ks[i].User < ks[j].User
+		}
+		return ks[i].CreatedAt.Before(ks[j].CreatedAt)
+	})
+}
+
+func sortLocations(ls []LocationProfile) {
+	sort.SliceStable(ls, func(i, j int) bool { return locationKey(ls[i].Name) < locationKey(ls[j].Name) })
+}
+
+func locationKey(name string) string {
+	return strings.ToLower(strings.TrimSpace(name))
+}
+
+func sortExercises(es []Exercise) {
+	sort.SliceStable(es, func(i, j int) bool { return es[i].Slug < es[j].Slug })
+}
+
+// activityKey identifies an activity across imports; activities without a
+// source ID fall back to their start time.
+func activityKey(a Activity) string {
+	id := a.ID
+	if id == "" {
+		id = a.Start + "/" + a.Name
+	}
+	return a.Source + "/" + id
+}
+
+func validateAPIKey(k APIKey) error {
+	if k.ID == "" || k.Hash == "" {
+		return errors.New("store: api key id and hash required")
+	}
+	return ValidateUser(k.User)
+}
+
+func validateStravaToken(t StravaToken) error {
+	if t.AccessToken == "" {
+		return errors.New("store: strava access token required")
+	}
+	return nil
+}
+
+// ValidateLocationName rejects names that would break out of the user's keys.
+func ValidateLocationName(name string) error {
+	key := locationKey(name)
+	if key == "" || strings.Contains(key, "/") {
+		return fmt.Errorf("store: invalid location name %q", name)
+	}
+	return nil
+}
+
+func validateLocation(l LocationProfile) error {
+	return ValidateLocationName(l.Name)
+}
+
+func validateUsage(u Usage) error {
+	if u.Date == "" {
+		return errors.New("store: usage date required")
+	}
+	return nil
+}
+
+func validateWorkout(w Workout) error {
+	if strings.TrimSpace(w.ID) == "" {
+		return errors.New("store: workout id required")
+	}
+	return nil
+}
@@ -0,0 +1,441 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aaronromeo/swolegen/internal/id"
+	bolt "go.etcd.io/bbolt"
+)
+
+func TestMemory(t *testing.T) {
+	testStore(t, NewMemory())
+}
+
+func TestBolt(t *testing.T) {
+	b, err := OpenBolt(filepath.Join(t.TempDir(), "swolegen.db"))
+	if err != nil {
+		t.Fatalf("OpenBolt: %v", err)
+	}
+	t.Cleanup(func() { b.Close() }) //nolint:errcheck
+	testStore(t, b)
+}
+
+func TestBolt_MigrationsIdempotent(t *testing.T) {
+	p := filepath.Join(t.TempDir(), "swolegen.db")
+	b, err := OpenBolt(p)
+	if err != nil {
+		t.Fatalf("OpenBolt: %v", err)
+	}
+	ctx := context.Background()
+	if err := b.PutWorkout(ctx, Workout{ID: "2025-08-09-home-01", Date: "2025-08-09"}); err != nil {
+		t.Fatalf("PutWorkout: %v", err)
+	}
+	if err := b.Ping(ctx); err != nil {
+		t.Fatalf("Ping: %v", err)
+	}
+	if err := b.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if err := b.Ping(ctx); err == nil {
+		t.Fatalf("Ping succeeded on a closed store")
+	}
+
+	b, err = OpenBolt(p)
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	defer b.Close() //nolint:errcheck
+	v, err := b.SchemaVersion()
+	if err != nil {
+		t.Fatalf("SchemaVersion: %v", err)
+	}
+	if want := migrations[len(migrations)-1].version; v != want {
+		t.Fatalf("schema version = %d; want %d", v, want)
+	}
+	if _, err := b.GetWorkout(ctx, "2025-08-09-home-01"); err != nil {
+		t.Fatalf("workout lost across reopen: %v", err)
+	}
+}
+
+// TestBolt_ScopesLegacyRecords opens a schema 2 file, from before records
+// were scoped, and checks its data now belongs to DefaultUser.
+func TestBolt_ScopesLegacyRecords(t *testing.T) {
+	p := filepath.Join(t.TempDir(), "swolegen.db")
+	db, err := bolt.Open(p, 0o600, nil)
+	if err != nil {
+		t.Fatalf("bolt.Open: %v", err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, m := range migrations[:2] {
+			if err := m.up(tx); err != nil {
+				return err
+			}
+		}
+		meta, err := tx.CreateBucketIfNotExists(bucketMeta)
+		if err != nil {
+			return err
+		}
+		if err := meta.Put(keySchemaVersion, []byte{0, 0, 0, 0, 0, 0, 0, 2}); err != nil {
+			return err
+		}
+		if err := putJSON(tx.Bucket(bucketWorkouts), "2025-08-09-home-01", Workout{ID: "2025-08-09-home-01", Date: "2025-08-09"}); err != nil {
+			return err
+		}
+		return putJSON(tx.Bucket(bucketSets), "2025-08-09-home-01/s1", LoggedSet{WorkoutID: "2025-08-09-home-01", SetID: "s1"})
+	})
+	if err != nil {
+		t.Fatalf("seed v2 file: %v", err)
+	}
+	db.Close() //nolint:errcheck
+
+	b, err := OpenBolt(p)
+	if err != nil {
+		t.Fatalf("OpenBolt: %v", err)
+	}
+	defer b.Close() //nolint:errcheck
+	ctx := context.Background()
+	if _, err := b.GetWorkout(ctx, "2025-08-09-home-01"); err != nil {
+		t.Fatalf("legacy workout not visible to the default user: %v", err)
+	}
+	if ss, err := b.ListSets(ctx, SetFilter{}); err != nil || len(ss) != 1 {
+		t.Fatalf("legacy sets = %v, %v; want 1", ss, err)
+	}
+	if ws, err := b.ListWorkouts(WithUser(ctx, "alice"), WorkoutFilter{}); err != nil || len(ws) != 0 {
+		t.Fatalf("alice sees legacy workouts: %v, %v", ws, err)
+	}
+}
+
+func testStore(t *testing.T, s Store) {
+	t.Helper()
+	ctx := context.Background()
+	now := time.Date(2025, 8, 9, 12, 0, 0, 0, time.UTC)
+
+	workouts := []Workout{
+		{ID: "2025-08-07-home-11", Date: "2025-08-07", Location: "home", SessionType: "pull", YAML: []byte("a: 1\n"), CreatedAt: now},
+		{ID: "2025-08-08-gym-downtown-22", Date: "2025-08-08", Location: "gym:downtown", SessionType: "push", CreatedAt: now},
+		{ID: "2025-08-09-home-33", Date: "2025-08-09", Location: "home", SessionType: "lower", CreatedAt: now},
+	}
+	for _, w := range workouts {
+		if err := s.PutWorkout(ctx, w); err != nil {
+			t.Fatalf("PutWorkout(%s): %v", w.ID, err)
+		}
+	}
+	if err := s.PutWorkout(ctx, Workout{}); err == nil {
+		t.Fatalf("expected error for empty workout id")
+	}
+
+	got, err := s.GetWorkout(ctx, "2025-08-07-home-11")
+	if err != nil {
+		t.Fatalf("GetWorkout: %v", err)
+	}
+	if string(got.YAML) != "a: 1\n" || !got.CreatedAt.Equal(now) {
+		t.Fatalf("round trip mismatch: %+v", got)
+	}
+	if _, err := s.GetWorkout(ctx, "missing"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("GetWorkout(missing) err = %v; want ErrNotFound", err)
+	}
+
+	list, err := s.ListWorkouts(ctx, WorkoutFilter{Location: "home"})
+	if err != nil {
+		t.Fatalf("ListWorkouts: %v", err)
+	}
+	if len(list) != 2 || list[0].ID != "2025-08-09-home-33" {
+		t.Fatalf("ListWorkouts(home) = %+v; want newest-first home workouts", list)
+	}
+	list, err = s.ListWorkouts(ctx, WorkoutFilter{From: "2025-08-08", To: "2025-08-08"})
+	if err != nil {
+		t.Fatalf("ListWorkouts: %v", err)
+	}
+	if len(list) != 1 || list[0].SessionType != "push" {
+		t.Fatalf("ListWorkouts(date range) = %+v", list)
+	}
+	var pages []string
+	for before := ""; ; {
+		page, err := s.ListWorkouts(ctx, WorkoutFilter{Before: before, Limit: 2})
+		if err != nil {
+			t.Fatalf("ListWorkouts(page): %v", err)
+		}
+		if len(page) == 0 {
+			break
+		}
+		for _, w := range page {
+			pages = append(pages, w.ID)
+		}
+		before = page[len(page)-1].ID
+	}
+	if want := "2025-08-09-home-33,2025-08-08-gym-downtown-22,2025-08-07-home-11"; strings.Join(pages, ",") != want {
+		t.Fatalf("paged ListWorkouts = %v; want %s", pages, want)
+	}
+
+	reps := 10
+	sets := []LoggedSet{
+		{SetID: "A-RDL-1", Date: "2025-08-09", Exercise: "RDL", ActualReps: &reps},
+		{SetID: "A-RDL-2", Date: "2025-08-09", Exercise: "RDL"},
+	}
+	if err := s.PutSets(ctx, "2025-08-09-home-33", sets); err != nil {
+		t.Fatalf("PutSets: %v", err)
+	}
+	// Replacing a workout's sets drops the old ones.
+	if err := s.PutSets(ctx, "2025-08-09-home-33", sets[:1]); err != nil {
+		t.Fatalf("PutSets(replace): %v", err)
+	}
+	gotSets, err := s.ListSets(ctx, SetFilter{Exercise: "rdl"})
+	if err != nil {
+		t.Fatalf("ListSets: %v", err)
+	}
+	if len(gotSets) != 1 || gotSets[0].WorkoutID != "2025-08-09-home-33" || *gotSets[0].ActualReps != 10 {
+		t.Fatalf("ListSets = %+v", gotSets)
+	}
+
+	if err := s.DeleteWorkout(ctx, "2025-08-09-home-33"); err != nil {
+		t.Fatalf("DeleteWorkout: %v", err)
+	}
+	if err := s.DeleteWorkout(ctx, "2025-08-09-home-33"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("second DeleteWorkout err = %v; want ErrNotFound", err)
+	}
+	if gotSets, _ := s.ListSets(ctx, SetFilter{}); len(gotSets) != 0 {
+		t.Fatalf("sets not deleted with workout: %+v", gotSets)
+	}
+
+	if err := s.PutExercise(ctx, Exercise{Slug: "RDL", Name: "Romanian Deadlift"}); err != nil {
+		t.Fatalf("PutExercise: %v", err)
+	}
+	if ex, _ := s.ListExercises(ctx); len(ex) != 1 || ex[0].Name != "Romanian Deadlift" {
+		t.Fatalf("ListExercises = %+v", ex)
+	}
+
+	acts := []Activity{
+		{Source: "strava", ID: "1", Name: "Run", Start: "2025-08-01T10:00:00Z", Effort: 40},
+		{Source: "strava", ID: "2", Name: "Ride", Start: "2025-08-08T10:00:00Z", Effort: 65},
+	}
+	if err := s.PutActivities(ctx, acts); err != nil {
+		t.Fatalf("PutActivities: %v", err)
+	}
+	// Re-importing the same activity updates rather than duplicates it.
+	if err := s.PutActivities(ctx, acts[1:]); err != nil {
+		t.Fatalf("PutActivities(again): %v", err)
+	}
+	gotActs, err := s.ListActivities(ctx, ActivityFilter{From: "2025-08-05"})
+	if err != nil {
+		t.Fatalf("ListActivities: %v", err)
+	}
+	if len(gotActs) != 1 || gotActs[0].Name != "Ride" {
+		t.Fatalf("ListActivities = %+v", gotActs)
+	}
+
+	for _, u := range []Usage{
+		{Date: "2025-08-09", Model: "gpt-4o-mini", Requests: 1, Calls: 3, Repairs: 2, PromptTokens: 100, CostUSD: 0.01},
+		{Date: "2025-08-09", Model: "gpt-4o-mini", Requests: 1, Calls: 1, PromptTokens: 50, CostUSD: 0.005},
+		{Date: "2025-08-08", Model: "gpt-4o-mini", Requests: 1, Calls: 1},
+	} {
+		if err := s.AddUsage(ctx, u); err != nil {
+			t.Fatalf("AddUsage: %v", err)
+		}
+	}
+	if err := s.AddUsage(ctx, Usage{}); err == nil {
+		t.Fatalf("expected error for usage without a date")
+	}
+	usage, err := s.ListUsage(ctx, UsageFilter{From: "2025-08-09"})
+	if err != nil {
+		t.Fatalf("ListUsage: %v", err)
+	}
+	if len(usage) != 1 || usage[0].Requests != 2 || usage[0].Calls != 4 || usage[0].Repairs != 2 || usage[0].PromptTokens != 150 {
+		t.Fatalf("ListUsage = %+v; want one rolled-up day", usage)
+	}
+
+	// Another user sees none of the default user's records.
+	other := WithUser(ctx, "alice")
+	if ws, err := s.ListWorkouts(other, WorkoutFilter{}); err != nil || len(ws) != 0 {
+		t.Fatalf("ListWorkouts as alice = %v, %v; want none", ws, err)
+	}
+	if ss, err := s.ListSets(other, SetFilter{}); err != nil || len(ss) != 0 {
+		t.Fatalf("ListSets as alice = %v, %v; want none", ss, err)
+	}
+	if as, err := s.ListActivities(other, ActivityFilter{}); err != nil || len(as) != 0 {
+		t.Fatalf("ListActivities as alice = %v, %v; want none", as, err)
+	}
+	if err := s.PutWorkout(other, Workout{ID: "2025-08-07-home-11", Date: "2025-08-07", Location: "alice"}); err != nil {
+		t.Fatalf("PutWorkout as alice: %v", err)
+	}
+	if err := s.DeleteWorkout(other, "2025-08-07-home-11"); err != nil {
+		t.Fatalf("DeleteWorkout as alice: %v", err)
+	}
+	if w, err := s.GetWorkout(ctx, "2025-08-07-home-11"); err != nil || w.Location != "home" {
+		t.Fatalf("default user's workout = %+v, %v; want it untouched by alice", w, err)
+	}
+
+	// Strava tokens and location profiles are per user too.
+	if err := s.PutStravaToken(ctx, StravaToken{AccessToken: "a1", RefreshToken: "r1", ExpiresAt: 100}); err != nil {
+		t.Fatalf("PutStravaToken: %v", err)
+	}
+	if tok, err := s.GetStravaToken(ctx); err != nil || tok.RefreshToken != "r1" {
+		t.Fatalf("GetStravaToken = %+v, %v", tok, err)
+	}
+	if _, err := s.GetStravaToken(other); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("GetStravaToken as alice = %v; want ErrNotFound", err)
+	}
+	if err := s.DeleteStravaToken(ctx); err != nil {
+		t.Fatalf("DeleteStravaToken: %v", err)
+	}
+	if _, err := s.GetStravaToken(ctx); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("GetStravaToken after delete = %v; want ErrNotFound", err)
+	}
+	if err := s.PutLocation(ctx, LocationProfile{Name: "a/b"}); err == nil {
+		t.Fatalf("expected error for a location name with '/'")
+	}
+	for _, l := range []LocationProfile{
+		{Name: "home", Equipment: []string{"dumbbell"}},
+		{Name: "Gym:Downtown", Equipment: []string{"barbell", "rack"}},
+	} {
+		if err := s.PutLocation(ctx, l); err != nil {
+			t.Fatalf("PutLocation(%s): %v", l.Name, err)
+		}
+	}
+	if l, err := s.GetLocation(ctx, "gym:downtown"); err != nil || len(l.Equipment) != 2 {
+		t.Fatalf("GetLocation = %+v, %v; want a case-insensitive match", l, err)
+	}
+	if ls, err := s.ListLocations(ctx); err != nil || len(ls) != 2 || ls[0].Name != "Gym:Downtown" {
+		t.Fatalf("ListLocations = %+v, %v", ls, err)
+	}
+	if ls, err := s.ListLocations(other); err != nil || len(ls) != 0 {
+		t.Fatalf("ListLocations as alice = %+v, %v; want none", ls, err)
+	}
+	if err := s.DeleteLocation(other, "home"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("DeleteLocation as alice = %v; want ErrNotFound", err)
+	}
+	if err := s.DeleteLocation(ctx, "HOME"); err != nil {
+		t.Fatalf("DeleteLocation: %v", err)
+	}
+
+	// API keys.
+	if err := s.PutAPIKey(ctx, APIKey{ID: "k1", User: "Not/Valid", Hash: "h"}); err == nil {
+		t.Fatalf("expected error for an invalid user id")
+	}
+	revoked := now
+	for _, k := range []APIKey{
+		{ID: "k2", User: "bob", Hash: "h2", CreatedAt: now},
+		{ID: "k1", User: "alice", Hash: "h1", CreatedAt: now, RevokedAt: &revoked},
+	} {
+		if err := s.PutAPIKey(ctx, k); err != nil {
+			t.Fatalf("PutAPIKey: %v", err)
+		}
+	}
+	if k, err := s.GetAPIKey(ctx, "k1"); err != nil || k.User != "alice" || !k.Revoked() {
+		t.Fatalf("GetAPIKey = %+v, %v", k, err)
+	}
+	if _, err := s.GetAPIKey(ctx, "nope"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("GetAPIKey(missing) = %v; want ErrNotFound", err)
+	}
+	if ks, err := s.ListAPIKeys(ctx); err != nil || len(ks) != 2 || ks[0].ID != "k1" {
+		t.Fatalf("ListAPIKeys = %+v, %v", ks, err)
+	}
+}
+
+func TestCreateWorkout(t *testing.T) {
+	for name, s := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			create := func(seed string) string {
+				t.Helper()
+				w, err := s.CreateWorkout(ctx, Workout{Date: "2025-08-09", Location: "home", Seed: seed}, func(w *Workout) error {
+					w.YAML = []byte("workout_id: " + w.ID + "\n")
+					return nil
+				})
+				if err != nil {
+					t.Fatalf("CreateWorkout(%s): %v", seed, err)
+				}
+				if got, err := s.GetWorkout(ctx, w.ID); err != nil || string(got.YAML) != "workout_id: "+w.ID+"\n" {
+					t.Fatalf("stored workout = %+v, %v; want stamped YAML", got, err)
+				}
+				return w.ID
+			}
+
+			first := create("seed-a")
+			if want := id.WorkoutID("2025-08-09", "home", []byte("seed-a")); first != want {
+				t.Fatalf("first ID = %q; want %q", first, want)
+			}
+			// Same seed → same ID (idempotent regeneration).
+			if again := create("seed-a"); again != first {
+				t.Fatalf("same seed created %q; want %q", again, first)
+			}
+
+			// A different workout already holding the hashed ID forces a bump.
+			if err := s.PutWorkout(ctx, Workout{ID: id.WorkoutID("2025-08-09", "home", []byte("seed-b")), Seed: "other"}); err != nil {
+				t.Fatalf("PutWorkout: %v", err)
+			}
+			if bumped, want := create("seed-b"), id.WorkoutIDAttempt("2025-08-09", "home", []byte("seed-b"), 1); bumped != want {
+				t.Fatalf("bumped ID = %q; want %q", bumped, want)
+			}
+
+			if _, err := s.CreateWorkout(ctx, Workout{Date: "2025-08-09", Location: "home", Seed: "seed-c"}, func(*Workout) error {
+				return errors.New("stamp failed")
+			}); err == nil {
+				t.Fatalf("expected the stamp error")
+			}
+			if _, err := s.GetWorkout(ctx, id.WorkoutID("2025-08-09", "home", []byte("seed-c"))); !errors.Is(err, ErrNotFound) {
+				t.Fatalf("failed create stored a workout: %v", err)
+			}
+		})
+	}
+}
+
+// TestCreateWorkout_Concurrent saves workouts whose seeds all hash to the
+// same NN at once: each must land on its own ID.
+func TestCreateWorkout_Concurrent(t *testing.T) {
+	for name, s := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			const n = 20
+			target := id.WorkoutID("2025-08-09", "home", []byte("seed-0"))
+			var seeds []string
+			for i := 0; len(seeds) < n; i++ {
+				if seed := fmt.Sprintf("seed-%d", i); id.WorkoutID("2025-08-09", "home", []byte(seed)) == target {
+					seeds = append(seeds, seed)
+				}
+			}
+			ids := make([]string, n)
+			var wg sync.WaitGroup
+			for i := range n {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					w, err := s.CreateWorkout(ctx, Workout{Date: "2025-08-09", Location: "home", Seed: seeds[i]}, func(*Workout) error { return nil })
+					if err != nil {
+						t.Errorf("CreateWorkout: %v", err)
+						return
+					}
+					ids[i] = w.ID
+				}()
+			}
+			wg.Wait()
+
+			seen := map[string]bool{}
+			for _, wid := range ids {
+				if seen[wid] {
+					t.Fatalf("two saves took %s: %v", wid, ids)
+				}
+				seen[wid] = true
+			}
+			if ws, err := s.ListWorkouts(ctx, WorkoutFilter{}); err != nil || len(ws) != n {
+				t.Fatalf("stored %d workouts, %v; want %d", len(ws), err, n)
+			}
+		})
+	}
+}
+
+func testStores(t *testing.T) map[string]Store {
+	t.Helper()
+	b, err := OpenBolt(filepath.Join(t.TempDir(), "swolegen.db"))
+	if err != nil {
+		t.Fatalf("OpenBolt: %v", err)
+	}
+	t.Cleanup(func() { b.Close() }) //nolint:errcheck
+	return map[string]Store{"memory": NewMemory(), "bolt": b}
+}
@@ -0,0 +1,48 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+)
+
+// DefaultUser owns records written without a user: the CLI, servers running
+// without authentication, and data stored before records were scoped.
+const DefaultUser = "default"
+
+var userRe = regexp.MustCompile(`^[a-z0-9][a-z0-9._-]{0,63}$`)
+
+// ValidateUser checks a user ID: lowercase letters, digits, '.', '_' and
+// '-', starting with a letter or digit. IDs appear in storage keys, so '/'
+// is never allowed.
+func ValidateUser(user string) error {
+	if !userRe.MatchString(user) {
+		return fmt.Errorf("store: invalid user id %q", user)
+	}
+	return nil
+}
+
+type userKey struct{}
+
+// WithUser scopes the store calls made with the returned context to user.
+func WithUser(ctx context.Context, user string) context.Context {
+	return context.WithValue(ctx, userKey{}, user)
+}
+
+// UserFrom reports the user ctx is scoped to, DefaultUser when none.
+func UserFrom(ctx context.Context) string {
+	if user, ok := ctx.Value(userKey{}).(string); ok && user != "" {
+		return user
+	}
+	return DefaultUser
+}
+
+// scoped prefixes key with the context's user. User IDs cannot contain '/',
+// so one user's prefix never matches another's keys.
+func scoped(ctx context.Context, key string) string {
+	return UserFrom(ctx) + "/" + key
+}
+
+func userPrefix(ctx context.Context) string {
+	return UserFrom(ctx) + "/"
+}
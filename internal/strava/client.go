@@ -9,9 +9,14 @@ import (
 	"strconv"
 	"time"
 
+	"github.com/aaronromeo/swolegen/internal/tracing"
 	"github.com/hashicorp/go-retryablehttp"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
+const tracerName = "github.com/aaronromeo/swolegen/internal/strava"
+
 type TokenSource interface {
 	Current(ctx context.Context) (*Token, error)
 	Save(ctx context.Context, t *Token) error
@@ -43,10 +48,26 @@ type Client struct {
 	source TokenSource
 }
 
-func NewWithTokenSource(ts TokenSource) *Client {
+// ClientOption configures a Client.
+type ClientOption func(*Client)
+
+// WithTimeout bounds each HTTP attempt to the Strava API.
+func WithTimeout(d time.Duration) ClientOption {
+	return func(c *Client) {
+		if d > 0 {
+			c.h.HTTPClient.Timeout = d
+		}
+	}
+}
+
+func NewWithTokenSource(ts TokenSource, opts ...ClientOption) *Client {
 	h := retryablehttp.NewClient()
 	h.RetryMax = 3
-	return &Client{h: h, source: ts}
+	c := &Client{h: h, source: ts}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
 }
 
 type Activity struct {
@@ -57,13 +78,22 @@ type Activity struct {
 	Effort      float64       `json:"suffer_score"` // Strava may return numbers with decimals
 }
 
-func (c *Client) GetRecentActivities(ctx context.Context, sinceDays int) ([]Activity, error) {
+// GetRecentActivities lists the activities of the sinceDays days before the
+// session day, and of the day itself. day is the session date at midnight
+// in the session's zone, so the window follows the user's calendar rather
+// than the server's clock; sinceDays 0 leaves the window open at the start.
+func (c *Client) GetRecentActivities(ctx context.Context, day time.Time, sinceDays int) (acts []Activity, err error) {
+	ctx, span := tracing.Tracer(tracerName).Start(ctx, "strava.activities", trace.WithAttributes(attribute.Int("swolegen.strava.since_days", sinceDays)))
+	defer func() {
+		span.SetAttributes(attribute.Int("swolegen.strava.activities", len(acts)))
+		tracing.End(span, err)
+	}()
 	tok, err := c.source.Current(ctx)
 	if err != nil {
 		return nil, err
 	}
 
-	// Build URL with sinceDays → after=unix seconds, per_page=100 (single page MVP)
+	// Build URL with the window → before/after=unix seconds, per_page=100 (single page MVP)
 	u, err := url.Parse(activitiesURL)
 	if err != nil {
 		return nil, err
@@ -71,9 +101,9 @@ func (c *Client) GetRecentActivities(ctx context.Context, sinceDays int) ([]Acti
 
 	q := u.Query()
 	q.Set("per_page", "100")
+	q.Set("before", strconv.FormatInt(day.AddDate(0, 0, 1).Unix(), 10))
 	if sinceDays > 0 {
-		after := time.Now().Add(-time.Duration(sinceDays) * 24 * time.Hour).Unix()
-		q.Set("after", strconv.FormatInt(after, 10))
+		q.Set("after", strconv.FormatInt(day.AddDate(0, 0, -sinceDays).Unix(), 10))
 	}
 	u.RawQuery = q.Encode()
 
@@ -84,6 +114,7 @@ func (c *Client) GetRecentActivities(ctx context.Context, sinceDays int) ([]Acti
 	req.Header.Set("Authorization", "Bearer "+tok.AccessToken)
 
 	resp, err := c.h.Do(req)
+	observe("activities", resp, err)
 	if err != nil {
 		return nil, err
 	}
@@ -8,9 +8,14 @@ import (
 	"net/url"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"testing"
 	"time"
+
+	"github.com/aaronromeo/swolegen/internal/config"
+	"github.com/aaronromeo/swolegen/internal/metrics"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 )
 
 type fixedTokenSource struct{ tok *Token }
@@ -22,6 +27,7 @@ type fixtureTransport struct {
 	t       *testing.T
 	status  int
 	body    []byte
+	header  http.Header
 	lastURL string
 	sawAuth string
 }
@@ -29,9 +35,12 @@ type fixtureTransport struct {
 func (ft *fixtureTransport) RoundTrip(req *http.Request) (*http.Response, error) {
 	ft.lastURL = req.URL.String()
 	ft.sawAuth = req.Header.Get("Authorization")
+	if ft.header == nil {
+		ft.header = make(http.Header)
+	}
 	resp := &http.Response{
 		StatusCode: ft.status,
-		Header:     make(http.Header),
+		Header:     ft.header.Clone(),
 		Body:       io.NopCloser(bytes.NewReader(ft.body)),
 		Request:    req,
 	}
@@ -51,6 +60,11 @@ func readFixture(t *testing.T, name string) []byte {
 func TestGetRecentActivities_Success(t *testing.T) {
 	// Prepare client with fixed token far in future (no refresh)
 	ts := fixedTokenSource{tok: &Token{AccessToken: "x", RefreshToken: "", ExpiresAt: time.Now().Add(365 * 24 * time.Hour).Unix()}}
+	toronto, err := time.LoadLocation("America/Toronto")
+	if err != nil {
+		t.Fatal(err)
+	}
+	day := time.Date(2025, 8, 9, 0, 0, 0, 0, toronto)
 	c := NewWithTokenSource(ts)
 	c.h.RetryMax = 0
 
@@ -58,7 +72,7 @@ func TestGetRecentActivities_Success(t *testing.T) {
 	c.h.HTTPClient.Transport = ft
 
 	ctx := context.Background()
-	acts, err := c.GetRecentActivities(ctx, 7)
+	acts, err := c.GetRecentActivities(ctx, day, 7)
 	if err != nil {
 		t.Fatalf("GetRecentActivities error: %v", err)
 	}
@@ -68,14 +82,18 @@ func TestGetRecentActivities_Success(t *testing.T) {
 	if !strings.HasPrefix(ft.sawAuth, "Bearer ") {
 		t.Fatalf("expected Authorization Bearer header, got %q", ft.sawAuth)
 	}
-	// sinceDays>0 should include `after` in query
+	// The window runs from midnight sinceDays before the session day to the
+	// end of the day, in the session's zone.
 	u, err := url.Parse(ft.lastURL)
 	if err != nil {
 		t.Fatalf("parse URL error: %v", err)
 	}
 
-	if u.Query().Get("after") == "" {
-		t.Fatalf("expected 'after' query param in URL, got %q", ft.lastURL)
+	if want := strconv.FormatInt(time.Date(2025, 8, 2, 4, 0, 0, 0, time.UTC).Unix(), 10); u.Query().Get("after") != want {
+		t.Fatalf("expected after=%s from the session date, got %q", want, ft.lastURL)
+	}
+	if want := strconv.FormatInt(time.Date(2025, 8, 10, 4, 0, 0, 0, time.UTC).Unix(), 10); u.Query().Get("before") != want {
+		t.Fatalf("expected before=%s at the end of the session day, got %q", want, ft.lastURL)
 	}
 }
 
@@ -88,12 +106,38 @@ func TestGetRecentActivities_HTTPError(t *testing.T) {
 	c.h.HTTPClient.Transport = ft
 
 	ctx := context.Background()
-	_, err := c.GetRecentActivities(ctx, 0)
+	_, err := c.GetRecentActivities(ctx, time.Now(), 0)
 	if err == nil {
 		t.Fatalf("expected error on HTTP 500")
 	}
 }
 
+func TestGetRecentActivities_RateLimitMetrics(t *testing.T) {
+	ts := fixedTokenSource{tok: &Token{AccessToken: "x", ExpiresAt: time.Now().Add(365 * 24 * time.Hour).Unix()}}
+	c := NewWithTokenSource(ts)
+	c.h.RetryMax = 0
+	c.h.HTTPClient.Transport = &fixtureTransport{t: t, status: 200, body: []byte(`[]`), header: http.Header{
+		"X-Ratelimit-Limit": {"200,2000"},
+		"X-Ratelimit-Usage": {"12,340"},
+	}}
+	ok := metrics.StravaRequests.WithLabelValues("activities", "200")
+	before := testutil.ToFloat64(ok)
+
+	if _, err := c.GetRecentActivities(context.Background(), time.Now(), 0); err != nil {
+		t.Fatalf("GetRecentActivities error: %v", err)
+	}
+	if d := testutil.ToFloat64(ok) - before; d != 1 {
+		t.Errorf("requests: got %v, want 1", d)
+	}
+	for labels, want := range map[[2]string]float64{
+		{"15m", "limit"}: 200, {"daily", "limit"}: 2000, {"15m", "usage"}: 12, {"daily", "usage"}: 340,
+	} {
+		if got := testutil.ToFloat64(metrics.StravaRateLimit.WithLabelValues(labels[0], labels[1])); got != want {
+			t.Errorf("%v: got %v, want %v", labels, got, want)
+		}
+	}
+}
+
 func TestUserTokenSource(t *testing.T) {
 	// Test with valid token
 	token := &Token{
@@ -143,3 +187,30 @@ func TestUserTokenSource(t *testing.T) {
 		t.Fatalf("expected 'no user token provided' error, got %q", err.Error())
 	}
 }
+
+func TestOAuth(t *testing.T) {
+	o := NewOAuth(config.StravaConfig{ClientID: "42", RedirectBaseURL: "https://swolegen.example.com/", StateSecret: "s3cret"})
+	if err := o.CheckConfig(); err == nil || !strings.Contains(err.Error(), "STRAVA_CLIENT_SECRET not set") {
+		t.Fatalf("expected missing client secret, got %v", err)
+	}
+
+	raw, err := o.AuthorizeURL("alice")
+	if err != nil {
+		t.Fatalf("AuthorizeURL: %v", err)
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := u.Query()
+	if q.Get("client_id") != "42" || q.Get("redirect_uri") != "https://swolegen.example.com/oauth/strava/callback" || q.Get("scope") != "read,activity:read_all" {
+		t.Fatalf("unexpected authorize URL %s", raw)
+	}
+	if user, err := o.ValidateState(q.Get("state")); err != nil || user != "alice" {
+		t.Fatalf("ValidateState = %q, %v; want alice", user, err)
+	}
+	other := NewOAuth(config.StravaConfig{StateSecret: "other"})
+	if _, err := other.ValidateState(q.Get("state")); err == nil {
+		t.Fatal("state signed with another secret validated")
+	}
+}
@@ -0,0 +1,32 @@
+package strava
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/aaronromeo/swolegen/internal/metrics"
+)
+
+// rateLimitWindows names the comma-separated fields of Strava's
+// X-RateLimit-Limit and X-RateLimit-Usage headers.
+var rateLimitWindows = []string{"15m", "daily"}
+
+// observe exports the outcome of a Strava call and the rate limit state
+// its response reported.
+func observe(endpoint string, resp *http.Response, err error) {
+	if err != nil {
+		metrics.StravaRequests.WithLabelValues(endpoint, "error").Inc()
+		return
+	}
+	metrics.StravaRequests.WithLabelValues(endpoint, strconv.Itoa(resp.StatusCode)).Inc()
+	for kind, header := range map[string]string{"limit": "X-RateLimit-Limit", "usage": "X-RateLimit-Usage"} {
+		for i, v := range strings.Split(resp.Header.Get(header), ",") {
+			n, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+			if err != nil || i >= len(rateLimitWindows) {
+				continue
+			}
+			metrics.StravaRateLimit.WithLabelValues(rateLimitWindows[i], kind).Set(n)
+		}
+	}
+}
@@ -6,13 +6,14 @@ import (
 	"crypto/sha256"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/url"
-	"os"
 	"strconv"
 	"strings"
 	"time"
 
+	"github.com/aaronromeo/swolegen/internal/config"
 	"github.com/hashicorp/go-retryablehttp"
 )
 
@@ -24,102 +25,144 @@ type Token struct {
 	Scope        string `json:"scope"`
 }
 
-func scopes() string {
-	s := os.Getenv("STRAVA_SCOPES")
-	if s == "" {
+// OAuth runs Strava's authorization code flow for the API application in
+// its config.
+type OAuth struct {
+	cfg config.StravaConfig
+}
+
+// NewOAuth returns the OAuth flow for cfg.
+func NewOAuth(cfg config.StravaConfig) *OAuth {
+	return &OAuth{cfg: cfg}
+}
+
+func (o *OAuth) scopes() string {
+	if o.cfg.Scopes == "" {
 		return "read,activity:read_all"
 	}
-	return s
+	return o.cfg.Scopes
 }
 
-func redirectBase() (string, error) {
-	base := os.Getenv("STRAVA_REDIRECT_BASE_URL")
-	if base == "" {
+func (o *OAuth) redirectBase() (string, error) {
+	if o.cfg.RedirectBaseURL == "" {
 		return "", fmt.Errorf("STRAVA_REDIRECT_BASE_URL not set")
 	}
-	return strings.TrimRight(base, "/"), nil
+	return strings.TrimRight(o.cfg.RedirectBaseURL, "/"), nil
 }
 
-func clientID() (string, error) {
-	id := os.Getenv("STRAVA_CLIENT_ID")
-	if id == "" {
+func (o *OAuth) clientID() (string, error) {
+	if o.cfg.ClientID == "" {
 		return "", fmt.Errorf("STRAVA_CLIENT_ID not set")
 	}
-	return id, nil
+	return o.cfg.ClientID, nil
 }
 
-func clientSecret() (string, error) {
-	sec := os.Getenv("STRAVA_CLIENT_SECRET")
-	if sec == "" {
+func (o *OAuth) clientSecret() (string, error) {
+	if o.cfg.ClientSecret == "" {
 		return "", fmt.Errorf("STRAVA_CLIENT_SECRET not set")
 	}
-	return sec, nil
+	return o.cfg.ClientSecret, nil
 }
 
-func stateSecret() ([]byte, error) {
-	sec := os.Getenv("STRAVA_STATE_SECRET")
-	if sec == "" {
+func (o *OAuth) stateSecret() ([]byte, error) {
+	if o.cfg.StateSecret == "" {
 		return nil, fmt.Errorf("STRAVA_STATE_SECRET not set")
 	}
-	return []byte(sec), nil
+	return []byte(o.cfg.StateSecret), nil
 }
 
-// SignedState creates a short-lived HMAC'd state token.
-func SignedState() (string, error) {
-	key, err := stateSecret()
+// httpClient returns a client for the token endpoint bounded by the
+// configured timeout.
+func (o *OAuth) httpClient() *retryablehttp.Client {
+	h := retryablehttp.NewClient()
+	h.RetryMax = 2
+	if o.cfg.Timeout > 0 {
+		h.HTTPClient.Timeout = o.cfg.Timeout
+	}
+	return h
+}
+
+// SignedState creates a short-lived HMAC'd state token naming the user the
+// flow was started for, so the callback can store the token for them.
+func (o *OAuth) SignedState(user string) (string, error) {
+	key, err := o.stateSecret()
 	if err != nil {
 		return "", err
 	}
-	ts := time.Now().Unix()
-	msg := fmt.Sprintf("%d", ts)
+	msg := fmt.Sprintf("%d.%s", time.Now().Unix(), base64.RawURLEncoding.EncodeToString([]byte(user)))
 	mac := hmac.New(sha256.New, key)
 	mac.Write([]byte(msg))
 	sig := mac.Sum(nil)
-	raw := fmt.Sprintf("%d.%s", ts, base64.RawURLEncoding.EncodeToString(sig))
-	return raw, nil
+	return msg + "." + base64.RawURLEncoding.EncodeToString(sig), nil
 }
 
-// ValidateState checks HMAC and age (5 minutes).
-func ValidateState(raw string) error {
-	key, err := stateSecret()
+// ValidateState checks HMAC and age (5 minutes) and returns the user the
+// state was signed for.
+func (o *OAuth) ValidateState(raw string) (string, error) {
+	key, err := o.stateSecret()
 	if err != nil {
-		return err
+		return "", err
 	}
 	parts := strings.Split(raw, ".")
-	if len(parts) != 2 {
-		return fmt.Errorf("bad state format")
+	if len(parts) != 3 {
+		return "", fmt.Errorf("bad state format")
 	}
-	tsStr, sigB64 := parts[0], parts[1]
+	tsStr, userB64, sigB64 := parts[0], parts[1], parts[2]
 	ts, err := strconv.ParseInt(tsStr, 10, 64)
 	if err != nil {
-		return fmt.Errorf("bad state ts")
+		return "", fmt.Errorf("bad state ts")
 	}
 	if time.Since(time.Unix(ts, 0)) > 5*time.Minute {
-		return fmt.Errorf("state expired")
+		return "", fmt.Errorf("state expired")
 	}
 	mac := hmac.New(sha256.New, key)
-	mac.Write([]byte(tsStr))
+	mac.Write([]byte(tsStr + "." + userB64))
 	expected := mac.Sum(nil)
 	got, err := base64.RawURLEncoding.DecodeString(sigB64)
 	if err != nil {
-		return fmt.Errorf("state b64")
+		return "", fmt.Errorf("state b64")
 	}
 	if !hmac.Equal(expected, got) {
-		return fmt.Errorf("state mismatch")
+		return "", fmt.Errorf("state mismatch")
+	}
+	user, err := base64.RawURLEncoding.DecodeString(userB64)
+	if err != nil {
+		return "", fmt.Errorf("state user b64")
 	}
-	return nil
+	return string(user), nil
 }
 
-func AuthorizeURL() (string, error) {
-	cbBase, err := redirectBase()
+// CheckConfig reports every Strava setting AuthorizeURL and ExchangeCode
+// need that is missing.
+func (o *OAuth) CheckConfig() error {
+	var errs []error
+	if _, err := o.redirectBase(); err != nil {
+		errs = append(errs, err)
+	}
+	if _, err := o.clientID(); err != nil {
+		errs = append(errs, err)
+	}
+	if _, err := o.clientSecret(); err != nil {
+		errs = append(errs, err)
+	}
+	if _, err := o.stateSecret(); err != nil {
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+// AuthorizeURL returns Strava's consent page for user; the callback stores
+// the token it grants under that user.
+func (o *OAuth) AuthorizeURL(user string) (string, error) {
+	cbBase, err := o.redirectBase()
 	if err != nil {
 		return "", err
 	}
-	cid, err := clientID()
+	cid, err := o.clientID()
 	if err != nil {
 		return "", err
 	}
-	state, err := SignedState()
+	state, err := o.SignedState(user)
 	if err != nil {
 		return "", err
 	}
@@ -130,25 +173,24 @@ func AuthorizeURL() (string, error) {
 	q.Set("response_type", "code")
 	q.Set("redirect_uri", cbBase+"/oauth/strava/callback")
 	q.Set("approval_prompt", "auto")
-	q.Set("scope", scopes())
+	q.Set("scope", o.scopes())
 	q.Set("state", state)
 	u.RawQuery = q.Encode()
 	return u.String(), nil
 }
 
 // ExchangeCode for tokens
-func ExchangeCode(ctx context.Context, code string) (*Token, error) {
-	cid, err := clientID()
+func (o *OAuth) ExchangeCode(ctx context.Context, code string) (*Token, error) {
+	cid, err := o.clientID()
 	if err != nil {
 		return nil, err
 	}
-	sec, err := clientSecret()
+	sec, err := o.clientSecret()
 	if err != nil {
 		return nil, err
 	}
 
-	h := retryablehttp.NewClient()
-	h.RetryMax = 2
+	h := o.httpClient()
 
 	vals := url.Values{}
 	vals.Set("client_id", cid)
@@ -160,6 +202,7 @@ func ExchangeCode(ctx context.Context, code string) (*Token, error) {
 	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 
 	resp, err := h.Do(req)
+	observe("token_exchange", resp, err)
 	if err != nil {
 		return nil, err
 	}
@@ -175,7 +218,7 @@ func ExchangeCode(ctx context.Context, code string) (*Token, error) {
 }
 
 // RefreshIfNeeded refreshes using refresh_token when expired or near expiry (<=120s).
-func RefreshIfNeeded(ctx context.Context, tok *Token) (*Token, error) {
+func (o *OAuth) RefreshIfNeeded(ctx context.Context, tok *Token) (*Token, error) {
 	if tok == nil {
 		return nil, fmt.Errorf("nil token")
 	}
@@ -183,17 +226,16 @@ func RefreshIfNeeded(ctx context.Context, tok *Token) (*Token, error) {
 		return tok, nil
 	}
 
-	cid, err := clientID()
+	cid, err := o.clientID()
 	if err != nil {
 		return nil, err
 	}
-	sec, err := clientSecret()
+	sec, err := o.clientSecret()
 	if err != nil {
 		return nil, err
 	}
 
-	h := retryablehttp.NewClient()
-	h.RetryMax = 2
+	h := o.httpClient()
 
 	vals := url.Values{}
 	vals.Set("client_id", cid)
@@ -205,6 +247,7 @@ func RefreshIfNeeded(ctx context.Context, tok *Token) (*Token, error) {
 	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 
 	resp, err := h.Do(req)
+	observe("token_refresh", resp, err)
 	if err != nil {
 		return nil, err
 	}
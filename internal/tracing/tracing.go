@@ -0,0 +1,96 @@
+// Package tracing sets up OpenTelemetry tracing for the server and names
+// the span attributes the pipeline records.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const serviceName = "swolegen"
+
+// Exporters accepted by Setup.
+const (
+	ExporterNone   = "none"
+	ExporterOTLP   = "otlp"
+	ExporterStdout = "stdout"
+)
+
+// Span attribute keys shared across packages.
+const (
+	AttrStage            = attribute.Key("swolegen.stage")
+	AttrAttempt          = attribute.Key("swolegen.attempt")
+	AttrProvider         = attribute.Key("swolegen.llm.provider")
+	AttrModel            = attribute.Key("swolegen.llm.model")
+	AttrPromptVersion    = attribute.Key("swolegen.llm.prompt_version")
+	AttrPromptTokens     = attribute.Key("swolegen.llm.prompt_tokens")
+	AttrCompletionTokens = attribute.Key("swolegen.llm.completion_tokens")
+	AttrCacheHit         = attribute.Key("swolegen.cache_hit")
+	AttrRepairs          = attribute.Key("swolegen.llm.repairs")
+	AttrValidationErrors = attribute.Key("swolegen.validation.error_count")
+	AttrValidationError  = attribute.Key("swolegen.validation.category")
+)
+
+// stdout is where the stdout exporter writes; tests replace it.
+var stdout io.Writer = os.Stdout
+
+// Setup installs the global tracer provider and W3C propagator for exporter
+// and returns a function that flushes and stops it. With ExporterNone the
+// global no-op provider stays in place.
+func Setup(ctx context.Context, exporter string, sampleRatio float64) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	var exp sdktrace.SpanExporter
+	var err error
+	switch exporter {
+	case "", ExporterNone:
+		return func(context.Context) error { return nil }, nil
+	case ExporterOTLP:
+		exp, err = otlptracehttp.New(ctx)
+	case ExporterStdout:
+		exp, err = stdouttrace.New(stdouttrace.WithWriter(stdout))
+	default:
+		return nil, fmt.Errorf("tracing: unknown exporter %q (want otlp, stdout or none)", exporter)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("tracing: %s exporter: %w", exporter, err)
+	}
+	res, err := resource.Merge(resource.Default(), resource.NewSchemaless(semconv.ServiceName(serviceName)))
+	if err != nil {
+		return nil, fmt.Errorf("tracing: resource: %w", err)
+	}
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exp),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(sampleRatio))),
+	)
+	otel.SetTracerProvider(tp)
+	return tp.Shutdown, nil
+}
+
+// Tracer returns the named tracer from the global provider. Callers look
+// it up per span so tests can install a provider after package init.
+func Tracer(name string) trace.Tracer {
+	return otel.Tracer(name)
+}
+
+// End records err on span, if any, and ends it.
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
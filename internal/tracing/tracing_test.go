@@ -0,0 +1,42 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+)
+
+func TestSetup(t *testing.T) {
+	prev := otel.GetTracerProvider()
+	t.Cleanup(func() { otel.SetTracerProvider(prev) })
+	var buf bytes.Buffer
+	prevOut := stdout
+	stdout = &buf
+	t.Cleanup(func() { stdout = prevOut })
+
+	shutdown, err := Setup(context.Background(), ExporterStdout, 1)
+	if err != nil {
+		t.Fatalf("Setup: %v", err)
+	}
+	_, span := Tracer("test").Start(context.Background(), "llm.generate")
+	span.SetAttributes(AttrAttempt.Int(3))
+	span.End()
+	if err := shutdown(context.Background()); err != nil {
+		t.Fatalf("shutdown: %v", err)
+	}
+	for _, want := range []string{`"Name":"llm.generate"`, `"swolegen.attempt"`, `"swolegen"`} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("stdout export missing %s: %s", want, buf.String())
+		}
+	}
+
+	if _, err := Setup(context.Background(), "zipkin", 1); err == nil {
+		t.Error("expected error for unknown exporter")
+	}
+	if shutdown, err := Setup(context.Background(), ExporterNone, 1); err != nil || shutdown(context.Background()) != nil {
+		t.Errorf("none: %v", err)
+	}
+}
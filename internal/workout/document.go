@@ -0,0 +1,134 @@
+package workout
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/aaronromeo/swolegen/internal/id"
+	"github.com/aaronromeo/swolegen/internal/llm/schemas"
+	"github.com/aaronromeo/swolegen/internal/store"
+	"gopkg.in/yaml.v3"
+)
+
+// ToJSON converts a YAML (or JSON) document to JSON so it can be checked by
+// the schema types. Unquoted YAML dates are kept as YYYY-MM-DD strings.
+func ToJSON(doc []byte) ([]byte, error) {
+	var v any
+	if err := yaml.Unmarshal(doc, &v); err != nil {
+		return nil, fmt.Errorf("yaml parse: %w", err)
+	}
+	v, err := jsonValue(v)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(v)
+}
+
+func jsonValue(v any) (any, error) {
+	switch t := v.(type) {
+	case map[string]any:
+		for k, e := range t {
+			cv, err := jsonValue(e)
+			if err != nil {
+				return nil, err
+			}
+			t[k] = cv
+		}
+		return t, nil
+	case map[any]any:
+		m := make(map[string]any, len(t))
+		for k, e := range t {
+			cv, err := jsonValue(e)
+			if err != nil {
+				return nil, err
+			}
+			m[fmt.Sprint(k)] = cv
+		}
+		return m, nil
+	case []any:
+		for i, e := range t {
+			cv, err := jsonValue(e)
+			if err != nil {
+				return nil, err
+			}
+			t[i] = cv
+		}
+		return t, nil
+	case time.Time:
+		if t.Equal(time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())) {
+			return t.Format("2006-01-02"), nil
+		}
+		return t.Format(time.RFC3339), nil
+	default:
+		return v, nil
+	}
+}
+
+// Parse decodes and validates a workout document against the workout schema.
+func Parse(doc []byte) (*schemas.WorkoutV12Json, error) {
+	b, err := ToJSON(doc)
+	if err != nil {
+		return nil, err
+	}
+	var w schemas.WorkoutV12Json
+	if err := json.Unmarshal(b, &w); err != nil {
+		return nil, fmt.Errorf("workout: %w", err)
+	}
+	return &w, nil
+}
+
+// LoggedSets returns the sets the user filled in (actual reps or weight),
+// ready to record against the workout. Untouched sets are skipped.
+func LoggedSets(w *schemas.WorkoutV12Json) []store.LoggedSet {
+	date := w.Date.Format("2006-01-02")
+	out := []store.LoggedSet{}
+	for _, s := range w.Sets {
+		if s.ActualReps == nil && s.ActualWeight == nil {
+			continue
+		}
+		ls := store.LoggedSet{
+			WorkoutID:    w.WorkoutId,
+			SetID:        s.Id,
+			Date:         date,
+			Exercise:     s.Exercise,
+			Tier:         string(s.Tier),
+			Units:        string(w.Units),
+			TargetWeight: s.TargetWeight,
+			ActualWeight: s.ActualWeight,
+			ActualReps:   s.ActualReps,
+			RIR:          s.Rir,
+		}
+		if s.TargetReps != nil {
+			ls.TargetReps = fmt.Sprint(s.TargetReps)
+		}
+		if s.Notes != nil {
+			ls.Notes = *s.Notes
+		}
+		out = append(out, ls)
+	}
+	return out
+}
+
+// Exercises returns the distinct movements in a workout, keyed by id.Slug.
+func Exercises(w *schemas.WorkoutV12Json) []store.Exercise {
+	seen := map[string]int{}
+	out := []store.Exercise{}
+	for _, s := range w.Sets {
+		slug := id.Slug(s.Exercise)
+		if slug == "" {
+			continue
+		}
+		i, ok := seen[slug]
+		if !ok {
+			seen[slug] = len(out)
+			out = append(out, store.Exercise{Slug: slug, Name: s.Exercise})
+			i = len(out) - 1
+		}
+		if s.Equipment != "" && !slices.Contains(out[i].Equipment, s.Equipment) {
+			out[i].Equipment = append(out[i].Equipment, s.Equipment)
+		}
+	}
+	return out
+}
@@ -0,0 +1,60 @@
+package workout
+
+import (
+	"strings"
+	"testing"
+)
+
+const filledWorkout = `version: 1.2
+workout_id: 2025-08-09-home-42
+date: 2025-08-09
+location: home
+units: lbs
+duration_minutes: 45
+goal: hypertrophy
+notes_to_user: null
+cut_order: [A]
+sets:
+  - {id: A-GOBLET-SQ-1, tier: A, must: true, superset: null, order: 1, exercise: Goblet Squat, equipment: dumbbell,
+     target_reps: 8-10, target_weight: 60, rir: 2, rest_s: 90, actual_weight: 60, actual_reps: 10, notes: easy}
+  - {id: A-GOBLET-SQ-2, tier: A, must: true, superset: null, order: 2, exercise: Goblet Squat, equipment: kettlebell,
+     target_reps: 8-10, target_weight: 60, rir: 2, rest_s: 90, actual_weight: null, actual_reps: null, notes: null}
+post_workout: {perceived_difficulty: 7, completion_time_minutes: 40, notes: null}
+`
+
+func TestToJSON_KeepsDates(t *testing.T) {
+	b, err := ToJSON([]byte("date: 2025-08-09\nat: 2025-08-09T06:30:00Z\n"))
+	if err != nil {
+		t.Fatalf("ToJSON: %v", err)
+	}
+	if !strings.Contains(string(b), `"date":"2025-08-09"`) || !strings.Contains(string(b), `"at":"2025-08-09T06:30:00Z"`) {
+		t.Fatalf("unexpected json: %s", b)
+	}
+}
+
+func TestLoggedSets(t *testing.T) {
+	w, err := Parse([]byte(filledWorkout))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	sets := LoggedSets(w)
+	if len(sets) != 1 {
+		t.Fatalf("expected only the filled set, got %+v", sets)
+	}
+	s := sets[0]
+	if s.WorkoutID != "2025-08-09-home-42" || s.Date != "2025-08-09" || s.SetID != "A-GOBLET-SQ-1" ||
+		s.TargetReps != "8-10" || *s.ActualReps != 10 || *s.ActualWeight != 60 || s.Notes != "easy" {
+		t.Fatalf("unexpected logged set: %+v", s)
+	}
+
+	ex := Exercises(w)
+	if len(ex) != 1 || ex[0].Slug != "GOBLET-SQUAT" || len(ex[0].Equipment) != 2 {
+		t.Fatalf("unexpected exercises: %+v", ex)
+	}
+}
+
+func TestParse_RejectsInvalid(t *testing.T) {
+	if _, err := Parse([]byte("workout_id: x\n")); err == nil {
+		t.Fatalf("expected schema error")
+	}
+}
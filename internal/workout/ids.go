@@ -0,0 +1,31 @@
+package workout
+
+import (
+	"errors"
+
+	"gopkg.in/yaml.v3"
+)
+
+// SetWorkoutID rewrites the top-level workout_id of a workout YAML document,
+// leaving the rest of the document as generated.
+func SetWorkoutID(doc []byte, workoutID string) ([]byte, error) {
+	var root yaml.Node
+	if err := yaml.Unmarshal(doc, &root); err != nil {
+		return nil, err
+	}
+	if len(root.Content) == 0 || root.Content[0].Kind != yaml.MappingNode {
+		return nil, errors.New("workout yaml: expected a mapping document")
+	}
+	m := root.Content[0]
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		if m.Content[i].Value == "workout_id" {
+			m.Content[i+1].SetString(workoutID)
+			return yaml.Marshal(&root)
+		}
+	}
+	m.Content = append(m.Content,
+		&yaml.Node{Kind: yaml.ScalarNode, Value: "workout_id"},
+		&yaml.Node{Kind: yaml.ScalarNode, Value: workoutID},
+	)
+	return yaml.Marshal(&root)
+}
@@ -0,0 +1,32 @@
+package workout
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSetWorkoutID(t *testing.T) {
+	in := []byte("version: 1.2\nworkout_id: 2025-08-09-home-07\nlocation: home\n")
+	out, err := SetWorkoutID(in, "2025-08-09-home-42")
+	if err != nil {
+		t.Fatalf("SetWorkoutID: %v", err)
+	}
+	if !strings.Contains(string(out), "workout_id: 2025-08-09-home-42") || strings.Contains(string(out), "home-07") {
+		t.Fatalf("workout_id not replaced:\n%s", out)
+	}
+	if !strings.Contains(string(out), "location: home") {
+		t.Fatalf("other fields lost:\n%s", out)
+	}
+
+	out, err = SetWorkoutID([]byte("version: 1.2\n"), "2025-08-09-home-42")
+	if err != nil {
+		t.Fatalf("SetWorkoutID(missing): %v", err)
+	}
+	if !strings.Contains(string(out), "workout_id: 2025-08-09-home-42") {
+		t.Fatalf("workout_id not added:\n%s", out)
+	}
+
+	if _, err := SetWorkoutID([]byte("- a\n- b\n"), "x"); err == nil {
+		t.Fatalf("expected error for non-mapping document")
+	}
+}
@@ -0,0 +1,65 @@
+package workout
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"time"
+
+	"github.com/aaronromeo/swolegen/internal/llm/schemas"
+	"github.com/aaronromeo/swolegen/internal/store"
+)
+
+// Provenance records what produced a generated workout.
+type Provenance struct {
+	// Seed is the analyzer's workout_id seed; empty falls back to one
+	// derived from the plan.
+	Seed string
+	// InputsHash identifies the analyzer inputs the plan came from (see
+	// llm.AnalyzerInputs.Hash); empty when the plan was supplied directly.
+	InputsHash    string
+	Provider      string
+	Model         string
+	PromptVersion string
+}
+
+// Save assigns the deterministic workout_id for the seed, stamps it into the
+// generated YAML and records the workout, created at now, with the plan and
+// provenance that produced it.
+func Save(ctx context.Context, st store.Store, plan schemas.AnalyzerV1Json, doc []byte, p Provenance, now time.Time) (store.Workout, error) {
+	seed := p.Seed
+	if seed == "" {
+		planHash, err := hashJSON(plan)
+		if err != nil {
+			return store.Workout{}, err
+		}
+		seed = planHash
+	}
+	w := store.Workout{
+		Date:          plan.Meta.Date.Format("2006-01-02"),
+		Location:      plan.Meta.Location,
+		SessionType:   string(plan.Session.Type),
+		Plan:          &plan,
+		CreatedAt:     now.UTC(),
+		Seed:          seed,
+		InputsHash:    p.InputsHash,
+		Provider:      p.Provider,
+		Model:         p.Model,
+		PromptVersion: p.PromptVersion,
+	}
+	return st.CreateWorkout(ctx, w, func(w *store.Workout) error {
+		stamped, err := SetWorkoutID(doc, w.ID)
+		w.YAML = stamped
+		return err
+	})
+}
+
+func hashJSON(v any) (string, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:]), nil
+}
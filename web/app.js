@@ -1,8 +1,12 @@
 (function(){
+  const apiKeyEl = document.getElementById('apiKey');
   const btnOAuth = document.getElementById('btn-oauth');
   const btnRecent = document.getElementById('btn-recent');
   const btnAnalyze = document.getElementById('btn-analyze');
   const btnGenerate = document.getElementById('btn-generate');
+  const btnPlanJob = document.getElementById('btn-plan-job');
+  const btnCancelJob = document.getElementById('btn-cancel-job');
+  const jobStatusEl = document.getElementById('jobStatus');
   const accessTokenEl = document.getElementById('accessToken');
   const daysEl = document.getElementById('days');
   const stravaRecentEl = document.getElementById('stravaRecent');
@@ -14,6 +18,7 @@
   const historyUrlEl = document.getElementById('historyUrl');
   const locationEl = document.getElementById('location');
   const equipContainer = document.getElementById('equipContainer');
+  const btnSaveLocation = document.getElementById('btn-save-location');
   const durationEl = document.getElementById('duration');
   const unitsEl = document.getElementById('units');
   const cardioEl = document.getElementById('cardio');
@@ -25,6 +30,51 @@
   // Cache latest Strava recent response for Analyzer
   let lastStravaRecent = null;
   let lastAnalyze = null; // cache the AnalyzerPlan for Generate
+  let lastWorkoutSeed = ''; // X-Workout-Seed from Analyze, replayed on Generate
+  let lastInputsHash = ''; // X-Inputs-Hash from Analyze, replayed on Generate
+  let currentJobId = ''; // background job being followed, if any
+
+  // The API key authenticates every call below; keep it in this browser only
+  apiKeyEl.value = localStorage.getItem('apiKey') || '';
+  apiKeyEl.addEventListener('input', () => {
+    localStorage.setItem('apiKey', apiKeyEl.value.trim());
+  });
+
+  // fetch with the caller's X-API-Key added
+  function api(path, opts = {}) {
+    const headers = Object.assign({}, opts.headers);
+    const key = apiKeyEl.value.trim();
+    if (key) headers['X-API-Key'] = key;
+    return fetch(path, Object.assign({}, opts, { headers }));
+  }
+
+  // Read server-sent events from a fetch response, calling onEvent for each
+  async function readEvents(resp, onEvent) {
+    const reader = resp.body.getReader();
+    const decoder = new TextDecoder();
+    let buf = '';
+    for (;;) {
+      const { value, done } = await reader.read();
+      if (done) break;
+      buf += decoder.decode(value, { stream: true });
+      let idx;
+      while ((idx = buf.indexOf('\n\n')) >= 0) {
+        const block = buf.slice(0, idx);
+        buf = buf.slice(idx + 2);
+        let event = 'message', data = '', id = '';
+        for (const line of block.split('\n')) {
+          if (line.startsWith('event: ')) event = line.slice(7);
+          else if (line.startsWith('data: ')) data += line.slice(6);
+          else if (line.startsWith('id: ')) id = line.slice(4);
+        }
+        onEvent(event, data ? JSON.parse(data) : {}, id);
+      }
+    }
+  }
+
+  if (new URLSearchParams(window.location.search).get('strava') === 'connected') {
+    setOutput({ status: 'Strava connected; your token is stored on the server' });
+  }
 
   // Load token from localStorage if present
   const straveToken = localStorage.getItem('strava_token');
@@ -85,11 +135,45 @@
         wrap.appendChild(lb);
         equipContainer.appendChild(wrap);
       });
+      loadLocation();
     } catch (e) {
       equipContainer.textContent = 'Failed to load equipment list';
     }
   }
 
+  // Check the equipment saved for the current location, if any
+  async function loadLocation() {
+    const name = locationEl.value.trim();
+    if (!name) return;
+    try {
+      const resp = await api(`/v1/locations/${encodeURIComponent(name)}`);
+      if (resp.status !== 200) return;
+      const profile = await resp.json();
+      const saved = new Set(profile.equipment || []);
+      equipContainer.querySelectorAll('input[type="checkbox"]').forEach(cb => {
+        cb.checked = saved.has(cb.value);
+      });
+    } catch (e) {}
+  }
+
+  locationEl.addEventListener('change', loadLocation);
+
+  btnSaveLocation.addEventListener('click', async () => {
+    const name = locationEl.value.trim();
+    if (!name) return;
+    const checked = Array.from(equipContainer.querySelectorAll('input[type="checkbox"]:checked')).map(cb => cb.value);
+    try {
+      const resp = await api(`/v1/locations/${encodeURIComponent(name)}`, {
+        method: 'PUT',
+        headers: { 'Content-Type': 'application/json' },
+        body: JSON.stringify({ equipment: checked })
+      });
+      setOutput({ status: resp.status, data: await resp.json() });
+    } catch (err) {
+      setOutput({ error: String(err) });
+    }
+  });
+
   function parseEquipmentYAML(yamlText) {
     const lines = yamlText.split(/\r?\n/);
     const result = [];
@@ -134,8 +218,19 @@
     return result;
   }
 
-  btnOAuth.addEventListener('click', () => {
-    window.location.href = '/oauth/strava/start';
+  // Navigations cannot carry X-API-Key, so ask for the authorize URL first
+  btnOAuth.addEventListener('click', async () => {
+    try {
+      const resp = await api('/v1/strava/authorize');
+      const data = await resp.json();
+      if (resp.status !== 200) {
+        setOutput({ status: resp.status, data });
+        return;
+      }
+      window.location.href = data.authorize_url;
+    } catch (err) {
+      setOutput({ error: String(err) });
+    }
   });
 
   btnRecent.addEventListener('click', async () => {
@@ -147,7 +242,9 @@
     if (token) headers['Authorization'] = `Bearer ${token}`;
 
     try {
-      const resp = await fetch(`/strava/recent?days=${encodeURIComponent(days)}`, { headers });
+      // The window ends on today in the browser's zone, not the server's.
+      const tz = Intl.DateTimeFormat().resolvedOptions().timeZone || '';
+      const resp = await api(`/strava/recent?days=${encodeURIComponent(days)}&timezone=${encodeURIComponent(tz)}`, { headers });
       const data = await resp.json();
       setOutput({ status: resp.status, data });
 
@@ -171,11 +268,8 @@
     }
   });
 
-  btnAnalyze.addEventListener('click', async () => {
-    console.log('btnAnalyze clicked');
-
-    setOutput({status: 'loading /llm/analyze...'});
-
+  // Build the AnalyzerInputs body from the form
+  function analyzerInputs() {
     // collect checked equipment keys
     const checked = Array.from(document.querySelectorAll('#equipContainer input[type="checkbox"]:checked')).map(cb => cb.value);
 
@@ -193,22 +287,32 @@
     const sleepVal = garminSleepEl.value.trim();
     if (sleepVal !== '') {
       const n = Number(sleepVal);
-      if (!Number.isNaN(n)) body.garmin_sleep_score = n;
+      if (!Number.isNaN(n)) body.sleep_score = n;
     }
     const batteryVal = garminBatteryEl.value.trim();
     if (batteryVal !== '') {
       const n = Number(batteryVal);
-      if (!Number.isNaN(n)) body.garmin_body_battery = n;
+      if (!Number.isNaN(n)) body.body_battery = n;
     }
+    return body;
+  }
+
+  btnAnalyze.addEventListener('click', async () => {
+    console.log('btnAnalyze clicked');
+
+    setOutput({status: 'loading /llm/analyze...'});
+    const body = analyzerInputs();
 
     try {
-      const resp = await fetch('/llm/analyze', {
+      const resp = await api('/llm/analyze', {
         method: 'POST',
         headers: { 'Content-Type': 'application/json' },
         body: JSON.stringify(body)
       });
       const data = await resp.json();
       lastAnalyze = (resp.status === 200) ? data : null;
+      lastWorkoutSeed = (resp.status === 200) ? (resp.headers.get('X-Workout-Seed') || '') : '';
+      lastInputsHash = (resp.status === 200) ? (resp.headers.get('X-Inputs-Hash') || '') : '';
       setOutput({ status: resp.status, data });
     } catch (err) {
       setOutput({ error: String(err) });
@@ -220,24 +324,115 @@
       setOutput({ error: 'Run Analyze first; no plan cached.' });
       return;
     }
-    setOutput({status: 'loading /llm/generate...'});
+    setOutput({status: 'streaming /llm/generate/stream...'});
     yamlOutEl.value = '';
     try {
-      const resp = await fetch('/llm/generate', {
+      const resp = await api('/llm/generate/stream', {
         method: 'POST',
-        headers: { 'Content-Type': 'application/json' },
+        headers: { 'Content-Type': 'application/json', 'X-Workout-Seed': lastWorkoutSeed, 'X-Inputs-Hash': lastInputsHash },
         body: JSON.stringify(lastAnalyze)
       });
-      const data = await resp.json();
-      setOutput({ status: resp.status, data });
-      if (resp.status === 200 && typeof data === 'string') {
-        yamlOutEl.value = atob(data);
+      if (!resp.ok || !resp.body) {
+        setOutput({ status: resp.status, data: await resp.text() });
+        return;
+      }
+      await readEvents(resp, handleGenerateEvent);
+    } catch (err) {
+      setOutput({ error: String(err) });
+    }
+  });
+
+  function handleGenerateEvent(event, data) {
+    switch (event) {
+      case 'stage':
+        setOutput({ stage: data.stage, attempt: data.attempt || undefined });
+        // a repair attempt restarts the output
+        if (data.stage === 'repairing') yamlOutEl.value = '';
+        break;
+      case 'delta':
+        yamlOutEl.value += data.text;
+        yamlOutEl.scrollTop = yamlOutEl.scrollHeight;
+        break;
+      case 'done':
+        yamlOutEl.value = data.workout_yaml || '';
+        setOutput({ status: 'done', workout_id: data.workout_id });
+        break;
+      case 'error':
+        setOutput({ error: data.error, findings: data.findings });
+        break;
+    }
+  }
+
+  // Analyze + Generate as a background job, following progress over SSE
+  btnPlanJob.addEventListener('click', async () => {
+    setOutput({status: 'submitting /v1/jobs...'});
+    yamlOutEl.value = '';
+    try {
+      const resp = await api('/v1/jobs', {
+        method: 'POST',
+        headers: { 'Content-Type': 'application/json' },
+        body: JSON.stringify(analyzerInputs())
+      });
+      const job = await resp.json();
+      if (resp.status !== 202) {
+        setOutput({ status: resp.status, data: job });
+        return;
       }
+      followJob(job.id);
+    } catch (err) {
+      setOutput({ error: String(err) });
+    }
+  });
+
+  btnCancelJob.addEventListener('click', async () => {
+    if (!currentJobId) return;
+    try {
+      await api(`/v1/jobs/${encodeURIComponent(currentJobId)}`, { method: 'DELETE' });
     } catch (err) {
       setOutput({ error: String(err) });
     }
   });
 
+  // EventSource cannot send X-API-Key, so follow the job over fetch and
+  // resume with Last-Event-ID when the stream drops
+  async function followJob(id) {
+    currentJobId = id;
+    btnCancelJob.disabled = false;
+    const terminal = ['done', 'failed', 'canceled'];
+    let lastEventId = '';
+    let state = '';
+    while (!terminal.includes(state)) {
+      try {
+        const headers = lastEventId ? { 'Last-Event-ID': lastEventId } : {};
+        const resp = await api(`/v1/jobs/${encodeURIComponent(id)}/events`, { headers });
+        if (!resp.ok || !resp.body) {
+          setOutput({ status: resp.status, data: await resp.text() });
+          break;
+        }
+        await readEvents(resp, (event, ev, eventId) => {
+          if (eventId) lastEventId = eventId;
+          state = ev.state;
+          const attempt = ev.attempt ? ` (attempt ${ev.attempt})` : '';
+          jobStatusEl.textContent = `job ${id}: ${ev.state}${attempt}`;
+        });
+      } catch (err) {
+        await new Promise(r => setTimeout(r, 1000));
+      }
+    }
+
+    currentJobId = '';
+    btnCancelJob.disabled = true;
+    const resp = await api(`/v1/jobs/${encodeURIComponent(id)}`);
+    const job = await resp.json();
+    setOutput({ status: resp.status, data: job });
+    if (job.state === 'done' && job.result) {
+      lastAnalyze = job.result.plan;
+      lastWorkoutSeed = job.result.seed || '';
+      lastInputsHash = job.result.inputs_hash || '';
+      yamlOutEl.value = job.result.workout_yaml || '';
+    }
+  }
+
   btnCopyYaml.addEventListener('click', async () => {
     if (!yamlOutEl.value) return;
     try {